@@ -11,15 +11,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	cfgpkg "llmspt/internal/config"
 	"llmspt/internal/diag"
-	"llmspt/internal/pipeline"
+	"llmspt/pkg/llmspt"
 )
 
-var pipelineRun = pipeline.Run
+// 运行入口（测试可替换）；CLI 仅负责配置合并与终端交互，装配/运行委托公共包 llmspt。
+var pipelineRun = llmspt.Run
 
 // 简化的 CLI：默认子命令 run。
 // 位置参数为 roots（文件/目录 或 "-" 表示 STDIN，不能与其他根混用）。
@@ -30,38 +33,73 @@ func main() {
 
 func run() int {
 	start := time.Now()
-	corrID := genCorrID()
 	// 在任何 ENV 读取前，尝试加载工作目录下的 .env（不覆盖已有 ENV）。
 	_ = loadDotEnv(".env")
-	// 从配置读取日志级别，仅保留 level 选项；默认 info
-	logLevel := "info"
-	// 先占位默认，稍后在解析/合并配置后重建 logger 以使用最终 level
-	logger := diag.NewLogger(corrID, logLevel)
-	defer func() {
-		logger.Close() // 确保关闭 logger 以释放文件句柄
-		windowsFileCleanupDelay() // Windows 文件句柄释放延迟
-	}()
 	// flags
 	var (
 		flagConfig      string
 		flagLLM         string
+		flagModel       string
 		flagConcurrency int
 		flagMaxTokens   int
 		flagMaxRetries  int
+		flagInvokeRetry int
+		flagDecodeRetry int
 		flagInitDir     string
+		flagListComps   bool
 		flagStatus      bool
+		flagSkipUnch    bool
+		flagDumpBatches string
+		flagOnBlocked   string
+		flagProgress    string
+		flagMaxBatches  int
+		flagMaxRecords  int
+		flagRanges      string
+		flagNoGateCap   bool
+		flagCorrID      string
+		flagLenientCfg  bool
+		flagLogFields   = logFields{}
 	)
 	flag.StringVar(&flagConfig, "config", "", "配置文件路径（JSON）；缺省读取 ./config.json（若存在）")
 	flag.StringVar(&flagLLM, "llm", "", "provider 名称（覆盖配置）")
+	flag.StringVar(&flagModel, "model", "", "覆盖活动 provider 的 options.model（覆盖配置）")
 	flag.IntVar(&flagConcurrency, "concurrency", 0, "并发度（覆盖配置）")
 	flag.IntVar(&flagMaxTokens, "max-tokens", 0, "最大 token 预算（覆盖配置）")
 	// max-retries 允许显式设置为 0；默认 -1 表示“未覆盖”。
 	flag.IntVar(&flagMaxRetries, "max-retries", -1, "LLM 阶段最大重试次数（覆盖配置；0 表示不重试）")
+	flag.IntVar(&flagInvokeRetry, "max-invoke-retries", -1, "LLM 调用失败的最大重试次数（覆盖配置；缺省沿用 max-retries）")
+	flag.IntVar(&flagDecodeRetry, "max-decode-retries", -1, "解码失败的最大重试次数（覆盖配置；缺省沿用 max-retries）")
 	flag.StringVar(&flagInitDir, "init-config", "", "在指定目录生成默认配置 config.json 和 .env 模板（若已存在则跳过，不覆盖）；不带值时默认当前目录")
+	flag.BoolVar(&flagListComps, "list-components", false, "按类别列出已注册的组件实现名（reader/splitter/…/llm_client）后退出")
+	flag.BoolVar(&flagSkipUnch, "skip-unchanged", false, "源文件内容未变更（摘要一致）时跳过处理（覆盖配置）")
+	flag.StringVar(&flagOnBlocked, "on-blocked", "", "上游内容拦截的处理策略：passthrough（原文透传）|fail（失败且不重试）（覆盖配置）")
+	flag.StringVar(&flagDumpBatches, "dump-batches", "", "仅执行 Reader→Splitter→Batcher，将批边界报告（JSON）写入指定文件（- 为 STDOUT）后退出")
 	flag.BoolVar(&flagStatus, "status", true, "终端状态提示（stderr）。TTY 动态刷新；非 TTY 打点输出")
+	flag.StringVar(&flagProgress, "progress-json", "", "机器可读进度事件流（NDJSON）：文件描述符编号（如 3）或文件路径")
+	flag.IntVar(&flagMaxBatches, "max-batches", 0, "本次运行最多调度的批数，达到后停止并以退出码 4 结束（覆盖配置；0 不限制）")
+	flag.IntVar(&flagMaxRecords, "max-records", 0, "本次运行最多调度的目标记录数，达到后停止并以退出码 4 结束（覆盖配置；0 不限制）")
+	flag.StringVar(&flagRanges, "record-ranges", "", "仅翻译各文件中的指定记录（1 起的序号，如 100-150,200），其余原文透传（覆盖配置）")
+	flag.BoolVar(&flagNoGateCap, "no-gate-concurrency-cap", false, "不按 provider 的 limits.rpm 限定并发上限（覆盖配置 gate_concurrency_cap）")
+	flag.StringVar(&flagCorrID, "corr-id", "", "日志关联 ID（覆盖 ENV LLM_SPT_CORR_ID；缺省随机生成），便于与外部请求/追踪关联")
+	flag.BoolVar(&flagLenientCfg, "lenient-config", false, "解析配置时忽略未知字段（告警列出被忽略的键）而非报错，便于新旧版本共用配置（等价配置 allow_unknown）")
+	flag.Var(flagLogFields, "log-field", "附加到每条日志事件的静态字段 k=v（可重复）")
 	normalizeInitArg()
 	flag.Parse()
 
+	corrID, err := resolveCorrID(flagCorrID, os.Getenv("LLM_SPT_CORR_ID"))
+	if err != nil {
+		fprintf(os.Stderr, "参数错误: %v\n", err)
+		return 2
+	}
+	// 从配置读取日志级别，仅保留 level 选项；默认 info
+	logLevel := "info"
+	// 先占位默认，稍后在解析/合并配置后重建 logger 以使用最终 level
+	logger := newLogger(corrID, logLevel, flagLogFields)
+	defer func() {
+		logger.Close() // 确保关闭 logger 以释放文件句柄
+		windowsFileCleanupDelay() // Windows 文件句柄释放延迟
+	}()
+
 	// roots（位置参数）
 	roots := flag.Args()
 
@@ -92,6 +130,12 @@ func run() int {
 		return 0
 	}
 
+	// --list-components: 列出注册表后退出（不读取配置）
+	if flagListComps {
+		listComponents(os.Stdout)
+		return 0
+	}
+
 	// JSON 配置（文件或 ENV: LLM_SPT_CONFIG_JSON）
 	var cfgJSON []byte
 	if s := os.Getenv("LLM_SPT_CONFIG_JSON"); s != "" {
@@ -112,12 +156,17 @@ func run() int {
 
 	cfg := cfgpkg.Defaults()
 	if flagConfig != "" || len(cfgJSON) > 0 {
-		base, err := cfgpkg.LoadJSON(flagConfig, cfgJSON)
+		base, ignored, err := cfgpkg.LoadJSONAllowUnknown(flagConfig, cfgJSON, flagLenientCfg)
 		if err != nil {
 			fprintf(os.Stderr, "配置解析失败: %v\n", err)
 			logger.Error("pipeline", string(diag.Classify(err)), "first error", &start)
 			return 3
 		}
+		if len(ignored) > 0 {
+			keys := strings.Join(ignored, ", ")
+			fprintf(os.Stderr, "提示：配置中的未知字段已忽略：%s\n", keys)
+			logger.WarnWithKV("config", "unknown config fields ignored", "", "", map[string]string{"keys": keys})
+		}
 		cfg = cfgpkg.Merge(cfg, base)
 	}
 
@@ -137,6 +186,9 @@ func run() int {
 	if flagLLM != "" {
 		overCLI.LLM = flagLLM
 	}
+	if flagModel != "" {
+		overCLI.Model = flagModel
+	}
 	if flagConcurrency > 0 {
 		overCLI.Concurrency = flagConcurrency
 	}
@@ -146,13 +198,38 @@ func run() int {
 	if flagMaxRetries >= 0 {
 		overCLI.MaxRetries = flagMaxRetries
 	}
+	if flagInvokeRetry >= 0 {
+		overCLI.MaxInvokeRetries = &flagInvokeRetry
+	}
+	if flagDecodeRetry >= 0 {
+		overCLI.MaxDecodeRetries = &flagDecodeRetry
+	}
+	if flagSkipUnch {
+		overCLI.SkipUnchanged = true
+	}
+	if flagNoGateCap {
+		off := false
+		overCLI.GateConcurrencyCap = &off
+	}
+	if flagOnBlocked != "" {
+		overCLI.OnBlocked = flagOnBlocked
+	}
+	if flagMaxBatches > 0 {
+		overCLI.MaxBatches = flagMaxBatches
+	}
+	if flagMaxRecords > 0 {
+		overCLI.MaxRecords = flagMaxRecords
+	}
+	if flagRanges != "" {
+		overCLI.RecordRanges = flagRanges
+	}
 	if len(roots) > 0 {
 		overCLI.Inputs = roots
 	}
 	cfg = cfgpkg.Merge(cfg, overCLI)
 
 	// 基本校验 & 装配
-	if err := cfgpkg.Validate(cfg); err != nil {
+	if err := llmspt.Validate(cfg); err != nil {
 		fprintf(os.Stderr, "配置校验失败: %v\n", err)
 		// 提示打印有效配置，便于诊断
 		_ = dumpConfig(cfg)
@@ -166,37 +243,61 @@ func run() int {
 	}
 	logger.Close() // 关闭旧 logger
 	windowsFileCleanupDelay() // Windows 文件句柄释放延迟
-	logger = diag.NewLogger(corrID, logLevel)
+	logger = newLogger(corrID, logLevel, flagLogFields)
 
-	// 预检：若使用文件系统 Writer，检查输出目录的可写性
-	if err := preflightCheckOutputDir(cfg); err != nil {
-		fprintf(os.Stderr, "输出目录不可写或无法创建: %v\n", err)
-		logger.Error("pipeline", string(diag.Classify(err)), "first error", &start)
-		return 3
-	}
-
-	comp, set, _, _, err := cfgpkg.Assemble(cfg)
+	comp, set, err := llmspt.Assemble(cfg)
 	if err != nil {
 		fprintf(os.Stderr, "装配失败: %v\n", err)
 		logger.Error("pipeline", string(diag.Classify(err)), "first error", &start)
 		return 3
 	}
 
+	// 预检：由 Writer 检查自身输出目标的可写性（--dump-batches 不写出工件，跳过）
+	if flagDumpBatches == "" {
+		if err := llmspt.Preflight(context.Background(), comp); err != nil {
+			fprintf(os.Stderr, "输出目标不可写: %v\n", err)
+			logger.Error("pipeline", string(diag.Classify(err)), "first error", &start)
+			return 3
+		}
+	}
+
+	// --dump-batches: 输出批边界报告并退出（不调用 LLM）
+	if flagDumpBatches != "" {
+		if err := writeBatchDump(flagDumpBatches, comp, set); err != nil {
+			fprintf(os.Stderr, "批次导出失败: %v\n", err)
+			logger.Error("pipeline", string(diag.Classify(err)), "first error", &start)
+			return 1
+		}
+		return 0
+	}
+
 	// 终端信息提示（非日志）：按 CLI 启用，默认开启
 	term := diag.NewTerminal(os.Stderr, flagStatus)
 	diag.SetTerminal(term)
 	defer diag.SetTerminal(nil)
+	// 机器可读进度事件（与终端提示并行，--status=false 时照常写出）
+	if flagProgress != "" {
+		ps, err := diag.OpenProgressStream(flagProgress)
+		if err != nil {
+			fprintf(os.Stderr, "进度事件流打开失败: %v\n", err)
+			logger.Error("pipeline", string(diag.Classify(err)), "first error", &start)
+			return 3
+		}
+		defer ps.Close()
+		term.SetProgress(ps)
+	}
 	if term != nil {
-		term.RunStart(cfg.Concurrency, cfg.LLM)
+		term.RunStart(set.EffectiveConcurrency(), cfg.LLM)
 	}
 
 	// debug: 输出运行时配置信息（已脱敏）
 	if logger != nil {
 		kv := map[string]string{
 			"inputs_count":   fmt.Sprintf("%d", len(cfg.Inputs)),
-			"concurrency":    fmt.Sprintf("%d", cfg.Concurrency),
+			"concurrency":    fmt.Sprintf("%d", set.EffectiveConcurrency()),
 			"max_tokens":     fmt.Sprintf("%d", cfg.MaxTokens),
 			"llm":            cfg.LLM,
+			"model":          cfg.Model,
 			"reader":         cfg.Components.Reader,
 			"splitter":       cfg.Components.Splitter,
 			"batcher":        cfg.Components.Batcher,
@@ -232,8 +333,18 @@ func run() int {
 	// STDIN 混用规则已在 Validate 中统一校验，此处不再重复。
 
 	// 运行流水线
+	diag.ResetMetrics()
 	t := logger.Start("pipeline", "run")
+	defer logErrorSummary(logger)
 	if err := pipelineRun(context.Background(), comp, set, logger); err != nil {
+		// 成本护栏触发：已完成的工件有效，以独立退出码区分于运行失败
+		if errors.Is(err, llmspt.ErrCapReached) {
+			fprintf(os.Stderr, "已达到运行上限，停止调度剩余工作: %v\n", err)
+			if term != nil {
+				term.RunFinish(false, time.Since(start))
+			}
+			return 4
+		}
 		// 分类到最接近的退出码（运行期错误）
 		code := string(diag.Classify(err))
 		logger.Error("pipeline", code, "first error", &start)
@@ -260,6 +371,33 @@ func run() int {
 	return 0
 }
 
+// logErrorSummary 在运行结束时记录按组件/错误码汇总的错误计数（无错误时不记录），
+// 以及批规模（记录数/估算 token 数）的分位数（无批时不记录），供调整 max_tokens 与上下文半径。
+func logErrorSummary(logger *diag.Logger) {
+	if s := diag.ErrorSummary(); s != "" {
+		logger.InfoWithKV("pipeline", "error summary", "", "", map[string]string{"errors": s})
+	}
+	if s := diag.HistogramSummary(); s != "" {
+		logger.InfoWithKV("pipeline", "batch summary", "", "", map[string]string{"batches": s})
+	}
+}
+
+// writeBatchDump 将批边界报告写入 path（"-" 为 STDOUT）。
+func writeBatchDump(path string, comp llmspt.Pipeline, set llmspt.Settings) error {
+	if path == "-" {
+		return llmspt.DumpBatches(context.Background(), comp, set, os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := llmspt.DumpBatches(context.Background(), comp, set, f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func fprintf(w *os.File, format string, a ...any) { _, _ = fmt.Fprintf(w, format, a...) }
 
 func dumpConfig(c cfgpkg.Config) error {
@@ -311,6 +449,59 @@ func genCorrID() string {
 	return hex.EncodeToString(b[:])
 }
 
+// corrIDRe: 外部关联 ID 的允许格式（1-128 位字母数字与 . _ : -），覆盖常见的请求 ID / trace ID 形态。
+var corrIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// resolveCorrID 选择关联 ID：旗标优先于 ENV；两者均为空（去空白后）时随机生成；格式非法时报错。
+func resolveCorrID(flagVal, envVal string) (string, error) {
+	id := strings.TrimSpace(flagVal)
+	if id == "" {
+		id = strings.TrimSpace(envVal)
+	}
+	if id == "" {
+		return genCorrID(), nil
+	}
+	if !corrIDRe.MatchString(id) {
+		return "", fmt.Errorf("corr-id %q: want 1-128 chars of [A-Za-z0-9._:-]", id)
+	}
+	return id, nil
+}
+
+// logFields: --log-field 的可重复 k=v 旗标值。
+type logFields map[string]string
+
+func (f logFields) String() string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + f[k]
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f logFields) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	k = strings.TrimSpace(k)
+	if !ok || k == "" {
+		return fmt.Errorf("want k=v, got %q", s)
+	}
+	f[k] = strings.TrimSpace(v)
+	return nil
+}
+
+// newLogger 创建 Logger 并附加静态字段。
+func newLogger(corrID, level string, fields logFields) *diag.Logger {
+	l := diag.NewLogger(corrID, level)
+	if len(fields) > 0 {
+		l.SetFields(fields)
+	}
+	return l
+}
+
 // loadDotEnv 读取简单的 .env 文件格式并注入进程环境。
 // 规则：
 // - 忽略不存在的文件；无法读取时返回错误（但调用处可忽略）。
@@ -368,6 +559,13 @@ func loadDotEnv(path string) error {
 	return s.Err()
 }
 
+// listComponents: 每类一行输出已注册实现名，如 "writer: fs, multi, s3"（类别顺序固定，名称升序）。
+func listComponents(w *os.File) {
+	for _, k := range llmspt.ListComponents() {
+		fprintf(w, "%s: %s\n", k.Kind, strings.Join(k.Names, ", "))
+	}
+}
+
 // normalizeInitArg: 允许 --init-config 在未提供路径值时采用默认值当前目录 "."。
 // 兼容以下形式：
 //
@@ -432,9 +630,33 @@ func writeDotEnv(path string) error {
 	b.WriteString("# 运行参数覆盖\n")
 	b.WriteString("LLM_SPT_INPUTS=\n")
 	b.WriteString("LLM_SPT_CONCURRENCY=\n")
+	b.WriteString("LLM_SPT_AUTO_CONCURRENCY=\n")
+	b.WriteString("LLM_SPT_MAX_CONCURRENCY=\n")
 	b.WriteString("LLM_SPT_MAX_TOKENS=\n")
+	b.WriteString("LLM_SPT_BYTES_PER_TOKEN=\n")
+	b.WriteString("LLM_SPT_OVERHEAD_TOKENS=\n")
+	b.WriteString("LLM_SPT_BUDGET_HEADROOM_PCT=\n")
 	b.WriteString("LLM_SPT_MAX_RETRIES=\n")
-	b.WriteString("LLM_SPT_LLM=\n\n")
+	b.WriteString("LLM_SPT_MAX_INVOKE_RETRIES=\n")
+	b.WriteString("LLM_SPT_MAX_DECODE_RETRIES=\n")
+	b.WriteString("LLM_SPT_RETRY_ON=\n")
+	b.WriteString("LLM_SPT_SKIP_UNCHANGED=\n")
+	b.WriteString("LLM_SPT_FAIL_ON_EMPTY=\n")
+	b.WriteString("LLM_SPT_CONTINUE_ON_ERROR=\n")
+	b.WriteString("LLM_SPT_MAX_CONSECUTIVE_FAILURES=\n")
+	b.WriteString("LLM_SPT_ON_BLOCKED=\n")
+	b.WriteString("LLM_SPT_STREAM_SEGMENT_RECORDS=\n")
+	b.WriteString("LLM_SPT_MAX_BATCHES=\n")
+	b.WriteString("LLM_SPT_MAX_RECORDS=\n")
+	b.WriteString("LLM_SPT_MANIFEST_PATH=\n")
+	b.WriteString("LLM_SPT_RECORD_RANGES=\n")
+	b.WriteString("LLM_SPT_ORDERED_OUTPUT=\n")
+	b.WriteString("LLM_SPT_TARGETS=\n")
+	b.WriteString("LLM_SPT_GATE_CONCURRENCY_CAP=\n")
+	b.WriteString("LLM_SPT_LLM=\n")
+	b.WriteString("LLM_SPT_MODEL=\n")
+	b.WriteString("# 日志关联 ID（空则每次运行随机生成）\n")
+	b.WriteString("LLM_SPT_CORR_ID=\n\n")
 
 	// 组件选择
 	b.WriteString("# 组件选择\n")
@@ -452,6 +674,7 @@ func writeDotEnv(path string) error {
 	b.WriteString("LLM_SPT_PROVIDER__openai__LIMITS_RPM=\n")
 	b.WriteString("LLM_SPT_PROVIDER__openai__LIMITS_TPM=\n")
 	b.WriteString("LLM_SPT_PROVIDER__openai__LIMITS_MAX_TOKENS_PER_REQ=\n")
+	b.WriteString("LLM_SPT_PROVIDER__openai__CONCURRENCY=\n")
 	b.WriteString("LLM_SPT_PROVIDER__openai__OPTIONS_JSON=\n\n")
 
 	// Provider: gemini
@@ -460,6 +683,7 @@ func writeDotEnv(path string) error {
 	b.WriteString("LLM_SPT_PROVIDER__gemini__LIMITS_RPM=\n")
 	b.WriteString("LLM_SPT_PROVIDER__gemini__LIMITS_TPM=\n")
 	b.WriteString("LLM_SPT_PROVIDER__gemini__LIMITS_MAX_TOKENS_PER_REQ=\n")
+	b.WriteString("LLM_SPT_PROVIDER__gemini__CONCURRENCY=\n")
 	b.WriteString("LLM_SPT_PROVIDER__gemini__OPTIONS_JSON=\n\n")
 
 	// 常见供应商 API Key（由 Provider 客户端读取，不经 LLM_SPT_ 前缀）
@@ -482,65 +706,3 @@ func writeDotEnv(path string) error {
 	}
 	return nil
 }
-
-// preflightCheckOutputDir: 当 Writer 使用文件系统实现(fs)时，启动前检查输出目录可写性。
-// 规则：
-// - 若目录已存在：尝试创建并删除临时文件；失败则判为不可写。
-// - 若目录不存在：检查父目录是否可写（尝试在父目录创建并删除临时目录）。
-// 仅针对 fs writer 生效；其他 writer 跳过。
-func preflightCheckOutputDir(cfg cfgpkg.Config) error {
-	// 计算生效的 writer 名称
-	def := cfgpkg.Defaults()
-	writerName := cfg.Components.Writer
-	if strings.TrimSpace(writerName) == "" {
-		writerName = def.Components.Writer
-	}
-	if strings.TrimSpace(writerName) != "fs" {
-		return nil
-	}
-	// 解析 fs writer 的 output_dir
-	var wopts struct {
-		OutputDir string `json:"output_dir"`
-	}
-	if len(cfg.Options.Writer) > 0 {
-		_ = json.Unmarshal(cfg.Options.Writer, &wopts)
-	}
-	dir := strings.TrimSpace(wopts.OutputDir)
-	if dir == "" {
-		// 未指定时无法可靠检查，让装配阶段按实现自行报错
-		return nil
-	}
-	if st, err := os.Stat(dir); err == nil && st.IsDir() {
-		// 目录存在：尝试写入临时文件
-		f, err := os.CreateTemp(dir, ".wcheck-*")
-		if err != nil {
-			return err
-		}
-		name := f.Name()
-		_ = f.Close()
-		_ = os.Remove(name)
-		return nil
-	} else if err == nil && !st.IsDir() {
-		return fmt.Errorf("路径存在但不是目录: %s", dir)
-	} else if err != nil && !os.IsNotExist(err) {
-		return err
-	}
-	// 目录不存在：检查父目录可写性
-	parent := filepath.Dir(dir)
-	if parent == "" || parent == dir {
-		return fmt.Errorf("无法确定父目录: %s", dir)
-	}
-	pst, err := os.Stat(parent)
-	if err != nil {
-		return err
-	}
-	if !pst.IsDir() {
-		return fmt.Errorf("父路径不是目录: %s", parent)
-	}
-	tmpd, err := os.MkdirTemp(parent, ".wcheck-*")
-	if err != nil {
-		return err
-	}
-	_ = os.RemoveAll(tmpd)
-	return nil
-}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	cfgpkg "llmspt/internal/config"
@@ -136,6 +138,37 @@ func TestRunWithConfigFile(t *testing.T) {
 	}
 }
 
+// --lenient-config：未知字段不再导致配置解析失败（默认仍为严格）
+func TestRunLenientConfig(t *testing.T) {
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(cwd)
+
+	cfg := cfgpkg.DefaultTemplateConfig()
+	cfg.Inputs = []string{"-"}
+	b, _ := json.Marshal(cfg)
+	b = append(b[:len(b)-1], `,"from_newer_version":true}`...)
+	path := filepath.Join(dir, "cfg.json")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	orig := pipelineRun
+	pipelineRun = func(ctx context.Context, comp pipeline.Components, set pipeline.Settings, logger *diag.Logger) error {
+		return nil
+	}
+	defer func() { pipelineRun = orig }()
+
+	resetFlag([]string{"llmspt", "--config", path})
+	if code := run(); code != 3 {
+		t.Fatalf("strict: expect 3, got %d", code)
+	}
+	resetFlag([]string{"llmspt", "--config", path, "--lenient-config"})
+	if code := run(); code != 0 {
+		t.Fatalf("lenient: run return %d", code)
+	}
+}
+
 func TestRunConfigFileNotFound(t *testing.T) {
 	dir := t.TempDir()
 	cwd, _ := os.Getwd()
@@ -208,6 +241,33 @@ func TestRunPipelineError(t *testing.T) {
 	}
 }
 
+// 成本护栏触发：以退出码 4 区分于运行失败；--max-batches/--max-records 覆盖配置
+func TestRunCapReached(t *testing.T) {
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(cwd)
+
+	cfg := cfgpkg.DefaultTemplateConfig()
+	cfg.Inputs = []string{"-"}
+	b, _ := json.Marshal(cfg)
+	t.Setenv("LLM_SPT_CONFIG_JSON", string(b))
+
+	resetFlag([]string{"llmspt", "--max-batches", "7", "--max-records", "90"})
+	orig := pipelineRun
+	pipelineRun = func(ctx context.Context, comp pipeline.Components, set pipeline.Settings, logger *diag.Logger) error {
+		if set.MaxBatches != 7 || set.MaxRecords != 90 {
+			t.Fatalf("caps not applied: %d %d", set.MaxBatches, set.MaxRecords)
+		}
+		return fmt.Errorf("reader iterate: %w", pipeline.ErrCapReached)
+	}
+	defer func() { pipelineRun = orig }()
+
+	if code := run(); code != 4 {
+		t.Fatalf("expect 4, got %d", code)
+	}
+}
+
 func TestRunInitConfigFileExists(t *testing.T) {
     dir := t.TempDir()
     cwd, _ := os.Getwd()
@@ -443,3 +503,101 @@ func TestRunDebugProviderInfo(t *testing.T) {
 		t.Fatalf("pipelineRun not called")
 	}
 }
+
+func TestRunDumpBatches(t *testing.T) {
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(cwd)
+
+	src := filepath.Join(dir, "a.srt")
+	if err := os.WriteFile(src, []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nWorld\n"), 0o644); err != nil {
+		t.Fatalf("write srt: %v", err)
+	}
+	cfg := cfgpkg.DefaultTemplateConfig()
+	cfg.Inputs = []string{src}
+	b, _ := json.Marshal(cfg)
+	t.Setenv("LLM_SPT_CONFIG_JSON", string(b))
+
+	out := filepath.Join(dir, "batches.json")
+	resetFlag([]string{"llmspt", "--dump-batches", out})
+	orig := pipelineRun
+	pipelineRun = func(ctx context.Context, comp pipeline.Components, set pipeline.Settings, logger *diag.Logger) error {
+		t.Fatalf("pipelineRun should not be called")
+		return nil
+	}
+	defer func() { pipelineRun = orig }()
+
+	if code := run(); code != 0 {
+		t.Fatalf("run return %d", code)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read dump: %v", err)
+	}
+	var rep pipeline.BatchReport
+	if err := json.Unmarshal(data, &rep); err != nil || len(rep.Batches) == 0 {
+		t.Fatalf("unexpected dump: %v\n%s", err, data)
+	}
+	if first := rep.Batches[0]; first.TargetFrom != 0 || len(first.Records) != 2 {
+		t.Fatalf("unexpected batch: %+v", first)
+	}
+}
+
+// --list-components: 不读取配置，按类别输出注册表后以 0 退出
+func TestRunListComponents(t *testing.T) {
+	t.Setenv("LLM_SPT_CONFIG_JSON", "{invalid")
+	out := filepath.Join(t.TempDir(), "list.txt")
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	old := os.Stdout
+	os.Stdout = f
+	resetFlag([]string{"llmspt", "--list-components"})
+	code := run()
+	os.Stdout = old
+	f.Close()
+	if code != 0 {
+		t.Fatalf("run return %d", code)
+	}
+	data, _ := os.ReadFile(out)
+	if !strings.Contains(string(data), "writer: fs, multi, s3\n") || !strings.HasPrefix(string(data), "reader: ") {
+		t.Fatalf("unexpected output:\n%s", data)
+	}
+}
+
+// 关联 ID：旗标优先于 ENV，均为空时随机生成，非法格式报错（run 以退出码 2 结束）
+func TestResolveCorrID(t *testing.T) {
+	if id, err := resolveCorrID(" req-1 ", "env-1"); err != nil || id != "req-1" {
+		t.Fatalf("flag: %q %v", id, err)
+	}
+	if id, err := resolveCorrID("", "trace:abc.def_1"); err != nil || id != "trace:abc.def_1" {
+		t.Fatalf("env: %q %v", id, err)
+	}
+	if id, err := resolveCorrID(" ", ""); err != nil || len(id) != 32 {
+		t.Fatalf("random: %q %v", id, err)
+	}
+	for _, bad := range []string{"has space", "a/b", strings.Repeat("x", 129)} {
+		if _, err := resolveCorrID(bad, ""); err == nil {
+			t.Fatalf("expect %q rejected", bad)
+		}
+	}
+	f := logFields{}
+	if err := f.Set("trace_id=abc"); err != nil || f["trace_id"] != "abc" {
+		t.Fatalf("set: %v %v", err, f)
+	}
+	if err := f.Set("svc = api=v2"); err != nil || f["svc"] != "api=v2" || f.String() != "svc=api=v2,trace_id=abc" {
+		t.Fatalf("set with '=' in value: %v %v", err, f)
+	}
+	for _, bad := range []string{"novalue", "=x"} {
+		if err := f.Set(bad); err == nil {
+			t.Fatalf("expect %q rejected", bad)
+		}
+	}
+
+	resetFlag([]string{"llmspt", "--corr-id", "bad id"})
+	if code := run(); code != 2 {
+		t.Fatalf("expect 2, got %d", code)
+	}
+}
@@ -1,12 +1,20 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"llmspt/internal/diag"
 	"llmspt/internal/pipeline"
 	"llmspt/internal/rate"
+	"llmspt/pkg/contract"
 	"llmspt/pkg/registry"
 )
 
@@ -31,15 +39,109 @@ func Validate(cfg Config) error {
 	if cfg.Concurrency < 1 {
 		return errors.New("config: concurrency must be >= 1")
 	}
+	if cfg.MaxConcurrency < 0 {
+		return errors.New("config: max_concurrency must be >= 0")
+	}
+	if cfg.AutoConcurrency && cfg.MaxConcurrency > 0 && cfg.MaxConcurrency < cfg.Concurrency {
+		return errors.New("config: max_concurrency must be >= concurrency")
+	}
 	if cfg.MaxTokens <= 0 {
 		return errors.New("config: max_tokens must be > 0")
 	}
+	if cfg.BudgetHeadroomPct < 0 || cfg.BudgetHeadroomPct > 99 {
+		return errors.New("config: budget_headroom_pct must be within [0,99]")
+	}
+	if cfg.BytesPerToken < 0 {
+		return errors.New("config: bytes_per_token must be >= 0")
+	}
+	if cfg.OverheadTokens < 0 {
+		return errors.New("config: overhead_tokens must be >= 0")
+	}
 	if cfg.MaxRetries < 0 {
 		return errors.New("config: max_retries must be >= 0")
 	}
+	if cfg.MaxInvokeRetries != nil && *cfg.MaxInvokeRetries < 0 {
+		return errors.New("config: max_invoke_retries must be >= 0")
+	}
+	if cfg.MaxDecodeRetries != nil && *cfg.MaxDecodeRetries < 0 {
+		return errors.New("config: max_decode_retries must be >= 0")
+	}
+	switch cfg.OnBlocked {
+	case "", pipeline.OnBlockedPassthrough, pipeline.OnBlockedFail:
+	default:
+		return fmt.Errorf("config: on_blocked: unknown policy %q (want passthrough|fail)", cfg.OnBlocked)
+	}
+	if cfg.MaxConsecutiveFailures < 0 {
+		return errors.New("config: max_consecutive_failures must be >= 0")
+	}
+	if cfg.StreamSegmentRecords < 0 {
+		return errors.New("config: stream_segment_records must be >= 0")
+	}
+	if cfg.StreamSegmentRecords > 0 && cfg.SkipUnchanged {
+		return errors.New("config: stream_segment_records cannot be combined with skip_unchanged")
+	}
+	if cfg.OrderedOutput != nil && !*cfg.OrderedOutput && cfg.SkipUnchanged {
+		return errors.New("config: ordered_output=false cannot be combined with skip_unchanged")
+	}
+	if cfg.MaxBatches < 0 || cfg.MaxRecords < 0 {
+		return errors.New("config: max_batches/max_records must be >= 0")
+	}
+	if _, err := pipeline.ParseRecordRanges(cfg.RecordRanges); err != nil {
+		return fmt.Errorf("config: record_ranges: %w", err)
+	}
+	if cfg.RecordRanges != "" && cfg.StreamSegmentRecords > 0 {
+		return errors.New("config: record_ranges cannot be combined with stream_segment_records")
+	}
+	if len(cfg.Targets) > 0 {
+		fl := cfg.FileLang
+		switch {
+		case len(fl.Rules) > 0 || fl.CompanionExt != "":
+			return errors.New("config: targets cannot be combined with file_lang")
+		case cfg.StreamSegmentRecords > 0:
+			return errors.New("config: targets cannot be combined with stream_segment_records")
+		}
+		seen := map[string]bool{}
+		for _, l := range cfg.Targets {
+			if strings.TrimSpace(l) == "" || strings.ContainsAny(l, `/\`) || seen[l] {
+				return fmt.Errorf("config: targets: invalid or duplicate language %q", l)
+			}
+			seen[l] = true
+		}
+	}
+	for _, name := range cfg.RetryOn {
+		if _, ok := diag.ParseCode(name); !ok {
+			return fmt.Errorf("config: retry_on: unknown error code %q", name)
+		}
+	}
+	for _, f := range cfg.Sidecar.ExtraFields {
+		if !contains(pipeline.SidecarFields, f) {
+			return fmt.Errorf("config: sidecar.extra_fields: unknown field %q", f)
+		}
+	}
+	if err := pipeline.ValidateSidecarPath(cfg.Sidecar.Dir, cfg.Sidecar.Ext); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	for i, r := range cfg.FileLang.Rules {
+		if strings.TrimSpace(r.Lang) == "" {
+			return fmt.Errorf("config: file_lang.rules[%d]: lang empty", i)
+		}
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			return fmt.Errorf("config: file_lang.rules[%d]: pattern %q: %w", i, r.Pattern, err)
+		}
+	}
+	if err := validateHTTPDefaults(cfg.HTTPDefaults); err != nil {
+		return err
+	}
 	if cfg.LLM == "" {
 		return errors.New("config: llm not set")
 	}
+	cfg, err := applyModel(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg, err = applyHTTPDefaults(cfg); err != nil {
+		return err
+	}
 	prov, ok := cfg.Provider[cfg.LLM]
 	if !ok {
 		return fmt.Errorf("config: provider %q not found", cfg.LLM)
@@ -47,6 +149,12 @@ func Validate(cfg Config) error {
 	if prov.Client == "" {
 		return fmt.Errorf("config: provider %q missing client", cfg.LLM)
 	}
+	if prov.Limits.MinSleepMs < 0 || prov.Limits.PollStepMs < 0 {
+		return fmt.Errorf("config: provider %q: min_sleep_ms/poll_step_ms must be >= 0", cfg.LLM)
+	}
+	if prov.Concurrency < 0 {
+		return fmt.Errorf("config: provider %q: concurrency must be >= 0", cfg.LLM)
+	}
 	if prov.Limits.MaxTokensPerReq > 0 && cfg.MaxTokens > prov.Limits.MaxTokensPerReq {
 		return fmt.Errorf("config: max_tokens(%d) exceeds provider.max_tokens_per_req(%d)", cfg.MaxTokens, prov.Limits.MaxTokensPerReq)
 	}
@@ -75,6 +183,21 @@ func Validate(cfg Config) error {
 	if registry.LLMClient[prov.Client] == nil {
 		return fmt.Errorf("config: llm client %q not registered", prov.Client)
 	}
+	// 预检所有 Provider 的选项（不仅是当前激活者），按名称排序以保证报错稳定；
+	// 未注册校验器的 client 跳过（非激活 Provider 的 client 名不在此处强制）。
+	names := make([]string, 0, len(cfg.Provider))
+	for name := range cfg.Provider {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := cfg.Provider[name]
+		if check := registry.LLMClientOptions[p.Client]; check != nil {
+			if err := check(p.Options); err != nil {
+				return fmt.Errorf("config: provider %q (client %q): %w", name, p.Client, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -84,6 +207,13 @@ func Assemble(cfg Config) (pipeline.Components, pipeline.Settings, rate.Gate, ra
 	if err := Validate(cfg); err != nil {
 		return pipeline.Components{}, pipeline.Settings{}, nil, "", err
 	}
+	cfg, err := applyModel(cfg)
+	if err != nil {
+		return pipeline.Components{}, pipeline.Settings{}, nil, "", err
+	}
+	if cfg, err = applyHTTPDefaults(cfg); err != nil {
+		return pipeline.Components{}, pipeline.Settings{}, nil, "", err
+	}
 
 	// 有效名称
 	d := Defaults()
@@ -104,7 +234,11 @@ func Assemble(cfg Config) (pipeline.Components, pipeline.Settings, rate.Gate, ra
 	if err != nil {
 		return pipeline.Components{}, pipeline.Settings{}, nil, "", err
 	}
-	b, err := registry.Batcher[bn](cfg.Options.Batcher)
+	bopts, err := applyBytesPerToken(cfg.Options.Batcher, cfg.BytesPerToken)
+	if err != nil {
+		return pipeline.Components{}, pipeline.Settings{}, nil, "", err
+	}
+	b, err := registry.Batcher[bn](bopts)
 	if err != nil {
 		return pipeline.Components{}, pipeline.Settings{}, nil, "", err
 	}
@@ -132,6 +266,15 @@ func Assemble(cfg Config) (pipeline.Components, pipeline.Settings, rate.Gate, ra
 	if err != nil {
 		return pipeline.Components{}, pipeline.Settings{}, nil, "", err
 	}
+	// 区域设置：在装饰器包装前读取客户端声明的 locale，交由 Pipeline 注入 Prompt 模板变量
+	var locale string
+	if lh, ok := llm.(contract.LocaleHinter); ok {
+		locale = lh.Locale()
+	}
+	// 调试捕获：以装饰器包装客户端，逐批落盘原始请求/响应（客户端实现无需感知；流式能力随之保留）
+	if dir := cfg.Logging.DebugCaptureDir; dir != "" {
+		llm = diag.NewCaptureClient(llm, dir, prov.Client, prov.Options)
+	}
 
 	comp := pipeline.Components{
 		Reader:        r,
@@ -145,32 +288,201 @@ func Assemble(cfg Config) (pipeline.Components, pipeline.Settings, rate.Gate, ra
 	}
 
 	// 限流 Gate（按 provider 限额构造；分组键从 options 中派生 API Key）
-	gmap := map[rate.LimitKey]rate.Limits{}
 	// 默认使用 API Key 派生分组键（更稳定）；若失败则退化为 provider 名称。
 	key, derr := rate.DeriveKeyFromProviderOptions(prov.Client, prov.Options)
 	if derr != nil {
 		key = rate.LimitKey(cfg.LLM)
 	}
-	gmap[key] = rate.Limits{RPM: prov.Limits.RPM, TPM: prov.Limits.TPM, MaxTokensPerReq: prov.Limits.MaxTokensPerReq}
-	gate := rate.NewGate(gmap, nil)
+	// 各维度均未启用时不构造 Gate（保持接口值为 nil），Pipeline 跳过闸门路径，免去每批的加锁开销。
+	var gate rate.Gate
+	if prov.Limits.RPM > 0 || prov.Limits.TPM > 0 || prov.Limits.MaxTokensPerReq > 0 {
+		gate = rate.NewGate(map[rate.LimitKey]rate.Limits{key: {
+			RPM:             prov.Limits.RPM,
+			TPM:             prov.Limits.TPM,
+			MaxTokensPerReq: prov.Limits.MaxTokensPerReq,
+			MinSleep:        time.Duration(prov.Limits.MinSleepMs) * time.Millisecond,
+			PollStep:        time.Duration(prov.Limits.PollStepMs) * time.Millisecond,
+		}}, nil)
+	}
 
+	ranges, err := pipeline.ParseRecordRanges(cfg.RecordRanges)
+	if err != nil {
+		return pipeline.Components{}, pipeline.Settings{}, nil, "", fmt.Errorf("config: record_ranges: %w", err)
+	}
 	set := pipeline.Settings{
-		Inputs:      cloneStrings(cfg.Inputs),
-		Concurrency: cfg.Concurrency,
-		MaxTokens:   cfg.MaxTokens,
-		// BytesPerToken: 由 Prompt 估算器默认 4；此处保持 0 使用默认。
-		BytesPerToken: 0,
-		MaxRetries:    cfg.MaxRetries,
-		Gate:          gate,
-		GateKey:       key,
+		Inputs:            cloneStrings(cfg.Inputs),
+		Concurrency:       cfg.Concurrency,
+		AutoConcurrency:   cfg.AutoConcurrency,
+		MaxConcurrency:    cfg.MaxConcurrency,
+		MaxTokens:         cfg.MaxTokens,
+		BudgetHeadroomPct: cfg.BudgetHeadroomPct,
+		// BytesPerToken: 0 时由 Prompt 估算器默认 4（与 sliding 的默认一致）
+		BytesPerToken:          cfg.BytesPerToken,
+		OverheadTokens:         cfg.OverheadTokens,
+		MaxRetries:             cfg.MaxRetries,
+		MaxInvokeRetries:       cloneIntPtr(cfg.MaxInvokeRetries),
+		MaxDecodeRetries:       cloneIntPtr(cfg.MaxDecodeRetries),
+		Gate:                   gate,
+		GateKey:                key,
+		SkipUnchanged:          cfg.SkipUnchanged,
+		FailOnEmpty:            cfg.FailOnEmpty,
+		ContinueOnError:        cfg.ContinueOnError,
+		MaxConsecutiveFailures: cfg.MaxConsecutiveFailures,
+		OnBlocked:              cfg.OnBlocked,
+		StreamSegmentRecords:   cfg.StreamSegmentRecords,
+		MaxBatches:             cfg.MaxBatches,
+		MaxRecords:             cfg.MaxRecords,
+		RecordRanges:           ranges,
+		OrderedOutput:          cloneBoolPtr(cfg.OrderedOutput),
+		Targets:                cloneStrings(cfg.Targets),
+		Locale:                 locale,
+		ProviderConcurrency:    prov.Concurrency,
+		ManifestPath:           cfg.ManifestPath,
+		// 仅记录：捕获装饰器已在上方包装 LLM
+		DebugCaptureDir: cfg.Logging.DebugCaptureDir,
+		SidecarDir:      cfg.Sidecar.Dir,
+		SidecarExt:      cfg.Sidecar.Ext,
+	}
+	// 边车行结构：任一项显式设置时覆盖默认
+	if sc := cfg.Sidecar; sc.IncludeSrc != nil || sc.IncludeMeta != nil || len(sc.ExtraFields) > 0 {
+		so := pipeline.DefaultSidecarOptions()
+		if sc.IncludeSrc != nil {
+			so.IncludeSrc = *sc.IncludeSrc
+		}
+		if sc.IncludeMeta != nil {
+			so.IncludeMeta = *sc.IncludeMeta
+		}
+		so.ExtraFields = cloneStrings(sc.ExtraFields)
+		set.Sidecar = &so
+	}
+	if fl := cfg.FileLang; len(fl.Rules) > 0 || fl.CompanionExt != "" {
+		fo := pipeline.FileLangOptions{Var: fl.Var, CompanionExt: fl.CompanionExt}
+		for _, r := range fl.Rules {
+			fo.Rules = append(fo.Rules, pipeline.FileLangRule{Pattern: r.Pattern, Lang: r.Lang})
+		}
+		set.FileLang = &fo
+	}
+	for _, name := range cfg.RetryOn {
+		c, _ := diag.ParseCode(name)
+		set.RetryOn = append(set.RetryOn, c)
+	}
+	// 限流快照间隔：0 默认 5s，负值关闭（仅 debug 日志下生效）
+	switch ms := cfg.Logging.GateSnapshotMs; {
+	case ms == 0:
+		set.GateSnapshotEvery = 5 * time.Second
+	case ms > 0:
+		set.GateSnapshotEvery = time.Duration(ms) * time.Millisecond
+	}
+	// 限流并发上限：默认开启，显式 false 关闭
+	if gate != nil && (cfg.GateConcurrencyCap == nil || *cfg.GateConcurrencyCap) {
+		capConcurrencyByRPM(&set, prov.Limits.RPM)
 	}
 
 	return comp, set, gate, key, nil
 }
 
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func effName(got, def string) string {
 	if got == "" {
 		return def
 	}
 	return got
 }
+
+// gateCapLatency: 限流并发上限所假定的单次 LLM 调用时延（典型的整批翻译请求耗时）。
+const gateCapLatency = 10 * time.Second
+
+// rpmWorkerCap 返回 rpm 额度下能保持忙碌的 worker 数：ceil(rpm*gateCapLatency/60s)，至少为 1。
+// 每个 worker 每 gateCapLatency 发出一次请求；更多的 worker 只会阻塞在闸门上。
+func rpmWorkerCap(rpm int) int {
+	n := (int64(rpm)*int64(gateCapLatency) + int64(time.Minute) - 1) / int64(time.Minute)
+	if n < 1 {
+		return 1
+	}
+	return int(n)
+}
+
+// capConcurrencyByRPM 将同时处理中的批数上限（Settings.WorkerLimit）限定为 rpmWorkerCap(rpm)：
+// 超出额度的 worker 只会阻塞在闸门上，徒占 goroutine 与缓冲内存。
+// rpm<=0 或上限未超出时不变；下调时原上限记入 ConcurrencyCappedFrom。
+func capConcurrencyByRPM(set *pipeline.Settings, rpm int) {
+	from := set.WorkerLimit()
+	if rpm <= 0 {
+		return
+	}
+	limit := rpmWorkerCap(rpm)
+	if from <= limit {
+		return
+	}
+	if set.Concurrency > limit {
+		set.Concurrency = limit
+	}
+	if set.ProviderConcurrency > limit {
+		set.ProviderConcurrency = limit
+	}
+	if set.AutoConcurrency {
+		set.MaxConcurrency = limit
+	}
+	set.ConcurrencyCappedFrom = from
+}
+
+// applyBytesPerToken 将顶层 bytes_per_token 注入 Batcher 的 options：仅当 bpt > 0 且 options 未显式设置
+// bytes_per_token（缺失、null 或 <=0）时写入，Batcher 的显式取值优先。options 非 JSON 对象时返回配置错误。
+func applyBytesPerToken(raw json.RawMessage, bpt int) (json.RawMessage, error) {
+	if bpt <= 0 {
+		return raw, nil
+	}
+	obj := map[string]json.RawMessage{}
+	if t := bytes.TrimSpace(raw); len(t) > 0 && !bytes.Equal(t, []byte("null")) {
+		if err := json.Unmarshal(t, &obj); err != nil || obj == nil {
+			return raw, errors.New("config: bytes_per_token: options.batcher must be a JSON object")
+		}
+	}
+	var cur int
+	if v, ok := obj["bytes_per_token"]; ok && json.Unmarshal(v, &cur) == nil && cur > 0 {
+		return raw, nil
+	}
+	obj["bytes_per_token"] = json.RawMessage(strconv.Itoa(bpt))
+	return json.Marshal(obj)
+}
+
+// applyModel 将顶层 model 合并进活动 provider 的 options（{"model": ...}，其余键保留）；
+// 返回克隆了 Provider 映射的新配置，不修改入参。options 为空或 null 时视为空对象；
+// 非 JSON 对象时返回配置错误。model 为空或活动 provider 不存在时原样返回（后者由 Validate 报告）。
+func applyModel(cfg Config) (Config, error) {
+	if cfg.Model == "" {
+		return cfg, nil
+	}
+	prov, ok := cfg.Provider[cfg.LLM]
+	if !ok {
+		return cfg, nil
+	}
+	obj := map[string]json.RawMessage{}
+	if raw := bytes.TrimSpace(prov.Options); len(raw) > 0 && !bytes.Equal(raw, []byte("null")) {
+		if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+			return cfg, fmt.Errorf("config: model: provider %q options must be a JSON object to apply model override", cfg.LLM)
+		}
+	}
+	m, _ := json.Marshal(cfg.Model)
+	obj["model"] = m
+	merged, err := json.Marshal(obj)
+	if err != nil {
+		return cfg, fmt.Errorf("config: model: provider %q: %w", cfg.LLM, err)
+	}
+	prov.Options = merged
+	provs := make(map[string]Provider, len(cfg.Provider))
+	for k, v := range cfg.Provider {
+		provs[k] = v
+	}
+	provs[cfg.LLM] = prov
+	cfg.Provider = provs
+	return cfg, nil
+}
@@ -1,7 +1,17 @@
 package config
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"llmspt/pkg/contract"
 )
 
 // UT-CFG-01: 解析完整 config.json
@@ -29,14 +39,24 @@ func TestEnvOverlay(t *testing.T) {
 		"LLM_SPT_LLM=mock",
 		"LLM_SPT_COMPONENTS_READER=fs",
 		"LLM_SPT_PROVIDER__mock__CLIENT=mock",
+		"LLM_SPT_PROVIDER__mock__CONCURRENCY=16",
+		"LLM_SPT_SKIP_UNCHANGED=true",
+		"LLM_SPT_MAX_INVOKE_RETRIES=0",
+		"LLM_SPT_MAX_BATCHES=50",
+		"LLM_SPT_MAX_RECORDS=1000",
+		"LLM_SPT_MODEL=gpt-4o",
 	}
 	over, err := EnvOverlay(env)
 	if err != nil {
 		t.Fatalf("EnvOverlay 错误: %v", err)
 	}
-	if over.LLM != "mock" || over.Concurrency != 3 || len(over.Inputs) != 2 {
+	if over.LLM != "mock" || over.Concurrency != 3 || len(over.Inputs) != 2 || !over.SkipUnchanged || over.Provider["mock"].Concurrency != 16 || over.MaxBatches != 50 || over.MaxRecords != 1000 || over.Model != "gpt-4o" {
 		t.Fatalf("覆盖结果不正确: %+v", over)
 	}
+	// 显式 0 同样覆盖；未设置的分阶段重试保持 nil（沿用 max_retries）
+	if m := Merge(DefaultTemplateConfig(), over); m.MaxInvokeRetries == nil || *m.MaxInvokeRetries != 0 || m.MaxDecodeRetries != nil {
+		t.Fatalf("分阶段重试覆盖不正确: %v %v", m.MaxInvokeRetries, m.MaxDecodeRetries)
+	}
 }
 
 // UT-CFG-03: 含非法字段
@@ -47,6 +67,73 @@ func TestLoadJSONUnknown(t *testing.T) {
 	}
 }
 
+// 宽松解析：忽略未知字段（含嵌套结构体内的键），返回升序的点分键路径；已知字段照常解码（键名不区分大小写）；
+// 配置自身的 allow_unknown=true 等价于宽松模式；严格模式不返回忽略列表
+func TestLoadJSONAllowUnknown(t *testing.T) {
+	raw := []byte(`{"concurrency": 3, "future": {"x": 1}, "logging": {"Level": "debug", "colour": true}, "options": {"writer": {"new_key": 1}},
+		"provider": {"openai": {"client": "openai", "limtis": {"rpm": 1}, "limits": {"rpm": 5, "burst": 2}}}}`)
+	if _, _, err := LoadJSONAllowUnknown("", raw, false); err == nil {
+		t.Fatal("strict mode must reject unknown fields")
+	}
+	cfg, ignored, err := LoadJSONAllowUnknown("", raw, true)
+	if err != nil {
+		t.Fatalf("lenient: %v", err)
+	}
+	if strings.Join(ignored, ",") != "future,logging.colour,provider.openai.limits.burst,provider.openai.limtis" {
+		t.Fatalf("ignored = %v", ignored)
+	}
+	if cfg.Concurrency != 3 || cfg.Logging.Level != "debug" || !strings.Contains(string(cfg.Options.Writer), "new_key") || cfg.Provider["openai"].Limits.RPM != 5 {
+		t.Fatalf("known fields not decoded: %+v", cfg)
+	}
+	self := []byte(`{"allow_unknown": true, "future": 1}`)
+	cfg, err = LoadJSON("", self)
+	if err != nil || !cfg.AllowUnknown {
+		t.Fatalf("allow_unknown in config: %+v %v", cfg, err)
+	}
+	if _, ignored, _ := LoadJSONAllowUnknown("", self, false); len(ignored) != 1 || ignored[0] != "future" {
+		t.Fatalf("ignored = %v", ignored)
+	}
+	if _, ignored, err := LoadJSONAllowUnknown("", []byte(`{"concurrency": 2}`), false); err != nil || ignored != nil {
+		t.Fatalf("strict: %v %v", ignored, err)
+	}
+}
+
+// options.* 的 "@<path>" 引用以文件内容替换：相对配置文件目录解析；非引用取值原样保留；文件缺失或非 JSON 失败
+func TestLoadJSONOptionFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "opts"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "opts", "pb.json"), []byte("{\"inline_glossary\": \"a=b\"}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	write := func(body string) string {
+		p := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	cfg, err := LoadJSON(write(`{"options": {"prompt_builder": "@opts/pb.json", "batcher": {"max_tokens": 10}, "decoder": "@"}}`), nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if string(cfg.Options.PromptBuilder) != `{"inline_glossary": "a=b"}` {
+		t.Fatalf("prompt_builder = %s", cfg.Options.PromptBuilder)
+	}
+	if string(cfg.Options.Batcher) != `{"max_tokens": 10}` || string(cfg.Options.Decoder) != `"@"` {
+		t.Fatalf("non-reference options changed: %s %s", cfg.Options.Batcher, cfg.Options.Decoder)
+	}
+	for _, body := range []string{`{"options": {"writer": "@missing.json"}}`, `{"options": {"writer": "@bad.json"}}`} {
+		if _, err := LoadJSON(write(body), nil); err == nil || !strings.Contains(err.Error(), "options.writer") {
+			t.Fatalf("%s: expect error, got %v", body, err)
+		}
+	}
+}
+
 // 补充覆盖: splitComma 与 atoi
 func TestSplitCommaAtoi(t *testing.T) {
 	parts := splitComma("a, b , ,c")
@@ -88,8 +175,308 @@ func TestValidateErrors(t *testing.T) {
 		t.Fatal("MaxTokens<=0 应失败")
 	}
 	cfg = DefaultTemplateConfig()
+	cfg.RetryOn = []string{"network", "bogus"}
+	if err := Validate(cfg); err == nil {
+		t.Fatal("未知 retry_on 分类应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.Sidecar.Dir = "../qa"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("sidecar.dir 逃逸输出根应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.Sidecar.Ext = "jsonl"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("sidecar.ext 缺少 '.' 应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	prov := cfg.Provider[cfg.LLM]
+	prov.Concurrency = -1
+	cfg.Provider[cfg.LLM] = prov
+	if err := Validate(cfg); err == nil {
+		t.Fatal("provider.concurrency 为负应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.StreamSegmentRecords = 100
+	cfg.SkipUnchanged = true
+	if err := Validate(cfg); err == nil {
+		t.Fatal("stream_segment_records 与 skip_unchanged 同时启用应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.MaxRecords = -1
+	if err := Validate(cfg); err == nil {
+		t.Fatal("max_records 为负应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.RecordRanges = "150-100"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("record_ranges 起点大于终点应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.RecordRanges = "1-10"
+	cfg.StreamSegmentRecords = 100
+	if err := Validate(cfg); err == nil {
+		t.Fatal("record_ranges 与 stream_segment_records 同时启用应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.OrderedOutput = boolPtr(false)
+	cfg.SkipUnchanged = true
+	if err := Validate(cfg); err == nil {
+		t.Fatal("ordered_output=false 与 skip_unchanged 同时启用应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.Targets = []string{"zh", "zh"}
+	if err := Validate(cfg); err == nil {
+		t.Fatal("targets 重复语言应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.Targets = []string{"zh", "ja"}
+	cfg.FileLang.CompanionExt = ".lang"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("targets 与 file_lang 同时启用应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.OverheadTokens = -1
+	if err := Validate(cfg); err == nil {
+		t.Fatal("overhead_tokens 为负应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.BudgetHeadroomPct = 100
+	if err := Validate(cfg); err == nil {
+		t.Fatal("budget_headroom_pct 越界应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.Concurrency = 4
+	cfg.AutoConcurrency = true
+	cfg.MaxConcurrency = 2
+	if err := Validate(cfg); err == nil {
+		t.Fatal("max_concurrency 低于 concurrency 应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.Sidecar.ExtraFields = []string{"cost"}
+	if err := Validate(cfg); err == nil {
+		t.Fatal("未知 sidecar.extra_fields 应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	p := cfg.Provider["mock"]
+	p.Limits.MinSleepMs = -1
+	cfg.Provider["mock"] = p
+	if err := Validate(cfg); err == nil {
+		t.Fatal("负的 min_sleep_ms 应失败")
+	}
+	cfg = DefaultTemplateConfig()
 	cfg.Provider = map[string]Provider{"mock": {Client: "", Limits: Limits{}}}
 	if err := Validate(cfg); err == nil {
 		t.Fatal("client 为空应失败")
 	}
+	cfg = DefaultTemplateConfig()
+	cfg.FileLang.Rules = []FileLangRule{{Pattern: "[", Lang: "Japanese"}}
+	if err := Validate(cfg); err == nil {
+		t.Fatal("非法 file_lang 模式应失败")
+	}
+	cfg = DefaultTemplateConfig()
+	cfg.OnBlocked = "retry"
+	if err := Validate(cfg); err == nil {
+		t.Fatal("未知 on_blocked 策略应失败")
+	}
+	// 非激活 Provider 的选项同样预检，报错指明 provider 与字段
+	cfg = DefaultTemplateConfig()
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("模板配置应通过校验: %v", err)
+	}
+	p = cfg.Provider["openai"]
+	p.Options = json.RawMessage(`{"temprature": 0.2}`)
+	cfg.Provider["openai"] = p
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), `"openai"`) || !strings.Contains(err.Error(), "temprature") {
+		t.Fatalf("选项拼写错误应失败并指明 provider/字段: %v", err)
+	}
+}
+
+// 限额全为 0 时不构造 Gate；任一维度启用时构造
+func TestAssembleGateDisabled(t *testing.T) {
+	cfg := DefaultTemplateConfig()
+	p := cfg.Provider[cfg.LLM]
+	p.Limits = Limits{}
+	cfg.Provider[cfg.LLM] = p
+	_, set, gate, _, err := Assemble(cfg)
+	if err != nil {
+		t.Fatalf("assemble: %v", err)
+	}
+	if gate != nil || set.Gate != nil {
+		t.Fatalf("无限额时 Gate 应为 nil: %#v", set.Gate)
+	}
+	p.Limits = Limits{RPM: 60}
+	cfg.Provider[cfg.LLM] = p
+	if _, set, _, _, err = Assemble(cfg); err != nil || set.Gate == nil {
+		t.Fatalf("启用 rpm 时应构造 Gate: %v", err)
+	}
+}
+
+// 并发上限超过 ceil(rpm*时延/60s) 时下调（固定与自适应并发），记录原上限；显式关闭时不变
+func TestAssembleGateConcurrencyCap(t *testing.T) {
+	for rpm, want := range map[int]int{1: 1, 6: 1, 7: 2, 60: 10, 61: 11, 600: 100} {
+		if got := rpmWorkerCap(rpm); got != want {
+			t.Fatalf("rpmWorkerCap(%d) = %d, want %d", rpm, got, want)
+		}
+	}
+	cfg := DefaultTemplateConfig()
+	p := cfg.Provider[cfg.LLM]
+	p.Limits = Limits{RPM: 60}
+	cfg.Provider[cfg.LLM] = p
+	cfg.Concurrency = 64
+	_, set, _, _, err := Assemble(cfg)
+	if err != nil {
+		t.Fatalf("assemble: %v", err)
+	}
+	if set.EffectiveConcurrency() != 10 || set.ConcurrencyCappedFrom != 64 {
+		t.Fatalf("fixed: concurrency=%d capped_from=%d", set.EffectiveConcurrency(), set.ConcurrencyCappedFrom)
+	}
+	cfg.Concurrency = 8
+	if _, set, _, _, err = Assemble(cfg); err != nil {
+		t.Fatalf("assemble: %v", err)
+	}
+	if set.EffectiveConcurrency() != 8 || set.ConcurrencyCappedFrom != 0 {
+		t.Fatalf("below cap: concurrency=%d capped_from=%d", set.EffectiveConcurrency(), set.ConcurrencyCappedFrom)
+	}
+	cfg.Concurrency = 4
+	cfg.AutoConcurrency = true
+	if _, set, _, _, err = Assemble(cfg); err != nil {
+		t.Fatalf("assemble: %v", err)
+	}
+	if set.EffectiveConcurrency() != 4 || set.WorkerLimit() != 10 || set.ConcurrencyCappedFrom != 16 {
+		t.Fatalf("auto: start=%d limit=%d capped_from=%d", set.EffectiveConcurrency(), set.WorkerLimit(), set.ConcurrencyCappedFrom)
+	}
+	cfg.GateConcurrencyCap = boolPtr(false)
+	if _, set, _, _, err = Assemble(cfg); err != nil {
+		t.Fatalf("assemble: %v", err)
+	}
+	if set.WorkerLimit() != 16 || set.ConcurrencyCappedFrom != 0 {
+		t.Fatalf("disabled: limit=%d capped_from=%d", set.WorkerLimit(), set.ConcurrencyCappedFrom)
+	}
+}
+
+// model 覆盖合并进活动 provider 的 options：保留其余键、不修改入参；空 options 视为空对象；非对象失败
+func TestApplyModel(t *testing.T) {
+	cfg := DefaultTemplateConfig()
+	cfg.LLM = "openai"
+	cfg.Model = "gpt-4o"
+	p := cfg.Provider["openai"]
+	p.Options = json.RawMessage(`{"model":"old","base_url":"http://x","api_key":"k"}`)
+	cfg.Provider["openai"] = p
+	got, err := applyModel(cfg)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	var o map[string]any
+	if err := json.Unmarshal(got.Provider["openai"].Options, &o); err != nil || o["model"] != "gpt-4o" || o["base_url"] != "http://x" {
+		t.Fatalf("merged options = %s (%v)", got.Provider["openai"].Options, err)
+	}
+	if !strings.Contains(string(cfg.Provider["openai"].Options), `"old"`) {
+		t.Fatal("入参配置不应被修改")
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("覆盖后应通过校验: %v", err)
+	}
+	for _, raw := range []string{"", "null", " "} {
+		p.Options = json.RawMessage(raw)
+		cfg.Provider["openai"] = p
+		if got, err := applyModel(cfg); err != nil || string(got.Provider["openai"].Options) != `{"model":"gpt-4o"}` {
+			t.Fatalf("options %q: %s (%v)", raw, got.Provider["openai"].Options, err)
+		}
+	}
+	p.Options = json.RawMessage(`["x"]`)
+	cfg.Provider["openai"] = p
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "JSON object") {
+		t.Fatalf("非对象 options 应失败: %v", err)
+	}
+}
+
+// http_defaults 合并进 HTTP 类 Provider：默认头/查询参数到达请求，Provider 自身的同名头（大小写不敏感）与超时优先；
+// 非 HTTP client 的 options 不变
+func TestAssembleHTTPDefaults(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+	}))
+	defer srv.Close()
+	cfg := DefaultTemplateConfig()
+	cfg.LLM = "openai"
+	p := cfg.Provider["openai"]
+	p.Options = json.RawMessage(fmt.Sprintf(`{"base_url":%q,"api_key":"k","timeout_seconds":7,"extra_headers":{"x-team":"provider"}}`, srv.URL))
+	cfg.Provider["openai"] = p
+	mockOpts := string(cfg.Provider["mock"].Options)
+	cfg.HTTPDefaults = HTTPDefaults{
+		Headers:        map[string]string{"X-Team": "default", "X-Gateway": "gw"},
+		Query:          map[string]string{"api-version": "2024-06-01"},
+		TimeoutSeconds: 30,
+		Proxy:          "http://proxy:3128",
+	}
+	merged, err := applyHTTPDefaults(cfg)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	var o struct {
+		TimeoutSeconds int               `json:"timeout_seconds"`
+		Proxy          string            `json:"proxy"`
+		ExtraHeaders   map[string]string `json:"extra_headers"`
+	}
+	if err := json.Unmarshal(merged.Provider["openai"].Options, &o); err != nil || o.TimeoutSeconds != 7 || o.Proxy != "http://proxy:3128" || len(o.ExtraHeaders) != 2 {
+		t.Fatalf("merged options = %s (%v)", merged.Provider["openai"].Options, err)
+	}
+	if string(merged.Provider["mock"].Options) != mockOpts || strings.Contains(string(cfg.Provider["openai"].Options), "gw") {
+		t.Fatal("非 HTTP client 与入参配置不应被修改")
+	}
+	cfg.HTTPDefaults.Proxy = ""
+	comp, _, _, _, err := Assemble(cfg)
+	if err != nil {
+		t.Fatalf("assemble: %v", err)
+	}
+	if _, err := comp.LLM.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if got.Header.Get("X-Team") != "provider" || got.Header.Get("X-Gateway") != "gw" || got.URL.Query().Get("api-version") != "2024-06-01" {
+		t.Fatalf("request headers=%v query=%q", got.Header, got.URL.RawQuery)
+	}
+	cfg.HTTPDefaults.TimeoutSeconds = -1
+	if err := Validate(cfg); err == nil {
+		t.Fatal("负 http_defaults.timeout_seconds 应失败")
+	}
+}
+
+func TestApplyBytesPerToken(t *testing.T) {
+	for _, c := range []struct{ raw, want string }{
+		{`{"context_radius":1,"bytes_per_token":0}`, `{"bytes_per_token":3,"context_radius":1}`},
+		{`{"bytes_per_token":null}`, `{"bytes_per_token":3}`},
+		{``, `{"bytes_per_token":3}`},
+		{`{"bytes_per_token":5}`, `{"bytes_per_token":5}`},
+	} {
+		got, err := applyBytesPerToken(json.RawMessage(c.raw), 3)
+		if err != nil || string(got) != c.want {
+			t.Fatalf("%s: got %s (%v), want %s", c.raw, got, err, c.want)
+		}
+	}
+	if got, _ := applyBytesPerToken(json.RawMessage(`{"context_radius":1}`), 0); string(got) != `{"context_radius":1}` {
+		t.Fatalf("bpt=0 must keep options: %s", got)
+	}
+	if _, err := applyBytesPerToken(json.RawMessage(`[1]`), 3); err == nil {
+		t.Fatal("非对象 options 应失败")
+	}
+	// 传播：Settings 与 Batcher 采用同一系数
+	cfg := DefaultTemplateConfig()
+	cfg.BytesPerToken = 2
+	comp, set, _, _, err := Assemble(cfg)
+	if err != nil || set.BytesPerToken != 2 {
+		t.Fatalf("settings bytes_per_token = %d (%v)", set.BytesPerToken, err)
+	}
+	// 单条记录 8 字节 + 每条额外 80 字节：系数 4 估 22 token，系数 2 估 44 token，超出 30 的预算
+	recs := []contract.Record{{Index: 0, FileID: "f", Text: "aaaaaaaa"}}
+	if _, err := comp.Batcher.Make(context.Background(), recs, contract.BatchLimit{MaxTokens: 30}); err == nil {
+		t.Fatal("batcher 应沿用顶层 bytes_per_token=2 而超出预算")
+	}
+	cfg.BytesPerToken = 0
+	comp, _, _, _, _ = Assemble(cfg)
+	if _, err := comp.Batcher.Make(context.Background(), recs, contract.BatchLimit{MaxTokens: 30}); err != nil {
+		t.Fatalf("默认系数 4 应可装入: %v", err)
+	}
 }
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"llmspt/pkg/registry"
+)
+
+// 合并优先级（高 → 低）：Provider options 自身的键 > 顶层 http_defaults > client 内置默认。
+// headers/query 按键合并；timeout_seconds/proxy 整值合并。
+
+// empty 报告是否未提供任何默认值。
+func (h HTTPDefaults) empty() bool {
+	return len(h.Headers) == 0 && len(h.Query) == 0 && h.TimeoutSeconds == 0 && strings.TrimSpace(h.Proxy) == ""
+}
+
+// validateHTTPDefaults 检查 http_defaults 的取值（代理 URL 的合法性由 client 校验器在合并后检查）。
+func validateHTTPDefaults(h HTTPDefaults) error {
+	if h.TimeoutSeconds < 0 {
+		return errors.New("config: http_defaults.timeout_seconds must be >= 0")
+	}
+	for k := range h.Headers {
+		if strings.TrimSpace(k) == "" {
+			return errors.New("config: http_defaults.headers: empty header name")
+		}
+	}
+	for k := range h.Query {
+		if strings.TrimSpace(k) == "" {
+			return errors.New("config: http_defaults.query: empty parameter name")
+		}
+	}
+	return nil
+}
+
+// applyHTTPDefaults 将顶层 http_defaults 合并进各 HTTP 类 Provider（registry.LLMClientHTTP 登记的 client）的 options；
+// 返回克隆了 Provider 映射的新配置，不修改入参。http_defaults 为空时原样返回；options 非 JSON 对象时返回配置错误。
+func applyHTTPDefaults(cfg Config) (Config, error) {
+	if cfg.HTTPDefaults.empty() {
+		return cfg, nil
+	}
+	provs := make(map[string]Provider, len(cfg.Provider))
+	for name, p := range cfg.Provider {
+		if registry.LLMClientHTTP[p.Client] {
+			merged, err := mergeHTTPDefaults(p.Options, cfg.HTTPDefaults)
+			if err != nil {
+				return cfg, fmt.Errorf("config: http_defaults: provider %q: %w", name, err)
+			}
+			p.Options = merged
+		}
+		provs[name] = p
+	}
+	cfg.Provider = provs
+	return cfg, nil
+}
+
+// mergeHTTPDefaults 将 h 合并进单个 Provider 的原样 options（options 为空或 null 时视为空对象）。
+func mergeHTTPDefaults(raw json.RawMessage, h HTTPDefaults) (json.RawMessage, error) {
+	obj := map[string]json.RawMessage{}
+	if raw := bytes.TrimSpace(raw); len(raw) > 0 && !bytes.Equal(raw, []byte("null")) {
+		if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+			return nil, errors.New("options must be a JSON object")
+		}
+	}
+	if err := mergeStringMap(obj, "extra_headers", h.Headers, strings.EqualFold); err != nil {
+		return nil, err
+	}
+	if err := mergeStringMap(obj, "extra_query", h.Query, func(a, b string) bool { return a == b }); err != nil {
+		return nil, err
+	}
+	if h.TimeoutSeconds > 0 && unsetOption(obj["timeout_seconds"]) {
+		obj["timeout_seconds"] = json.RawMessage(strconv.Itoa(h.TimeoutSeconds))
+	}
+	if p := strings.TrimSpace(h.Proxy); p != "" && unsetOption(obj["proxy"]) {
+		v, _ := json.Marshal(p)
+		obj["proxy"] = v
+	}
+	return json.Marshal(obj)
+}
+
+// mergeStringMap 将 defs 中 options[key] 尚未包含的键补入（same 判定键相等）；options[key] 须为字符串映射。
+func mergeStringMap(obj map[string]json.RawMessage, key string, defs map[string]string, same func(a, b string) bool) error {
+	if len(defs) == 0 {
+		return nil
+	}
+	cur := map[string]string{}
+	if v := obj[key]; !unsetOption(v) {
+		if err := json.Unmarshal(v, &cur); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+next:
+	for k, v := range defs {
+		for ck := range cur {
+			if same(ck, k) {
+				continue next
+			}
+		}
+		cur[k] = v
+	}
+	b, err := json.Marshal(cur)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	obj[key] = b
+	return nil
+}
+
+// unsetOption 报告选项值缺失或为零值（null、0、空串）。
+func unsetOption(v json.RawMessage) bool {
+	switch string(bytes.TrimSpace(v)) {
+	case "", "null", "0", `""`:
+		return true
+	}
+	return false
+}
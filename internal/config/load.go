@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -28,29 +30,54 @@ func Defaults() Config {
 	}
 }
 
-// LoadJSON 从文件路径或原始 JSON 解析 Config（严格拒绝未知字段）。
+// LoadJSON 从文件路径或原始 JSON 解析 Config（严格拒绝未知字段；配置自身 allow_unknown=true 时忽略）。
+// options.* 取值为 "@<path>" 字符串时以该 JSON 文件内容替换（见 resolveOptionFiles）：
+// 相对路径相对配置文件所在目录解析；原始 JSON（raw）来源相对当前工作目录。
 func LoadJSON(path string, raw []byte) (Config, error) {
+	cfg, _, err := LoadJSONAllowUnknown(path, raw, false)
+	return cfg, err
+}
+
+// LoadJSONAllowUnknown 同 LoadJSON；allowUnknown 为 true（或配置自身 allow_unknown=true）时忽略未知字段，
+// 并返回被忽略的键路径（点分，如 "logging.colour"，升序），供调用方告警。严格模式下返回 nil。
+func LoadJSONAllowUnknown(path string, raw []byte, allowUnknown bool) (Config, []string, error) {
 	var cfg Config
-	var r io.Reader
+	baseDir := "."
 	switch {
 	case len(raw) > 0:
-		r = bytes.NewReader(raw)
 	case path != "":
-		f, err := os.Open(path)
+		baseDir = filepath.Dir(path)
+		b, err := os.ReadFile(path)
 		if err != nil {
-			return cfg, err
+			return cfg, nil, err
 		}
-		defer f.Close()
-		r = f
+		raw = b
 	default:
-		return cfg, errors.New("no config source provided")
+		return cfg, nil, errors.New("no config source provided")
+	}
+	if !allowUnknown {
+		// 先探测配置自身的开关；语法错误留给下方的正式解码报告
+		var probe struct {
+			AllowUnknown bool `json:"allow_unknown"`
+		}
+		_ = json.NewDecoder(bytes.NewReader(raw)).Decode(&probe)
+		allowUnknown = probe.AllowUnknown
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if !allowUnknown {
+		dec.DisallowUnknownFields()
 	}
-	dec := json.NewDecoder(r)
-	dec.DisallowUnknownFields()
 	if err := dec.Decode(&cfg); err != nil {
-		return cfg, err
+		return cfg, nil, err
+	}
+	var ignored []string
+	if allowUnknown {
+		ignored = unknownKeys(raw, reflect.TypeOf(cfg))
 	}
-	return cfg, nil
+	if err := resolveOptionFiles(&cfg.Options, baseDir); err != nil {
+		return cfg, ignored, err
+	}
+	return cfg, ignored, nil
 }
 
 // Merge 按优先级合并（后者覆盖前者）。
@@ -64,18 +91,141 @@ func Merge(base, over Config) Config {
     if over.Concurrency != 0 {
         out.Concurrency = over.Concurrency
     }
+    // AutoConcurrency：仅 true 覆盖（false 视为未设置）
+    if over.AutoConcurrency {
+        out.AutoConcurrency = true
+    }
+    // AllowUnknown：仅 true 覆盖（解析期开关，保留以便 dump 出有效配置）
+    if over.AllowUnknown {
+        out.AllowUnknown = true
+    }
+    if over.MaxConcurrency != 0 {
+        out.MaxConcurrency = over.MaxConcurrency
+    }
     if over.MaxTokens != 0 {
         out.MaxTokens = over.MaxTokens
     }
+    if over.BudgetHeadroomPct != 0 {
+        out.BudgetHeadroomPct = over.BudgetHeadroomPct
+    }
+    if over.BytesPerToken != 0 {
+        out.BytesPerToken = over.BytesPerToken
+    }
+    if over.OverheadTokens != 0 {
+        out.OverheadTokens = over.OverheadTokens
+    }
     // 特殊：MaxRetries 的 0 具有语义（禁用重试），需要显式可覆盖。
     // 约定：当 over.MaxRetries >= 0 时认为“存在”，否则（例如 -1）视为未覆盖。
     if over.MaxRetries >= 0 {
         out.MaxRetries = over.MaxRetries
     }
-	// Logging（仅 level）
+    // 分阶段重试：nil 视为未设置
+    if over.MaxInvokeRetries != nil {
+        out.MaxInvokeRetries = cloneIntPtr(over.MaxInvokeRetries)
+    }
+    if over.MaxDecodeRetries != nil {
+        out.MaxDecodeRetries = cloneIntPtr(over.MaxDecodeRetries)
+    }
+    if len(over.RetryOn) > 0 {
+        out.RetryOn = cloneStrings(over.RetryOn)
+    }
+    // SkipUnchanged：仅 true 覆盖（false 视为未设置）
+    if over.SkipUnchanged {
+        out.SkipUnchanged = true
+    }
+    // FailOnEmpty：同上，仅 true 覆盖
+    if over.FailOnEmpty {
+        out.FailOnEmpty = true
+    }
+    // ContinueOnError：同上，仅 true 覆盖
+    if over.ContinueOnError {
+        out.ContinueOnError = true
+    }
+    if over.MaxConsecutiveFailures != 0 {
+        out.MaxConsecutiveFailures = over.MaxConsecutiveFailures
+    }
+    if strings.TrimSpace(over.OnBlocked) != "" {
+        out.OnBlocked = strings.TrimSpace(over.OnBlocked)
+    }
+    if over.StreamSegmentRecords != 0 {
+        out.StreamSegmentRecords = over.StreamSegmentRecords
+    }
+    if over.MaxBatches != 0 {
+        out.MaxBatches = over.MaxBatches
+    }
+    if over.MaxRecords != 0 {
+        out.MaxRecords = over.MaxRecords
+    }
+    if strings.TrimSpace(over.ManifestPath) != "" {
+        out.ManifestPath = strings.TrimSpace(over.ManifestPath)
+    }
+    if strings.TrimSpace(over.RecordRanges) != "" {
+        out.RecordRanges = strings.TrimSpace(over.RecordRanges)
+    }
+    // OrderedOutput：nil 不覆盖（显式 false 可关闭默认的顺序输出）
+    if over.OrderedOutput != nil {
+        v := *over.OrderedOutput
+        out.OrderedOutput = &v
+    }
+    // GateConcurrencyCap：nil 不覆盖（显式 false 可关闭默认的限流并发上限）
+    if over.GateConcurrencyCap != nil {
+        v := *over.GateConcurrencyCap
+        out.GateConcurrencyCap = &v
+    }
+    if len(over.Targets) > 0 {
+        out.Targets = cloneStrings(over.Targets)
+    }
+	// Logging（level、gate 快照间隔与捕获目录；零值视为未设置）
 	if strings.TrimSpace(over.Logging.Level) != "" {
 		out.Logging.Level = strings.TrimSpace(over.Logging.Level)
 	}
+	if over.Logging.GateSnapshotMs != 0 {
+		out.Logging.GateSnapshotMs = over.Logging.GateSnapshotMs
+	}
+	if strings.TrimSpace(over.Logging.DebugCaptureDir) != "" {
+		out.Logging.DebugCaptureDir = strings.TrimSpace(over.Logging.DebugCaptureDir)
+	}
+	// Sidecar（nil/空不覆盖）
+	if over.Sidecar.IncludeSrc != nil {
+		v := *over.Sidecar.IncludeSrc
+		out.Sidecar.IncludeSrc = &v
+	}
+	if over.Sidecar.IncludeMeta != nil {
+		v := *over.Sidecar.IncludeMeta
+		out.Sidecar.IncludeMeta = &v
+	}
+	if len(over.Sidecar.ExtraFields) > 0 {
+		out.Sidecar.ExtraFields = cloneStrings(over.Sidecar.ExtraFields)
+	}
+	if strings.TrimSpace(over.Sidecar.Dir) != "" {
+		out.Sidecar.Dir = strings.TrimSpace(over.Sidecar.Dir)
+	}
+	if strings.TrimSpace(over.Sidecar.Ext) != "" {
+		out.Sidecar.Ext = strings.TrimSpace(over.Sidecar.Ext)
+	}
+	// HTTPDefaults（零值/空不覆盖；headers/query 按键合并）
+	if len(over.HTTPDefaults.Headers) > 0 {
+		out.HTTPDefaults.Headers = mergeStringMaps(out.HTTPDefaults.Headers, over.HTTPDefaults.Headers)
+	}
+	if len(over.HTTPDefaults.Query) > 0 {
+		out.HTTPDefaults.Query = mergeStringMaps(out.HTTPDefaults.Query, over.HTTPDefaults.Query)
+	}
+	if over.HTTPDefaults.TimeoutSeconds != 0 {
+		out.HTTPDefaults.TimeoutSeconds = over.HTTPDefaults.TimeoutSeconds
+	}
+	if strings.TrimSpace(over.HTTPDefaults.Proxy) != "" {
+		out.HTTPDefaults.Proxy = strings.TrimSpace(over.HTTPDefaults.Proxy)
+	}
+	// FileLang（空不覆盖；规则整体替换）
+	if over.FileLang.Var != "" {
+		out.FileLang.Var = over.FileLang.Var
+	}
+	if len(over.FileLang.Rules) > 0 {
+		out.FileLang.Rules = append([]FileLangRule(nil), over.FileLang.Rules...)
+	}
+	if over.FileLang.CompanionExt != "" {
+		out.FileLang.CompanionExt = over.FileLang.CompanionExt
+	}
 
 	// 组件名（空不覆盖）
 	if over.Components.Reader != "" {
@@ -137,13 +287,16 @@ func Merge(base, over Config) Config {
 	if strings.TrimSpace(over.LLM) != "" {
 		out.LLM = strings.TrimSpace(over.LLM)
 	}
+	if strings.TrimSpace(over.Model) != "" {
+		out.Model = strings.TrimSpace(over.Model)
+	}
 	return out
 }
 
 // EnvOverlay 从环境变量构建一个 Config 覆盖（仅解析有限键集合）。
 // 规则：前缀 LLM_SPT_；未知但匹配本集合之外的键忽略（保持 5.1 边界最小化）。
-// 支持：INPUTS, CONCURRENCY, MAX_TOKENS, LLM, COMPONENTS_*
-// 以及 PROVIDER__<name>__CLIENT / PROVIDER__<name>__LIMITS_{RPM,TPM,MAX_TOKENS_PER_REQ} / PROVIDER__<name>__OPTIONS_JSON
+// 支持：INPUTS, CONCURRENCY, AUTO_CONCURRENCY, MAX_CONCURRENCY, MAX_TOKENS, BYTES_PER_TOKEN, OVERHEAD_TOKENS, BUDGET_HEADROOM_PCT, MAX_RETRIES, MAX_INVOKE_RETRIES, MAX_DECODE_RETRIES, RETRY_ON, SKIP_UNCHANGED, FAIL_ON_EMPTY, CONTINUE_ON_ERROR, MAX_CONSECUTIVE_FAILURES, ON_BLOCKED, STREAM_SEGMENT_RECORDS, MAX_BATCHES, MAX_RECORDS, MANIFEST_PATH, RECORD_RANGES, ORDERED_OUTPUT, TARGETS, GATE_CONCURRENCY_CAP, LLM, MODEL, COMPONENTS_*
+// 以及 PROVIDER__<name>__CLIENT / PROVIDER__<name>__LIMITS_{RPM,TPM,MAX_TOKENS_PER_REQ} / PROVIDER__<name>__CONCURRENCY / PROVIDER__<name>__OPTIONS_JSON
 func EnvOverlay(environ []string) (Config, error) {
     var over Config
     // 默认：-1 表示未设置，以便 Merge 能区分“未覆盖”和“显式设置为 0”。
@@ -170,16 +323,96 @@ func EnvOverlay(environ []string) (Config, error) {
 			if v, err := atoi(val); err == nil {
 				over.Concurrency = v
 			}
+		case "AUTO_CONCURRENCY":
+			if v, err := strconv.ParseBool(strings.TrimSpace(val)); err == nil {
+				over.AutoConcurrency = v
+			}
+		case "MAX_CONCURRENCY":
+			if v, err := atoi(val); err == nil {
+				over.MaxConcurrency = v
+			}
 		case "MAX_TOKENS":
 			if v, err := atoi(val); err == nil {
 				over.MaxTokens = v
 			}
+		case "BYTES_PER_TOKEN":
+			if v, err := atoi(val); err == nil {
+				over.BytesPerToken = v
+			}
+		case "OVERHEAD_TOKENS":
+			if v, err := atoi(val); err == nil {
+				over.OverheadTokens = v
+			}
+		case "BUDGET_HEADROOM_PCT":
+			if v, err := atoi(val); err == nil {
+				over.BudgetHeadroomPct = v
+			}
         case "MAX_RETRIES":
             if v, err := atoi(val); err == nil {
                 over.MaxRetries = v
             }
+		case "MAX_INVOKE_RETRIES":
+			if v, err := atoi(val); err == nil {
+				over.MaxInvokeRetries = &v
+			}
+		case "MAX_DECODE_RETRIES":
+			if v, err := atoi(val); err == nil {
+				over.MaxDecodeRetries = &v
+			}
+		case "RETRY_ON":
+			if val != "" {
+				over.RetryOn = splitComma(val)
+			}
+		case "SKIP_UNCHANGED":
+			if v, err := strconv.ParseBool(strings.TrimSpace(val)); err == nil {
+				over.SkipUnchanged = v
+			}
+		case "FAIL_ON_EMPTY":
+			if v, err := strconv.ParseBool(strings.TrimSpace(val)); err == nil {
+				over.FailOnEmpty = v
+			}
+		case "CONTINUE_ON_ERROR":
+			if v, err := strconv.ParseBool(strings.TrimSpace(val)); err == nil {
+				over.ContinueOnError = v
+			}
+		case "MAX_CONSECUTIVE_FAILURES":
+			if v, err := atoi(val); err == nil {
+				over.MaxConsecutiveFailures = v
+			}
+		case "ON_BLOCKED":
+			over.OnBlocked = strings.TrimSpace(val)
+		case "STREAM_SEGMENT_RECORDS":
+			if v, err := atoi(val); err == nil {
+				over.StreamSegmentRecords = v
+			}
+		case "MAX_BATCHES":
+			if v, err := atoi(val); err == nil {
+				over.MaxBatches = v
+			}
+		case "MAX_RECORDS":
+			if v, err := atoi(val); err == nil {
+				over.MaxRecords = v
+			}
+		case "MANIFEST_PATH":
+			over.ManifestPath = strings.TrimSpace(val)
+		case "RECORD_RANGES":
+			over.RecordRanges = strings.TrimSpace(val)
+		case "ORDERED_OUTPUT":
+			if v, err := strconv.ParseBool(strings.TrimSpace(val)); err == nil {
+				over.OrderedOutput = &v
+			}
+		case "GATE_CONCURRENCY_CAP":
+			if v, err := strconv.ParseBool(strings.TrimSpace(val)); err == nil {
+				over.GateConcurrencyCap = &v
+			}
+		case "TARGETS":
+			if val != "" {
+				over.Targets = splitComma(val)
+			}
 		case "LLM":
 			over.LLM = strings.TrimSpace(val)
+		case "MODEL":
+			over.Model = strings.TrimSpace(val)
 		case "COMPONENTS_READER":
 			over.Components.Reader = strings.TrimSpace(val)
 		case "COMPONENTS_SPLITTER":
@@ -224,6 +457,21 @@ func EnvOverlay(environ []string) (Config, error) {
                             p.Limits.MaxTokensPerReq = v
                             changed = true
                         }
+                    case "LIMITS_MIN_SLEEP_MS":
+                        if v, err := atoi(val); err == nil {
+                            p.Limits.MinSleepMs = v
+                            changed = true
+                        }
+                    case "LIMITS_POLL_STEP_MS":
+                        if v, err := atoi(val); err == nil {
+                            p.Limits.PollStepMs = v
+                            changed = true
+                        }
+                    case "CONCURRENCY":
+                        if v, err := atoi(val); err == nil {
+                            p.Concurrency = v
+                            changed = true
+                        }
                     case "OPTIONS_JSON":
                         // 原样 JSON；空值视为未设置，避免清空现有配置
                         if strings.TrimSpace(val) != "" {
@@ -256,6 +504,34 @@ func cloneStrings(in []string) []string {
 	return out
 }
 
+// mergeStringMaps 返回 base 与 over 的合并副本（同名键取 over）。
+func mergeStringMaps(base, over map[string]string) map[string]string {
+	out := make(map[string]string, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		out[k] = v
+	}
+	return out
+}
+
+func cloneBoolPtr(in *bool) *bool {
+	if in == nil {
+		return nil
+	}
+	v := *in
+	return &v
+}
+
+func cloneIntPtr(in *int) *int {
+	if in == nil {
+		return nil
+	}
+	v := *in
+	return &v
+}
+
 func cloneRaw(in json.RawMessage) json.RawMessage {
 	if len(in) == 0 {
 		return nil
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveOptionFiles 展开 options.* 中的文件引用：取值为以 "@" 开头的 JSON 字符串（如 "@opts/prompt.json"）时，
+// 以该文件内容（须为合法 JSON）替换之，交由各组件工厂严格解析。相对路径相对 baseDir（配置文件所在目录）解析。
+func resolveOptionFiles(o *Options, baseDir string) error {
+	fields := []struct {
+		name string
+		raw  *json.RawMessage
+	}{
+		{"reader", &o.Reader},
+		{"splitter", &o.Splitter},
+		{"batcher", &o.Batcher},
+		{"writer", &o.Writer},
+		{"prompt_builder", &o.PromptBuilder},
+		{"decoder", &o.Decoder},
+		{"assembler", &o.Assembler},
+	}
+	for _, f := range fields {
+		ref, ok := optionFileRef(*f.raw)
+		if !ok {
+			continue
+		}
+		p := ref
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(baseDir, p)
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("config: options.%s: %w", f.name, err)
+		}
+		b = bytes.TrimSpace(b)
+		if !json.Valid(b) {
+			return fmt.Errorf("config: options.%s: %s is not valid JSON", f.name, ref)
+		}
+		*f.raw = json.RawMessage(b)
+	}
+	return nil
+}
+
+// optionFileRef 报告 raw 是否为 "@<path>" 形式的 JSON 字符串并返回路径。
+func optionFileRef(raw json.RawMessage) (string, bool) {
+	t := bytes.TrimSpace(raw)
+	if len(t) == 0 || t[0] != '"' {
+		return "", false
+	}
+	var s string
+	if json.Unmarshal(t, &s) != nil || !strings.HasPrefix(s, "@") || len(s) == 1 {
+		return "", false
+	}
+	return s[1:], true
+}
@@ -15,13 +15,15 @@ func DefaultTemplateConfig() Config {
 		MaxTokens:   2048,
 		MaxRetries:  2,
 		Logging:     Logging{Level: "info"},
+		Sidecar:     Sidecar{IncludeSrc: boolPtr(true), IncludeMeta: boolPtr(true), ExtraFields: []string{}},
+		FileLang:    FileLang{Var: "target_lang", Rules: []FileLangRule{}},
 		Components:  d.Components,
 		LLM:         "mock",
 		Provider: map[string]Provider{
 			"mock": {
 				Client: "mock",
 				// 包含所有 mock 选项键（可为空）
-				Options: json.RawMessage(`{"prefix":"","api_key":"","response_mode":""}`),
+				Options: json.RawMessage(`{"prefix":"","api_key":"","response_mode":"","fail_on_indices":[],"fail_mode":"","fail_times":0,"stream_chunk_bytes":0,"delay_ms":0,"delay_jitter_ms":0}`),
 				Limits:  Limits{RPM: 60, TPM: 10000, MaxTokensPerReq: 4096},
 			},
             "openai": {
@@ -30,13 +32,30 @@ func DefaultTemplateConfig() Config {
                 Options: json.RawMessage(`{
   "base_url": "",
   "model": "", 
+  "model_fallbacks": [],
   "api_key_env": "",
   "api_key": "",
   "timeout_seconds": 60,
   "temperature": null,
+  "reasoning": null,
+  "reasoning_effort": "",
+  "max_output_tokens": 0,
   "endpoint_path": "",
   "disable_default_auth": false,
-  "extra_headers": {}
+  "extra_headers": {},
+  "extra_query": {},
+  "retryable_statuses": [],
+  "allowed_hosts": [],
+  "on_empty_response": "retry",
+  "max_response_bytes": 0,
+  "max_idle_conns": 0,
+  "max_idle_conns_per_host": 0,
+  "idle_conn_timeout_seconds": 0,
+  "proxy": "",
+  "locale": "",
+  "stream": false,
+  "stream_idle_timeout_seconds": 0,
+  "json_mode": "schema"
 }`),
                 Limits: Limits{RPM: 0, TPM: 0, MaxTokensPerReq: 0},
             },
@@ -46,6 +65,7 @@ func DefaultTemplateConfig() Config {
                 Options: json.RawMessage(`{
   "base_url": "",
   "model": "",
+  "model_fallbacks": [],
   "api_key_env": "",
   "api_key": "",
   "endpoint_path": "",
@@ -53,7 +73,16 @@ func DefaultTemplateConfig() Config {
   "api_key_in_query": true,
   "extra_headers": {},
   "extra_query": {},
-  "response_mime_type": ""
+  "response_mime_type": "",
+  "retryable_statuses": [],
+  "allowed_hosts": [],
+  "on_empty_response": "retry",
+  "max_response_bytes": 0,
+  "max_idle_conns": 0,
+  "max_idle_conns_per_host": 0,
+  "idle_conn_timeout_seconds": 0,
+  "proxy": "",
+  "locale": ""
 }`),
                 Limits: Limits{RPM: 0, TPM: 0, MaxTokensPerReq: 0},
             },
@@ -62,16 +91,26 @@ func DefaultTemplateConfig() Config {
 	// Options：包含所有键（值可为空/默认），确保键存在。
 	cfg.Options.Reader = json.RawMessage(`{
   "buf_size": 65536,
-  "exclude_dir_names": [".git", "node_modules", "vendor"]
+  "exclude_dir_names": [".git", "node_modules", "vendor"],
+  "max_open_files": 0,
+  "index_exts": []
 }`)
 	cfg.Options.Splitter = json.RawMessage(`{
   "max_fragment_bytes": 0,
-  "allow_exts": [".srt"]
+  "allow_exts": [".srt"],
+  "strip_tags": false,
+  "lenient_timing": false,
+  "preserve_speaker_labels": false,
+  "check_monotonic": false,
+  "on_non_monotonic": "error"
 }`)
     cfg.Options.Batcher = json.RawMessage(`{
   "context_radius": 1,
-  "bytes_per_token": 4,
-  "extra_bytes_per_record": 80
+  "left_radius": null,
+  "right_radius": null,
+  "bytes_per_token": 0,
+  "extra_bytes_per_record": 80,
+  "scene_gap_ms": 0
 }`)
 	cfg.Options.Writer = json.RawMessage(`{
   "output_dir": "out",
@@ -79,17 +118,51 @@ func DefaultTemplateConfig() Config {
   "flat": true,
   "perm_file": 0,
   "perm_dir": 0,
-  "buf_size": 65536
+  "buf_size": 65536,
+  "route": [],
+  "fsync": "always",
+  "fsync_batch_size": 0,
+  "on_collision": "error",
+  "write_bom": false,
+  "emit_checksum": "",
+  "part_suffix": ""
 }`)
 	cfg.Options.PromptBuilder = json.RawMessage(`{
   "inline_system_template": "",
   "system_template_path": "",
   "inline_glossary": "",
-  "glossary_path": ""
+  "glossary_path": "",
+  "vars": {},
+  "file_vars": [],
+  "examples": [],
+  "examples_path": "",
+  "max_examples": 0,
+  "max_example_bytes": 0,
+  "output_format": "json",
+  "include_meta_keys": []
 }`)
-	// decoder.srt 当前无配置项，保持空对象
-	cfg.Options.Decoder = json.RawMessage(`{}`)
-	// srt 装配器无配置项，保持空对象
-	cfg.Options.Assembler = json.RawMessage(`{}`)
+	// 顺序输出为默认行为，显式写出以便发现 ordered_output 开关
+	cfg.OrderedOutput = boolPtr(true)
+	// 限流并发上限默认开启，显式写出以便发现开关
+	cfg.GateConcurrencyCap = boolPtr(true)
+	// 多目标语言默认关闭（单语言，工件与源同名）
+	cfg.Targets = []string{}
+	// Provider 共用的 HTTP 默认值（空表示不提供，各 Provider 自身设置优先）
+	cfg.HTTPDefaults = HTTPDefaults{Headers: map[string]string{}, Query: map[string]string{}}
+	// 全局估算系数：同时作用于 Pipeline 预算与 Batcher（batcher 的 bytes_per_token 为 0 时沿用）
+	cfg.BytesPerToken = 4
+	cfg.Options.Decoder = json.RawMessage(`{
+  "lenient": false,
+  "preserve_lines": false,
+  "meta_fields": [],
+  "field_map": {},
+  "case_insensitive_keys": false,
+  "ignore_extra_ids": false,
+  "trim_invisible": false
+}`)
+	// linear 装配器：默认保留原序号，未翻译（原文透传）块原样保留
+	cfg.Options.Assembler = json.RawMessage(`{"renumber": false, "on_untranslated": "keep", "line_ending": "lf"}`)
 	return cfg
 }
+
+func boolPtr(v bool) *bool { return &v }
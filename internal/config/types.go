@@ -9,25 +9,130 @@ import (
 type Config struct {
 	Inputs      []string `json:"inputs"`
 	Concurrency int      `json:"concurrency"`
-	MaxTokens   int      `json:"max_tokens"`
+	// AutoConcurrency: 自适应并发（AIMD），以 concurrency 为起点按延迟与错误率在 [1, max_concurrency] 内调整。
+	AutoConcurrency bool `json:"auto_concurrency"`
+	// MaxConcurrency: 自适应并发上限；0 表示 4×concurrency。
+	MaxConcurrency int `json:"max_concurrency"`
+	MaxTokens      int `json:"max_tokens"`
+	// GateConcurrencyCap: 按活动 Provider 的 limits.rpm 将并发上限限定为 ceil(rpm×10s/60s)（null/true，默认）——
+	// 按典型调用时延 10s 估算，多出的 worker 只会阻塞在限流闸门上；false 关闭（CLI --no-gate-concurrency-cap）。
+	GateConcurrencyCap *bool `json:"gate_concurrency_cap"`
+	// BudgetHeadroomPct: 批预算在扣除提示词开销后再预留的百分比（0-99），为模型输出留出空间。
+	BudgetHeadroomPct int `json:"budget_headroom_pct"`
+	// BytesPerToken: 全局 token 估算系数（tokens ≈ ceil(utf8_bytes / bytes_per_token)），供 Pipeline 的预算/闸门估算，
+	// 并注入 options.batcher（其未设置或 <=0 时），使各阶段估算一致。0 采用默认 4。
+	BytesPerToken int `json:"bytes_per_token"`
+	// OverheadTokens: 固定提示词开销（token）；>0 时取代 PromptBuilder 对模板的开销估算参与批预算，0 使用估算值。
+	OverheadTokens int `json:"overhead_tokens"`
 	// MaxRetries: LLM 阶段最大重试次数（>=0）。0 表示不重试。
-	MaxRetries int     `json:"max_retries"`
-	Logging    Logging `json:"logging"`
+	MaxRetries int `json:"max_retries"`
+	// MaxInvokeRetries / MaxDecodeRetries: 分别限定 LLM 调用失败与解码失败的重试次数（>=0）；
+	// null 表示沿用 max_retries。
+	MaxInvokeRetries *int `json:"max_invoke_retries"`
+	MaxDecodeRetries *int `json:"max_decode_retries"`
+	// SkipUnchanged: 源内容摘要未变更的文件跳过处理（需 Writer 支持源摘要持久化，如 fs）。
+	SkipUnchanged bool `json:"skip_unchanged"`
+	// FailOnEmpty: 空或仅含空白的源文件视为错误（默认 false：写出空工件）。
+	FailOnEmpty bool `json:"fail_on_empty"`
+	// ContinueOnError: 单个文件失败时记录并继续处理其余文件，运行结束时返回失败汇总。
+	ContinueOnError bool `json:"continue_on_error"`
+	// MaxConsecutiveFailures: 连续失败文件数达到该值即终止运行（即使 continue_on_error）；0 表示不限制。
+	MaxConsecutiveFailures int `json:"max_consecutive_failures"`
+	// OnBlocked: 上游内容拦截的运行级策略（passthrough|fail）；为空遵循各 Provider 的 on_empty_response。
+	OnBlocked string `json:"on_blocked"`
+	// StreamSegmentRecords: >0 时对支持流式拆分的 Splitter（如 srt）按该记录数分段边读边处理，
+	// 适用于超大输入（如 STDIN 流）；段间不共享上下文。0 关闭；不可与 skip_unchanged 同时启用。
+	StreamSegmentRecords int `json:"stream_segment_records"`
+	// MaxBatches / MaxRecords: 运行级成本护栏——本次运行最多调度的批数 / 目标记录数；0 表示不限制。
+	// 达到上限后停止调度新工作（在途文件照常完成），CLI 以退出码 4 结束。
+	MaxBatches int `json:"max_batches"`
+	MaxRecords int `json:"max_records"`
+	// ManifestPath: 非空时在运行结束写出 JSON 工件清单（工件、源文件、字节数、状态）。
+	ManifestPath string `json:"manifest_path"`
+	// RecordRanges: 仅翻译各文件中选中的记录（1 起的记录序号，如 "100-150,200"），其余原文透传；为空处理全部。
+	// 需 Decoder 支持原文透传；不可与 stream_segment_records 同时启用。
+	RecordRanges string `json:"record_ranges"`
+	// OrderedOutput: 同一文件的批按序装配为单一工件（null/true，默认）；false 时每批完成即写出分片工件
+	// （<stem>.part-<批号六位><ext>），边车按完成顺序写出。不可与 skip_unchanged 同时启用。
+	OrderedOutput *bool `json:"ordered_output"`
+	// Targets: 多目标语言扇出（如 ["zh","ja"]）；非空时每个文件按各语言各翻译一遍，写出 <stem>.<lang><ext>，
+	// 语言经模板变量 target_lang 注入。不可与 file_lang、stream_segment_records 同时启用；skip_unchanged 按各语言工件记录源摘要。
+	Targets []string `json:"targets"`
+	// RetryOn: 可重试的错误分类名（unknown/network/protocol/invariant/budget/io/blocked）；为空采用默认策略。
+	RetryOn []string `json:"retry_on"`
+	Logging Logging  `json:"logging"`
+	// Sidecar: JSONL 边车（<artifact>.jsonl）行结构；缺省与历史一致（file_id,from,to,src,dst,meta）。
+	Sidecar Sidecar `json:"sidecar"`
+	// FileLang: 逐文件目标语言（文件名规则 / 伴随 .lang 文件）；规则与伴随扩展名均为空时关闭。
+	FileLang FileLang `json:"file_lang"`
+
+	// HTTPDefaults: 各 HTTP 类 Provider（openai/gemini）共用的请求头/查询参数/超时/代理，
+	// 配置期合并进各自 options；Provider 自身的设置优先。
+	HTTPDefaults HTTPDefaults `json:"http_defaults"`
 
 	// 组件名选择（空则使用默认名）。
 	Components Components `json:"components"`
 
 	// LLM Provider 选择与定义。
-	LLM      string              `json:"llm"`
+	LLM string `json:"llm"`
+	// Model: 非空时覆盖活动 provider 的 options.model（合并进其 options，其余键不变），便于逐次运行切换模型。
+	Model    string              `json:"model"`
 	Provider map[string]Provider `json:"provider"`
 
 	// 各组件 Options 子树，原样 JSON 传入工厂。
 	Options Options `json:"options"`
+
+	// AllowUnknown: 解析配置时忽略未知字段（列出被忽略的键告警）而非报错，便于新旧版本二进制共用配置；
+	// 默认严格（CLI --lenient-config）。仅影响顶层配置解码，组件/Provider options 仍由各工厂严格校验。
+	AllowUnknown bool `json:"allow_unknown"`
 }
 
-// Logging: 仅保留日志等级可配置；输出路径与轮转策略为固定默认。
+// Logging: 日志等级与调试诊断可配置；输出路径与轮转策略为固定默认。
 type Logging struct {
 	Level string `json:"level"`
+	// GateSnapshotMs: debug 级别下记录限流剩余额度的间隔（毫秒）；0 表示默认 5000，<0 关闭。
+	GateSnapshotMs int `json:"gate_snapshot_ms"`
+	// DebugCaptureDir: 非空时逐批落盘原始请求/响应至 <dir>/<file>/<batch>/（api_key 已脱敏）；为空关闭。
+	DebugCaptureDir string `json:"debug_capture_dir"`
+}
+
+// Sidecar: JSONL 边车字段配置；指针为 nil 表示未设置（默认输出）。
+type Sidecar struct {
+	IncludeSrc  *bool `json:"include_src"`
+	IncludeMeta *bool `json:"include_meta"`
+	// ExtraFields: 追加字段（batch/model/attempts/src_path/out_path）。
+	ExtraFields []string `json:"extra_fields"`
+	// Dir: 边车集中写出的子目录（相对输出根，如 "qa"）；为空与主工件同路。
+	// fs writer 扁平模式下需配合 route 规则（如 {"match":"qa/**","dest":"qa"}）保留该目录。
+	Dir string `json:"dir"`
+	// Ext: 边车扩展名（以 "." 开头）；为空默认 ".jsonl"。
+	Ext string `json:"ext"`
+}
+
+// FileLang: 逐文件目标语言推导，结果作为 prompt 模板变量（默认 target_lang）按文件覆盖。
+type FileLang struct {
+	// Var: 模板变量名；为空默认 "target_lang"。
+	Var string `json:"var"`
+	// Rules: 按序匹配文件基名（path.Match 语法，如 "*.ja.srt"），首个命中生效。
+	Rules []FileLangRule `json:"rules"`
+	// CompanionExt: 伴随文件扩展名（如 ".lang"）；movie.srt 旁的 movie.lang 内容优先于 Rules。
+	CompanionExt string `json:"companion_ext"`
+}
+
+// FileLangRule: 文件名模式 → 目标语言。
+type FileLangRule struct {
+	Pattern string `json:"pattern"`
+	Lang    string `json:"lang"`
+}
+
+// HTTPDefaults: Provider 级 HTTP 默认值；零值/空表示不提供该项。
+type HTTPDefaults struct {
+	// Headers/Query: 按键合并进 options.extra_headers/extra_query，Provider 已有的同名键优先（请求头名大小写不敏感）。
+	Headers map[string]string `json:"headers"`
+	Query   map[string]string `json:"query"`
+	// TimeoutSeconds/Proxy: Provider 未设置 timeout_seconds/proxy（缺失、0 或空串）时填入。
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	Proxy          string `json:"proxy"`
 }
 
 // Components: 组件名选择（注册表中的实现名）。
@@ -57,6 +162,9 @@ type Provider struct {
 	Client  string          `json:"client"`
 	Options json.RawMessage `json:"options"`
 	Limits  Limits          `json:"limits"`
+	// Concurrency: 该 Provider 激活时的并发度（同时处理中的批数上限），取代全局 concurrency；
+	// auto_concurrency 下作为上限。0 表示沿用全局设置。
+	Concurrency int `json:"concurrency"`
 }
 
 // Limits: 限流配置（仅承载；执行位于 rate.Gate）。
@@ -64,4 +172,7 @@ type Limits struct {
 	RPM             int `json:"rpm"`
 	TPM             int `json:"tpm"`
 	MaxTokensPerReq int `json:"max_tokens_per_req"`
+	// MinSleepMs/PollStepMs: 闸门等待的最小睡眠与分片步长（毫秒）；0 表示默认（10ms/200ms）。
+	MinSleepMs int `json:"min_sleep_ms"`
+	PollStepMs int `json:"poll_step_ms"`
 }
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// unknownKeys 返回 raw（JSON 对象）中在结构体类型 t 上没有对应字段的键路径（点分，升序）。
+// 与 encoding/json 一致：按 json 标签（无标签时为字段名）不区分大小写匹配，展开匿名嵌入结构体；
+// 递归进入结构体字段与元素为结构体的映射（如 provider.<name>.），切片/json.RawMessage 等取值不检查（由各自的消费者校验）。
+func unknownKeys(raw []byte, t reflect.Type) []string {
+	var out []string
+	collectUnknown(raw, t, "", &out)
+	sort.Strings(out)
+	return out
+}
+
+func collectUnknown(raw []byte, t reflect.Type, prefix string, out *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var obj map[string]json.RawMessage
+	switch t.Kind() {
+	case reflect.Struct:
+	case reflect.Map:
+		et := t.Elem()
+		for et.Kind() == reflect.Pointer {
+			et = et.Elem()
+		}
+		if et.Kind() != reflect.Struct || json.Unmarshal(raw, &obj) != nil {
+			return
+		}
+		for k, v := range obj {
+			collectUnknown(v, et, prefix+k+".", out)
+		}
+		return
+	default:
+		return
+	}
+	if json.Unmarshal(raw, &obj) != nil {
+		return
+	}
+	for k, v := range obj {
+		f, ok := jsonField(t, k)
+		if !ok {
+			*out = append(*out, prefix+k)
+			continue
+		}
+		collectUnknown(v, f.Type, prefix+k+".", out)
+	}
+}
+
+// jsonField 在 t 中查找 JSON 键 key 对应的导出字段。
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			et := f.Type
+			if et.Kind() == reflect.Pointer {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				if sf, ok := jsonField(et, key); ok {
+					return sf, true
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,218 @@
+package diag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"llmspt/pkg/contract"
+)
+
+// CaptureClient 为 LLMClient 装饰器：逐批落盘原始请求与响应，便于复现特定文件/Provider 的异常输出。
+// 布局：<dir>/<fileID>/<batchIndex>/request.json 与 response.txt（失败时为 error.txt）；
+// 重试会覆盖同批文件，保留最后一次尝试。
+// request.json 记录批窗口、Prompt 载荷与 Provider 选项（api_key 与敏感请求头已脱敏）。
+// 落盘失败不影响调用结果（诊断旁路）。
+type CaptureClient struct {
+	next    contract.LLMClient
+	dir     string
+	client  string
+	options json.RawMessage
+}
+
+// captureStreamer 为实现 contract.LLMStreamer 的客户端保留流式能力：
+// 块原样转交调用方，同时累积写入 response.txt（流结束、出错或关闭时落盘）。
+type captureStreamer struct {
+	*CaptureClient
+	stream contract.LLMStreamer
+}
+
+// NewCaptureClient 包装 next；client/options 为 Provider 的实现名与原始选项，仅用于记录。
+// next 实现 contract.LLMStreamer 时返回值同样实现该接口，开启捕获不会关闭流式路径。
+func NewCaptureClient(next contract.LLMClient, dir, client string, options json.RawMessage) contract.LLMClient {
+	c := &CaptureClient{next: next, dir: dir, client: client, options: RedactOptions(options)}
+	if st, ok := next.(contract.LLMStreamer); ok {
+		return &captureStreamer{CaptureClient: c, stream: st}
+	}
+	return c
+}
+
+// IsCaptured 报告 c 是否已由 NewCaptureClient 包装。
+func IsCaptured(c contract.LLMClient) bool {
+	switch c.(type) {
+	case *CaptureClient, *captureStreamer:
+		return true
+	}
+	return false
+}
+
+type captureRequest struct {
+	FileID     string          `json:"file_id"`
+	BatchIndex int64           `json:"batch_index"`
+	TargetFrom int64           `json:"target_from"`
+	TargetTo   int64           `json:"target_to"`
+	Client     string          `json:"client,omitempty"`
+	Options    json.RawMessage `json:"options,omitempty"`
+	Prompt     any             `json:"prompt"`
+}
+
+// begin 写出 request.json 并返回该批的捕获目录。
+func (c *CaptureClient) begin(b contract.Batch, p contract.Prompt) string {
+	dir := filepath.Join(c.dir, captureSubdir(string(b.FileID)), fmt.Sprintf("%d", b.BatchIndex))
+	if err := os.MkdirAll(dir, 0o755); err == nil {
+		req := captureRequest{
+			FileID:     string(b.FileID),
+			BatchIndex: b.BatchIndex,
+			TargetFrom: int64(b.TargetFrom),
+			TargetTo:   int64(b.TargetTo),
+			Client:     c.client,
+			Options:    c.options,
+			Prompt:     p,
+		}
+		if data, err := json.MarshalIndent(req, "", "  "); err == nil {
+			_ = os.WriteFile(filepath.Join(dir, "request.json"), data, 0o644)
+		}
+	}
+	return dir
+}
+
+func captureError(dir string, err error) {
+	_ = os.WriteFile(filepath.Join(dir, "error.txt"), []byte(err.Error()+"\n"), 0o644)
+}
+
+// Invoke 先写出 request.json，再调用下游并写出 response.txt / error.txt。
+func (c *CaptureClient) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	dir := c.begin(b, p)
+	raw, err := c.next.Invoke(ctx, b, p)
+	if err != nil {
+		captureError(dir, err)
+		return raw, err
+	}
+	// 流式变体（Raw.Reader）在此物化以便落盘：捕获仅用于调试，不追求流式内存特性
+	if raw, err = raw.Materialize(); err != nil {
+		captureError(dir, err)
+		return raw, err
+	}
+	_ = os.WriteFile(filepath.Join(dir, "response.txt"), []byte(raw.Text), 0o644)
+	return raw, nil
+}
+
+// InvokeStream 先写出 request.json，再建立下游流；读取中的块同时累积到 response.txt。
+func (c *captureStreamer) InvokeStream(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.RawStream, error) {
+	dir := c.begin(b, p)
+	rs, err := c.stream.InvokeStream(ctx, b, p)
+	if err != nil {
+		captureError(dir, err)
+		return nil, err
+	}
+	return &captureStream{next: rs, dir: dir}, nil
+}
+
+// captureStream 转交下游块并累积文本；首次结束（完成、出错或关闭）时落盘，出错时另写 error.txt。
+type captureStream struct {
+	next    contract.RawStream
+	dir     string
+	buf     strings.Builder
+	flushed bool
+}
+
+func (s *captureStream) Next() (string, bool, error) {
+	chunk, done, err := s.next.Next()
+	s.buf.WriteString(chunk)
+	if err != nil {
+		s.flush()
+		captureError(s.dir, err)
+	} else if done {
+		s.flush()
+	}
+	return chunk, done, err
+}
+
+func (s *captureStream) Close() error {
+	s.flush()
+	return s.next.Close()
+}
+
+// Model 转交下游流报告的模型名（未实现 ModelReporter 时为空）。
+func (s *captureStream) Model() string {
+	if m, ok := s.next.(contract.ModelReporter); ok {
+		return m.Model()
+	}
+	return ""
+}
+
+func (s *captureStream) flush() {
+	if s.flushed {
+		return
+	}
+	s.flushed = true
+	_ = os.WriteFile(filepath.Join(s.dir, "response.txt"), []byte(s.buf.String()), 0o644)
+}
+
+// captureSubdir 将 FileID 映射为捕获目录下的安全相对路径：
+// 去除绝对前缀与盘符，".." 段替换为 "_"，避免写出到捕获目录之外。
+func captureSubdir(id string) string {
+	id = strings.ReplaceAll(id, "\\", "/")
+	var parts []string
+	for _, seg := range strings.Split(id, "/") {
+		switch seg {
+		case "", ".":
+			continue
+		case "..":
+			seg = "_"
+		}
+		parts = append(parts, strings.ReplaceAll(seg, ":", "_"))
+	}
+	if len(parts) == 0 {
+		return "_"
+	}
+	return filepath.Join(parts...)
+}
+
+// RedactOptions 返回脱敏后的 Provider 选项副本：
+// 键名含 key/token/secret/authorization/password（不区分大小写，*_env 除外）的非空字符串值替换为 "***"，
+// 递归作用于嵌套对象（如 extra_headers）。非对象或解析失败时返回 nil（宁缺勿泄露）。
+func RedactOptions(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil
+	}
+	redactMap(m)
+	out, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func redactMap(m map[string]any) {
+	for k, v := range m {
+		switch vv := v.(type) {
+		case map[string]any:
+			redactMap(vv)
+		case string:
+			if vv != "" && sensitiveKey(k) {
+				m[k] = "***"
+			}
+		}
+	}
+}
+
+func sensitiveKey(k string) bool {
+	k = strings.ToLower(k)
+	if strings.HasSuffix(k, "_env") {
+		return false
+	}
+	for _, s := range []string{"key", "token", "secret", "authorization", "password"} {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
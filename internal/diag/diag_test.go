@@ -2,11 +2,14 @@ package diag
 
 import (
     "context"
+    "encoding/json"
     "errors"
     "fmt"
+    "io"
     "io/fs"
     "net"
     "os"
+    "path/filepath"
     "runtime"
     "strings"
     "testing"
@@ -97,11 +100,60 @@ func TestRotatingFileEnsureAndRotate(t *testing.T) {
     }
 }
 
-// UT-DIAG-02: 指标计数
-func TestMetricsNoop(t *testing.T) {
+// UT-DIAG-02: 指标计数与错误摘要
+func TestMetricsCounts(t *testing.T) {
+	ResetMetrics()
+	t.Cleanup(ResetMetrics)
+	if ErrorSummary() != "" {
+		t.Fatalf("summary should be empty without errors")
+	}
 	IncOp("comp", "stage", "success")
-	IncError("comp", "code")
+	IncOp("comp", "stage", "success")
+	for i := 0; i < 12; i++ {
+		IncError("llm_client", "rate_limited")
+	}
+	for i := 0; i < 3; i++ {
+		IncError("llm_client", "network")
+	}
+	IncError("decoder", "protocol")
+	IncError("decoder", "protocol")
 	ObserveDuration("comp", "stage", 1)
+	if n := OpCounts()[OpKey{Comp: "comp", Stage: "stage", Result: "success"}]; n != 2 {
+		t.Fatalf("op count = %d", n)
+	}
+	if got, want := ErrorSummary(), "decoder: protocol=2; llm_client: network=3, rate_limited=12"; got != want {
+		t.Fatalf("summary = %q, want %q", got, want)
+	}
+	var sb strings.Builder
+	NewTerminal(&sb, true).RunFinish(false, time.Second)
+	if !strings.Contains(sb.String(), "| 错误 decoder: protocol=2;") {
+		t.Fatalf("run finish missing summary: %q", sb.String())
+	}
+}
+
+// 分布指标：最近秩分位数与单行摘要
+func TestHistogram(t *testing.T) {
+	ResetMetrics()
+	t.Cleanup(ResetMetrics)
+	if HistogramSummary() != "" || HistogramPercentiles(HistBatchTokens).N != 0 {
+		t.Fatalf("histogram should be empty")
+	}
+	for i := 100; i >= 1; i-- {
+		ObserveValue(HistBatchTokens, int64(i))
+	}
+	ObserveValue(HistBatchRecords, 7)
+	p := HistogramPercentiles(HistBatchTokens)
+	if p != (Percentiles{N: 100, P50: 50, P90: 90, P99: 99, Max: 100}) {
+		t.Fatalf("percentiles = %+v", p)
+	}
+	want := "batch_records: n=1 p50=7 p90=7 p99=7 max=7; batch_tokens: n=100 p50=50 p90=90 p99=99 max=100"
+	if got := HistogramSummary(); got != want {
+		t.Fatalf("summary = %q, want %q", got, want)
+	}
+	ResetMetrics()
+	if HistogramSummary() != "" {
+		t.Fatalf("reset should clear histograms")
+	}
 }
 
 // 补充覆盖: 错误分类
@@ -126,6 +178,13 @@ func TestClassify(t *testing.T) {
     if CodeUnknown != Classify(errors.New("other")) {
         t.Fatalf("未知分类错误")
     }
+    blocked := fmt.Errorf("blocked (SAFETY): %w: %w", contract.ErrResponseBlocked, contract.ErrInvalidInput)
+    if CodeBlocked != Classify(blocked) {
+        t.Fatalf("拦截分类错误")
+    }
+    if c, ok := ParseCode("Blocked"); !ok || c != CodeBlocked {
+        t.Fatalf("ParseCode blocked")
+    }
 }
 
 // 补充覆盖: Logger 基本流程
@@ -307,6 +366,37 @@ func TestLoggerWithSink(t *testing.T) {
     }
 }
 
+// 静态字段随每条事件输出于 "fields"；SetFields 拷贝入参
+func TestLoggerFields(t *testing.T) {
+	dir := t.TempDir()
+	l := &Logger{corrID: "req-42", level: Info, sink: NewRotatingFile(dir, 1<<20)}
+	fields := map[string]string{"trace_id": "abc", "svc": "api"}
+	l.SetFields(fields)
+	fields["svc"] = "mutated"
+	l.Start("comp", "msg").Finish("ok", 1)
+	l.Error("comp", "code", "msg", nil)
+	_ = l.Close()
+	b, err := os.ReadFile(filepath.Join(dir, "llmspt-current.txt"))
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want 3 events, got %q", b)
+	}
+	for _, line := range lines {
+		var ev Event
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		if ev.CorrID != "req-42" || ev.Fields["trace_id"] != "abc" || ev.Fields["svc"] != "api" {
+			t.Fatalf("unexpected event: %s", line)
+		}
+	}
+	var nl *Logger
+	nl.SetFields(fields)
+}
+
 // 覆盖 Level.String 与 parseLevel 分支，以及 lv<level 过滤
 func TestLoggerLevelsAndFilter(t *testing.T) {
     if Warn.String() != "warn" {
@@ -388,6 +478,69 @@ func TestTerminalNilReceiverNoop(t *testing.T) {
     tn.RunFinish(true, 0)
 }
 
+// 进度事件流：终端禁用时照常写出 NDJSON；字段与 schema 版本稳定；fd/路径目标解析
+func TestProgressStream(t *testing.T) {
+    ResetMetrics()
+    defer ResetMetrics()
+    var sb strings.Builder
+    term := NewTerminal(io.Discard, false)
+    term.SetProgress(NewProgressStream(&sb))
+    IncError("llm_client", "network")
+    term.RunStart(2, "mock")
+    term.FileStart("dir/a.srt", 0)
+    term.FileProgress(1, 3, 1)
+    term.FileFinish(false, 1500*time.Millisecond)
+    term.RunFinish(false, 2*time.Second)
+
+    lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+    if len(lines) != 5 {
+        t.Fatalf("expect 5 events, got %d: %q", len(lines), sb.String())
+    }
+    var evs []map[string]any
+    for _, l := range lines {
+        var ev map[string]any
+        if err := json.Unmarshal([]byte(l), &ev); err != nil {
+            t.Fatalf("invalid json %q: %v", l, err)
+        }
+        if ev["v"] != float64(ProgressVersion) || ev["ts"] == "" {
+            t.Fatalf("missing common fields: %v", ev)
+        }
+        evs = append(evs, ev)
+    }
+    want := []string{EventRunStart, EventFileStart, EventFileProgress, EventFileDone, EventRunDone}
+    for i, w := range want {
+        if evs[i]["event"] != w {
+            t.Fatalf("event %d = %v, want %s", i, evs[i]["event"], w)
+        }
+    }
+    if evs[2]["file"] != "dir/a.srt" || evs[2]["done"] != float64(1) || evs[2]["errors"] != float64(1) {
+        t.Fatalf("progress fields: %v", evs[2])
+    }
+    if evs[3]["ok"] != false || evs[3]["batches_total"] != float64(3) || evs[3]["duration_ms"] != float64(1500) {
+        t.Fatalf("file_done fields: %v", evs[3])
+    }
+    errs, _ := evs[4]["errors"].(map[string]any)
+    if evs[4]["files"] != float64(1) || errs["llm_client"] == nil {
+        t.Fatalf("run_done fields: %v", evs[4])
+    }
+
+    path := filepath.Join(t.TempDir(), "progress.ndjson")
+    ps, err := OpenProgressStream(path)
+    if err != nil {
+        t.Fatalf("open path: %v", err)
+    }
+    ps.Emit(EventRunStart, nil)
+    if err := ps.Close(); err != nil {
+        t.Fatalf("close: %v", err)
+    }
+    if b, _ := os.ReadFile(path); !strings.Contains(string(b), `"event":"run_start"`) {
+        t.Fatalf("file content: %q", b)
+    }
+    if _, err := OpenProgressStream("987654"); err == nil {
+        t.Fatalf("expect error for unopened fd")
+    }
+}
+
 // shortenBase 边界
 func TestShortenBaseEdge(t *testing.T) {
     _ = shortenBase("", 10) // 行为依赖 filepath.Base("") 返回 "."，不做强断言
@@ -395,3 +548,125 @@ func TestShortenBaseEdge(t *testing.T) {
         t.Fatalf("shortenBase max<=0 should be empty")
     }
 }
+
+type captureStubLLM struct{ err error }
+
+func (s captureStubLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+    if s.err != nil {
+        return contract.Raw{}, s.err
+    }
+    return contract.Raw{Text: "translated"}, nil
+}
+
+// 调试捕获：按 <dir>/<file>/<batch>/ 落盘请求与响应，选项中的密钥与敏感请求头被脱敏
+func TestCaptureClient(t *testing.T) {
+    dir := t.TempDir()
+    opts := []byte(`{"model":"m","api_key":"sk-secret","api_key_env":"OPENAI_API_KEY","extra_headers":{"Authorization":"Bearer sk-secret","X-Trace":"t"}}`)
+    c := NewCaptureClient(captureStubLLM{}, dir, "openai", opts)
+    b := contract.Batch{FileID: "sub/../a.srt", BatchIndex: 3, TargetFrom: 5, TargetTo: 9}
+    if _, err := c.Invoke(context.Background(), b, contract.TextPrompt("hello")); err != nil {
+        t.Fatalf("invoke: %v", err)
+    }
+    base := filepath.Join(dir, "sub", "_", "a.srt", "3")
+    req, err := os.ReadFile(filepath.Join(base, "request.json"))
+    if err != nil {
+        t.Fatalf("request.json: %v", err)
+    }
+    s := string(req)
+    if strings.Contains(s, "sk-secret") || !strings.Contains(s, "OPENAI_API_KEY") || !strings.Contains(s, `"X-Trace": "t"`) || !strings.Contains(s, "hello") {
+        t.Fatalf("request.json = %s", s)
+    }
+    if resp, _ := os.ReadFile(filepath.Join(base, "response.txt")); string(resp) != "translated" {
+        t.Fatalf("response.txt = %q", resp)
+    }
+
+    failing := NewCaptureClient(captureStubLLM{err: contract.ErrRateLimited}, dir, "openai", nil)
+    if _, err := failing.Invoke(context.Background(), contract.Batch{FileID: "b.srt"}, nil); !errors.Is(err, contract.ErrRateLimited) {
+        t.Fatalf("err = %v", err)
+    }
+    if _, err := os.Stat(filepath.Join(dir, "b.srt", "0", "error.txt")); err != nil {
+        t.Fatalf("error.txt: %v", err)
+    }
+}
+
+// captureStubStreamer 以两块返回 "trans" + "lated"
+type captureStubStreamer struct{ captureStubLLM }
+
+func (captureStubStreamer) InvokeStream(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.RawStream, error) {
+    return &captureChunks{chunks: []string{"trans", "lated"}}, nil
+}
+
+type captureChunks struct{ chunks []string }
+
+func (c *captureChunks) Next() (string, bool, error) {
+    chunk := c.chunks[0]
+    c.chunks = c.chunks[1:]
+    return chunk, len(c.chunks) == 0, nil
+}
+
+func (c *captureChunks) Close() error { return nil }
+
+// 调试捕获保留流式能力：块原样转交，结束时累积文本落盘为 response.txt
+func TestCaptureClientStream(t *testing.T) {
+    dir := t.TempDir()
+    if _, ok := NewCaptureClient(captureStubLLM{}, dir, "", nil).(contract.LLMStreamer); ok {
+        t.Fatalf("non-streaming client must not gain InvokeStream")
+    }
+    c := NewCaptureClient(captureStubStreamer{}, dir, "openai", nil)
+    if !IsCaptured(c) || IsCaptured(captureStubStreamer{}) {
+        t.Fatalf("IsCaptured mismatch")
+    }
+    st, ok := c.(contract.LLMStreamer)
+    if !ok {
+        t.Fatalf("streaming client lost InvokeStream")
+    }
+    rs, err := st.InvokeStream(context.Background(), contract.Batch{FileID: "a.srt", BatchIndex: 1}, contract.TextPrompt("hello"))
+    if err != nil {
+        t.Fatalf("invoke stream: %v", err)
+    }
+    var got strings.Builder
+    for {
+        chunk, done, err := rs.Next()
+        if err != nil {
+            t.Fatalf("next: %v", err)
+        }
+        got.WriteString(chunk)
+        if done {
+            break
+        }
+    }
+    rs.Close()
+    base := filepath.Join(dir, "a.srt", "1")
+    if resp, _ := os.ReadFile(filepath.Join(base, "response.txt")); got.String() != "translated" || string(resp) != "translated" {
+        t.Fatalf("got=%q response.txt=%q", got.String(), resp)
+    }
+    if _, err := os.Stat(filepath.Join(base, "request.json")); err != nil {
+        t.Fatalf("request.json: %v", err)
+    }
+}
+
+// sink 不可写时一次性降级到后备输出：仅告警一次，后续事件不再重试 sink
+func TestLoggerSinkFallbackOnce(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "logs")
+	if err := os.WriteFile(blocker, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	l := &Logger{corrID: "c", level: Info, sink: NewRotatingFile(blocker, 1<<20), fallback: &out}
+	for i := 0; i < 3; i++ {
+		l.Error("comp", "code", fmt.Sprintf("msg%d", i), nil)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	got := out.String()
+	if n := strings.Count(got, "logger sink error"); n != 1 {
+		t.Fatalf("want exactly one warning, got %d:\n%s", n, got)
+	}
+	for i := 0; i < 3; i++ {
+		if !strings.Contains(got, fmt.Sprintf(`"msg":"msg%d"`, i)) {
+			t.Fatalf("event %d missing from fallback:\n%s", i, got)
+		}
+	}
+}
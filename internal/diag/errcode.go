@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net"
 	"os"
+	"strings"
 	"time"
 
 	"llmspt/pkg/contract"
@@ -22,14 +23,35 @@ const (
 	CodeBudget    Code = "budget"
 	CodeCancel    Code = "cancel"
 	CodeIO        Code = "io"
+	// CodeBlocked: 上游内容安全/合规策略拦截（重试无益，默认不重试）。
+	CodeBlocked Code = "blocked"
+	// CodePanic: 组件在流水线 goroutine 内 panic，已恢复为错误（默认不重试）。
+	CodePanic Code = "panic"
 )
 
+// ErrPanic 流水线恢复组件 panic 后返回的错误哨兵（归类为 CodePanic）。
+var ErrPanic = errors.New("panic recovered")
+
+// ParseCode 将分类名（大小写不敏感）解析为已知 Code；未知名称返回 false。
+func ParseCode(name string) (Code, bool) {
+	switch c := Code(strings.ToLower(strings.TrimSpace(name))); c {
+	case CodeUnknown, CodeNetwork, CodeProtocol, CodeInvariant, CodeBudget, CodeCancel, CodeIO, CodeBlocked:
+		return c, true
+	default:
+		return "", false
+	}
+}
+
 // Classify 将错误归为最小分类。
 // 说明：仅依赖哨兵错误与标准库错误类型，不做字符串匹配。
 func Classify(err error) Code {
 	if err == nil {
 		return CodeUnknown
 	}
+	// 组件 panic：先于其他分类（恢复值本身可能是包装了哨兵的 error）
+	if errors.Is(err, ErrPanic) {
+		return CodePanic
+	}
 	// 取消/超时优先
 	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 		return CodeCancel
@@ -38,6 +60,10 @@ func Classify(err error) Code {
 	if errors.Is(err, contract.ErrBudgetExceeded) || errors.Is(err, contract.ErrRateLimited) {
 		return CodeBudget
 	}
+	// 内容拦截：先于协议/不变量判定（拦截错误可能同时包装 ErrResponseInvalid 或 ErrInvalidInput）
+	if errors.Is(err, contract.ErrResponseBlocked) {
+		return CodeBlocked
+	}
 	// 协议/解码
 	if errors.Is(err, contract.ErrResponseInvalid) {
 		return CodeProtocol
@@ -3,6 +3,7 @@ package diag
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
@@ -40,6 +41,10 @@ type Logger struct {
 	level  Level
 	sink   *RotatingFile
 	mu     sync.Mutex
+	// fields: 附加到每条事件的静态字段（如外部 trace_id）
+	fields map[string]string
+	// fallback: sink 缺失或失效后的后备输出；nil 表示 stderr。
+	fallback io.Writer
 }
 
 // NewLogger 通过配置的 level 初始化，并将日志写入默认路径 output/log，10m 轮转。
@@ -49,6 +54,21 @@ func NewLogger(corrID, level string) *Logger {
 	return &Logger{corrID: corrID, level: lvl, sink: sink}
 }
 
+// SetFields 设置附加到每条事件的静态字段（拷贝；输出于 "fields"），用于与外部服务的日志/追踪关联。
+// 应在开始记录前调用。
+func (l *Logger) SetFields(fields map[string]string) {
+	if l == nil {
+		return
+	}
+	cp := make(map[string]string, len(fields))
+	for k, v := range fields {
+		cp[k] = v
+	}
+	l.mu.Lock()
+	l.fields = cp
+	l.mu.Unlock()
+}
+
 func parseLevel(s string) Level {
 	switch strings.ToLower(s) {
 	case "debug":
@@ -76,6 +96,7 @@ type Event struct {
 	Batch  string            `json:"batch_id,omitempty"`
 	Msg    string            `json:"msg"`
 	KV     map[string]string `json:"kv,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 // log 以最小开销写出事件，遵循级别与采样。
@@ -87,18 +108,29 @@ func (l *Logger) log(lv Level, ev Event) {
 	ev.Level = lv.String()
 	ev.TS = NowUTC()
 	ev.CorrID = l.corrID
-	b, _ := json.Marshal(ev)
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if l.sink == nil {
-		// 后备：写 stderr
-		_, _ = os.Stderr.Write(append(b, '\n'))
-		return
+	ev.Fields = l.fields
+	b, _ := json.Marshal(ev)
+	if l.sink != nil {
+		err := l.sink.WriteLine(b)
+		if err == nil {
+			return
+		}
+		// 一次性降级：首次失败即弃用 sink（如工作目录只读），余下运行期间写后备输出，仅告警一次
+		_ = l.sink.Close()
+		l.sink = nil
+		fmt.Fprintf(l.out(), "logger sink error: %v (falling back to stderr for the rest of the run)\n", err)
 	}
-	if err := l.sink.WriteLine(b); err != nil {
-		fmt.Fprintf(os.Stderr, "logger sink error: %v\n", err)
-		_, _ = os.Stderr.Write(append(b, '\n'))
+	_, _ = l.out().Write(append(b, '\n'))
+}
+
+// out 返回后备输出（默认 stderr）。
+func (l *Logger) out() io.Writer {
+	if l.fallback != nil {
+		return l.fallback
 	}
+	return os.Stderr
 }
 
 // Start 记录 start 事件；返回计时器用于 Finish。
@@ -146,6 +178,16 @@ func (l *Logger) ErrorWithKV(comp, code, msg string, durSince *time.Time, fileID
     l.log(Error, Event{Comp: comp, Stage: "error", Code: code, DurMS: dur, Msg: msg, FileID: fileID, Batch: batch, KV: kv})
 }
 
+// InfoWithKV 记录一次性的 info 事件（无计时），支持 file_id/batch_id 与键值。
+func (l *Logger) InfoWithKV(comp, msg, fileID, batch string, kv map[string]string) {
+	l.log(Info, Event{Comp: comp, Stage: "finish", FileID: fileID, Batch: batch, Msg: msg, KV: kv})
+}
+
+// WarnWithKV 记录一次性的 warn 事件（无计时），用于不中断运行的异常情况。
+func (l *Logger) WarnWithKV(comp, msg, fileID, batch string, kv map[string]string) {
+	l.log(Warn, Event{Comp: comp, Stage: "finish", FileID: fileID, Batch: batch, Msg: msg, KV: kv})
+}
+
 // InfoFinish 在已有起点的情况下记录 finish。
 func (l *Logger) InfoFinish(comp, msg string, start time.Time, count int64) {
 	l.log(Info, Event{Comp: comp, Stage: "finish", DurMS: time.Since(start).Milliseconds(), Count: count, Msg: msg})
@@ -169,11 +211,29 @@ func (t *Timer) Finish(msg string, count int64) {
 	t.l.log(Info, Event{Comp: t.comp, Stage: "finish", DurMS: time.Since(t.t0).Milliseconds(), Count: count, FileID: t.fileID, Batch: t.batch, Msg: msg})
 }
 
+// FinishWithKV 记录 finish 并附带键值（例如实际服务的模型名）。
+func (t *Timer) FinishWithKV(msg string, count int64, kv map[string]string) {
+	if t == nil || t.l == nil {
+		return
+	}
+	t.l.log(Info, Event{Comp: t.comp, Stage: "finish", DurMS: time.Since(t.t0).Milliseconds(), Count: count, FileID: t.fileID, Batch: t.batch, Msg: msg, KV: kv})
+}
+
 // DebugStart 输出调试级别的"start"类事件（仅在 level=debug 时生效）。
 func (l *Logger) DebugStart(comp, msg, fileID, batch string, kv map[string]string) {
 	l.log(Debug, Event{Comp: comp, Stage: "start", FileID: fileID, Batch: batch, Msg: msg, KV: kv})
 }
 
+// DebugWithKV 记录一次性的调试事件（仅在 level=debug 时生效）。
+func (l *Logger) DebugWithKV(comp, msg, fileID, batch string, kv map[string]string) {
+	l.log(Debug, Event{Comp: comp, Stage: "finish", FileID: fileID, Batch: batch, Msg: msg, KV: kv})
+}
+
+// DebugEnabled 报告是否输出调试级别事件，便于调用方跳过昂贵的诊断采集。
+func (l *Logger) DebugEnabled() bool {
+	return l != nil && l.level <= Debug
+}
+
 // Close 关闭 logger 的 sink，释放文件句柄
 func (l *Logger) Close() error {
 	l.mu.Lock()
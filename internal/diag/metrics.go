@@ -1,22 +1,186 @@
 package diag
 
-// 最小指标接口（无导出实现，默认 no-op）。
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 最小指标接口（进程内计数，无外部导出）。
 // 名称参考 5.3.4：
 // - op_total{comp,stage,result}
 // - error_total{comp,code}
 // - op_duration_ms{comp,stage}
+// - 分布（直方图）：按名称记录观测值，运行结束时输出分位数（见 ObserveValue/HistogramSummary）
+
+// OpKey 操作计数的维度。
+type OpKey struct {
+	Comp, Stage, Result string
+}
+
+var (
+	metricsMu sync.Mutex
+	opCounts  = map[OpKey]int64{}
+	errCounts = map[string]map[string]int64{}
+	hists     = map[string][]int64{}
+)
+
+// 分布指标名称。
+const (
+	// HistBatchTokens 每个送入 LLM 的批的估算 token 数（含上下文记录，不含提示词固定开销）。
+	HistBatchTokens = "batch_tokens"
+	// HistBatchRecords 每个送入 LLM 的批的记录数（含上下文记录）。
+	HistBatchRecords = "batch_records"
+)
 
 // IncOp 累加操作计数（result=success|error）。
 func IncOp(comp, stage, result string) {
-	// 保持最小 no-op；适配层可通过替换实现导出。
+	metricsMu.Lock()
+	opCounts[OpKey{Comp: comp, Stage: stage, Result: result}]++
+	metricsMu.Unlock()
 }
 
 // IncError 按分类累加错误计数。
 func IncError(comp, code string) {
-	// 保持最小 no-op；适配层可通过替换实现导出。
+	metricsMu.Lock()
+	m := errCounts[comp]
+	if m == nil {
+		m = map[string]int64{}
+		errCounts[comp] = m
+	}
+	m[code]++
+	metricsMu.Unlock()
 }
 
 // ObserveDuration 记录阶段耗时（毫秒）。
 func ObserveDuration(comp, stage string, durMS int64) {
 	// 保持最小 no-op；适配层可通过替换实现导出。
 }
+
+// ObserveValue 向分布 name 追加一个观测值（保留全部样本，规模与批数同阶）。
+func ObserveValue(name string, v int64) {
+	metricsMu.Lock()
+	hists[name] = append(hists[name], v)
+	metricsMu.Unlock()
+}
+
+// Percentiles 分布 name 的分位数（最近秩法）。
+type Percentiles struct {
+	N             int
+	P50, P90, P99 int64
+	Max           int64
+}
+
+// HistogramPercentiles 返回分布 name 的样本数与 p50/p90/p99/max；无样本时 N=0。
+func HistogramPercentiles(name string) Percentiles {
+	metricsMu.Lock()
+	vs := append([]int64(nil), hists[name]...)
+	metricsMu.Unlock()
+	if len(vs) == 0 {
+		return Percentiles{}
+	}
+	sort.Slice(vs, func(i, j int) bool { return vs[i] < vs[j] })
+	rank := func(p int) int64 {
+		// 最近秩：ceil(p/100 × N)，1 起
+		k := (p*len(vs) + 99) / 100
+		if k < 1 {
+			k = 1
+		}
+		return vs[k-1]
+	}
+	return Percentiles{N: len(vs), P50: rank(50), P90: rank(90), P99: rank(99), Max: vs[len(vs)-1]}
+}
+
+// HistogramSummary 将全部分布渲染为单行摘要（按名称排序），
+// 如 "batch_records: n=12 p50=40 p90=52 p99=55 max=55; batch_tokens: n=12 p50=820 ..."；无样本时返回空串。
+func HistogramSummary() string {
+	metricsMu.Lock()
+	names := make([]string, 0, len(hists))
+	for name := range hists {
+		names = append(names, name)
+	}
+	metricsMu.Unlock()
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		p := HistogramPercentiles(name)
+		if p.N == 0 {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("; ")
+		}
+		fmt.Fprintf(&sb, "%s: n=%d p50=%d p90=%d p99=%d max=%d", name, p.N, p.P50, p.P90, p.P99, p.Max)
+	}
+	return sb.String()
+}
+
+// OpCounts 返回操作计数快照（拷贝）。
+func OpCounts() map[OpKey]int64 {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	out := make(map[OpKey]int64, len(opCounts))
+	for k, v := range opCounts {
+		out[k] = v
+	}
+	return out
+}
+
+// ErrorCounts 返回 comp→code→次数 的错误计数快照（拷贝）。
+func ErrorCounts() map[string]map[string]int64 {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	out := make(map[string]map[string]int64, len(errCounts))
+	for comp, m := range errCounts {
+		cp := make(map[string]int64, len(m))
+		for code, n := range m {
+			cp[code] = n
+		}
+		out[comp] = cp
+	}
+	return out
+}
+
+// ErrorSummary 将错误计数渲染为单行摘要（组件与错误码按名称排序），
+// 如 "decoder: protocol=2; llm_client: network=3, rate_limited=12"；无错误时返回空串。
+func ErrorSummary() string {
+	counts := ErrorCounts()
+	comps := make([]string, 0, len(counts))
+	for comp := range counts {
+		comps = append(comps, comp)
+	}
+	sort.Strings(comps)
+	var sb strings.Builder
+	for _, comp := range comps {
+		codes := make([]string, 0, len(counts[comp]))
+		for code := range counts[comp] {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		if sb.Len() > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(comp)
+		sb.WriteString(": ")
+		for i, code := range codes {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(code)
+			sb.WriteByte('=')
+			sb.WriteString(strconv.FormatInt(counts[comp][code], 10))
+		}
+	}
+	return sb.String()
+}
+
+// ResetMetrics 清零全部计数（每次运行开始时调用，亦供测试使用）。
+func ResetMetrics() {
+	metricsMu.Lock()
+	opCounts = map[OpKey]int64{}
+	errCounts = map[string]map[string]int64{}
+	hists = map[string][]int64{}
+	metricsMu.Unlock()
+}
@@ -0,0 +1,108 @@
+package diag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressVersion 进度事件流的 schema 版本（字段 "v"）。
+// 兼容约定：同一版本内只追加字段、不改名不删除；破坏性变更时递增。
+const ProgressVersion = 1
+
+// 进度事件类型（字段 "event"），与 Terminal 回调一一对应：
+//   - run_start:     concurrency, llm
+//   - file_start:    file, batches_total（流式分段模式下为 0，表示未知）
+//   - file_progress: file, done, total, errors
+//   - file_done:     file, ok, batches_total, duration_ms
+//   - run_done:      ok, files, duration_ms, errors（comp→code→次数，无错误时为空对象）
+//
+// 每行一个 JSON 对象，公共字段：v（版本）、event、ts（RFC3339Nano，UTC）。
+const (
+	EventRunStart     = "run_start"
+	EventFileStart    = "file_start"
+	EventFileProgress = "file_progress"
+	EventFileDone     = "file_done"
+	EventRunDone      = "run_done"
+)
+
+// ProgressStream 机器可读的进度事件流（NDJSON），供 TUI/CI 等包装工具消费。
+// 独立于日志与人类终端输出；并发安全；写失败后进入禁用态为 no-op。
+type ProgressStream struct {
+	mu     sync.Mutex
+	w      io.Writer
+	c      io.Closer
+	failed bool
+}
+
+// NewProgressStream 以 w 构造事件流（不负责关闭 w）。
+func NewProgressStream(w io.Writer) *ProgressStream {
+	return &ProgressStream{w: w}
+}
+
+// OpenProgressStream 按目标打开事件流：纯数字视为已打开的文件描述符（如 3），否则为文件路径（截断写入）。
+func OpenProgressStream(target string) (*ProgressStream, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil, fmt.Errorf("progress stream: empty target")
+	}
+	if fd, err := strconv.ParseUint(target, 10, 32); err == nil {
+		f := os.NewFile(uintptr(fd), "progress-fd-"+target)
+		if f == nil {
+			return nil, fmt.Errorf("progress stream: invalid fd %s", target)
+		}
+		if _, err := f.Stat(); err != nil {
+			return nil, fmt.Errorf("progress stream: fd %s: %w", target, err)
+		}
+		// 标准输出/错误不随事件流关闭
+		if fd <= 2 {
+			return &ProgressStream{w: f}, nil
+		}
+		return &ProgressStream{w: f, c: f}, nil
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("progress stream: %w", err)
+	}
+	return &ProgressStream{w: f, c: f}, nil
+}
+
+// Emit 写出一条事件；fields 为事件特有字段（不得覆盖公共字段）。
+func (p *ProgressStream) Emit(event string, fields map[string]any) {
+	if p == nil {
+		return
+	}
+	ev := make(map[string]any, len(fields)+3)
+	for k, v := range fields {
+		ev[k] = v
+	}
+	ev["v"] = ProgressVersion
+	ev["event"] = event
+	ev["ts"] = time.Now().UTC().Format(time.RFC3339Nano)
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed {
+		return
+	}
+	if _, err := p.w.Write(b); err != nil {
+		p.failed = true
+	}
+}
+
+// Close 关闭底层文件（由 OpenProgressStream 打开时）。
+func (p *ProgressStream) Close() error {
+	if p == nil || p.c == nil {
+		return nil
+	}
+	return p.c.Close()
+}
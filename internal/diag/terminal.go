@@ -35,9 +35,23 @@ type Terminal struct {
     lastLen   int
     lastFlush time.Time
 
+    // 机器可读事件流（可选）：与终端输出并行，不受 enabled 影响
+    events  *ProgressStream
+    curFile string // 完整 FileID
+    evTotal int    // 当前文件批次总数（以最近一次进度为准）
+    evFiles int    // 已完成文件数
+
     mu sync.Mutex
 }
 
+// SetProgress 挂接机器可读进度事件流（nil 解除）；终端禁用（--status=false）时事件照常写出。
+func (t *Terminal) SetProgress(p *ProgressStream) {
+    if t == nil { return }
+    t.mu.Lock()
+    t.events = p
+    t.mu.Unlock()
+}
+
 // 进程级终端（可选，全局设置后供 pipeline 旁路调用）。
 var (
     termMu sync.RWMutex
@@ -74,6 +88,8 @@ func (t *Terminal) RunStart(concurrency int, llm string) {
     if t == nil { return }
     t.mu.Lock()
     defer t.mu.Unlock()
+    t.evFiles = 0
+    t.events.Emit(EventRunStart, map[string]any{"concurrency": concurrency, "llm": llm})
     if !t.enabled { return }
     t.concurrency = concurrency
     t.llm = llm
@@ -92,6 +108,8 @@ func (t *Terminal) FileStart(fileID string, batchesTotal int) {
     if t == nil { return }
     t.mu.Lock()
     defer t.mu.Unlock()
+    t.curFile, t.evTotal = fileID, batchesTotal
+    t.events.Emit(EventFileStart, map[string]any{"file": fileID, "batches_total": batchesTotal})
     if !t.enabled { return }
     t.curFileID = shortenBase(fileID, 48)
     t.batchesTotal = batchesTotal
@@ -107,6 +125,8 @@ func (t *Terminal) FileProgress(done, total, errs int) {
     if t == nil { return }
     t.mu.Lock()
     defer t.mu.Unlock()
+    t.evTotal = total
+    t.events.Emit(EventFileProgress, map[string]any{"file": t.curFile, "done": done, "total": total, "errors": errs})
     if !t.enabled || !t.isTTY { return }
     // 合并状态
     t.batchesDone = done
@@ -129,6 +149,9 @@ func (t *Terminal) FileFinish(ok bool, dur time.Duration) {
     if t == nil { return }
     t.mu.Lock()
     defer t.mu.Unlock()
+    // 批次总数以最近一次进度为准（流式分段模式下 FileStart 时未知）
+    t.evFiles++
+    t.events.Emit(EventFileDone, map[string]any{"file": t.curFile, "ok": ok, "batches_total": t.evTotal, "duration_ms": dur.Milliseconds()})
     if !t.enabled { return }
     t.filesDone++
     status := "done"
@@ -145,17 +168,25 @@ func (t *Terminal) FileFinish(ok bool, dur time.Duration) {
         status, t.curFileID, t.batchesTotal, formatDur(dur)))
 }
 
-// RunFinish: 结束总览。
+// RunFinish: 结束总览（含错误计数摘要）。
 func (t *Terminal) RunFinish(ok bool, dur time.Duration) {
     if t == nil { return }
     t.mu.Lock()
     defer t.mu.Unlock()
+    if t.events != nil {
+        t.events.Emit(EventRunDone, map[string]any{"ok": ok, "files": t.evFiles, "duration_ms": dur.Milliseconds(), "errors": ErrorCounts()})
+    }
     if !t.enabled { return }
     tag := "ok"
     if !ok {
         tag = "fail"
     }
-    t.println(fmt.Sprintf("[%s] 全部完成 | 文件 %d | 总用时 %s", tag, t.filesDone, formatDur(dur)))
+    line := fmt.Sprintf("[%s] 全部完成 | 文件 %d | 总用时 %s", tag, t.filesDone, formatDur(dur))
+    // 附带按组件/错误码汇总的错误计数（无错误时省略）
+    if s := ErrorSummary(); s != "" {
+        line += " | 错误 " + s
+    }
+    t.println(line)
 }
 
 // 内部输出工具
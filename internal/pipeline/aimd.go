@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"llmspt/internal/diag"
+)
+
+// aimdLimiter 自适应并发控制器（AIMD：加性增、乘性减）。
+// - worker 池按上限预先启动，limiter 仅约束“同时处理中”的批数；
+// - 每个 worker 在领取批之前 acquire，处理完该批后 release；
+// - 收缩不打断在途调用：已持有名额的 worker 完成当前批后，超出新上限的部分在 acquire 处等待（自然排空）；
+// - 扩张时唤醒等待者，立即可领取新批。
+// 顺序门闩不受影响：结果仍按 BatchIndex 暂存与冲刷。
+type aimdLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	max    int
+	// succ: 自上次调整以来的成功次数；达到当前 limit（约一个“窗口”）后加 1
+	succ int
+	// ewma: 成功调用延迟的平滑基线（指数加权，单位 ms）
+	ewma   float64
+	logger *diag.Logger
+}
+
+// aimdSlowFactor: 单次延迟超过基线的倍数即视为拥塞信号。
+const aimdSlowFactor = 2.0
+
+func newAIMDLimiter(start, max int, logger *diag.Logger) *aimdLimiter {
+	if max < 1 {
+		max = 1
+	}
+	if start < 1 {
+		start = 1
+	}
+	if start > max {
+		start = max
+	}
+	a := &aimdLimiter{limit: start, max: max, logger: logger}
+	a.cond = sync.NewCond(&a.mu)
+	return a
+}
+
+// acquire 阻塞直至处理中数量低于当前上限。
+// 不感知 ctx：名额总会被在途 worker 释放，取消路径下 worker 仍需领取并排空剩余批。
+func (a *aimdLimiter) acquire() {
+	a.mu.Lock()
+	for a.active >= a.limit {
+		a.cond.Wait()
+	}
+	a.active++
+	a.mu.Unlock()
+}
+
+func (a *aimdLimiter) release() {
+	a.mu.Lock()
+	a.active--
+	a.mu.Unlock()
+	a.cond.Signal()
+}
+
+// observe 记录一次 LLM 调用结果并调整上限：
+// - 网络/限流类错误或延迟尖峰：上限减半（不低于 1）；
+// - 其他成功：累计满一个窗口后上限加 1（不超过 max）。
+// 非拥塞类错误（如协议/输入错误）与取消不参与调整。
+func (a *aimdLimiter) observe(lat time.Duration, err error) {
+	a.mu.Lock()
+	prev := a.limit
+	ms := float64(lat) / float64(time.Millisecond)
+	congested := false
+	if err != nil {
+		switch diag.Classify(err) {
+		case diag.CodeNetwork, diag.CodeBudget:
+			congested = true
+		default:
+			a.mu.Unlock()
+			return
+		}
+	} else if a.ewma > 0 && ms > a.ewma*aimdSlowFactor {
+		congested = true
+	}
+	if err == nil {
+		if a.ewma == 0 {
+			a.ewma = ms
+		} else {
+			a.ewma = 0.8*a.ewma + 0.2*ms
+		}
+	}
+	if congested {
+		a.limit /= 2
+		if a.limit < 1 {
+			a.limit = 1
+		}
+		a.succ = 0
+	} else {
+		a.succ++
+		if a.succ >= a.limit && a.limit < a.max {
+			a.limit++
+			a.succ = 0
+		}
+	}
+	cur := a.limit
+	a.mu.Unlock()
+	if cur > prev {
+		a.cond.Broadcast()
+	}
+	if cur != prev && a.logger.DebugEnabled() {
+		a.logger.DebugWithKV("pipeline", "concurrency", "", "", map[string]string{
+			"from": strconv.Itoa(prev),
+			"to":   strconv.Itoa(cur),
+		})
+	}
+}
+
+// current 返回当前并发上限（测试与诊断用）。
+func (a *aimdLimiter) current() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.limit
+}
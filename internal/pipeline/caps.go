@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"llmspt/pkg/contract"
+)
+
+// ErrCapReached 运行级上限（MaxBatches/MaxRecords）已用尽且仍有待调度的工作；
+// 已完成的工件保持有效，未调度的文件不再处理。
+var ErrCapReached = errors.New("run cap reached")
+
+// runCaps 运行级成本护栏：累计已调度的批数与目标记录数（上下文记录不计）。
+// 仅由逐文件串行的调度路径访问（perFile 与其生产者在文件结束前完成），无需加锁。
+type runCaps struct {
+	maxBatches, maxRecords int
+	batches, records       int
+}
+
+// reserve 尝试为 nb 个批、nr 条目标记录占用额度；任一上限将被超出时不占用并返回 ErrCapReached。
+func (c *runCaps) reserve(nb, nr int) error {
+	if c.maxBatches > 0 && c.batches+nb > c.maxBatches {
+		return fmt.Errorf("%w: max_batches=%d (scheduled %d, need %d more)", ErrCapReached, c.maxBatches, c.batches, nb)
+	}
+	if c.maxRecords > 0 && c.records+nr > c.maxRecords {
+		return fmt.Errorf("%w: max_records=%d (scheduled %d, need %d more)", ErrCapReached, c.maxRecords, c.records, nr)
+	}
+	c.batches += nb
+	c.records += nr
+	return nil
+}
+
+// targetRecords 统计批的目标记录数。
+func targetRecords(bs ...contract.Batch) int {
+	n := 0
+	for _, b := range bs {
+		n += int(b.TargetTo-b.TargetFrom) + 1
+	}
+	return n
+}
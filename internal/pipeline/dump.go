@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"llmspt/internal/prompt"
+	"llmspt/pkg/contract"
+)
+
+// BatchDump 单个批次的切分结果（调试用）。
+type BatchDump struct {
+	FileID     contract.FileID `json:"file_id"`
+	BatchIndex int64           `json:"batch_index"`
+	TargetFrom contract.Index  `json:"target_from"`
+	TargetTo   contract.Index  `json:"target_to"`
+	// Records: 批内全部记录索引（含左右上下文）。
+	Records []contract.Index `json:"records"`
+	// EstimatedTokens: 批内记录文本的近似 token 数（按 BytesPerToken 估算，不含固定提示词开销）。
+	EstimatedTokens int `json:"estimated_tokens"`
+}
+
+// BatchReport DumpBatches 的输出：有效批预算、固定提示词开销与全部批次。
+type BatchReport struct {
+	MaxTokens      int         `json:"max_tokens"`
+	BudgetTokens   int         `json:"budget_tokens"`
+	OverheadTokens int         `json:"overhead_tokens"`
+	Batches        []BatchDump `json:"batches"`
+}
+
+// DumpBatches 仅执行 Reader → Splitter → Batcher（与 Run 相同的批预算），
+// 将每个批次的边界与估算 token 以 JSON 写入 w；不调用 LLM、不写出工件。
+// 用于排查批边界处的译文问题以及调优 context_radius / max_tokens。
+func DumpBatches(ctx context.Context, comp Components, set Settings, w io.Writer) error {
+	if err := sanity(comp, set); err != nil {
+		return fmt.Errorf("sanity: %w", err)
+	}
+	effMax, overhead, err := batchBudget(comp, set)
+	if err != nil {
+		return err
+	}
+	est := prompt.MakeEstimator(set.BytesPerToken)
+	rep := BatchReport{MaxTokens: set.MaxTokens, BudgetTokens: effMax, OverheadTokens: overhead, Batches: []BatchDump{}}
+	err = comp.Reader.Iterate(ctx, set.Inputs, func(fid contract.FileID, rc io.ReadCloser) error {
+		defer rc.Close()
+		recs, err := comp.Splitter.Split(ctx, fid, rc)
+		if err != nil {
+			return fmt.Errorf("splitter split: %w", err)
+		}
+		batches, err := comp.Batcher.Make(ctx, recs, contract.BatchLimit{MaxTokens: effMax})
+		if err == nil {
+			err = validateBatches(batches)
+		}
+		if err != nil {
+			return fmt.Errorf("batcher make: %w", err)
+		}
+		for _, b := range batches {
+			d := BatchDump{FileID: b.FileID, BatchIndex: b.BatchIndex, TargetFrom: b.TargetFrom, TargetTo: b.TargetTo, Records: make([]contract.Index, 0, len(b.Records))}
+			for _, r := range b.Records {
+				d.Records = append(d.Records, r.Index)
+				d.EstimatedTokens += est(r.Text)
+			}
+			rep.Batches = append(rep.Batches, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reader iterate: %w", err)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(rep)
+}
@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"llmspt/pkg/contract"
+)
+
+// FileLangOptions 逐文件目标语言推导：结果以模板变量形式经 contract.ContextualPromptBuilder 传给 PromptBuilder。
+// 优先级：伴随文件 > Rules（按序首个命中）> 不覆盖（沿用 PromptBuilder 构造期变量）。
+type FileLangOptions struct {
+	// Var: 写入的模板变量名；为空默认 "target_lang"。
+	Var string
+	// Rules: 以 path.Match 语法匹配 FileID 的基名（如 "*.ja.srt"）。
+	Rules []FileLangRule
+	// CompanionExt: 非空时读取与源文件同目录、同主名的伴随文件（如 movie.srt → movie.lang），
+	// 其去除首尾空白后的内容即为目标语言；文件不存在或为空时回退 Rules。
+	// 仅对可在本地文件系统定位的 FileID 生效（如 fs Reader）。
+	CompanionExt string
+}
+
+// FileLangRule 文件名模式 → 目标语言。
+type FileLangRule struct {
+	Pattern string
+	Lang    string
+}
+
+const defaultFileLangVar = "target_lang"
+
+// validateFileLang 校验模式语法与取值。
+func validateFileLang(o FileLangOptions) error {
+	for i, r := range o.Rules {
+		if strings.TrimSpace(r.Lang) == "" {
+			return fmt.Errorf("pipeline: file lang rule %d: empty lang", i)
+		}
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			return fmt.Errorf("pipeline: file lang rule %d: pattern %q: %w", i, r.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// resolveFileVars 推导单个文件的模板变量；无命中返回 nil。
+func resolveFileVars(o FileLangOptions, fileID contract.FileID) (map[string]string, error) {
+	key := o.Var
+	if key == "" {
+		key = defaultFileLangVar
+	}
+	id := string(fileID)
+	if o.CompanionExt != "" {
+		ext := o.CompanionExt
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		data, err := os.ReadFile(strings.TrimSuffix(id, path.Ext(id)) + ext)
+		switch {
+		case err == nil:
+			if lang := strings.TrimSpace(string(data)); lang != "" {
+				return map[string]string{key: lang}, nil
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, fmt.Errorf("file lang companion: %w", err)
+		}
+	}
+	base := path.Base(id)
+	for _, r := range o.Rules {
+		if ok, _ := path.Match(r.Pattern, base); ok {
+			return map[string]string{key: r.Lang}, nil
+		}
+	}
+	return nil, nil
+}
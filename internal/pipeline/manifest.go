@@ -0,0 +1,122 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"llmspt/pkg/contract"
+)
+
+// 工件清单状态。
+const (
+	ManifestWritten = "written"
+	ManifestFailed  = "failed"
+	ManifestSkipped = "skipped"
+)
+
+// ManifestEntry 清单条目：一次 Writer.Write（或一次跳过）对应一条。
+type ManifestEntry struct {
+	Artifact contract.ArtifactID `json:"artifact"`
+	FileID   contract.FileID     `json:"file_id"`
+	Bytes    int64               `json:"bytes"`
+	Status   string              `json:"status"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// Manifest 运行结束时写出的工件清单（JSON）。条目按写出完成顺序排列。
+type Manifest struct {
+	Artifacts []ManifestEntry `json:"artifacts"`
+}
+
+// manifest 线程安全的清单收集器；Reader 逐文件回调，cur 标记当前源文件。
+type manifest struct {
+	mu  sync.Mutex
+	cur contract.FileID
+	m   Manifest
+}
+
+func (m *manifest) begin(fid contract.FileID) {
+	m.mu.Lock()
+	m.cur = fid
+	m.mu.Unlock()
+}
+
+func (m *manifest) add(e ManifestEntry) {
+	m.mu.Lock()
+	if e.FileID == "" {
+		e.FileID = m.cur
+	}
+	m.m.Artifacts = append(m.m.Artifacts, e)
+	m.mu.Unlock()
+}
+
+// write 以临时文件 + 重命名原子写出清单。
+func (m *manifest) write(path string) error {
+	m.mu.Lock()
+	out := m.m
+	m.mu.Unlock()
+	if out.Artifacts == nil {
+		out.Artifacts = []ManifestEntry{}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// manifestWriter 包装 Writer：统计写出字节数并记录每个工件的结果。
+// 实现 contract.SidecarWriter 并转发给被包装者，使边车在启用清单时仍按边车语义写出（如不加 BOM）。
+type manifestWriter struct {
+	next contract.Writer
+	m    *manifest
+}
+
+func (w *manifestWriter) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	return w.record(ctx, id, r, w.next.Write)
+}
+
+// WriteSidecar 实现 contract.SidecarWriter。
+func (w *manifestWriter) WriteSidecar(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	return w.record(ctx, id, r, func(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+		return writeSidecar(ctx, w.next, id, r)
+	})
+}
+
+// record 经 write 写出并记录清单条目。
+func (w *manifestWriter) record(ctx context.Context, id contract.ArtifactID, r io.Reader, write func(context.Context, contract.ArtifactID, io.Reader) error) error {
+	cr := &countingReader{r: r}
+	err := write(ctx, id, cr)
+	e := ManifestEntry{Artifact: id, Bytes: cr.n, Status: ManifestWritten}
+	if err != nil {
+		e.Status = ManifestFailed
+		e.Error = err.Error()
+	}
+	w.m.add(e)
+	return err
+}
+
+// countingReader 统计经由 Writer 读取（即写出）的字节数。
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,34 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+
+	"llmspt/internal/diag"
+)
+
+// panicError 将 recover() 得到的 panic 值转为包装 diag.ErrPanic 的错误，记录堆栈并计数。
+// 调用方须在 defer 的函数内直接调用 recover()，非 nil 时再交由本函数处理。
+func panicError(r any, where string, logger *diag.Logger, fileID, batch string) error {
+	if logger != nil {
+		logger.ErrorWithKV(where, string(diag.CodePanic), "panic recovered", nil, fileID, batch, map[string]string{
+			"panic": fmt.Sprint(r),
+			"stack": string(debug.Stack()),
+		})
+	}
+	diag.IncError(where, string(diag.CodePanic))
+	return fmt.Errorf("%w in %s: %v", diag.ErrPanic, where, r)
+}
+
+// safeWrite 执行一次 Writer 写出；Writer panic 时恢复为错误。无论 Writer 如何返回（含未读尽即返回），
+// 均关闭读端（错误为 nil 时后续写入得到 io.ErrClosedPipe），使仍在向管道写入的门闩立即失败而非永久阻塞。
+func safeWrite(write func() error, pr *io.PipeReader, logger *diag.Logger, fileID string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r, "writer", logger, fileID, "")
+		}
+		_ = pr.CloseWithError(err)
+	}()
+	return write()
+}
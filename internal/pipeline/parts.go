@@ -0,0 +1,20 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"llmspt/pkg/contract"
+)
+
+// partID 无序输出（Settings.OrderedOutput=false）下单批分片工件的 ID：在源文件扩展名前插入
+// ".part-<BatchIndex 六位补零>"，保留扩展名以便 Writer 按其路由，如 "a/movie.srt" → "a/movie.part-000003.srt"；
+// 无扩展名（含以 "." 开头的隐藏文件名）时直接追加后缀。按分片名排序即恢复文件内批次顺序。
+func partID(fileID contract.FileID, batchIndex int64) contract.ArtifactID {
+	id := string(fileID)
+	ext := filepath.Ext(id)
+	if ext == filepath.Base(id) {
+		ext = ""
+	}
+	return contract.ArtifactID(fmt.Sprintf("%s.part-%06d%s", id[:len(id)-len(ext)], batchIndex, ext))
+}
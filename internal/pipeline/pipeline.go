@@ -1,14 +1,21 @@
 package pipeline
 
 import (
+    "bytes"
     "context"
+    "crypto/sha256"
+    "encoding/hex"
     "errors"
     "fmt"
-    "encoding/json"
+    "hash"
     "io"
+    "strconv"
     "strings"
     "sync"
+    "sync/atomic"
     "time"
+    "unicode"
+    "unicode/utf8"
 
 	"llmspt/internal/diag"
 	"llmspt/internal/prompt"
@@ -42,13 +49,111 @@ type Settings struct {
 	MaxTokens     int
 	BytesPerToken int
 	// MaxRetries: LLM/Decoder 阶段最大重试次数（>=0）。0 表示不重试。
+	// 作为 MaxInvokeRetries/MaxDecodeRetries 未设置时的共同默认值。
 	MaxRetries int
+	// MaxInvokeRetries: LLM 调用失败（网络/限流等）的最大重试次数；nil 沿用 MaxRetries。
+	MaxInvokeRetries *int
+	// MaxDecodeRetries: 解码失败（响应无效，重新请求）的最大重试次数；nil 沿用 MaxRetries。
+	// 两类重试分别计数、互不占用额度。
+	MaxDecodeRetries *int
+	// OverheadTokens: >0 时作为固定提示词开销参与预算，跳过 PromptBuilder.EstimateOverheadTokens 的估算
+	// （自定义模板与估算器不一致时的逃生口）；0 使用估算值。
+	OverheadTokens int
+	// BudgetHeadroomPct: 扣除提示词开销后再按百分比预留的余量（0-99），为模型输出与估算误差留出空间。
+	BudgetHeadroomPct int
 	// 限流闸门（可选）：若非空，则在调用 LLM 前调用 Gate.Wait
 	Gate rate.Gate
 	// 限流分组键（外部根据 Provider 生成）
 	GateKey rate.LimitKey
+	// SkipUnchanged: 源内容摘要与上次成功写出时一致则跳过该文件（需 Writer 实现 contract.SourceHashStore）。
+	SkipUnchanged bool
+	// FailOnEmpty: 源文件为空或仅含空白（零记录）时以 ErrInvalidInput 失败，而非写出空工件。
+	// 被 Splitter 按扩展名过滤的非空文件不受影响。
+	FailOnEmpty bool
+	// RetryOn: 可重试的错误分类集合（同时作用于 LLM 调用与解码）；为空采用默认策略
+	// （调用：budget/network；解码：protocol）。取消（cancel）始终不重试。
+	RetryOn []diag.Code
+	// GateSnapshotEvery: debug 日志下周期性记录 Gate 剩余额度（comp=gate）的间隔；<=0 关闭。
+	// 仅当 Gate 实现 rate.Snapshoter 时生效。
+	GateSnapshotEvery time.Duration
+	// AutoConcurrency: 启用自适应并发（AIMD）。从 Concurrency 起步，依据 LLM 调用延迟与错误率
+	// 在 [1, MaxConcurrency] 内增减同时处理中的批数；关闭时使用固定 Concurrency。
+	AutoConcurrency bool
+	// MaxConcurrency: 自适应并发的上限；<=0 时取 4×Concurrency。
+	MaxConcurrency int
+	// ProviderConcurrency: 活动 Provider 的并发上限（config 的 provider.concurrency）；>0 时取代 Concurrency
+	// 作为并发度，并在自适应并发下作为上限（不超过 MaxConcurrency）。<=0 沿用全局设置。
+	ProviderConcurrency int
+	// DebugCaptureDir: 原始请求/响应捕获目录。LLM 尚未经 diag.NewCaptureClient 包装时由 Run 包装
+	// （不含 Provider 名与选项）；config.Assemble 已带 Provider 信息包装时不再二次包装。
+	DebugCaptureDir string
+	// ManifestPath: 非空时在运行结束写出 JSON 工件清单（工件 ID、源 FileID、字节数、状态），
+	// 失败运行同样写出已产生的条目，便于 CI 校验预期输出。
+	ManifestPath string
+	// Sidecar: JSONL 边车行结构；nil 使用 DefaultSidecarOptions（file_id,from,to,src,dst,meta）。
+	Sidecar *SidecarOptions
+	// SidecarDir: 边车集中写出的子目录（相对 Writer 输出根，如 "qa"），工件 ID 为 <dir>/<fileID><ext>；
+	// 为空时与主工件同路。Writer 为扁平模式时目录层级被丢弃，需配合其路由规则（如 fs 的 route）分流。
+	SidecarDir string
+	// SidecarExt: 边车扩展名（以 "." 开头）；为空默认 ".jsonl"。
+	SidecarExt string
+	// FileLang: 逐文件目标语言推导（文件名规则或伴随 .lang 文件）；nil 关闭。
+	// 需 PromptBuilder 实现 contract.ContextualPromptBuilder。
+	FileLang *FileLangOptions
+	// ContinueOnError: 单个文件失败时记录错误并继续处理后续文件；运行结束时以最后一个错误汇总返回。
+	// 取消（ctx）仍立即终止。
+	ContinueOnError bool
+	// MaxConsecutiveFailures: 连续失败文件数达到该值时立即以最后一个错误终止运行（即使 ContinueOnError）；
+	// 任一文件成功即清零。<=0 关闭。
+	MaxConsecutiveFailures int
+	// OnBlocked: 上游内容拦截（contract.ErrResponseBlocked）的运行级策略，优先于客户端自身的拦截策略：
+	//  - ""（默认）: 遵循客户端（报告 ErrSourcePassthrough 时透传，否则失败；拦截不参与默认重试）；
+	//  - "passthrough": 一律以原文透传该批（需 Decoder 实现 contract.PassthroughDecoder）；
+	//  - "fail": 一律失败且不重试（即使 RetryOn 含 blocked）。
+	OnBlocked string
+	// StreamSegmentRecords: >0 且 Splitter 实现 contract.StreamSplitter 时启用分段流式处理：
+	// 边读取边按该记录数分段切批并提交处理，超大输入（如 STDIN 流）无需整体读入内存。
+	// 段间不共享上下文窗口；计划批次数未知。与 SkipUnchanged 互斥（需先读完源计算摘要）。
+	StreamSegmentRecords int
+	// Locale: 目标区域设置（通常来自 LLM 客户端的 contract.LocaleHinter）；非空时作为模板变量 locale
+	// 注入每批 Prompt（逐文件变量同名时优先）。PromptBuilder 未实现 contract.ContextualPromptBuilder 时忽略。
+	Locale string
+	// MaxBatches / MaxRecords: 运行级成本护栏，分别限定本次运行调度的批数与目标记录数总量；<=0 不限制。
+	// 文件开始前按其全部批整体预留额度，不足则停止调度并以 ErrCapReached 结束（在途文件照常完成）；
+	// 分段流式模式下计划批数未知，逐批预留，额度耗尽时放弃当前文件（不写出半截工件）。
+	MaxBatches int
+	MaxRecords int
+	// RecordRanges: 仅翻译各文件中选中的记录区间（1 起的记录序号）；为空处理全部记录。
+	// 整文件照常切批后裁剪：与区间相交的目标部分保留为翻译批（区间外的相邻记录仍作为上下文送入模型），
+	// 其余部分不调用 LLM，由 Decoder 以原文透传（需 contract.PassthroughDecoder），输出仍为完整文件。
+	// 与 StreamSegmentRecords 互斥。
+	RecordRanges []RecordRange
+	// OrderedOutput: 同一文件的批按 BatchIndex 顺序装配并流式写入单一工件（nil 或 true，默认）。
+	// 显式为 false 时关闭顺序门闩：每批完成即单独装配并写出为分片工件（命名见 partID），
+	// 不再缓冲乱序到达的批；边车行按完成顺序写出。适用于不依赖顺序的下游（排序消费者、数据库等）。
+	// 与 SkipUnchanged 互斥（源摘要绑定于完整工件）。
+	OrderedOutput *bool
+	// ConcurrencyCappedFrom: config.Assemble 按限流额度（RPM）下调并发上限时的原值（WorkerLimit）；
+	// 仅记录，>0 时 Run 启动记录一条 info 日志，便于发现配置与限额不匹配。
+	ConcurrencyCappedFrom int
+	// Targets: 多目标语言扇出；非空时同一文件的切批结果依次按每种语言执行 Prompt→LLM→解码→装配→写出，
+	// 语言经模板变量 target_lang 注入（需 contract.ContextualPromptBuilder），工件与边车写至带语言后缀的 ID
+	// （见 targetID，如 movie.srt → movie.zh.srt）。语言间串行、语言内按并发度并行；成本护栏按语言数倍计。
+	// SkipUnchanged 的源摘要按各语言工件记录。与 FileLang、StreamSegmentRecords 互斥。
+	Targets []string
 }
 
+// orderedOutput 报告是否启用顺序门闩（OrderedOutput 未设置时为 true）。
+func (s Settings) orderedOutput() bool {
+	return s.OrderedOutput == nil || *s.OrderedOutput
+}
+
+// 内容拦截策略。
+const (
+	OnBlockedPassthrough = "passthrough"
+	OnBlockedFail        = "fail"
+)
+
 // Run 执行完整流水线：Reader → Splitter → Batcher → Prompt → (Gate) → LLM → Decoder → Assembler → Writer。
 // 约束：
 // - 所有组件均为同步实现；
@@ -60,27 +165,104 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
 	}
 
 	// 预估固定提示词开销（用于批量预算）
-	effMax := set.MaxTokens
-	if set.MaxTokens > 0 {
-		_, overhead := prompt.EffectiveMaxTokens(comp.PromptBuilder, set.BytesPerToken, set.MaxTokens)
-		effMax = set.MaxTokens - overhead
-		if effMax <= 0 {
-			return fmt.Errorf("%w: effective token budget <= 0 after overhead", contract.ErrBudgetExceeded)
+	effMax, _, err := batchBudget(comp, set)
+	if err != nil {
+		return err
+	}
+
+	sideOpts := DefaultSidecarOptions()
+	if set.Sidecar != nil {
+		sideOpts = *set.Sidecar
+	}
+	// 边车路径字段（src_path/out_path）的解析器：在 Writer 被清单包装前取得
+	srcRes, _ := comp.Reader.(contract.PathResolver)
+	outRes, _ := comp.Writer.(contract.PathResolver)
+
+	// 重试判定：配置集合优先，未配置时回退默认策略
+	var retryOn map[diag.Code]bool
+	if len(set.RetryOn) > 0 {
+		retryOn = make(map[diag.Code]bool, len(set.RetryOn))
+		for _, c := range set.RetryOn {
+			retryOn[c] = true
 		}
 	}
 
+	// 自适应并发：控制器跨文件共享，延迟基线与当前上限随 Run 持续演进
+	var lim *aimdLimiter
+	if set.AutoConcurrency {
+		lim = newAIMDLimiter(set.EffectiveConcurrency(), maxConcurrency(set), logger)
+	}
+
+	// 成本护栏：跨文件累计
+	caps := &runCaps{maxBatches: set.MaxBatches, maxRecords: set.MaxRecords}
+	// 批规模分布（diag 直方图）：与 Prompt 预算相同的估算系数
+	est := prompt.MakeEstimator(set.BytesPerToken)
+
 	// 顺序门闩：每个文件独立装配/写出。
 	// 由于 Reader/ Splitter 按文件遍历，我们逐文件处理，内部对批并发执行。
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-    perFile := func(fileID contract.FileID, recs []contract.Record) error {
-		// 切批
+	if set.DebugCaptureDir != "" && !diag.IsCaptured(comp.LLM) {
+		comp.LLM = diag.NewCaptureClient(comp.LLM, set.DebugCaptureDir, "", nil)
+	}
+	if set.DebugCaptureDir != "" && logger != nil {
+		logger.InfoWithKV("pipeline", "debug capture enabled", "", "", map[string]string{"dir": set.DebugCaptureDir})
+	}
+
+	if set.ConcurrencyCappedFrom > 0 && logger != nil {
+		logger.InfoWithKV("pipeline", "concurrency capped by gate", "", "", map[string]string{
+			"from": fmt.Sprintf("%d", set.ConcurrencyCappedFrom),
+			"to":   fmt.Sprintf("%d", set.WorkerLimit()),
+		})
+	}
+
+	// 限流诊断：仅 debug 级别启用，随 Run 结束（ctx 取消）退出
+	if sn, ok := set.Gate.(rate.Snapshoter); ok && set.GateSnapshotEvery > 0 && logger.DebugEnabled() {
+		go snapshotGate(ctx, sn, set.GateKey, set.GateSnapshotEvery, logger)
+	}
+
+    // split 非 nil 时为分段流式模式：recs 被忽略，记录由 split 逐条产出并按 StreamSegmentRecords 分段切批，
+    // 与 LLM 处理并行进行（见 streamBatches）；计划批次数未知，进度以已产出批数计。
+    perFile := func(fileID contract.FileID, recs []contract.Record, split func(emit func(contract.Record) error) error) error {
+		// 文件级取消：首错只终止本文件的在途批次，不波及后续文件（ContinueOnError）
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		// 逐文件模板变量（如目标语言）：为 nil 时走普通 Build
+		var fileVars map[string]string
+		if set.Locale != "" {
+			fileVars = map[string]string{"locale": set.Locale}
+		}
+		if set.FileLang != nil {
+			v, err := resolveFileVars(*set.FileLang, fileID)
+			if err != nil {
+				return err
+			}
+			if fileVars != nil && v != nil {
+				for k, val := range v {
+					fileVars[k] = val
+				}
+			} else if v != nil {
+				fileVars = v
+			}
+			if fileVars != nil && logger.DebugEnabled() {
+				logger.DebugWithKV("pipeline", "file vars", string(fileID), "", fileVars)
+			}
+		}
+		// 切批（流式模式由生产者分段进行）
+		var batches []contract.Batch
 		btimer := (*diag.Timer)(nil)
-		if logger != nil {
+		if logger != nil && split == nil {
 			btimer = logger.StartWith("batcher", "make", string(fileID), "")
 		}
-        batches, err := comp.Batcher.Make(ctx, recs, contract.BatchLimit{MaxTokens: effMax})
+		var err error
+		// 零记录时不调用 Batcher：无批可处理，各目标直接写出空工件
+		if split == nil && len(recs) > 0 {
+			batches, err = comp.Batcher.Make(ctx, recs, contract.BatchLimit{MaxTokens: effMax})
+			if err == nil {
+				err = validateBatches(batches)
+			}
+		}
         if err != nil {
 			if logger != nil {
 				code := diag.Classify(err)
@@ -97,9 +279,41 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
             btimer.Finish("make", int64(len(batches)))
             diag.IncOp("batcher", "finish", "success")
         }
+		// 记录区间：裁剪为翻译批 + 透传批；成本护栏只计翻译批
+		var pass map[int64]bool
+		charged := batches
+		if len(set.RecordRanges) > 0 && split == nil {
+			batches, pass = selectRanges(batches, recs, set.RecordRanges)
+			charged = make([]contract.Batch, 0, len(batches))
+			for _, b := range batches {
+				if !pass[b.BatchIndex] {
+					charged = append(charged, b)
+				}
+			}
+			if logger != nil {
+				logger.InfoWithKV("pipeline", "record ranges", string(fileID), "", map[string]string{
+					"translate_batches":   fmt.Sprintf("%d", len(charged)),
+					"passthrough_batches": fmt.Sprintf("%d", len(pass)),
+				})
+			}
+		}
+		// 多目标语言：每种语言各处理一遍全部批
+		nTargets := 1
+		if len(set.Targets) > 0 {
+			nTargets = len(set.Targets)
+		}
+		// 成本护栏：整文件预留（含全部目标语言），额度不足时不启动该文件
+		if split == nil {
+			if err := caps.reserve(len(charged)*nTargets, targetRecords(charged...)*nTargets); err != nil {
+				return err
+			}
+			for _, b := range charged {
+				observeBatch(b, est)
+			}
+		}
         // 终端提示：文件开始（即使 total=0 也要发）
         if t := diag.GetTerminal(); t != nil {
-            t.FileStart(string(fileID), len(batches))
+            t.FileStart(string(fileID), len(batches)*nTargets)
         }
         fileStart := time.Now()
         ok := false
@@ -108,51 +322,64 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
                 t.FileFinish(ok, time.Since(fileStart))
             }
         }()
-        if len(batches) == 0 {
-            // 没有目标，写空输出
-            atimer := (*diag.Timer)(nil)
-            if logger != nil {
-                atimer = logger.StartWith("assembler", "assemble", string(fileID), "")
-			}
-			r, aerr := comp.Assembler.Assemble(ctx, fileID, nil)
-			if aerr != nil {
-				if logger != nil {
-					code := diag.Classify(aerr)
-					logger.ErrorWith("assembler", string(code), "assemble failed", nil, string(fileID), "")
-					diag.IncOp("assembler", "error", "error")
-					if code != diag.CodeUnknown {
-						diag.IncError("assembler", string(code))
+        // 仅用于进度展示（不再用于退出条件）；多目标语言时各语言的批次累计计入同一文件
+        want := len(batches) * nTargets
+        doneCount := 0
+        errCount := 0
+        // runTarget 对同一组批执行 Prompt→LLM→解码→装配→写出，工件写至 out（单语言时即 fileID）；
+        // 装配仍以源 fileID 调用（spans 携带源 FileID）。fileVars 为该目标的模板变量（遮蔽文件级变量）。切批结果在各目标间共享。
+        runTarget := func(out contract.FileID, fileVars map[string]string) error {
+        if ff, ok := comp.Assembler.(contract.FileFinisher); ok {
+            // 本目标的批已全部装配（或已放弃）：释放装配器为该文件保留的跨批状态
+            defer ff.FinishFile(fileID)
+        }
+        if len(batches) == 0 && split == nil {
+            // 没有目标，写空输出（无序模式无分片可写，仅写空边车）
+            if set.orderedOutput() {
+	            atimer := (*diag.Timer)(nil)
+	            if logger != nil {
+	                atimer = logger.StartWith("assembler", "assemble", string(fileID), "")
+				}
+				r, aerr := comp.Assembler.Assemble(ctx, fileID, nil)
+				if aerr != nil {
+					if logger != nil {
+						code := diag.Classify(aerr)
+						logger.ErrorWith("assembler", string(code), "assemble failed", nil, string(fileID), "")
+						diag.IncOp("assembler", "error", "error")
+						if code != diag.CodeUnknown {
+							diag.IncError("assembler", string(code))
+						}
 					}
+					return fmt.Errorf("assembler assemble: %w", aerr)
+				}
+				if atimer != nil {
+					atimer.Finish("assemble", 0)
+					diag.IncOp("assembler", "finish", "success")
 				}
-				return fmt.Errorf("assembler assemble: %w", aerr)
-			}
-			if atimer != nil {
-				atimer.Finish("assemble", 0)
-				diag.IncOp("assembler", "finish", "success")
-			}
 
-			wtimer := (*diag.Timer)(nil)
-			if logger != nil {
-				wtimer = logger.StartWith("writer", "write", string(fileID), "")
-			}
-			werr := comp.Writer.Write(ctx, contract.ArtifactID(fileID), r)
-            if werr != nil {
-                if logger != nil {
-                    code := diag.Classify(werr)
-                    logger.ErrorWith("writer", string(code), "write failed", nil, string(fileID), "")
-                    diag.IncOp("writer", "error", "error")
-                    if code != diag.CodeUnknown {
-                        diag.IncError("writer", string(code))
-                    }
-                }
-                return fmt.Errorf("writer write: %w", werr)
-            }
-            if wtimer != nil {
-                wtimer.Finish("write", 0)
-                diag.IncOp("writer", "finish", "success")
+				wtimer := (*diag.Timer)(nil)
+				if logger != nil {
+					wtimer = logger.StartWith("writer", "write", string(fileID), "")
+				}
+				werr := comp.Writer.Write(ctx, contract.ArtifactID(out), r)
+	            if werr != nil {
+	                if logger != nil {
+	                    code := diag.Classify(werr)
+	                    logger.ErrorWith("writer", string(code), "write failed", nil, string(fileID), "")
+	                    diag.IncOp("writer", "error", "error")
+	                    if code != diag.CodeUnknown {
+	                        diag.IncError("writer", string(code))
+	                    }
+	                }
+	                return fmt.Errorf("writer write: %w", werr)
+	            }
+	            if wtimer != nil {
+	                wtimer.Finish("write", 0)
+	                diag.IncOp("writer", "finish", "success")
+	            }
             }
             // 写出空 JSONL 边车
-            if perr := comp.Writer.Write(ctx, contract.ArtifactID(string(fileID)+".jsonl"), strings.NewReader("")); perr != nil {
+            if perr := writeSidecar(ctx, comp.Writer, sidecarID(out, set.SidecarDir, set.SidecarExt), strings.NewReader("")); perr != nil {
                 if logger != nil {
                     code := diag.Classify(perr)
                     logger.ErrorWith("writer", string(code), "write failed", nil, string(fileID), "")
@@ -161,39 +388,121 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
                 }
                 return fmt.Errorf("writer write(jsonl): %w", perr)
             }
-            ok = true
             return nil
         }
 
 		// 并发 worker 处理 LLM/Decoder，结果通过门闩按序装配/写出
-		type job struct{ b contract.Batch }
+		// pass: 记录区间外的透传批，不构建 Prompt、不调用 LLM
+		type job struct {
+			b    contract.Batch
+			pass bool
+		}
 		type res struct {
 			idx   int64
+			b     contract.Batch
 			spans []contract.SpanResult
+			info  batchInfo
 			err   error
 		}
-		// 有界通道：默认 2×并发度，形成自然背压
-		inCh := make(chan job, set.Concurrency*2)
-		outCh := make(chan res, set.Concurrency*2)
+		// worker 数：固定并发度；自适应时按上限启动，由 limiter 约束同时处理中的批数
+		nWorkers := set.EffectiveConcurrency()
+		if lim != nil {
+			nWorkers = maxConcurrency(set)
+		}
+		if nWorkers < 1 {
+			nWorkers = 1
+		}
+		// 有界通道：默认 2×worker 数，形成自然背压
+		inCh := make(chan job, nWorkers*2)
+		outCh := make(chan res, nWorkers*2)
+
+		// 流式路径：客户端实现 LLMStreamer 且解码器实现 StreamDecoder 时边读边解码；
+		// 结果仍按批收集后进入顺序门闩（批内增量冲刷不在本路径范围内）。
+		streamer, _ := comp.LLM.(contract.LLMStreamer)
+		sdec, _ := comp.Decoder.(contract.StreamDecoder)
+		// rdec: 非流式调用返回携带 Reader 的 Raw 时使用（与 LLMStreamer 无关）
+		rdec := sdec
+		if streamer == nil || sdec == nil {
+			streamer, sdec = nil, nil
+		}
 
 		// workers
 		var wg sync.WaitGroup
 		worker := func() {
 			defer wg.Done()
-            for j := range inCh {
+			// 自适应并发：领取批之前占用名额，处理完成（进入下一轮或退出）时归还
+			held := false
+			defer func() {
+				if held {
+					lim.release()
+				}
+			}()
+			// 组件 panic：恢复为当前批的失败结果（触发首错取消），该 worker 退出，其余 worker 继续排空
+			var cur *job
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				if cur == nil {
+					// 领取批之前（非组件代码）的 panic 原样抛出
+					panic(r)
+				}
+				err := panicError(r, "worker", logger, string(fileID), fmt.Sprintf("%d", cur.b.BatchIndex))
+				outCh <- res{idx: cur.b.BatchIndex, b: cur.b, err: err}
+			}()
+			for {
+				cur = nil
+				if lim != nil {
+					if held {
+						lim.release()
+					}
+					lim.acquire()
+					held = true
+				}
+				j, ok := <-inCh
+				if !ok {
+					return
+				}
+				cur = &j
+				// 首错取消后不再调用组件：以取消错误快速排空余下的批（生产者已停止投递）
+				if err := ctx.Err(); err != nil {
+					outCh <- res{idx: j.b.BatchIndex, b: j.b, err: err}
+					continue
+				}
+				if j.pass {
+					tgt := contract.Target{FileID: j.b.FileID, From: j.b.TargetFrom, To: j.b.TargetTo}
+					spans, err := comp.Decoder.(contract.PassthroughDecoder).Passthrough(ctx, tgt, batchIndexMeta(j.b))
+					if err != nil && logger != nil {
+						code := diag.Classify(err)
+						logger.ErrorWith("decoder", string(code), "passthrough failed", nil, string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex))
+					}
+					outCh <- res{idx: j.b.BatchIndex, b: j.b, spans: spans, err: err}
+					continue
+				}
                 // 先构建 Prompt（一次性），再基于实际 Prompt 内容估算 tokens 更接近真实请求规模
                 var err error
                 var p contract.Prompt
                 pbtimer := (*diag.Timer)(nil)
+                // 目标区间对应的源序号范围（如 SRT 字幕序号 "412-430"），便于将批日志对应到源条目
+                seq := seqRange(j.b)
                 if logger != nil {
                     pbtimer = logger.StartWith("prompt_builder", "build", string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex))
-					logger.DebugStart("prompt_builder", "build_req", string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex), map[string]string{
+					kv := map[string]string{
 						"from":    fmt.Sprintf("%d", j.b.TargetFrom),
 						"to":      fmt.Sprintf("%d", j.b.TargetTo),
 						"records": fmt.Sprintf("%d", len(j.b.Records)),
-					})
+					}
+					if seq != "" {
+						kv["seq"] = seq
+					}
+					logger.DebugStart("prompt_builder", "build_req", string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex), kv)
+				}
+				if cp, ok := comp.PromptBuilder.(contract.ContextualPromptBuilder); ok && fileVars != nil {
+					p, err = cp.BuildWithVars(ctx, j.b, fileVars)
+				} else {
+					p, err = comp.PromptBuilder.Build(ctx, j.b)
 				}
-				p, err = comp.PromptBuilder.Build(ctx, j.b)
 				if err != nil {
 					if logger != nil {
 						code := diag.Classify(err)
@@ -203,7 +512,7 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
 							diag.IncError("prompt_builder", string(code))
 						}
 					}
-					outCh <- res{idx: j.b.BatchIndex, err: err}
+					outCh <- res{idx: j.b.BatchIndex, b: j.b, err: err}
 					continue
 				}
                 if pbtimer != nil {
@@ -221,8 +530,28 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
                 }
                 // 调用 LLM + 解码（带重试）
                 tgt := contract.Target{FileID: j.b.FileID, From: j.b.TargetFrom, To: j.b.TargetTo}
-				attempts := set.MaxRetries + 1
+				// 调用与解码重试分别计数；每次重试消耗其一，因而总尝试次数不超过两者之和 + 1
+				invokeRetries := retryLimit(set.MaxInvokeRetries, set.MaxRetries)
+				decodeRetries := retryLimit(set.MaxDecodeRetries, set.MaxRetries)
+				attempts := invokeRetries + decodeRetries + 1
+				invokeFails, decodeFails := 0, 0
 				var lastErr error
+				// passthrough: 以源文本生成同形结果并送出；返回 true 表示该批已完成，否则返回替代错误
+				passthrough := func(err error, attempt int) (bool, error) {
+					pd, ok := comp.Decoder.(contract.PassthroughDecoder)
+					if !ok {
+						return false, fmt.Errorf("%w: decoder does not support passthrough: %w", err, contract.ErrInvalidInput)
+					}
+					spans, perr := pd.Passthrough(ctx, tgt, batchIndexMeta(j.b))
+					if perr != nil {
+						return false, perr
+					}
+					if logger != nil {
+						logger.InfoWithKV("llm_client", "passthrough source", string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex), map[string]string{"reason": err.Error()})
+					}
+					outCh <- res{idx: j.b.BatchIndex, b: j.b, spans: spans, info: batchInfo{attempts: attempt + 1}}
+					return true, nil
+				}
 				for attempt := 0; attempt < attempts; attempt++ {
 					if set.Gate != nil {
 						if logger != nil {
@@ -249,15 +578,46 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
 					// LLM 调用
 					lltimer := (*diag.Timer)(nil)
 					if logger != nil {
-						lltimer = logger.StartWithKV("llm_client", "invoke", string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex), map[string]string{
+						kv := map[string]string{
 							"tokens":  fmt.Sprintf("%d", tokens),
 							"attempt": fmt.Sprintf("%d", attempt+1),
-						})
+						}
+						if seq != "" {
+							kv["seq"] = seq
+						}
+						lltimer = logger.StartWithKV("llm_client", "invoke", string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex), kv)
+					}
+					t0 := time.Now()
+					var raw contract.Raw
+					var rs contract.RawStream
+					if streamer != nil {
+						rs, err = streamer.InvokeStream(ctx, j.b, p)
+						if mr, ok := rs.(contract.ModelReporter); ok && err == nil {
+							raw.Model = mr.Model()
+						}
+					} else {
+						raw, err = comp.LLM.Invoke(ctx, j.b, p)
+					}
+					// 流式响应的耗时以读完（解码结束）为准，建立阶段只在失败时记录
+					streamed := rs != nil || raw.Reader != nil
+					if lim != nil && !streamed {
+						lim.observe(time.Since(t0), err)
+					}
+					// 上游拦截且要求原文透传：由解码器以源文本生成同形结果，不消耗重试
+					if err != nil && passthroughBlocked(err, set.OnBlocked) {
+						var done bool
+						if done, err = passthrough(err, attempt); done {
+							lastErr = nil
+							goto jobdone
+						}
 					}
-					raw, err := comp.LLM.Invoke(ctx, j.b, p)
 					if err != nil {
                     if logger != nil {
                         code := diag.Classify(err)
+                        msg := "invoke failed"
+                        if code == diag.CodeBlocked {
+                            msg = "content blocked"
+                        }
                         // 若为上游 HTTP 错误，附带状态码/消息
                         var kv map[string]string
                         var ue contract.UpstreamError
@@ -269,9 +629,11 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
                                 if len(m) > 200 { m = m[:200] }
                                 kv["upstream_msg"] = m
                             }
-                            logger.ErrorWithKV("llm_client", string(code), "invoke failed", nil, string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex), kv)
+                            logger.ErrorWithKV("llm_client", string(code), msg, nil, string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex), kv)
+                        } else if code == diag.CodeBlocked {
+                            logger.ErrorWithKV("llm_client", string(code), msg, nil, string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex), map[string]string{"reason": err.Error()})
                         } else {
-                            logger.ErrorWith("llm_client", string(code), "invoke failed", nil, string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex))
+                            logger.ErrorWith("llm_client", string(code), msg, nil, string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex))
                         }
                         diag.IncOp("llm_client", "error", "error")
                         if code != diag.CodeUnknown {
@@ -279,14 +641,19 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
                         }
                     }
 						lastErr = err
-						if attempt+1 < attempts && shouldRetryInvoke(err) {
+						if invokeFails < invokeRetries && shouldRetryInvoke(err, retryOn) && !(set.OnBlocked == OnBlockedFail && errors.Is(err, contract.ErrResponseBlocked)) {
+							invokeFails++
 							_ = sleepWithCtx(ctx, 200*time.Millisecond)
 							continue
 						}
 						break
 					}
 					if lltimer != nil {
-						lltimer.Finish("invoke", int64(tokens))
+						if raw.Model != "" {
+							lltimer.FinishWithKV("invoke", int64(tokens), map[string]string{"model": raw.Model})
+						} else {
+							lltimer.Finish("invoke", int64(tokens))
+						}
 						diag.IncOp("llm_client", "finish", "success")
 					}
 
@@ -296,23 +663,22 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
 					if logger != nil {
 						dctimer = logger.StartWith("decoder", "decode", string(j.b.FileID), fmt.Sprintf("%d", j.b.BatchIndex))
 					}
-                if dm, ok := comp.Decoder.(contract.DecoderWithMeta); ok {
-                    // 构建 idx→meta 只读映射（批窗口内可见），并回填源文本用于协议校验（如“原文回显”检测）
-                    idxMeta := make(contract.IndexMetaMap, len(j.b.Records))
-                    for _, r := range j.b.Records {
-                        // 拷贝一份 meta
-                        mm := make(contract.Meta, len(r.Meta)+1)
-                        for k, v := range r.Meta {
-                            mm[k] = v
-                        }
-                        // 附带源文本供解码器用于协议层校验（键名以 _ 前缀避免与业务字段冲突）
-                        mm["_src_text"] = r.Text
-                        idxMeta[r.Index] = mm
-                    }
-                    spans, err = dm.DecodeWithMeta(ctx, tgt, raw, idxMeta)
+                if rs != nil {
+                    spans, err = decodeStream(ctx, sdec, tgt, rs, batchIndexMeta(j.b))
                 } else {
-                    spans, err = comp.Decoder.Decode(ctx, tgt, raw)
+                    spans, err = decodeRaw(ctx, comp.Decoder, rdec, tgt, raw, batchIndexMeta(j.b))
                 }
+					if lim != nil && streamed {
+						lim.observe(time.Since(t0), err)
+					}
+					// 流式响应的拦截在读取途中才能发现：与调用期拦截同样按透传策略处理
+					if err != nil && streamed && passthroughBlocked(err, set.OnBlocked) {
+						var done bool
+						if done, err = passthrough(err, attempt); done {
+							lastErr = nil
+							goto jobdone
+						}
+					}
 					if err != nil {
 						if logger != nil {
 							code := diag.Classify(err)
@@ -323,7 +689,17 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
 							}
 						}
 						lastErr = err
-						if attempt+1 < attempts && shouldRetryDecode(err) {
+						// 流式读取中断（网络类，如块间空闲超时）或读取途中发现的拦截属于调用失败：按调用重试策略与预算处理
+						if code := diag.Classify(err); streamed && (code == diag.CodeNetwork || code == diag.CodeBlocked) {
+							if invokeFails < invokeRetries && shouldRetryInvoke(err, retryOn) && !(set.OnBlocked == OnBlockedFail && errors.Is(err, contract.ErrResponseBlocked)) {
+								invokeFails++
+								_ = sleepWithCtx(ctx, 200*time.Millisecond)
+								continue
+							}
+							break
+						}
+						if decodeFails < decodeRetries && shouldRetryDecode(err, retryOn) {
+							decodeFails++
 							_ = sleepWithCtx(ctx, 200*time.Millisecond)
 							continue
 						}
@@ -334,34 +710,64 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
 					}
 					diag.IncOp("decoder", "finish", "success")
 					// 成功
-					outCh <- res{idx: j.b.BatchIndex, spans: spans, err: nil}
+					outCh <- res{idx: j.b.BatchIndex, b: j.b, spans: spans, info: batchInfo{model: raw.Model, attempts: attempt + 1}, err: nil}
 					lastErr = nil
 					goto jobdone
 				}
 				// 最终失败
-				outCh <- res{idx: j.b.BatchIndex, err: lastErr}
+				outCh <- res{idx: j.b.BatchIndex, b: j.b, err: lastErr}
 			jobdone:
 				_ = 0
 			}
 		}
 
-		nWorkers := set.Concurrency
-		if nWorkers < 1 {
-			nWorkers = 1
-		}
 		wg.Add(nWorkers)
 		for i := 0; i < nWorkers; i++ {
 			go worker()
 		}
 
-		// 生产者
+		// 生产者：流式模式下边拆分边切批，produced 供进度展示；perr 在 close(inCh) 前写入，
+		// 经 workers 退出 → close(outCh) 建立先后关系，排空 outCh 后读取无竞争
+		var produced atomic.Int64
+		var perr error
 		go func() {
 			defer close(inCh)
-			for _, b := range batches {
+			// 拆分/切批组件 panic：恢复为生产者错误并取消（先于 close(inCh) 执行，保证 perr 的可见性）
+			defer func() {
+				if r := recover(); r != nil {
+					perr = panicError(r, "producer", logger, string(fileID), "")
+					cancel()
+				}
+			}()
+			push := func(b contract.Batch) error {
+				if split != nil {
+					if err := caps.reserve(1, targetRecords(b)); err != nil {
+						return err
+					}
+					observeBatch(b, est)
+				}
+				// 已取消即停止投递：select 在两路同时就绪时随机选择，缓冲未满时仍可能继续入队
+				if err := ctx.Err(); err != nil {
+					return err
+				}
 				select {
 				case <-ctx.Done():
+					return ctx.Err()
+				case inCh <- job{b: b, pass: pass[b.BatchIndex]}:
+					produced.Add(1)
+					return nil
+				}
+			}
+			if split != nil {
+				if err := streamBatches(ctx, comp.Batcher, contract.BatchLimit{MaxTokens: effMax}, set.StreamSegmentRecords, split, push); err != nil {
+					perr = err
+					cancel()
+				}
+				return
+			}
+			for _, b := range batches {
+				if push(b) != nil {
 					return
-				case inCh <- job{b: b}:
 				}
 			}
 		}()
@@ -369,35 +775,105 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
 		// 提交门闩：按 BatchIndex 连续冲刷；就绪即装配并通过管道流式写出
 		expect := int64(0)
 		buf := make(map[int64][]contract.SpanResult)
+		info := make(map[int64]batchInfo)
+		bats := make(map[int64]contract.Batch)
 		var firstErr error
 
-		// 建立管道，单次调用 Writer.Write，以流式方式落盘
-		pr, pw := io.Pipe()
+		// 顺序模式：建立管道，单次调用 Writer.Write，以流式方式落盘；
+		// 无序模式：每批单独写出分片工件，不建立主工件管道
+		ordered := set.orderedOutput()
+		var pw *io.PipeWriter
 		wdone := make(chan error, 1)
 		wtimer := (*diag.Timer)(nil)
-		if logger != nil {
-			wtimer = logger.StartWith("writer", "write", string(fileID), "")
+		if ordered {
+			var pr *io.PipeReader
+			pr, pw = io.Pipe()
+			if logger != nil {
+				wtimer = logger.StartWith("writer", "write", string(fileID), "")
+			}
+			go func() {
+				wdone <- safeWrite(func() error { return comp.Writer.Write(ctx, contract.ArtifactID(out), pr) }, pr, logger, string(fileID))
+			}()
+		} else {
+			wdone <- nil
 		}
-		go func() {
-			err := comp.Writer.Write(ctx, contract.ArtifactID(fileID), pr)
-			wdone <- err
-		}()
 
-		// JSONL 边车：并行写出至 <artifact>.jsonl
+		// JSONL 边车：并行写出至 <artifact>.jsonl（或 SidecarDir/SidecarExt 指定的位置）
 		prPairs, pwPairs := io.Pipe()
 		wdonePairs := make(chan error, 1)
 		go func() {
-			jsonlID := contract.ArtifactID(string(fileID) + ".jsonl")
-			err := comp.Writer.Write(ctx, jsonlID, prPairs)
-			wdonePairs <- err
+			wdonePairs <- safeWrite(func() error { return writeSidecar(ctx, comp.Writer, sidecarID(out, set.SidecarDir, set.SidecarExt), prPairs) }, prPairs, logger, string(fileID))
 		}()
-		enc := json.NewEncoder(pwPairs)
-		enc.SetEscapeHTML(false)
+		side := newSidecar(pwPairs, fileID, sideOpts)
+		side.resolvePaths(srcRes, outRes, contract.ArtifactID(out))
+		// 取消时立即关闭两条管道的写端：门闩阻塞在慢 Writer 上的写入随即失败，
+		// 聚合循环得以继续排空 outCh，Writer 的下一次读取得到取消错误后返回
+		stopPipes := context.AfterFunc(ctx, func() {
+			if pw != nil {
+				_ = pw.CloseWithError(ctx.Err())
+			}
+			_ = pwPairs.CloseWithError(ctx.Err())
+		})
 
-        // 仅用于进度展示（不再用于退出条件）
-        want := len(batches)
-        doneCount := 0
-        errCount := 0
+        // flush 装配并写出一批：先生成 JSONL 边车行（基于该批 Records 与 spans），再装配；
+        // 顺序模式追加到主工件管道，无序模式写出该批的分片工件。
+        // 管道因取消而关闭时以取消原因代替 io.ErrClosedPipe 返回。
+        flush := func(b contract.Batch, spans []contract.SpanResult, bi batchInfo) error {
+            if err := side.emit(b, spans, bi); err != nil {
+                if ctx.Err() != nil {
+                    return ctx.Err()
+                }
+                return err
+            }
+            bidx := fmt.Sprintf("%d", b.BatchIndex)
+            atimer := (*diag.Timer)(nil)
+            if logger != nil {
+                atimer = logger.StartWith("assembler", "assemble", string(fileID), bidx)
+            }
+            rd, aerr := comp.Assembler.Assemble(ctx, fileID, spans)
+            if aerr != nil {
+                if logger != nil {
+                    code := diag.Classify(aerr)
+                    logger.ErrorWith("assembler", string(code), "assemble failed", nil, string(fileID), bidx)
+                    diag.IncOp("assembler", "error", "error")
+                    if code != diag.CodeUnknown {
+                        diag.IncError("assembler", string(code))
+                    }
+                }
+                return aerr
+            }
+            if atimer != nil {
+                atimer.Finish("assemble", int64(len(spans)))
+                diag.IncOp("assembler", "finish", "success")
+            }
+            if ordered {
+                _, err := io.Copy(pw, rd)
+                if err != nil && ctx.Err() != nil {
+                    return ctx.Err()
+                }
+                return err
+            }
+            ptimer := (*diag.Timer)(nil)
+            if logger != nil {
+                ptimer = logger.StartWith("writer", "write", string(fileID), bidx)
+            }
+            if err := comp.Writer.Write(ctx, partID(out, b.BatchIndex), rd); err != nil {
+                if logger != nil {
+                    code := diag.Classify(err)
+                    logger.ErrorWith("writer", string(code), "write part failed", nil, string(fileID), bidx)
+                    diag.IncOp("writer", "error", "error")
+                    if code != diag.CodeUnknown {
+                        diag.IncError("writer", string(code))
+                    }
+                }
+                return fmt.Errorf("writer write(part): %w", err)
+            }
+            if ptimer != nil {
+                ptimer.Finish("write", 1)
+                diag.IncOp("writer", "finish", "success")
+            }
+            return nil
+        }
 
         // 由 workers 生命周期决定 outCh 关闭，避免基于固定计数阻塞
         go func() {
@@ -412,6 +888,9 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
                 errCount++
             }
             if t := diag.GetTerminal(); t != nil {
+                if split != nil {
+                    want = int(produced.Load())
+                }
                 t.FileProgress(doneCount, want, errCount)
             }
             if r.err != nil && firstErr == nil {
@@ -419,98 +898,49 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
                 cancel()
                 // 不立刻 return，继续排空 outCh 以便 orderly 结束
             }
-            if r.err == nil {
+            if r.err == nil && !ordered {
+                // 无序模式：完成即写出，不进入门闩缓冲；首错后不再写出新的分片
+                if firstErr == nil {
+                    if err := flush(r.b, r.spans, r.info); err != nil {
+                        firstErr = err
+                        cancel()
+                    }
+                }
+                continue
+            }
+            if r.err == nil && firstErr == nil {
+                // 首错后不再冲刷：工件终将以错误关闭，继续写出只会拖慢收敛
                 buf[r.idx] = r.spans
+                info[r.idx] = r.info
+                bats[r.idx] = r.b
                 for {
                     spans, ok := buf[expect]
                     if !ok {
                         break
                     }
-                    // 先生成 JSONL 边车（基于当前批 Records 与 spans）
-                    {
-                        recs := batches[expect].Records
-                        // 移动指针，减少重复扫描
-                        pos := 0
-                        if len(spans) > 0 {
-                            f0 := spans[0].From
-                            for pos < len(recs) && recs[pos].Index < f0 {
-                                pos++
-                            }
-                        }
-                        for _, sp := range spans {
-                            for pos < len(recs) && recs[pos].Index < sp.From {
-                                pos++
-                            }
-                            var sb strings.Builder
-                            j := pos
-                            firstTok := true
-                            for j < len(recs) && recs[j].Index <= sp.To {
-                                if !firstTok { sb.WriteByte('\n') } else { firstTok = false }
-                                sb.WriteString(recs[j].Text)
-                                j++
-                            }
-                            dst := sp.Output
-                            if sp.Meta != nil {
-                                if v := sp.Meta["dst_text"]; strings.TrimSpace(v) != "" {
-                                    dst = v
-                                }
-                            }
-                            row := struct {
-                                FileID string        `json:"file_id"`
-                                From   int64         `json:"from"`
-                                To     int64         `json:"to"`
-                                Src    string        `json:"src"`
-                                Dst    string        `json:"dst"`
-                                Meta   contract.Meta `json:"meta,omitempty"`
-                            }{
-                                FileID: string(fileID),
-                                From:   int64(sp.From),
-                                To:     int64(sp.To),
-                                Src:    sb.String(),
-                                Dst:    dst,
-                                Meta:   sp.Meta,
-                            }
-                            if err := enc.Encode(&row); err != nil && firstErr == nil {
-                                firstErr = err
-                                cancel()
-                                break
-                            }
+                    if err := flush(bats[expect], spans, info[expect]); err != nil {
+                        if firstErr == nil {
+                            firstErr = err
                         }
-                    }
-                    atimer := (*diag.Timer)(nil)
-                    if logger != nil {
-                        atimer = logger.StartWith("assembler", "assemble", string(fileID), fmt.Sprintf("%d", expect))
-                    }
-                    rd, aerr := comp.Assembler.Assemble(ctx, fileID, spans)
-                    if aerr != nil {
-                        if logger != nil {
-                            code := diag.Classify(aerr)
-                            logger.ErrorWith("assembler", string(code), "assemble failed", nil, string(fileID), fmt.Sprintf("%d", expect))
-                            diag.IncOp("assembler", "error", "error")
-                            if code != diag.CodeUnknown {
-                                diag.IncError("assembler", string(code))
-                            }
-                        }
-                        firstErr = aerr
-                        cancel()
-                        break
-                    }
-                    if atimer != nil {
-                        atimer.Finish("assemble", int64(len(spans)))
-                        diag.IncOp("assembler", "finish", "success")
-                    }
-                    if _, cerr := io.Copy(pw, rd); cerr != nil && firstErr == nil {
-                        firstErr = cerr
                         cancel()
                         break
                     }
                     delete(buf, expect)
+                    delete(info, expect)
+                    delete(bats, expect)
                     expect++
                 }
             }
         }
 
-        if firstErr != nil { _ = pw.CloseWithError(firstErr) } else { _ = pw.Close() }
+        stopPipes()
+        // 生产者错误（拆分/切批）优先于其触发取消后 worker 报告的取消错误
+        if perr != nil && (firstErr == nil || errors.Is(firstErr, context.Canceled)) {
+            firstErr = perr
+        }
+        if pw != nil {
+            if firstErr != nil { _ = pw.CloseWithError(firstErr) } else { _ = pw.Close() }
+        }
         if firstErr != nil { _ = pwPairs.CloseWithError(firstErr) } else { _ = pwPairs.Close() }
         werr := <-wdone
         werrPairs := <-wdonePairs
@@ -540,23 +970,100 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
         if wtimer != nil {
             wtimer.Finish("write", 1)
             diag.IncOp("writer", "finish", "success")
+        }
+            return nil
+        }
+        if len(set.Targets) == 0 {
+            if err := runTarget(fileID, fileVars); err != nil {
+                return err
+            }
+        }
+        // 多目标语言：按序逐语言处理（并发度仍由单个目标内的 worker 决定），任一语言失败即终止该文件
+        for _, lang := range set.Targets {
+            vars := make(map[string]string, len(fileVars)+1)
+            for k, v := range fileVars {
+                vars[k] = v
+            }
+            vars[defaultFileLangVar] = lang
+            if logger != nil {
+                logger.InfoWithKV("pipeline", "target", string(fileID), "", map[string]string{"lang": lang})
+            }
+            if err := runTarget(targetID(fileID, lang), vars); err != nil {
+                return fmt.Errorf("target %s: %w", lang, err)
+            }
         }
         ok = true
         return nil
     }
 
+	// 跳过未变更（可选）：需要 Writer 支持源摘要持久化
+	var store contract.SourceHashStore
+	if set.SkipUnchanged {
+		store = comp.Writer.(contract.SourceHashStore)
+	}
+
+	// 延迟落盘（可选）：在包装前取得原始 Writer 的 Flusher
+	flusher, _ := comp.Writer.(contract.Flusher)
+
+	// 工件清单（可选）：包装 Writer 统计字节与结果；perFile 在调用时读取 comp.Writer，因此此处替换即生效
+	var man *manifest
+	if set.ManifestPath != "" {
+		man = &manifest{}
+		comp.Writer = &manifestWriter{next: comp.Writer, m: man}
+	}
+
 	// Reader 遍历文件；逐文件拆分
 	rtimer := (*diag.Timer)(nil)
 	if logger != nil {
 		rtimer = logger.Start("reader", "iterate")
 	}
-    err := comp.Reader.Iterate(ctx, set.Inputs, func(fid contract.FileID, rc io.ReadCloser) error {
+    handle := func(fid contract.FileID, rc io.ReadCloser) error {
         defer rc.Close()
+        if man != nil {
+            man.begin(fid)
+        }
+        // 跳过未变更：边读边计算源内容摘要（sha256）
+        var src io.Reader = rc
+        var hasher hash.Hash
+        if store != nil {
+            hasher = sha256.New()
+            src = io.TeeReader(rc, hasher)
+        }
+        var blank *blankWriter
+        if set.FailOnEmpty {
+            blank = &blankWriter{}
+            src = io.TeeReader(src, blank)
+        }
+        // 分段流式：拆分与切批在 perFile 的生产者中进行；零记录时仍执行空源检查
+        if ss, ok := comp.Splitter.(contract.StreamSplitter); ok && set.StreamSegmentRecords > 0 {
+            split := func(emit func(contract.Record) error) error {
+                n := 0
+                if err := ss.SplitStream(ctx, fid, src, func(r contract.Record) error {
+                    n++
+                    return emit(r)
+                }); err != nil {
+                    return err
+                }
+                if blank != nil && n == 0 {
+                    if _, err := io.Copy(io.Discard, src); err != nil {
+                        return fmt.Errorf("source read: %w", err)
+                    }
+                    if blank.blank() {
+                        return fmt.Errorf("empty source %s: %w", fid, contract.ErrInvalidInput)
+                    }
+                }
+                return nil
+            }
+            if err := perFile(fid, nil, split); err != nil {
+                return fmt.Errorf("perFile: %w", err)
+            }
+            return nil
+        }
         stimer := (*diag.Timer)(nil)
         if logger != nil {
             stimer = logger.StartWith("splitter", "split", string(fid), "")
         }
-		recs, err := comp.Splitter.Split(ctx, fid, rc)
+		recs, err := comp.Splitter.Split(ctx, fid, src)
 		if err != nil {
 			if logger != nil {
 				code := diag.Classify(err)
@@ -572,76 +1079,125 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
 			stimer.Finish("split", int64(len(recs)))
 			diag.IncOp("splitter", "finish", "success")
 		}
-        if len(recs) == 0 {
-            // 没有可处理内容：按空输出
-            if t := diag.GetTerminal(); t != nil {
-                t.FileStart(string(fid), 0)
+		// 空源快速失败：零记录且源内容仅含空白
+		if blank != nil && len(recs) == 0 {
+			if _, err := io.Copy(io.Discard, src); err != nil {
+				return fmt.Errorf("source read: %w", err)
+			}
+			if blank.blank() {
+				err := fmt.Errorf("empty source %s: %w", fid, contract.ErrInvalidInput)
+				if logger != nil {
+					logger.ErrorWith("pipeline", string(diag.Classify(err)), "empty source", nil, string(fid), "")
+				}
+				return err
+			}
+		}
+        // 源摘要比对：与上次成功写出时记录的摘要一致则跳过该文件；
+        // 摘要按输出工件记录（多目标语言时每种语言的工件各一份），全部一致才跳过
+        srcHash := ""
+        arts := []contract.ArtifactID{contract.ArtifactID(fid)}
+        if len(set.Targets) > 0 {
+            arts = arts[:0]
+            for _, lang := range set.Targets {
+                arts = append(arts, contract.ArtifactID(targetID(fid, lang)))
             }
-            fileStart := time.Now()
-            ok := false
-            defer func() {
-                if t := diag.GetTerminal(); t != nil {
-                    t.FileFinish(ok, time.Since(fileStart))
-                }
-            }()
-            atimer := (*diag.Timer)(nil)
-            if logger != nil {
-                atimer = logger.StartWith("assembler", "assemble", string(fid), "")
+        }
+        if hasher != nil {
+            // Splitter 可能未读完（如扩展名过滤），补齐剩余字节以得到完整摘要
+            if _, err := io.Copy(io.Discard, src); err != nil {
+                return fmt.Errorf("source hash: %w", err)
             }
-            r, aerr := comp.Assembler.Assemble(ctx, fid, nil)
-            if aerr != nil {
-                if logger != nil {
-                    code := diag.Classify(aerr)
-                    logger.ErrorWith("assembler", string(code), "assemble failed", nil, string(fid), "")
-                    diag.IncOp("assembler", "error", "error")
-                    if code != diag.CodeUnknown {
-                        diag.IncError("assembler", string(code))
-                    }
+            srcHash = hex.EncodeToString(hasher.Sum(nil))
+            skip := true
+            for _, id := range arts {
+                prev, found, lerr := store.LoadSourceHash(ctx, id)
+                if lerr != nil {
+                    return fmt.Errorf("writer load source hash: %w", lerr)
+                }
+                if !found || prev != srcHash {
+                    skip = false
+                    break
                 }
-                return fmt.Errorf("assembler assemble: %w", aerr)
-            }
-            if atimer != nil {
-                atimer.Finish("assemble", 0)
-                diag.IncOp("assembler", "finish", "success")
-            }
-            wtimer := (*diag.Timer)(nil)
-            if logger != nil {
-                wtimer = logger.StartWith("writer", "write", string(fid), "")
             }
-            werr := comp.Writer.Write(ctx, contract.ArtifactID(fid), r)
-            if werr != nil {
+            if skip {
                 if logger != nil {
-                    code := diag.Classify(werr)
-                    logger.ErrorWith("writer", string(code), "write failed", nil, string(fid), "")
-                    diag.IncOp("writer", "error", "error")
-                    if code != diag.CodeUnknown {
-                        diag.IncError("writer", string(code))
+                    logger.InfoWithKV("pipeline", "skip unchanged", string(fid), "", map[string]string{"source_sha256": srcHash})
+                }
+                if t := diag.GetTerminal(); t != nil {
+                    t.FileStart(string(fid), 0)
+                    t.FileFinish(true, 0)
+                }
+                if man != nil {
+                    for _, id := range arts {
+                        man.add(ManifestEntry{Artifact: id, Status: ManifestSkipped})
                     }
                 }
-                return fmt.Errorf("writer write: %w", werr)
+                return nil
             }
-            if wtimer != nil {
-                wtimer.Finish("write", 1)
-                diag.IncOp("writer", "finish", "success")
+        }
+        saveHash := func() error {
+            if store == nil {
+                return nil
             }
-            // 写出空 JSONL 边车
-            if perr := comp.Writer.Write(ctx, contract.ArtifactID(string(fid)+".jsonl"), strings.NewReader("")); perr != nil {
-                if logger != nil {
-                    code := diag.Classify(perr)
-                    logger.ErrorWith("writer", string(code), "write failed", nil, string(fid), "")
-                    diag.IncOp("writer", "error", "error")
-                    if code != diag.CodeUnknown { diag.IncError("writer", string(code)) }
+            for _, id := range arts {
+                if err := store.SaveSourceHash(ctx, id, srcHash); err != nil {
+                    return fmt.Errorf("writer save source hash: %w", err)
                 }
-                return fmt.Errorf("writer write(jsonl): %w", perr)
             }
-            ok = true
             return nil
         }
-		if err := perFile(fid, recs); err != nil {
+        // 零记录（没有可处理内容）同样经 perFile：各目标语言写出空工件与空边车
+		if err := perFile(fid, recs, nil); err != nil {
 			return fmt.Errorf("perFile: %w", err)
 		}
+		return saveHash()
+	}
+	// 失败计数：ContinueOnError 下跳过失败文件；连续失败达到上限时熔断
+	var failed, consecutive int
+	var lastErr error
+	err = comp.Reader.Iterate(ctx, set.Inputs, func(fid contract.FileID, rc io.ReadCloser) error {
+		ferr := handle(fid, rc)
+		if ferr == nil {
+			consecutive = 0
+			return nil
+		}
+		// 上限耗尽：停止调度后续文件（不计为文件失败，亦不受 ContinueOnError 影响）
+		if ctx.Err() != nil || errors.Is(ferr, ErrCapReached) {
+			if logger != nil && errors.Is(ferr, ErrCapReached) {
+				logger.InfoWithKV("pipeline", "run cap reached", string(fid), "", map[string]string{"error": ferr.Error()})
+			}
+			return ferr
+		}
+		failed++
+		consecutive++
+		lastErr = ferr
+		if set.MaxConsecutiveFailures > 0 && consecutive >= set.MaxConsecutiveFailures {
+			return fmt.Errorf("%d consecutive file failures: %w", consecutive, ferr)
+		}
+		if !set.ContinueOnError {
+			return ferr
+		}
+		if logger != nil {
+			logger.ErrorWith("pipeline", string(diag.Classify(ferr)), "file failed, continuing", nil, string(fid), "")
+		}
 		return nil
 	})
+	// 迭代结束后（无论成败/取消）落盘 Writer 延迟的持久化工作；失败与运行本身的错误合并返回（已写出的工件可能未持久化）
+	var ferr error
+	if flusher != nil {
+		ferr = flusher.Flush(context.WithoutCancel(ctx))
+		if ferr != nil && logger != nil {
+			logger.ErrorWith("writer", string(diag.Classify(ferr)), "flush failed", nil, "", "")
+		}
+		if ferr != nil {
+			ferr = fmt.Errorf("writer flush: %w", ferr)
+		}
+	}
+	// 清单在迭代结束后写出（无论成败）；写出失败仅在运行本身成功时作为结果返回
+	var merr error
+	if man != nil {
+		merr = man.write(set.ManifestPath)
+	}
 	if err != nil {
 		if logger != nil {
 			code := diag.Classify(err)
@@ -651,15 +1207,44 @@ func Run(ctx context.Context, comp Components, set Settings, logger *diag.Logger
 				diag.IncError("reader", string(code))
 			}
 		}
-		return fmt.Errorf("reader iterate: %w", err)
+		return errors.Join(fmt.Errorf("reader iterate: %w", err), ferr)
 	}
 	if rtimer != nil {
 		rtimer.Finish("iterate", 0)
 		diag.IncOp("reader", "finish", "success")
 	}
+	if failed > 0 {
+		return errors.Join(fmt.Errorf("%d file(s) failed, last: %w", failed, lastErr), ferr)
+	}
+	if ferr != nil {
+		return ferr
+	}
+	if merr != nil {
+		return fmt.Errorf("manifest: %w", merr)
+	}
 	return nil
 }
 
+// batchBudget 返回扣除固定提示词开销与余量后的批预算及开销本身；MaxTokens<=0 时预算关闭（0）。
+func batchBudget(comp Components, set Settings) (effMax, overhead int, err error) {
+	effMax = set.MaxTokens
+	if set.MaxTokens <= 0 {
+		return effMax, 0, nil
+	}
+	if err := prompt.CheckExampleShare(comp.PromptBuilder, set.BytesPerToken, set.MaxTokens); err != nil {
+		return 0, 0, err
+	}
+	_, overhead = prompt.EffectiveMaxTokens(comp.PromptBuilder, set.BytesPerToken, set.MaxTokens, set.OverheadTokens)
+	effMax = set.MaxTokens - overhead
+	if set.BudgetHeadroomPct > 0 {
+		effMax -= effMax * set.BudgetHeadroomPct / 100
+	}
+	if effMax <= 0 {
+		return 0, 0, fmt.Errorf("%w: effective token budget <= 0 after overhead", contract.ErrBudgetExceeded)
+	}
+	return effMax, overhead, nil
+}
+
 func sanity(c Components, s Settings) error {
 	if c.Reader == nil || c.Splitter == nil || c.Batcher == nil || c.PromptBuilder == nil || c.LLM == nil || c.Decoder == nil || c.Assembler == nil || c.Writer == nil {
 		return errors.New("pipeline: missing components")
@@ -670,19 +1255,278 @@ func sanity(c Components, s Settings) error {
 	if len(s.Inputs) == 0 {
 		return errors.New("pipeline: empty inputs")
 	}
+	if s.OverheadTokens < 0 {
+		return fmt.Errorf("pipeline: overhead tokens %d must be >= 0", s.OverheadTokens)
+	}
+	if s.BudgetHeadroomPct < 0 || s.BudgetHeadroomPct > 99 {
+		return fmt.Errorf("pipeline: budget headroom %d%% out of range [0,99]", s.BudgetHeadroomPct)
+	}
+	if s.AutoConcurrency && s.MaxConcurrency > 0 && s.MaxConcurrency < s.Concurrency {
+		return fmt.Errorf("pipeline: max concurrency %d below concurrency %d", s.MaxConcurrency, s.Concurrency)
+	}
+	if s.ProviderConcurrency < 0 {
+		return fmt.Errorf("pipeline: provider concurrency %d must be >= 0", s.ProviderConcurrency)
+	}
+	switch s.OnBlocked {
+	case "", OnBlockedFail:
+	case OnBlockedPassthrough:
+		if _, ok := c.Decoder.(contract.PassthroughDecoder); !ok {
+			return errors.New("pipeline: on blocked passthrough requires a passthrough decoder")
+		}
+	default:
+		return fmt.Errorf("pipeline: unknown on blocked policy %q", s.OnBlocked)
+	}
+	if (s.MaxInvokeRetries != nil && *s.MaxInvokeRetries < 0) || (s.MaxDecodeRetries != nil && *s.MaxDecodeRetries < 0) {
+		return errors.New("pipeline: max invoke/decode retries must be >= 0")
+	}
+	if s.MaxConsecutiveFailures < 0 {
+		return fmt.Errorf("pipeline: max consecutive failures %d must be >= 0", s.MaxConsecutiveFailures)
+	}
+	if s.Sidecar != nil {
+		if err := validateSidecar(*s.Sidecar); err != nil {
+			return err
+		}
+	}
+	if err := ValidateSidecarPath(s.SidecarDir, s.SidecarExt); err != nil {
+		return err
+	}
+	if s.FileLang != nil {
+		if _, ok := c.PromptBuilder.(contract.ContextualPromptBuilder); !ok {
+			return errors.New("pipeline: file lang requires a contextual prompt builder")
+		}
+		if err := validateFileLang(*s.FileLang); err != nil {
+			return err
+		}
+	}
+	if s.SkipUnchanged {
+		if _, ok := c.Writer.(contract.SourceHashStore); !ok {
+			return errors.New("pipeline: skip unchanged requires a writer that stores source hashes")
+		}
+	}
+	if s.StreamSegmentRecords < 0 {
+		return fmt.Errorf("pipeline: stream segment records %d must be >= 0", s.StreamSegmentRecords)
+	}
+	if s.StreamSegmentRecords > 0 && s.SkipUnchanged {
+		return errors.New("pipeline: stream segment records is incompatible with skip unchanged")
+	}
+	if !s.orderedOutput() && s.SkipUnchanged {
+		return errors.New("pipeline: unordered output is incompatible with skip unchanged")
+	}
+	if len(s.Targets) > 0 {
+		if err := validateTargets(s.Targets); err != nil {
+			return err
+		}
+		if _, ok := c.PromptBuilder.(contract.ContextualPromptBuilder); !ok {
+			return errors.New("pipeline: targets require a contextual prompt builder")
+		}
+		switch {
+		case s.FileLang != nil:
+			return errors.New("pipeline: targets are incompatible with file lang")
+		case s.StreamSegmentRecords > 0:
+			return errors.New("pipeline: targets are incompatible with stream segment records")
+		}
+	}
+	if s.MaxBatches < 0 || s.MaxRecords < 0 {
+		return fmt.Errorf("pipeline: max batches %d / max records %d must be >= 0", s.MaxBatches, s.MaxRecords)
+	}
+	if len(s.RecordRanges) > 0 {
+		if err := validateRecordRanges(s.RecordRanges); err != nil {
+			return err
+		}
+		if _, ok := c.Decoder.(contract.PassthroughDecoder); !ok {
+			return errors.New("pipeline: record ranges require a passthrough decoder")
+		}
+		if s.StreamSegmentRecords > 0 {
+			return errors.New("pipeline: record ranges are incompatible with stream segment records")
+		}
+	}
+	return nil
+}
+
+// validateBatches 校验 Batcher 输出：各批窗口合法（见 contract.ValidateBatch），
+// 避免下游（Prompt 构建、客户端、解码器）以 Records[0].Index 为基准计算偏移时越界。
+func validateBatches(batches []contract.Batch) error {
+	for _, b := range batches {
+		if err := contract.ValidateBatch(b); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// observeBatch 记录送入 LLM 的批的规模分布（记录数与估算 token 数，均含上下文），供运行摘要输出分位数。
+// 每个切出的批记录一次（多目标语言不重复计，透传批不计）。
+func observeBatch(b contract.Batch, est contract.TokenEstimator) {
+	tokens := 0
+	for _, r := range b.Records {
+		tokens += est(r.Text)
+	}
+	diag.ObserveValue(diag.HistBatchRecords, int64(len(b.Records)))
+	diag.ObserveValue(diag.HistBatchTokens, int64(tokens))
+}
+
+// seqRange 返回批目标区间首尾记录的 Meta["seq"]（如 "412-430"；单条为 "412"）；任一端缺失时返回空串。
+func seqRange(b contract.Batch) string {
+	var first, last string
+	for _, r := range b.Records {
+		if r.Index == b.TargetFrom {
+			first = r.Meta["seq"]
+		}
+		if r.Index == b.TargetTo {
+			last = r.Meta["seq"]
+		}
+	}
+	if first == "" || last == "" {
+		return ""
+	}
+	if first == last {
+		return first
+	}
+	return first + "-" + last
+}
+
+// batchIndexMeta 构建批内 idx→meta 只读映射（拷贝），并回填源文本 "_src_text"
+// 供解码器做协议层校验（如“原文回显”检测）或原文透传（键名以 _ 前缀避免与业务字段冲突）。
+func batchIndexMeta(b contract.Batch) contract.IndexMetaMap {
+	idxMeta := make(contract.IndexMetaMap, len(b.Records))
+	for _, r := range b.Records {
+		mm := make(contract.Meta, len(r.Meta)+1)
+		for k, v := range r.Meta {
+			mm[k] = v
+		}
+		mm[contract.MetaSrcText] = r.Text
+		idxMeta[r.Index] = mm
+	}
+	return idxMeta
+}
+
+// WorkerLimit 返回同时处理中的批数上限：固定并发时即 EffectiveConcurrency，自适应并发时为 maxConcurrency。
+func (s Settings) WorkerLimit() int {
+	if s.AutoConcurrency {
+		return maxConcurrency(s)
+	}
+	return s.EffectiveConcurrency()
+}
+
+// EffectiveConcurrency 返回起始并发度：活动 Provider 的并发上限优先于全局 Concurrency（至少 1）；
+// 自适应并发下不超过 maxConcurrency。
+func (s Settings) EffectiveConcurrency() int {
+	c := s.Concurrency
+	if s.ProviderConcurrency > 0 {
+		c = s.ProviderConcurrency
+	}
+	if c < 1 {
+		c = 1
+	}
+	if s.AutoConcurrency {
+		if m := maxConcurrency(s); c > m {
+			c = m
+		}
+	}
+	return c
+}
+
+// maxConcurrency 返回自适应并发的上限：显式配置优先，否则取 4×Concurrency（至少 1）；
+// 设置了 ProviderConcurrency 时不超过该值。
+func maxConcurrency(s Settings) int {
+	m := s.MaxConcurrency
+	if m <= 0 {
+		m = 4
+		if s.Concurrency > 0 {
+			m = s.Concurrency * 4
+		}
+	}
+	if s.ProviderConcurrency > 0 && m > s.ProviderConcurrency {
+		m = s.ProviderConcurrency
+	}
+	return m
+}
+
+// decodeStream 以流式解码器边读边解析 rs（用毕关闭）。
+func decodeStream(ctx context.Context, sd contract.StreamDecoder, tgt contract.Target, rs contract.RawStream, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	defer rs.Close()
+	es := &errStream{RawStream: rs}
+	spans, err := collectStream(ctx, sd, tgt, contract.NewStreamReader(es), idxMeta)
+	if err != nil && es.err != nil {
+		// 读取失败是根因（解码器可能只报告为截断/无效 JSON）：以流错误为准，供拦截/网络类分类
+		return nil, es.err
+	}
+	return spans, err
+}
+
+// errStream 记录流读取中的首个错误。
+type errStream struct {
+	contract.RawStream
+	err error
+}
+
+func (s *errStream) Next() (string, bool, error) {
+	chunk, done, err := s.RawStream.Next()
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	return chunk, done, err
+}
+
+// collectStream 以流式解码器解析 r，收集 emit 的结果；
+// 解码失败时丢弃已收集的部分，与整批解码的重试语义一致。
+func collectStream(ctx context.Context, sd contract.StreamDecoder, tgt contract.Target, r io.Reader, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	spans := make([]contract.SpanResult, 0, int(tgt.To-tgt.From)+1)
+	err := sd.DecodeStream(ctx, tgt, r, idxMeta, func(sp contract.SpanResult) error {
+		spans = append(spans, sp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return spans, nil
+}
+
+// decodeRaw 解码一次 Invoke 的结果。Raw 携带 Reader 且解码器实现 StreamDecoder 时边读边解析（SourceEcho
+// 需整体判定，除外）；否则经 Materialize 读尽后走 DecodeWithMeta/Decode。Reader 用毕关闭（若可关闭）。
+func decodeRaw(ctx context.Context, dec contract.Decoder, sd contract.StreamDecoder, tgt contract.Target, raw contract.Raw, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	if raw.Reader != nil && sd != nil && !raw.SourceEcho {
+		if c, ok := raw.Reader.(io.Closer); ok {
+			defer c.Close()
+		}
+		return collectStream(ctx, sd, tgt, raw.Reader, idxMeta)
+	}
+	raw, err := raw.Materialize()
+	if err != nil {
+		return nil, err
+	}
+	if dm, ok := dec.(contract.DecoderWithMeta); ok {
+		return dm.DecodeWithMeta(ctx, tgt, raw, idxMeta)
+	}
+	return dec.Decode(ctx, tgt, raw)
+}
+
+// retryLimit: 阶段重试上限；未单独设置时沿用 MaxRetries，负值按 0。
+func retryLimit(v *int, def int) int {
+	n := def
+	if v != nil {
+		n = *v
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
 // shouldRetryInvoke: 根据错误类型判断是否重试 LLM 调用。
+// 若配置了 retryOn，则按集合判定（取消除外）；否则采用默认策略：
 // - 取消/超时：不重试；
 // - 预算/限流：重试（交由 Gate 控制速率）；
 // - 网络类错误：重试；
-// - 其他未知错误：不重试。
-func shouldRetryInvoke(err error) bool {
+// - 内容拦截（blocked）及其他错误：不重试。
+func shouldRetryInvoke(err error, retryOn map[diag.Code]bool) bool {
 	if err == nil {
 		return false
 	}
 	code := diag.Classify(err)
+	if retryOn != nil {
+		return code != diag.CodeCancel && retryOn[code]
+	}
 	switch code {
 	case diag.CodeCancel:
 		return false
@@ -693,14 +1537,29 @@ func shouldRetryInvoke(err error) bool {
 	}
 }
 
+// passthroughBlocked: 调用错误是否以原文透传处理；运行级 OnBlocked 优先于客户端的 ErrSourcePassthrough 标记。
+func passthroughBlocked(err error, policy string) bool {
+	switch policy {
+	case OnBlockedPassthrough:
+		return errors.Is(err, contract.ErrResponseBlocked) || errors.Is(err, contract.ErrSourcePassthrough)
+	case OnBlockedFail:
+		return errors.Is(err, contract.ErrSourcePassthrough) && !errors.Is(err, contract.ErrResponseBlocked)
+	}
+	return errors.Is(err, contract.ErrSourcePassthrough)
+}
+
 // shouldRetryDecode: 针对“模型幻觉/响应无效”做有限次重试。
+// 若配置了 retryOn，则按集合判定（取消除外）；否则采用默认策略：
 // - 协议/响应无效：重试；
 // - 取消/超时/输入非法等：不重试。
-func shouldRetryDecode(err error) bool {
+func shouldRetryDecode(err error, retryOn map[diag.Code]bool) bool {
 	if err == nil {
 		return false
 	}
 	code := diag.Classify(err)
+	if retryOn != nil {
+		return code != diag.CodeCancel && retryOn[code]
+	}
 	return code == diag.CodeProtocol
 }
 
@@ -744,3 +1603,66 @@ func approxPromptTokens(p contract.Prompt, bpt int) int {
     }
     return (total + bpt - 1) / bpt
 }
+
+// snapshotGate 按固定间隔记录 Gate 剩余 RPM/TPM 额度，直至 ctx 取消。
+func snapshotGate(ctx context.Context, sn rate.Snapshoter, key rate.LimitKey, every time.Duration, logger *diag.Logger) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			rpm, tpm := sn.Snapshot(key)
+			logger.DebugWithKV("gate", "snapshot", "", "", map[string]string{
+				"rpm_avail": strconv.Itoa(rpm),
+				"tpm_avail": strconv.Itoa(tpm),
+			})
+		}
+	}
+}
+
+// blankWriter 记录写入内容是否仅由空白（unicode.IsSpace）组成；开头的 UTF-8 BOM 仅剥离一次。
+// 流式写入时，跨块截断的 BOM 前缀或多字节序列暂存到下一次 Write 再判定。
+type blankWriter struct {
+	nonBlank bool
+	started  bool   // 已完成开头 BOM 的判定
+	pend     []byte // 尚不完整的尾部字节
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+func (w *blankWriter) Write(p []byte) (int, error) {
+	if w.nonBlank {
+		return len(p), nil
+	}
+	b := p
+	if len(w.pend) > 0 {
+		b = append(w.pend, p...)
+		w.pend = nil
+	}
+	if !w.started {
+		if len(b) < len(utf8BOM) && bytes.HasPrefix(utf8BOM, b) {
+			w.pend = append([]byte(nil), b...)
+			return len(p), nil
+		}
+		w.started = true
+		b = bytes.TrimPrefix(b, utf8BOM)
+	}
+	for len(b) > 0 {
+		if !utf8.FullRune(b) {
+			w.pend = append([]byte(nil), b...)
+			break
+		}
+		r, n := utf8.DecodeRune(b)
+		if !unicode.IsSpace(r) {
+			w.nonBlank = true
+			break
+		}
+		b = b[n:]
+	}
+	return len(p), nil
+}
+
+// blank 报告已写入内容是否为空白；结尾残留的不完整字节视为非空白。
+func (w *blankWriter) blank() bool { return !w.nonBlank && len(w.pend) == 0 }
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"llmspt/internal/rate"
 	"llmspt/pkg/contract"
 	sliding "llmspt/plugins/batcher/sliding"
 	djson "llmspt/plugins/decoder/srtjson"
@@ -35,7 +36,7 @@ func (m mockLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt
 	arr := make([]item, 0, b.TargetTo-b.TargetFrom+1)
 	for _, r := range b.Records {
 		if r.Index >= b.TargetFrom && r.Index <= b.TargetTo {
-			arr = append(arr, item{ID: int64(r.Index), Text: r.Text})
+			arr = append(arr, item{ID: int64(r.Index), Text: "T:" + r.Text})
 		}
 	}
 	bs, _ := json.Marshal(arr)
@@ -76,3 +77,31 @@ func BenchmarkPipeline(b *testing.B) {
 		})
 	}
 }
+
+// BenchmarkPipelineGateDisabled 对比高并发下“无 Gate”与“限额全为 0 的 Gate”的调度开销。
+func BenchmarkPipelineGateDisabled(b *testing.B) {
+	testFile := filepath.Join("..", "..", "testdata", "files", "test-100-line.srt")
+	c := 4 * runtime.NumCPU()
+	for _, tc := range []struct {
+		name string
+		gate rate.Gate
+	}{
+		{"gate=nil", nil},
+		{"gate=unlimited", rate.NewGate(map[rate.LimitKey]rate.Limits{"k": {}}, nil)},
+	} {
+		b.Run(fmt.Sprintf("%s/C=%d", tc.name, c), func(b *testing.B) {
+			dec, _ := djson.New(nil)
+			comp := Components{Reader: fsreader.New(nil), Splitter: srt.New(nil), Batcher: sliding.New(&sliding.Options{ContextRadius: 1}),
+				PromptBuilder: stubPB{}, LLM: mockLLM{}, Decoder: dec, Assembler: stubAssembler{}, Writer: discardWriter{}}
+			set := Settings{Inputs: []string{testFile}, Concurrency: c, MaxTokens: 200, Gate: tc.gate, GateKey: "k"}
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := Run(ctx, comp, set, nil); err != nil {
+					b.Fatalf("运行失败: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -2,13 +2,30 @@ package pipeline
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"llmspt/internal/diag"
+	"llmspt/internal/rate"
 	"llmspt/pkg/contract"
+	"llmspt/plugins/assembler/linear"
+	dline "llmspt/plugins/decoder/linemap"
+	dspan "llmspt/plugins/decoder/spanjson"
+	dsrt "llmspt/plugins/decoder/srtjson"
+	dtext "llmspt/plugins/decoder/textjson"
+	ssrt "llmspt/plugins/splitter/srt"
+	wfs "llmspt/plugins/writer/filesystem"
 )
 
 // 通用桩件 ----------------------------------------------------
@@ -114,3 +131,1745 @@ func TestRunRetryDecode(t *testing.T) {
 		t.Fatalf("输出错误: %s", w.out.String())
 	}
 }
+
+// hashWriter: 支持源摘要持久化的桩件 Writer。
+type hashWriter struct {
+	stubWriter
+	hashes map[contract.ArtifactID]string
+	writes int
+}
+
+func (w *hashWriter) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	if !strings.HasSuffix(string(id), ".jsonl") {
+		w.writes++
+	}
+	return w.stubWriter.Write(ctx, id, r)
+}
+
+func (w *hashWriter) LoadSourceHash(ctx context.Context, id contract.ArtifactID) (string, bool, error) {
+	h, ok := w.hashes[id]
+	return h, ok, nil
+}
+
+func (w *hashWriter) SaveSourceHash(ctx context.Context, id contract.ArtifactID, hash string) error {
+	w.hashes[id] = hash
+	return nil
+}
+
+// 跳过未变更：第二次运行源内容一致时不再写出
+func TestRunSkipUnchanged(t *testing.T) {
+	w := &hashWriter{hashes: map[contract.ArtifactID]string{}}
+	comp := Components{
+		Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{},
+		PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{},
+		Assembler: stubAssembler{}, Writer: w,
+	}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxTokens: 100, SkipUnchanged: true}
+	for i := 0; i < 2; i++ {
+		if err := Run(context.Background(), comp, set, nil); err != nil {
+			t.Fatalf("运行失败: %v", err)
+		}
+	}
+	if w.writes != 1 || w.hashes["f"] == "" {
+		t.Fatalf("应仅写出一次并记录摘要, writes=%d hashes=%v", w.writes, w.hashes)
+	}
+	// 不支持摘要持久化的 Writer 应在 sanity 阶段失败
+	comp.Writer = &stubWriter{}
+	if err := Run(context.Background(), comp, set, nil); err == nil {
+		t.Fatalf("应拒绝不支持摘要的 Writer")
+	}
+}
+
+// 配置的重试集合覆盖默认策略：未包含 protocol 时解码错误不重试
+func TestRunRetryOnOverride(t *testing.T) {
+	dec := &stubDecoder{fail: true}
+	comp := Components{
+		Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{},
+		PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: dec,
+		Assembler: stubAssembler{}, Writer: &stubWriter{},
+	}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxTokens: 100, MaxRetries: 2, RetryOn: []diag.Code{diag.CodeNetwork}}
+	if err := Run(context.Background(), comp, set, nil); !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("应返回协议错误, got %v", err)
+	}
+	if dec.called != 1 {
+		t.Fatalf("不应重试, 实际调用 %d 次", dec.called)
+	}
+}
+
+// snapGate: 不限流并统计 Snapshot 调用次数的桩件 Gate。
+type snapGate struct{ snaps atomic.Int32 }
+
+func (g *snapGate) Wait(ctx context.Context, a rate.Ask) error { return nil }
+func (g *snapGate) Try(a rate.Ask) bool                        { return true }
+func (g *snapGate) Snapshot(key rate.LimitKey) (int, int) {
+	g.snaps.Add(1)
+	return 1, 2
+}
+
+type slowLLM struct{}
+
+func (slowLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	time.Sleep(30 * time.Millisecond)
+	return contract.Raw{Text: "raw"}, nil
+}
+
+// Gate 快照仅在 debug 级别周期性采集
+func TestRunGateSnapshot(t *testing.T) {
+	for _, tc := range []struct {
+		level string
+		want  bool
+	}{{"debug", true}, {"info", false}} {
+		g := &snapGate{}
+		comp := Components{
+			Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{},
+			PromptBuilder: stubPB{}, LLM: slowLLM{}, Decoder: &stubDecoder{},
+			Assembler: stubAssembler{}, Writer: &stubWriter{},
+		}
+		set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxTokens: 100, Gate: g, GateKey: "k", GateSnapshotEvery: time.Millisecond}
+		logger := diag.NewLogger("c", tc.level)
+		if err := Run(context.Background(), comp, set, logger); err != nil {
+			t.Fatalf("运行失败: %v", err)
+		}
+		logger.Close()
+		if got := g.snaps.Load() > 0; got != tc.want {
+			t.Fatalf("level=%s 快照采集=%v, 期望 %v", tc.level, got, tc.want)
+		}
+	}
+}
+
+type textReader struct{ text string }
+
+func (r textReader) Iterate(ctx context.Context, roots []string, yield func(contract.FileID, io.ReadCloser) error) error {
+	return yield(contract.FileID("f"), io.NopCloser(strings.NewReader(r.text)))
+}
+
+// nopSplitter: 不读取源、产出零记录（模拟空文件或扩展名过滤）。
+type nopSplitter struct{}
+
+func (nopSplitter) Split(ctx context.Context, fileID contract.FileID, r io.Reader) ([]contract.Record, error) {
+	return nil, nil
+}
+
+// 空源快速失败：仅空白内容失败；非空但零记录（过滤）与默认关闭时写出空工件
+func TestRunFailOnEmpty(t *testing.T) {
+	cases := []struct {
+		text    string
+		fail    bool
+		wantErr bool
+	}{
+		{"\xEF\xBB\xBF \r\n\t", true, true},
+		{"", true, true},
+		{"readme", true, false},
+		{"  \n", false, false},
+	}
+	for _, tc := range cases {
+		comp := Components{
+			Reader: textReader{tc.text}, Splitter: nopSplitter{}, Batcher: stubBatcher{},
+			PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{},
+			Assembler: stubAssembler{}, Writer: &stubWriter{},
+		}
+		set := Settings{Inputs: []string{"in"}, Concurrency: 1, FailOnEmpty: tc.fail}
+		err := Run(context.Background(), comp, set, nil)
+		if got := errors.Is(err, contract.ErrInvalidInput); got != tc.wantErr || (!tc.wantErr && err != nil) {
+			t.Fatalf("text=%q fail=%v: err=%v", tc.text, tc.fail, err)
+		}
+	}
+}
+
+// blankWriter：仅剥离开头一次 BOM；其余位置的 BOM 字节、部分 BOM 与非 ASCII 文本均非空白；跨块逐字节写入结果一致
+func TestBlankWriter(t *testing.T) {
+	cases := []struct {
+		text  string
+		blank bool
+	}{
+		{"", true},
+		{"\xEF\xBB\xBF", true},
+		{"\xEF\xBB\xBF \r\n\u3000\u00a0", true},
+		{"\xEF\xBB", false},
+		{" \xEF\xBB\xBF", false},
+		{"\xEF\xBB\xBF\xEF\xBB\xBF", false},
+		{"\xBF\xBB", false},
+		{"\xEF\xBB\xBF字幕", false},
+		{"\n\xE5\xAD", false},
+	}
+	for _, tc := range cases {
+		whole := &blankWriter{}
+		_, _ = whole.Write([]byte(tc.text))
+		split := &blankWriter{}
+		for i := 0; i < len(tc.text); i++ {
+			_, _ = split.Write([]byte{tc.text[i]})
+		}
+		if whole.blank() != tc.blank || split.blank() != tc.blank {
+			t.Fatalf("text=%q: whole=%v split=%v want %v", tc.text, whole.blank(), split.blank(), tc.blank)
+		}
+	}
+}
+
+// limitBatcher: 记录收到的批预算，并按预算（每条记录计 10 token）切批。
+type limitBatcher struct{ limit, batches int }
+
+func (b *limitBatcher) Make(ctx context.Context, records []contract.Record, limit contract.BatchLimit) ([]contract.Batch, error) {
+	b.limit = limit.MaxTokens
+	per := limit.MaxTokens / 10
+	var out []contract.Batch
+	for i := 0; i < len(records); i += per {
+		j := i + per
+		if j > len(records) {
+			j = len(records)
+		}
+		out = append(out, contract.Batch{FileID: "f", BatchIndex: int64(len(out)), Records: records[i:j], TargetFrom: records[i].Index, TargetTo: records[j-1].Index})
+	}
+	b.batches = len(out)
+	return out, nil
+}
+
+type manySplitter struct{}
+
+func (manySplitter) Split(ctx context.Context, fileID contract.FileID, r io.Reader) ([]contract.Record, error) {
+	recs := make([]contract.Record, 20)
+	for i := range recs {
+		recs[i] = contract.Record{Index: contract.Index(i), FileID: fileID, Text: "hi"}
+	}
+	return recs, nil
+}
+
+type echoDecoder struct{}
+
+func (echoDecoder) Decode(ctx context.Context, tgt contract.Target, raw contract.Raw) ([]contract.SpanResult, error) {
+	var out []contract.SpanResult
+	for i := tgt.From; i <= tgt.To; i++ {
+		out = append(out, contract.SpanResult{FileID: tgt.FileID, From: i, To: i, Output: "ok"})
+	}
+	return out, nil
+}
+
+// 预算余量：余量越大，批预算越小、批次越多；越界余量被拒绝
+func TestRunBudgetHeadroom(t *testing.T) {
+	prevLimit, prevBatches := 0, 0
+	for _, pct := range []int{0, 20, 50} {
+		b := &limitBatcher{}
+		comp := Components{
+			Reader: stubReader{}, Splitter: manySplitter{}, Batcher: b,
+			PromptBuilder: stubPB{overhead: 0}, LLM: stubLLM{}, Decoder: echoDecoder{},
+			Assembler: stubAssembler{}, Writer: &stubWriter{},
+		}
+		set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxTokens: 100, BudgetHeadroomPct: pct}
+		if err := Run(context.Background(), comp, set, nil); err != nil {
+			t.Fatalf("pct=%d: %v", pct, err)
+		}
+		if pct > 0 && (b.limit >= prevLimit || b.batches <= prevBatches) {
+			t.Fatalf("pct=%d: limit=%d batches=%d, prev limit=%d batches=%d", pct, b.limit, b.batches, prevLimit, prevBatches)
+		}
+		prevLimit, prevBatches = b.limit, b.batches
+	}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxTokens: 100, BudgetHeadroomPct: 100}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: &stubWriter{}}
+	if err := Run(context.Background(), comp, set, nil); err == nil {
+		t.Fatalf("越界余量应被拒绝")
+	}
+}
+
+// 固定提示词开销：OverheadTokens>0 时取代估算值（估算超出 MaxTokens 亦可运行），批预算为 MaxTokens-OverheadTokens
+func TestRunOverheadTokens(t *testing.T) {
+	b := &limitBatcher{}
+	comp := Components{
+		Reader: stubReader{}, Splitter: manySplitter{}, Batcher: b,
+		PromptBuilder: stubPB{overhead: 500}, LLM: stubLLM{}, Decoder: echoDecoder{},
+		Assembler: stubAssembler{}, Writer: &stubWriter{},
+	}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxTokens: 100}
+	if err := Run(context.Background(), comp, set, nil); !errors.Is(err, contract.ErrBudgetExceeded) {
+		t.Fatalf("估算开销超出预算应失败: %v", err)
+	}
+	set.OverheadTokens = 30
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if b.limit != 70 {
+		t.Fatalf("limit = %d, want 70", b.limit)
+	}
+	set.OverheadTokens = -1
+	if err := Run(context.Background(), comp, set, nil); err == nil {
+		t.Fatalf("负开销应被拒绝")
+	}
+}
+
+// 批规模分布：每个切出的批记录一次记录数与估算 token 数
+func TestRunObservesBatchSizes(t *testing.T) {
+	diag.ResetMetrics()
+	t.Cleanup(diag.ResetMetrics)
+	b := &limitBatcher{}
+	comp := Components{
+		Reader: stubReader{}, Splitter: manySplitter{}, Batcher: b,
+		PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: echoDecoder{},
+		Assembler: stubAssembler{}, Writer: &stubWriter{},
+	}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxTokens: 70, BytesPerToken: 2}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	recs := diag.HistogramPercentiles(diag.HistBatchRecords)
+	if recs.N != b.batches || recs.Max != 7 {
+		t.Fatalf("records = %+v, batches = %d", recs, b.batches)
+	}
+	// 每条 "hi" 估算 1 token
+	if toks := diag.HistogramPercentiles(diag.HistBatchTokens); toks.N != b.batches || toks.Max != 7 || toks.P50 != 7 {
+		t.Fatalf("tokens = %+v", toks)
+	}
+}
+
+// hugeSplitter 产出 n 条记录（配合 limitBatcher{MaxTokens:10} 每批一条）。
+type hugeSplitter struct{ n int }
+
+func (s hugeSplitter) Split(ctx context.Context, fileID contract.FileID, r io.Reader) ([]contract.Record, error) {
+	recs := make([]contract.Record, s.n)
+	for i := range recs {
+		recs[i] = contract.Record{Index: contract.Index(i), FileID: fileID, Text: "hi"}
+	}
+	return recs, nil
+}
+
+type countLLM struct{ calls atomic.Int32 }
+
+func (l *countLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	l.calls.Add(1)
+	time.Sleep(5 * time.Millisecond)
+	return contract.Raw{Text: "raw"}, nil
+}
+
+// firstFailDecoder 首批解码失败，其余成功（并发安全）。
+type firstFailDecoder struct{}
+
+func (firstFailDecoder) Decode(ctx context.Context, tgt contract.Target, raw contract.Raw) ([]contract.SpanResult, error) {
+	if tgt.From == 0 {
+		return nil, contract.ErrResponseInvalid
+	}
+	return []contract.SpanResult{{FileID: tgt.FileID, From: tgt.From, To: tgt.To, Output: "ok"}}, nil
+}
+
+// 首错取消：多批文件的首批失败后生产者立即停止投递、worker 不再调用组件，
+// Run 迅速返回且不遗留 goroutine
+func TestRunFirstErrorTeardown(t *testing.T) {
+	const n = 5000
+	base := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		llm := &countLLM{}
+		comp := Components{
+			Reader: stubReader{}, Splitter: hugeSplitter{n: n}, Batcher: &limitBatcher{},
+			PromptBuilder: stubPB{}, LLM: llm, Decoder: firstFailDecoder{},
+			Assembler: stubAssembler{}, Writer: &stubWriter{},
+		}
+		set := Settings{Inputs: []string{"in"}, Concurrency: 8, MaxTokens: 10}
+		start := time.Now()
+		if err := Run(context.Background(), comp, set, nil); !errors.Is(err, contract.ErrResponseInvalid) {
+			t.Fatalf("run: %v", err)
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Fatalf("teardown too slow: %v", d)
+		}
+		// 仅首错前已在途的批（约两轮 worker）触达 LLM；已排队的批以取消错误排空
+		if c := llm.calls.Load(); c > 3*int32(set.Concurrency) {
+			t.Fatalf("llm calls after first error = %d of %d", c, n)
+		}
+	}
+	waitGoroutines(t, base)
+}
+
+// slowWriter 逐字节慢速读取（不感知 ctx），模拟阻塞在慢下游上的 Writer；
+// early 非 nil 时主工件不读取即以该错误返回。
+type slowWriter struct {
+	delay time.Duration
+	early error
+}
+
+func (w slowWriter) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	if w.early != nil && !strings.HasSuffix(string(id), ".jsonl") {
+		return w.early
+	}
+	b := make([]byte, 1)
+	for {
+		if _, err := r.Read(b); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		time.Sleep(w.delay)
+	}
+}
+
+// waitGoroutines 等待 goroutine 数回落至 base，超时则打印堆栈失败。
+func waitGoroutines(t *testing.T, base int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("goroutine leak: %d > %d\n%s", runtime.NumGoroutine(), base, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 文件中途取消：门闩阻塞在慢 Writer 上时，Run 仍迅速返回取消错误且不遗留 goroutine
+func TestRunCancelSlowWriter(t *testing.T) {
+	base := runtime.NumGoroutine()
+	comp := Components{
+		Reader: stubReader{}, Splitter: hugeSplitter{n: 200}, Batcher: &limitBatcher{},
+		PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: echoDecoder{},
+		Assembler: stubAssembler{}, Writer: slowWriter{delay: 20 * time.Millisecond},
+	}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 4, MaxTokens: 10}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if err := Run(ctx, comp, set, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("run: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("cancel took %v", d)
+	}
+	waitGoroutines(t, base)
+}
+
+// Writer 未读尽即返回：门闩不再阻塞在无人读取的管道上，Run 返回该错误
+func TestRunWriterReturnsEarly(t *testing.T) {
+	base := runtime.NumGoroutine()
+	boom := errors.New("disk full")
+	comp := Components{
+		Reader: stubReader{}, Splitter: hugeSplitter{n: 50}, Batcher: &limitBatcher{},
+		PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: echoDecoder{},
+		Assembler: stubAssembler{}, Writer: slowWriter{early: boom},
+	}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 4, MaxTokens: 10}
+	done := make(chan error, 1)
+	go func() { done <- Run(context.Background(), comp, set, nil) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("writer 错误应失败")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run 阻塞在管道写入上")
+	}
+	waitGoroutines(t, base)
+}
+
+type peakLLM struct{ cur, peak atomic.Int32 }
+
+func (l *peakLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	n := l.cur.Add(1)
+	defer l.cur.Add(-1)
+	for {
+		old := l.peak.Load()
+		if n <= old || l.peak.CompareAndSwap(old, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return contract.Raw{Text: "raw"}, nil
+}
+
+type idxDecoder struct{}
+
+func (idxDecoder) Decode(ctx context.Context, tgt contract.Target, raw contract.Raw) ([]contract.SpanResult, error) {
+	return []contract.SpanResult{{FileID: tgt.FileID, From: tgt.From, To: tgt.To, Output: fmt.Sprintf("%d,", tgt.From)}}, nil
+}
+
+// 自适应并发：从 1 起步逐步扩张且不超过上限，输出顺序保持不变
+func TestRunAutoConcurrency(t *testing.T) {
+	llm := &peakLLM{}
+	w := &stubWriter{}
+	comp := Components{
+		Reader: stubReader{}, Splitter: manySplitter{}, Batcher: &limitBatcher{},
+		PromptBuilder: stubPB{}, LLM: llm, Decoder: idxDecoder{},
+		Assembler: stubAssembler{}, Writer: w,
+	}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxTokens: 10, AutoConcurrency: true, MaxConcurrency: 4}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if p := llm.peak.Load(); p < 2 || p > 4 {
+		t.Fatalf("peak in-flight = %d, want within [2,4]", p)
+	}
+	var want strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&want, "%d,", i)
+	}
+	if w.out.String() != want.String() {
+		t.Fatalf("out = %q", w.out.String())
+	}
+	set.Concurrency = 2
+	set.MaxConcurrency = 1
+	if err := Run(context.Background(), comp, set, nil); err == nil {
+		t.Fatalf("上限低于起始并发应被拒绝")
+	}
+}
+
+// Provider 并发：取代全局并发度（可高可低），自适应并发下作为上限
+func TestRunProviderConcurrency(t *testing.T) {
+	run := func(set Settings) int32 {
+		llm := &peakLLM{}
+		comp := Components{
+			Reader: stubReader{}, Splitter: manySplitter{}, Batcher: &limitBatcher{},
+			PromptBuilder: stubPB{}, LLM: llm, Decoder: idxDecoder{},
+			Assembler: stubAssembler{}, Writer: &stubWriter{},
+		}
+		set.Inputs, set.MaxTokens = []string{"in"}, 10
+		if err := Run(context.Background(), comp, set, nil); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		return llm.peak.Load()
+	}
+	if p := run(Settings{Concurrency: 8, ProviderConcurrency: 2}); p > 2 {
+		t.Fatalf("peak = %d, want <= 2", p)
+	}
+	if p := run(Settings{Concurrency: 1, ProviderConcurrency: 4}); p < 2 || p > 4 {
+		t.Fatalf("peak = %d, want within [2,4]", p)
+	}
+	if p := run(Settings{Concurrency: 1, AutoConcurrency: true, MaxConcurrency: 8, ProviderConcurrency: 2}); p > 2 {
+		t.Fatalf("auto peak = %d, want <= 2", p)
+	}
+	if got := (Settings{Concurrency: 4, AutoConcurrency: true, ProviderConcurrency: 6, MaxConcurrency: 5}).EffectiveConcurrency(); got != 5 {
+		t.Fatalf("effective = %d, want 5", got)
+	}
+}
+// AIMD：成功按窗口加性增长，限流错误与延迟尖峰乘性收缩
+func TestAIMDLimiter(t *testing.T) {
+	a := newAIMDLimiter(1, 8, nil)
+	for i := 0; i < 1+2+3; i++ {
+		a.observe(10*time.Millisecond, nil)
+	}
+	if got := a.current(); got != 4 {
+		t.Fatalf("after growth limit = %d, want 4", got)
+	}
+	a.observe(10*time.Millisecond, contract.ErrRateLimited)
+	if got := a.current(); got != 2 {
+		t.Fatalf("after rate limit error limit = %d, want 2", got)
+	}
+	a.observe(10*time.Millisecond, contract.ErrResponseInvalid)
+	if got := a.current(); got != 2 {
+		t.Fatalf("protocol error must not adjust, limit = %d", got)
+	}
+	a.observe(time.Second, nil)
+	if got := a.current(); got != 1 {
+		t.Fatalf("after latency spike limit = %d, want 1", got)
+	}
+}
+
+// 工件清单：主工件与 JSONL 边车均被记录（源 FileID、字节数、状态）
+func TestRunManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "manifest.json")
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: &stubWriter{}}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, ManifestPath: path}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	got := map[contract.ArtifactID]ManifestEntry{}
+	for _, e := range m.Artifacts {
+		got[e.Artifact] = e
+	}
+	if e := got["f"]; e.FileID != "f" || e.Bytes != 2 || e.Status != ManifestWritten {
+		t.Fatalf("main entry = %+v", e)
+	}
+	if e := got["f.jsonl"]; e.FileID != "f" || e.Bytes == 0 || e.Status != ManifestWritten {
+		t.Fatalf("jsonl entry = %+v", e)
+	}
+}
+
+// 启用清单时边车仍经 SidecarWriter 写出：write_bom 只作用于主工件
+func TestRunManifestSidecarBOM(t *testing.T) {
+	dir := t.TempDir()
+	w, err := wfs.New(&wfs.Options{OutputDir: dir, WriteBOM: true})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, ManifestPath: filepath.Join(dir, "manifest.json")}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "f")); string(b) != "\ufeffok" {
+		t.Fatalf("main artifact = %q, want BOM", b)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "f.jsonl"))
+	if err != nil || len(b) == 0 || strings.HasPrefix(string(b), "\ufeff") {
+		t.Fatalf("sidecar must not start with BOM: %q (%v)", b, err)
+	}
+}
+
+type blockedLLM struct{}
+
+func (blockedLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	return contract.Raw{}, fmt.Errorf("blocked: %w: %w", contract.ErrResponseBlocked, contract.ErrSourcePassthrough)
+}
+
+type passDecoder struct{ stubDecoder }
+
+func (d *passDecoder) Passthrough(ctx context.Context, tgt contract.Target, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	return []contract.SpanResult{{FileID: tgt.FileID, From: tgt.From, To: tgt.To, Output: "src:" + idxMeta[tgt.From]["_src_text"]}}, nil
+}
+
+// 原文透传：客户端要求透传时由解码器以源文本生成结果；解码器不支持时失败
+func TestRunPassthrough(t *testing.T) {
+	w := &stubWriter{}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: blockedLLM{}, Decoder: &passDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxRetries: 2}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if w.out.String() != "src:hi" {
+		t.Fatalf("out = %q", w.out.String())
+	}
+	comp.Decoder = &stubDecoder{}
+	if err := Run(context.Background(), comp, set, nil); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput without passthrough support, got %v", err)
+	}
+}
+
+type jsonlWriter struct{ rows strings.Builder }
+
+func (w *jsonlWriter) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	b, _ := io.ReadAll(r)
+	if strings.HasSuffix(string(id), ".jsonl") {
+		w.rows.Write(b)
+	}
+	return nil
+}
+
+// 边车行结构：默认与历史一致；可省略 src/meta 并追加 batch/attempts；未知字段被拒绝
+func TestRunSidecarOptions(t *testing.T) {
+	run := func(sc *SidecarOptions) (string, error) {
+		w := &jsonlWriter{}
+		comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: w}
+		err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, Sidecar: sc}, nil)
+		return strings.TrimSpace(w.rows.String()), err
+	}
+	got, err := run(nil)
+	if err != nil || got != `{"file_id":"f","from":0,"to":0,"src":"hi","dst":"ok"}` {
+		t.Fatalf("default row = %s (%v)", got, err)
+	}
+	got, err = run(&SidecarOptions{ExtraFields: []string{"batch", "attempts"}})
+	if err != nil || got != `{"file_id":"f","from":0,"to":0,"dst":"ok","batch":0,"attempts":1}` {
+		t.Fatalf("tuned row = %s (%v)", got, err)
+	}
+	if _, err := run(&SidecarOptions{ExtraFields: []string{"cost"}}); err == nil {
+		t.Fatalf("未知边车字段应被拒绝")
+	}
+}
+
+// resolvingReader / resolvingWriter 实现 contract.PathResolver，将 FileID 解析到固定根下
+type resolvingReader struct{ stubReader }
+
+func (resolvingReader) ResolvePath(id contract.FileID) (string, bool) { return "/src/" + string(id), true }
+
+type resolvingWriter struct{ jsonlWriter }
+
+func (*resolvingWriter) ResolvePath(id contract.FileID) (string, bool) { return "/out/" + string(id), true }
+
+// 边车路径字段：按需追加 src_path/out_path；启用清单包装 Writer 时仍可解析；无解析器时省略
+func TestRunSidecarPaths(t *testing.T) {
+	sc := &SidecarOptions{ExtraFields: []string{"src_path", "out_path"}}
+	w := &resolvingWriter{}
+	comp := Components{Reader: resolvingReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, Sidecar: sc, ManifestPath: filepath.Join(t.TempDir(), "manifest.json")}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.TrimSpace(w.rows.String()); got != `{"file_id":"f","src_path":"/src/f","out_path":"/out/f","from":0,"to":0,"dst":"ok"}` {
+		t.Fatalf("row = %s", got)
+	}
+	plain := &jsonlWriter{}
+	comp.Reader, comp.Writer = stubReader{}, plain
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, Sidecar: sc}, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.TrimSpace(plain.rows.String()); got != `{"file_id":"f","from":0,"to":0,"dst":"ok"}` {
+		t.Fatalf("unresolvable row = %s", got)
+	}
+}
+
+// pathsReader 依次以给定路径为 FileID 产出文件
+type pathsReader struct{ paths []string }
+
+func (r pathsReader) Iterate(ctx context.Context, roots []string, yield func(contract.FileID, io.ReadCloser) error) error {
+	for _, p := range r.paths {
+		if err := yield(contract.NormalizeFileID(p), io.NopCloser(strings.NewReader("data"))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// varsPB 记录每次构造 Prompt 时收到的逐文件变量（批次并发构造，需加锁）
+type varsPB struct {
+	stubPB
+	mu  sync.Mutex
+	got []string
+}
+
+func (p *varsPB) BuildWithVars(ctx context.Context, b contract.Batch, vars map[string]string) (contract.Prompt, error) {
+	p.mu.Lock()
+	p.got = append(p.got, vars["target_lang"])
+	p.mu.Unlock()
+	return nil, nil
+}
+
+func (p *varsPB) Build(ctx context.Context, b contract.Batch) (contract.Prompt, error) {
+	p.mu.Lock()
+	p.got = append(p.got, "")
+	p.mu.Unlock()
+	return nil, nil
+}
+
+// TestRunFileLang 文件名规则与伴随 .lang 文件推导逐文件目标语言；伴随文件优先，无命中走普通 Build
+func TestRunFileLang(t *testing.T) {
+	dir := t.TempDir()
+	zh := filepath.Join(dir, "a.zh.srt")
+	ja := filepath.Join(dir, "b.zh.srt")
+	none := filepath.Join(dir, "c.srt")
+	if err := os.WriteFile(filepath.Join(dir, "b.zh.lang"), []byte(" Japanese\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pb := &varsPB{}
+	comp := Components{Reader: pathsReader{paths: []string{zh, ja, none}}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: pb, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: &stubWriter{}}
+	fl := &FileLangOptions{Rules: []FileLangRule{{Pattern: "*.zh.srt", Lang: "Chinese"}}, CompanionExt: ".lang"}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{dir}, Concurrency: 1, FileLang: fl}, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if want := []string{"Chinese", "Japanese", ""}; fmt.Sprint(pb.got) != fmt.Sprint(want) {
+		t.Fatalf("vars = %q, want %q", pb.got, want)
+	}
+	comp.PromptBuilder = stubPB{}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{dir}, Concurrency: 1, FileLang: fl}, nil); err == nil {
+		t.Fatalf("非上下文 PromptBuilder 应被拒绝")
+	}
+}
+
+// localePB 记录每次构造 Prompt 时收到的 locale/target_lang
+type localePB struct {
+	stubPB
+	got []string
+}
+
+func (p *localePB) BuildWithVars(ctx context.Context, b contract.Batch, vars map[string]string) (contract.Prompt, error) {
+	p.got = append(p.got, vars["locale"]+"/"+vars["target_lang"])
+	return nil, nil
+}
+
+// TestRunLocale 区域设置作为模板变量注入每个文件，并与逐文件目标语言合并
+func TestRunLocale(t *testing.T) {
+	pb := &localePB{}
+	comp := Components{Reader: pathsReader{paths: []string{"a.zh.srt", "c.srt"}}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: pb, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: &stubWriter{}}
+	fl := &FileLangOptions{Rules: []FileLangRule{{Pattern: "*.zh.srt", Lang: "Chinese"}}}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, FileLang: fl, Locale: "zh-CN"}, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if want := []string{"zh-CN/Chinese", "zh-CN/"}; fmt.Sprint(pb.got) != fmt.Sprint(want) {
+		t.Fatalf("vars = %q, want %q", pb.got, want)
+	}
+}
+
+// flushWriter 记录 Flush 调用
+type flushWriter struct {
+	stubWriter
+	flushed int
+	ctxErr  error
+	err     error
+}
+
+func (w *flushWriter) Flush(ctx context.Context) error {
+	w.flushed++
+	w.ctxErr = ctx.Err()
+	return w.err
+}
+
+// TestRunFlush Writer 实现 Flusher 时，运行结束（含失败）调用一次 Flush，且传入的 ctx 不随运行取消；
+// Flush 失败与文件失败合并返回
+func TestRunFlush(t *testing.T) {
+	w := &flushWriter{}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1}, nil); err != nil || w.flushed != 1 {
+		t.Fatalf("run: err=%v flushed=%d", err, w.flushed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = Run(ctx, comp, Settings{Inputs: []string{"in"}, Concurrency: 1}, nil)
+	if w.flushed != 2 || w.ctxErr != nil {
+		t.Fatalf("cancelled run: flushed=%d flush ctx err=%v", w.flushed, w.ctxErr)
+	}
+	w.err = contract.ErrPathInvalid
+	comp.Reader, comp.LLM = pathsReader{paths: []string{"bad1", "ok1"}}, badLLM{}
+	err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, ContinueOnError: true}, nil)
+	if !errors.Is(err, contract.ErrInvalidInput) || !errors.Is(err, contract.ErrPathInvalid) || !strings.Contains(err.Error(), "1 file(s) failed") {
+		t.Fatalf("failed run with flush error: %v", err)
+	}
+}
+
+// notesLLM 返回带 notes 附加字段的逐条 JSON
+type notesLLM struct{}
+
+func (notesLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	return contract.Raw{Text: `[{"id":0,"text":"你好","notes":"casual greeting"}]`}, nil
+}
+
+// TestRunNotesSidecarOnly srtjson 配置 meta_fields 后，notes 进入 JSONL 边车的 meta，而不进入主工件
+func TestRunNotesSidecarOnly(t *testing.T) {
+	dec, _ := dsrt.New(json.RawMessage(`{"meta_fields":["notes"]}`))
+	w := &artifactWriter{out: map[string]string{}}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: notesLLM{}, Decoder: dec, Assembler: stubAssembler{}, Writer: w}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1}, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if main := w.out["f"]; main != "你好\n\n" {
+		t.Fatalf("main artifact = %q", main)
+	}
+	var row struct {
+		Dst  string            `json:"dst"`
+		Meta map[string]string `json:"meta"`
+	}
+	if err := json.Unmarshal([]byte(w.out["f.jsonl"]), &row); err != nil || row.Meta["notes"] != "casual greeting" || row.Dst != "你好" {
+		t.Fatalf("sidecar row = %s (%v)", w.out["f.jsonl"], err)
+	}
+}
+
+// artifactWriter 按工件 ID 记录写出内容（主工件与边车由不同 goroutine 写出，需加锁）
+type artifactWriter struct {
+	mu  sync.Mutex
+	out map[string]string
+}
+
+func (w *artifactWriter) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	w.mu.Lock()
+	w.out[string(id)] = string(b)
+	w.mu.Unlock()
+	return err
+}
+
+// badLLM 对 FileID 以 bad 开头的文件返回不可重试错误
+type badLLM struct{}
+
+func (badLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	if strings.HasPrefix(string(b.Records[0].FileID), "bad") {
+		return contract.Raw{}, contract.ErrInvalidInput
+	}
+	return contract.Raw{Text: "raw"}, nil
+}
+
+// TestRunContinueOnError 失败文件被跳过并汇总返回；连续失败达到上限即熔断，任一成功清零计数
+func TestRunContinueOnError(t *testing.T) {
+	cases := []struct {
+		name  string
+		paths []string
+		max   int
+		want  string
+		msg   string
+	}{
+		{"continue", []string{"bad1", "ok1", "bad2", "ok2"}, 0, "okok", "2 file(s) failed"},
+		{"trip", []string{"bad1", "bad2", "ok1"}, 2, "", "2 consecutive file failures"},
+		{"reset", []string{"bad1", "ok1", "bad2", "ok2"}, 2, "okok", "2 file(s) failed"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &stubWriter{}
+			comp := Components{Reader: pathsReader{paths: tc.paths}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: badLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: w}
+			set := Settings{Inputs: []string{"in"}, Concurrency: 1, ContinueOnError: true, MaxConsecutiveFailures: tc.max}
+			err := Run(context.Background(), comp, set, nil)
+			if err == nil || !strings.Contains(err.Error(), tc.msg) || !errors.Is(err, contract.ErrInvalidInput) {
+				t.Fatalf("err = %v, want %q", err, tc.msg)
+			}
+			if got := w.out.String(); got != tc.want {
+				t.Fatalf("output = %q, want %q", got, tc.want)
+			}
+		})
+	}
+	// 默认模式：首个失败即终止
+	w := &stubWriter{}
+	comp := Components{Reader: pathsReader{paths: []string{"bad1", "ok1"}}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: badLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1}, nil); err == nil || w.out.Len() != 0 {
+		t.Fatalf("err=%v output=%q", err, w.out.String())
+	}
+}
+
+// TestDumpBatches 仅切批并输出批边界、记录索引与估算 token；不调用 LLM、不写出工件
+func TestDumpBatches(t *testing.T) {
+	w := &stubWriter{}
+	comp := Components{Reader: stubReader{}, Splitter: manySplitter{}, Batcher: &limitBatcher{}, PromptBuilder: stubPB{overhead: 20}, LLM: blockedLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	var out strings.Builder
+	if err := DumpBatches(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, MaxTokens: 120}, &out); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	var rep BatchReport
+	if err := json.Unmarshal([]byte(out.String()), &rep); err != nil {
+		t.Fatalf("decode report: %v\n%s", err, out.String())
+	}
+	if rep.BudgetTokens != 100 || rep.OverheadTokens != 20 || len(rep.Batches) != 2 {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+	b := rep.Batches[1]
+	if b.BatchIndex != 1 || b.TargetFrom != 10 || b.TargetTo != 19 || len(b.Records) != 10 || b.Records[0] != 10 || b.EstimatedTokens != 10 {
+		t.Fatalf("unexpected batch: %+v", b)
+	}
+	if w.out.Len() != 0 {
+		t.Fatalf("dump should not write artifacts")
+	}
+}
+
+// retryBlockedLLM 模拟客户端 retry 策略下的拦截（blocked + 无效响应），记录调用次数
+type retryBlockedLLM struct{ calls atomic.Int32 }
+
+func (l *retryBlockedLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	l.calls.Add(1)
+	return contract.Raw{}, fmt.Errorf("blocked (SAFETY): %w: %w", contract.ErrResponseBlocked, contract.ErrResponseInvalid)
+}
+
+// TestRunOnBlocked 拦截默认不重试；passthrough 策略改为原文透传；fail 策略压过 retry_on 与客户端透传
+func TestRunOnBlocked(t *testing.T) {
+	llm := &retryBlockedLLM{}
+	w := &stubWriter{}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: llm, Decoder: &passDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxRetries: 2, RetryOn: []diag.Code{diag.CodeProtocol}}
+	if err := Run(context.Background(), comp, set, nil); !errors.Is(err, contract.ErrResponseBlocked) || llm.calls.Load() != 1 {
+		t.Fatalf("default: err=%v calls=%d", err, llm.calls.Load())
+	}
+
+	set.OnBlocked = OnBlockedPassthrough
+	if err := Run(context.Background(), comp, set, nil); err != nil || w.out.String() != "src:hi" {
+		t.Fatalf("passthrough: err=%v out=%q", err, w.out.String())
+	}
+
+	llm.calls.Store(0)
+	set.OnBlocked = OnBlockedFail
+	set.RetryOn = []diag.Code{diag.CodeBlocked}
+	if err := Run(context.Background(), comp, set, nil); !errors.Is(err, contract.ErrResponseBlocked) || llm.calls.Load() != 1 {
+		t.Fatalf("fail: err=%v calls=%d", err, llm.calls.Load())
+	}
+	comp.LLM = blockedLLM{}
+	if err := Run(context.Background(), comp, set, nil); !errors.Is(err, contract.ErrSourcePassthrough) {
+		t.Fatalf("fail should override client passthrough, got %v", err)
+	}
+
+	comp.Decoder = &stubDecoder{}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, OnBlocked: OnBlockedPassthrough}, nil); err == nil {
+		t.Fatalf("passthrough without passthrough decoder should be rejected")
+	}
+}
+
+// streamLLM 流式桩件：首个流截断（响应无效），之后按 3 字节切块返回完整 JSON 数组。
+type streamLLM struct{ streams, invokes atomic.Int32 }
+
+func (l *streamLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	l.invokes.Add(1)
+	return contract.Raw{Text: `[{"id":0,"text":"hola"}]`}, nil
+}
+
+func (l *streamLLM) InvokeStream(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.RawStream, error) {
+	text := `[{"id":0,"text":"hola"}]`
+	if l.streams.Add(1) == 1 {
+		text = `[{"id":0,"te`
+	}
+	return &sliceStream{text: text, model: "m-stream"}, nil
+}
+
+type sliceStream struct{ text, model string }
+
+func (s *sliceStream) Model() string { return s.model }
+
+func (s *sliceStream) Next() (string, bool, error) {
+	n := min(3, len(s.text))
+	chunk := s.text[:n]
+	s.text = s.text[n:]
+	return chunk, s.text == "", nil
+}
+
+func (s *sliceStream) Close() error { return nil }
+
+// 流式路径：客户端与解码器均支持流式时走 InvokeStream + DecodeStream；截断的流按响应无效重试
+func TestRunStreamDecode(t *testing.T) {
+	llm := &streamLLM{}
+	dec, _ := dsrt.New(nil)
+	w := &stubWriter{}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: llm, Decoder: dec, Assembler: stubAssembler{}, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxRetries: 1}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if llm.streams.Load() != 2 || llm.invokes.Load() != 0 {
+		t.Fatalf("streams=%d invokes=%d", llm.streams.Load(), llm.invokes.Load())
+	}
+	if w.out.String() != "hola\n\n" {
+		t.Fatalf("out = %q", w.out.String())
+	}
+}
+
+// 流式路径同样记录流报告的实际模型（边车 model 字段；经捕获包装亦然）
+func TestRunStreamModel(t *testing.T) {
+	for _, capture := range []string{"", t.TempDir()} {
+		llm := &streamLLM{}
+		llm.streams.Store(1) // 跳过首个截断流
+		dec, _ := dsrt.New(nil)
+		w := &jsonlWriter{}
+		comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: llm, Decoder: dec, Assembler: stubAssembler{}, Writer: w}
+		set := Settings{Inputs: []string{"in"}, Concurrency: 1, DebugCaptureDir: capture, Sidecar: &SidecarOptions{ExtraFields: []string{"model"}}}
+		if err := Run(context.Background(), comp, set, nil); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		if !strings.Contains(w.rows.String(), `"model":"m-stream"`) {
+			t.Fatalf("capture=%q: sidecar row = %s", capture, w.rows.String())
+		}
+	}
+}
+
+// DebugCaptureDir：库调用方仅设置目录时由 Run 包装捕获；捕获不关闭流式路径
+func TestRunDebugCaptureStream(t *testing.T) {
+	llm := &streamLLM{}
+	llm.streams.Store(1) // 跳过首个截断流
+	dec, _ := dsrt.New(nil)
+	dir := t.TempDir()
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: llm, Decoder: dec, Assembler: stubAssembler{}, Writer: &stubWriter{}}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, DebugCaptureDir: dir}, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if llm.streams.Load() != 2 || llm.invokes.Load() != 0 {
+		t.Fatalf("capture must keep streaming: streams=%d invokes=%d", llm.streams.Load(), llm.invokes.Load())
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "f", "0", "response.txt")); err != nil || string(b) != `[{"id":0,"text":"hola"}]` {
+		t.Fatalf("response.txt = %q (%v)", b, err)
+	}
+}
+
+// readerLLM 以 Raw.Reader 移交响应（不物化 Text），记录 Reader 是否被关闭。
+type readerLLM struct{ closed atomic.Int32 }
+
+func (l *readerLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	return contract.Raw{Reader: &closeTracker{Reader: strings.NewReader(`[{"id":0,"text":"hola"}]`), n: &l.closed}}, nil
+}
+
+type closeTracker struct {
+	io.Reader
+	n *atomic.Int32
+}
+
+func (c *closeTracker) Close() error { c.n.Add(1); return nil }
+
+// rawDecoder 记录收到的 Raw（仅实现 Decode）。
+type rawDecoder struct{ got contract.Raw }
+
+func (d *rawDecoder) Decode(ctx context.Context, tgt contract.Target, raw contract.Raw) ([]contract.SpanResult, error) {
+	d.got = raw
+	return []contract.SpanResult{{FileID: tgt.FileID, From: tgt.From, To: tgt.To, Output: raw.Text}}, nil
+}
+
+// Raw.Reader：流式解码器边读边解析；不支持流式的解码器收到已物化的 Text；两种情形 Reader 均被关闭
+func TestRunRawReader(t *testing.T) {
+	llm := &readerLLM{}
+	sdec, _ := dsrt.New(nil)
+	w := &stubWriter{}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: llm, Decoder: sdec, Assembler: stubAssembler{}, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if w.out.String() != "hola\n\n" || llm.closed.Load() != 1 {
+		t.Fatalf("stream: out = %q closed = %d", w.out.String(), llm.closed.Load())
+	}
+	dec := &rawDecoder{}
+	comp.Decoder, comp.Writer = dec, &stubWriter{}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if dec.got.Reader != nil || dec.got.Text != `[{"id":0,"text":"hola"}]` || llm.closed.Load() != 2 {
+		t.Fatalf("fallback: raw = %+v closed = %d", dec.got, llm.closed.Load())
+	}
+}
+
+// stallLLM 流式桩件：首个流读到一半以网络类超时中断（模拟块间空闲超时），之后返回完整数组。
+type stallLLM struct{ streamLLM }
+
+func (l *stallLLM) InvokeStream(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.RawStream, error) {
+	if l.streams.Add(1) == 1 {
+		return &stalledStream{}, nil
+	}
+	return &sliceStream{text: `[{"id":0,"text":"hola"}]`}, nil
+}
+
+type stalledStream struct{ n int }
+
+func (s *stalledStream) Next() (string, bool, error) {
+	if s.n++; s.n == 1 {
+		return `[{"id":0,`, false, nil
+	}
+	return "", false, timeoutErr{}
+}
+
+func (s *stalledStream) Close() error { return nil }
+
+// timeoutErr 模拟读取超时（net.Error，Timeout=true）
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "stream idle" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+// 流式读取中断（网络类）按调用重试预算处理：解码重试为 0 时仍会重新请求
+func TestRunStreamNetworkRetry(t *testing.T) {
+	llm := &stallLLM{}
+	dec, _ := dsrt.New(nil)
+	w := &stubWriter{}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: llm, Decoder: dec, Assembler: stubAssembler{}, Writer: w}
+	one, zero := 1, 0
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxInvokeRetries: &one, MaxDecodeRetries: &zero}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if llm.streams.Load() != 2 || w.out.String() != "hola\n\n" {
+		t.Fatalf("streams=%d out=%q", llm.streams.Load(), w.out.String())
+	}
+}
+
+// blockedStreamLLM 流式桩件：流在首块即报告拦截（如 content_filter），调用期不报错。
+type blockedStreamLLM struct{ streamLLM }
+
+func (l *blockedStreamLLM) InvokeStream(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.RawStream, error) {
+	l.streams.Add(1)
+	return blockedStream{}, nil
+}
+
+type blockedStream struct{}
+
+func (blockedStream) Next() (string, bool, error) {
+	return "", false, fmt.Errorf("blocked (content_filter): %w: %w", contract.ErrResponseBlocked, contract.ErrResponseInvalid)
+}
+
+func (blockedStream) Close() error { return nil }
+
+// 读取途中发现的拦截同样按 on_blocked 处理：passthrough 以原文透传，fail 不重试
+func TestRunStreamBlocked(t *testing.T) {
+	llm := &blockedStreamLLM{}
+	dec, _ := dsrt.New(nil)
+	w := &stubWriter{}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: llm, Decoder: dec, Assembler: stubAssembler{}, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, MaxRetries: 2, OnBlocked: OnBlockedPassthrough}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if llm.streams.Load() != 1 || !strings.Contains(w.out.String(), "hi") {
+		t.Fatalf("streams=%d out=%q", llm.streams.Load(), w.out.String())
+	}
+	llm.streams.Store(0)
+	set.OnBlocked, set.RetryOn = OnBlockedFail, []diag.Code{diag.CodeBlocked}
+	comp.Writer = &stubWriter{}
+	if err := Run(context.Background(), comp, set, nil); !errors.Is(err, contract.ErrResponseBlocked) || llm.streams.Load() != 1 {
+		t.Fatalf("fail policy: streams=%d err=%v", llm.streams.Load(), err)
+	}
+}
+
+// rangeBatcher 产出目标区间越出批内记录的非法批
+type rangeBatcher struct{}
+
+func (rangeBatcher) Make(ctx context.Context, records []contract.Record, limit contract.BatchLimit) ([]contract.Batch, error) {
+	return []contract.Batch{{FileID: "f", BatchIndex: 0, Records: records, TargetFrom: records[0].Index, TargetTo: records[0].Index + 1}}, nil
+}
+
+// Batcher 输出的目标区间须落在批内记录中，否则按不变量违例失败
+func TestRunValidateBatches(t *testing.T) {
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: rangeBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}, Writer: &stubWriter{}}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1}, nil); !errors.Is(err, contract.ErrInvariantViolation) {
+		t.Fatalf("expect ErrInvariantViolation, got %v", err)
+	}
+}
+
+// idWriter 记录写出的工件 ID
+type idWriter struct {
+	mu  sync.Mutex
+	ids []contract.ArtifactID
+}
+
+func (w *idWriter) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	_, _ = io.Copy(io.Discard, r)
+	w.mu.Lock()
+	w.ids = append(w.ids, id)
+	w.mu.Unlock()
+	return nil
+}
+
+// 边车路径：默认与主工件同路；可集中到子目录并自定义扩展名；越界目录与非法扩展名被拒绝
+func TestRunSidecarPath(t *testing.T) {
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}}
+	for _, c := range []struct{ dir, ext, want string }{
+		{"", "", "f.jsonl"},
+		{"qa", ".qa.jsonl", "qa/f.qa.jsonl"},
+	} {
+		w := &idWriter{}
+		comp.Writer = w
+		if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, SidecarDir: c.dir, SidecarExt: c.ext}, nil); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		if len(w.ids) != 2 || !((w.ids[0] == "f" && w.ids[1] == contract.ArtifactID(c.want)) || (w.ids[1] == "f" && w.ids[0] == contract.ArtifactID(c.want))) {
+			t.Fatalf("ids = %v, want f and %s", w.ids, c.want)
+		}
+	}
+	if got := sidecarID("/data/a.srt", "qa", ""); got != "qa/data/a.srt.jsonl" {
+		t.Fatalf("absolute file id: %s", got)
+	}
+	for _, bad := range [][2]string{{"../qa", ""}, {"/qa", ""}, {"", "jsonl"}, {"", "./x"}} {
+		if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, SidecarDir: bad[0], SidecarExt: bad[1]}, nil); err == nil {
+			t.Fatalf("expect rejection for %v", bad)
+		}
+	}
+}
+
+// rateLLM 前 fails 次调用返回限流错误
+type rateLLM struct{ fails, calls int }
+
+func (l *rateLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	l.calls++
+	if l.calls <= l.fails {
+		return contract.Raw{}, contract.ErrRateLimited
+	}
+	return contract.Raw{Text: "raw"}, nil
+}
+
+// badDecoder 前 fails 次解码返回响应无效
+type badDecoder struct{ fails, calls int }
+
+func (d *badDecoder) Decode(ctx context.Context, tgt contract.Target, raw contract.Raw) ([]contract.SpanResult, error) {
+	d.calls++
+	if d.calls <= d.fails {
+		return nil, contract.ErrResponseInvalid
+	}
+	return []contract.SpanResult{{FileID: tgt.FileID, From: tgt.From, To: tgt.To, Output: "ok"}}, nil
+}
+
+// 调用与解码重试分别计数：各自上限内成功；任一超限即失败；未设置时沿用 MaxRetries
+func TestRunSplitRetries(t *testing.T) {
+	two, one := 2, 1
+	run := func(invokeFails, decodeFails int, set Settings) (int, error) {
+		llm := &rateLLM{fails: invokeFails}
+		comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: llm, Decoder: &badDecoder{fails: decodeFails}, Assembler: stubAssembler{}, Writer: &stubWriter{}}
+		set.Inputs, set.Concurrency = []string{"in"}, 1
+		err := Run(context.Background(), comp, set, nil)
+		return llm.calls, err
+	}
+	if calls, err := run(2, 1, Settings{MaxInvokeRetries: &two, MaxDecodeRetries: &one}); err != nil || calls != 4 {
+		t.Fatalf("within limits: calls=%d err=%v", calls, err)
+	}
+	if _, err := run(2, 0, Settings{MaxInvokeRetries: &one, MaxDecodeRetries: &two}); !errors.Is(err, contract.ErrRateLimited) {
+		t.Fatalf("invoke limit: expect ErrRateLimited, got %v", err)
+	}
+	if _, err := run(0, 2, Settings{MaxInvokeRetries: &two, MaxDecodeRetries: &one}); !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("decode limit: expect ErrResponseInvalid, got %v", err)
+	}
+	if calls, err := run(1, 1, Settings{MaxRetries: 1}); err != nil || calls != 3 {
+		t.Fatalf("fallback to MaxRetries: calls=%d err=%v", calls, err)
+	}
+}
+
+// streamSplitter 流式产出 n 条记录；产出 wait 条后等待首个 LLM 调用开始，验证处理先于读完输入
+type streamSplitter struct {
+	n, wait int
+	started chan struct{}
+}
+
+func (s *streamSplitter) Split(ctx context.Context, fileID contract.FileID, r io.Reader) ([]contract.Record, error) {
+	return nil, errors.New("unexpected Split")
+}
+
+func (s *streamSplitter) SplitStream(ctx context.Context, fileID contract.FileID, r io.Reader, emit func(contract.Record) error) error {
+	for i := 0; i < s.n; i++ {
+		if i == s.wait {
+			select {
+			case <-s.started:
+			case <-time.After(2 * time.Second):
+				return errors.New("no batch processed before input fully read")
+			}
+		}
+		if err := emit(contract.Record{Index: contract.Index(i), FileID: fileID, Text: "hi"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oneBatcher 每条记录一批（段内 BatchIndex 从 0 起）
+type oneBatcher struct{}
+
+func (oneBatcher) Make(ctx context.Context, records []contract.Record, limit contract.BatchLimit) ([]contract.Batch, error) {
+	out := make([]contract.Batch, len(records))
+	for i, r := range records {
+		out[i] = contract.Batch{FileID: r.FileID, BatchIndex: int64(i), Records: records[i : i+1], TargetFrom: r.Index, TargetTo: r.Index}
+	}
+	return out, nil
+}
+
+type startLLM struct{ once sync.Once; started chan struct{} }
+
+func (l *startLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	l.once.Do(func() { close(l.started) })
+	return contract.Raw{Text: "raw"}, nil
+}
+
+// 分段流式：输入未读完即开始处理；跨段批序全局连续、输出顺序稳定；与 SkipUnchanged 互斥
+func TestRunStreamSegments(t *testing.T) {
+	started := make(chan struct{})
+	w := &stubWriter{}
+	comp := Components{Reader: stubReader{}, Splitter: &streamSplitter{n: 10, wait: 6, started: started}, Batcher: oneBatcher{}, PromptBuilder: stubPB{}, LLM: &startLLM{started: started}, Decoder: idxDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 3, StreamSegmentRecords: 4}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.out.String(); got != "0,1,2,3,4,5,6,7,8,9," {
+		t.Fatalf("out = %q", got)
+	}
+	set.SkipUnchanged = true
+	comp.Writer = &hashWriter{}
+	if err := Run(context.Background(), comp, set, nil); err == nil {
+		t.Fatalf("expect stream + skip unchanged rejected")
+	}
+}
+
+// 成本护栏：额度不足的文件不启动，运行以 ErrCapReached 结束（ContinueOnError 不影响）；恰好用尽不视为触发
+func TestRunCaps(t *testing.T) {
+	comp := Components{Reader: pathsReader{paths: []string{"a", "b", "c"}}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: stubAssembler{}}
+	for _, set := range []Settings{
+		{Inputs: []string{"in"}, Concurrency: 1, MaxBatches: 2, ContinueOnError: true},
+		{Inputs: []string{"in"}, Concurrency: 1, MaxRecords: 2},
+	} {
+		w := &idWriter{}
+		comp.Writer = w
+		if err := Run(context.Background(), comp, set, nil); !errors.Is(err, ErrCapReached) {
+			t.Fatalf("expect ErrCapReached, got %v", err)
+		}
+		if len(w.ids) != 4 {
+			t.Fatalf("ids = %v, want a and b only", w.ids)
+		}
+		for _, id := range w.ids {
+			if strings.HasPrefix(string(id), "c") {
+				t.Fatalf("capped file written: %v", w.ids)
+			}
+		}
+	}
+	comp.Writer = &idWriter{}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, MaxBatches: 3, MaxRecords: 3}, nil); err != nil {
+		t.Fatalf("exact cap: %v", err)
+	}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, MaxBatches: -1}, nil); err == nil || errors.Is(err, ErrCapReached) {
+		t.Fatalf("expect negative cap rejected, got %v", err)
+	}
+	// 分段流式：逐批预留，额度耗尽即放弃当前文件
+	comp = Components{Reader: stubReader{}, Splitter: &streamSplitter{n: 10, wait: -1}, Batcher: oneBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: idxDecoder{}, Assembler: stubAssembler{}, Writer: &stubWriter{}}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 2, StreamSegmentRecords: 4, MaxBatches: 5}
+	if err := Run(context.Background(), comp, set, nil); !errors.Is(err, ErrCapReached) {
+		t.Fatalf("stream: expect ErrCapReached, got %v", err)
+	}
+	set.MaxBatches = 10
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("stream exact cap: %v", err)
+	}
+}
+
+// 批日志的源序号范围取自目标区间首尾记录的 Meta["seq"]（上下文记录不计）
+func TestSeqRange(t *testing.T) {
+	recs := []contract.Record{
+		{Index: 0, Meta: contract.Meta{"seq": "411"}},
+		{Index: 1, Meta: contract.Meta{"seq": "412"}},
+		{Index: 2, Meta: contract.Meta{"seq": "413"}},
+		{Index: 3, Meta: contract.Meta{"seq": "414"}},
+	}
+	for _, c := range []struct {
+		from, to contract.Index
+		want     string
+	}{{1, 2, "412-413"}, {3, 3, "414"}} {
+		if got := seqRange(contract.Batch{Records: recs, TargetFrom: c.from, TargetTo: c.to}); got != c.want {
+			t.Fatalf("[%d,%d] = %q, want %q", c.from, c.to, got, c.want)
+		}
+	}
+	if got := seqRange(contract.Batch{Records: []contract.Record{{Index: 0, Text: "x"}}}); got != "" {
+		t.Fatalf("records without seq: %q", got)
+	}
+}
+
+// 记录区间解析：单点/区间混合、空白容忍；非法格式与倒置区间被拒绝
+func TestParseRecordRanges(t *testing.T) {
+	rs, err := ParseRecordRanges(" 100-150, 7 ,3-3")
+	if err != nil || fmt.Sprint(rs) != "[{100 150} {7 7} {3 3}]" {
+		t.Fatalf("ranges = %v, err = %v", rs, err)
+	}
+	if rs, err := ParseRecordRanges(""); err != nil || rs != nil {
+		t.Fatalf("empty: %v %v", rs, err)
+	}
+	for _, bad := range []string{"0-3", "5-2", "a", "1-", "1,,2"} {
+		if _, err := ParseRecordRanges(bad); err == nil {
+			t.Fatalf("expect %q rejected", bad)
+		}
+	}
+}
+
+// pairBatcher 每批 2 条目标，Records 为整段记录（全部作为上下文可见）
+type pairBatcher struct{}
+
+func (pairBatcher) Make(ctx context.Context, records []contract.Record, limit contract.BatchLimit) ([]contract.Batch, error) {
+	var out []contract.Batch
+	for i := 0; i < len(records); i += 2 {
+		to := min(i+1, len(records)-1)
+		out = append(out, contract.Batch{FileID: records[0].FileID, BatchIndex: int64(len(out)), Records: records, TargetFrom: records[i].Index, TargetTo: records[to].Index})
+	}
+	return out, nil
+}
+
+// sixSplitter 产出 6 条记录，Index 自 10 起（验证区间按记录序号而非 Index 计）
+type sixSplitter struct{}
+
+func (sixSplitter) Split(ctx context.Context, fileID contract.FileID, r io.Reader) ([]contract.Record, error) {
+	recs := make([]contract.Record, 6)
+	for i := range recs {
+		recs[i] = contract.Record{Index: contract.Index(10 + i), FileID: fileID, Text: fmt.Sprintf("s%d", i+1)}
+	}
+	return recs, nil
+}
+
+// rangeLLM 记录每次调用的目标区间与可见记录数
+type rangeLLM struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *rangeLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	l.mu.Lock()
+	l.calls = append(l.calls, fmt.Sprintf("%d-%d/%d", b.TargetFrom, b.TargetTo, len(b.Records)))
+	l.mu.Unlock()
+	return contract.Raw{Text: "raw"}, nil
+}
+
+// rangeDecoder 译文渲染为 T<from>-<to>;，透传渲染为源文本
+type rangeDecoder struct{}
+
+func (rangeDecoder) Decode(ctx context.Context, tgt contract.Target, raw contract.Raw) ([]contract.SpanResult, error) {
+	return []contract.SpanResult{{FileID: tgt.FileID, From: tgt.From, To: tgt.To, Output: fmt.Sprintf("T%d-%d;", tgt.From, tgt.To)}}, nil
+}
+
+func (rangeDecoder) Passthrough(ctx context.Context, tgt contract.Target, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	var out []contract.SpanResult
+	for id := tgt.From; id <= tgt.To; id++ {
+		out = append(out, contract.SpanResult{FileID: tgt.FileID, From: id, To: id, Output: idxMeta[id][contract.MetaSrcText] + ";"})
+	}
+	return out, nil
+}
+
+// 记录区间：仅区间内目标调用 LLM（保留批内上下文），区间外原文透传，输出仍为完整文件；成本护栏只计翻译部分
+func TestRunRecordRanges(t *testing.T) {
+	llm := &rangeLLM{}
+	w := &stubWriter{}
+	comp := Components{Reader: stubReader{}, Splitter: sixSplitter{}, Batcher: pairBatcher{}, PromptBuilder: stubPB{}, LLM: llm, Decoder: rangeDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 2, RecordRanges: []RecordRange{{From: 3, To: 3}, {From: 2, To: 2}}, MaxBatches: 2, MaxRecords: 2}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := w.out.String(); got != "s1;T11-11;T12-12;s4;s5;s6;" {
+		t.Fatalf("out = %q", got)
+	}
+	sort.Strings(llm.calls)
+	if fmt.Sprint(llm.calls) != "[11-11/6 12-12/6]" {
+		t.Fatalf("calls = %v", llm.calls)
+	}
+
+	comp.Decoder = &stubDecoder{}
+	if err := Run(context.Background(), comp, set, nil); err == nil {
+		t.Fatalf("expect passthrough decoder required")
+	}
+	comp.Decoder = rangeDecoder{}
+	set.StreamSegmentRecords = 4
+	if err := Run(context.Background(), comp, set, nil); err == nil {
+		t.Fatalf("expect stream segments rejected")
+	}
+}
+
+// panicDecoder / panicWriter 模拟第三方组件在 goroutine 内 panic
+type panicDecoder struct{}
+
+func (panicDecoder) Decode(ctx context.Context, tgt contract.Target, raw contract.Raw) ([]contract.SpanResult, error) {
+	panic("decoder boom")
+}
+
+type panicWriter struct{}
+
+func (panicWriter) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	if strings.HasSuffix(string(id), ".jsonl") {
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}
+	panic("writer boom")
+}
+
+// worker 与写出 goroutine 内的 panic 被恢复为 CodePanic 错误，Run 返回错误而非崩溃
+func TestRunPanicRecovered(t *testing.T) {
+	diag.ResetMetrics()
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: stubLLM{}, Decoder: panicDecoder{}, Assembler: stubAssembler{}, Writer: &jsonlWriter{}}
+	err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 2}, nil)
+	if !errors.Is(err, diag.ErrPanic) || diag.Classify(err) != diag.CodePanic || !strings.Contains(err.Error(), "decoder boom") {
+		t.Fatalf("decoder panic: %v", err)
+	}
+	if n := diag.ErrorCounts()["worker"]["panic"]; n != 1 {
+		t.Fatalf("worker panic count = %d", n)
+	}
+	comp.Decoder, comp.Writer = &stubDecoder{}, panicWriter{}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1}, nil); !errors.Is(err, diag.ErrPanic) {
+		t.Fatalf("writer panic: %v", err)
+	}
+}
+
+// srtReader 产出带扩展名的单个文件
+type srtReader struct{}
+
+func (srtReader) Iterate(ctx context.Context, roots []string, yield func(contract.FileID, io.ReadCloser) error) error {
+	return yield(contract.FileID("d/m.srt"), io.NopCloser(strings.NewReader("data")))
+}
+
+// partsWriter 记录分片工件的写出顺序；写满 n 个分片后关闭 ready
+type partsWriter struct {
+	mu    sync.Mutex
+	order []string
+	out   map[string]string
+	n     int
+	ready chan struct{}
+}
+
+func (w *partsWriter) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.out[string(id)] = string(b)
+	if strings.Contains(string(id), ".part-") {
+		w.order = append(w.order, string(id))
+		if len(w.order) == w.n {
+			close(w.ready)
+		}
+	}
+	return err
+}
+
+// lateLLM 首批等待其余分片写出后才返回
+type lateLLM struct{ ready chan struct{} }
+
+func (l lateLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	if b.BatchIndex == 0 {
+		select {
+		case <-l.ready:
+		case <-ctx.Done():
+			return contract.Raw{}, ctx.Err()
+		}
+	}
+	return contract.Raw{Text: "raw"}, nil
+}
+
+// 无序输出：每批完成即写出分片工件（不等待更早的批），不写主工件；与 SkipUnchanged 互斥
+func TestRunUnorderedOutput(t *testing.T) {
+	w := &partsWriter{out: map[string]string{}, n: 2, ready: make(chan struct{})}
+	comp := Components{Reader: srtReader{}, Splitter: sixSplitter{}, Batcher: pairBatcher{}, PromptBuilder: stubPB{}, LLM: lateLLM{ready: w.ready}, Decoder: rangeDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	off := false
+	set := Settings{Inputs: []string{"in"}, Concurrency: 3, OrderedOutput: &off}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if last := w.order[len(w.order)-1]; len(w.order) != 3 || last != "d/m.part-000000.srt" {
+		t.Fatalf("part order = %v", w.order)
+	}
+	if w.out["d/m.part-000001.srt"] != "T12-13;" || w.out["d/m.part-000000.srt"] != "T10-11;" {
+		t.Fatalf("parts = %v", w.out)
+	}
+	if _, ok := w.out["d/m.srt"]; ok {
+		t.Fatalf("unordered mode must not write the main artifact")
+	}
+	if _, ok := w.out["d/m.srt.jsonl"]; !ok {
+		t.Fatalf("sidecar missing: %v", w.out)
+	}
+	set.SkipUnchanged = true
+	comp.Writer = &hashWriter{}
+	if err := Run(context.Background(), comp, set, nil); err == nil || !strings.Contains(err.Error(), "unordered output") {
+		t.Fatalf("expect skip unchanged rejected, got %v", err)
+	}
+}
+
+func TestPartID(t *testing.T) {
+	for in, want := range map[string]string{"a/movie.srt": "a/movie.part-000003.srt", "noext": "noext.part-000003", ".hidden": ".hidden.part-000003", "a.b/c": "a.b/c.part-000003"} {
+		if got := partID(contract.FileID(in), 3); string(got) != want {
+			t.Fatalf("partID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// 多目标语言：同一组批按语言依次处理，工件与边车写至带语言后缀的 ID，语言经 target_lang 注入；成本护栏按语言数倍计
+func TestRunTargets(t *testing.T) {
+	w := &partsWriter{out: map[string]string{}}
+	pb := &varsPB{}
+	comp := Components{Reader: srtReader{}, Splitter: sixSplitter{}, Batcher: pairBatcher{}, PromptBuilder: pb, LLM: stubLLM{}, Decoder: rangeDecoder{}, Assembler: stubAssembler{}, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, Targets: []string{"zh", "ja"}}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if want := []string{"zh", "zh", "zh", "ja", "ja", "ja"}; fmt.Sprint(pb.got) != fmt.Sprint(want) {
+		t.Fatalf("vars = %q, want %q", pb.got, want)
+	}
+	for _, id := range []string{"d/m.zh.srt", "d/m.zh.srt.jsonl", "d/m.ja.srt", "d/m.ja.srt.jsonl"} {
+		if _, ok := w.out[id]; !ok {
+			t.Fatalf("artifact %s missing: %v", id, w.out)
+		}
+	}
+	if _, ok := w.out["d/m.srt"]; ok || len(w.out) != 4 {
+		t.Fatalf("unexpected artifacts: %v", w.out)
+	}
+	set.MaxBatches = 5
+	if err := Run(context.Background(), comp, set, nil); !errors.Is(err, ErrCapReached) {
+		t.Fatalf("caps: %v", err)
+	}
+	set.MaxBatches = 0
+	set.Targets = []string{"zh", "zh"}
+	if err := Run(context.Background(), comp, set, nil); err == nil || !strings.Contains(err.Error(), "duplicate target") {
+		t.Fatalf("expect duplicate rejected, got %v", err)
+	}
+	comp.PromptBuilder = stubPB{}
+	set.Targets = []string{"zh"}
+	if err := Run(context.Background(), comp, set, nil); err == nil {
+		t.Fatalf("非上下文 PromptBuilder 应被拒绝")
+	}
+}
+
+// 多目标语言配合真实线性装配器：spans 携带源 FileID，装配以源文件校验，各语言工件内容完整
+func TestRunTargetsLinearAssembler(t *testing.T) {
+	asm, err := linear.New(nil)
+	if err != nil {
+		t.Fatalf("linear: %v", err)
+	}
+	w := &partsWriter{out: map[string]string{}}
+	comp := Components{Reader: srtReader{}, Splitter: sixSplitter{}, Batcher: pairBatcher{}, PromptBuilder: &varsPB{}, LLM: stubLLM{}, Decoder: rangeDecoder{}, Assembler: asm, Writer: w}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 2, Targets: []string{"zh", "ja"}}
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	for _, id := range []string{"d/m.zh.srt", "d/m.ja.srt"} {
+		if got := w.out[id]; got != "T10-11;T12-13;T14-15;" {
+			t.Fatalf("%s = %q", id, got)
+		}
+	}
+}
+
+// finishAssembler 记录 FinishFile 调用
+type finishAssembler struct {
+	stubAssembler
+	mu       sync.Mutex
+	finished []contract.FileID
+}
+
+func (a *finishAssembler) FinishFile(fid contract.FileID) {
+	a.mu.Lock()
+	a.finished = append(a.finished, fid)
+	a.mu.Unlock()
+}
+
+// 装配器实现 FileFinisher 时，每个目标的批全部装配后以源 FileID 调用一次（失败亦然）
+func TestRunFinishFile(t *testing.T) {
+	asm := &finishAssembler{}
+	comp := Components{Reader: stubReader{}, Splitter: stubSplitter{}, Batcher: stubBatcher{}, PromptBuilder: &varsPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{}, Assembler: asm, Writer: &stubWriter{}}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1, Targets: []string{"zh", "ja"}}, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if fmt.Sprint(asm.finished) != "[f f]" {
+		t.Fatalf("finished = %v", asm.finished)
+	}
+	asm.finished = nil
+	comp.Reader, comp.LLM = pathsReader{paths: []string{"bad1"}}, badLLM{}
+	if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1}, nil); err == nil || fmt.Sprint(asm.finished) != "[bad1]" {
+		t.Fatalf("failed run: err=%v finished=%v", err, asm.finished)
+	}
+}
+
+// 零记录的源在多目标语言下为每种语言写出空工件；跳过未变更按各语言工件记录摘要，缺任一语言的摘要即整体重跑
+func TestRunTargetsEmptySkipUnchanged(t *testing.T) {
+	w := &hashWriter{hashes: map[contract.ArtifactID]string{}}
+	comp := Components{
+		Reader: textReader{"x"}, Splitter: nopSplitter{}, Batcher: stubBatcher{},
+		PromptBuilder: &varsPB{}, LLM: stubLLM{}, Decoder: &stubDecoder{},
+		Assembler: stubAssembler{}, Writer: w,
+	}
+	set := Settings{Inputs: []string{"in"}, Concurrency: 1, Targets: []string{"zh", "ja"}, SkipUnchanged: true}
+	for i := 0; i < 2; i++ {
+		if err := Run(context.Background(), comp, set, nil); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+	if w.writes != 2 || len(w.hashes) != 2 || w.hashes["f.zh"] == "" || w.hashes["f.ja"] == "" {
+		t.Fatalf("writes=%d hashes=%v", w.writes, w.hashes)
+	}
+	delete(w.hashes, "f.ja")
+	if err := Run(context.Background(), comp, set, nil); err != nil {
+		t.Fatalf("rerun: %v", err)
+	}
+	if w.writes != 4 || w.hashes["f.ja"] == "" {
+		t.Fatalf("expect both targets rewritten: writes=%d hashes=%v", w.writes, w.hashes)
+	}
+}
+
+func TestTargetID(t *testing.T) {
+	for in, want := range map[string]string{"a/movie.srt": "a/movie.zh.srt", "noext": "noext.zh", ".hidden": ".hidden.zh", "a.b/c": "a.b/c.zh"} {
+		if got := targetID(contract.FileID(in), "zh"); string(got) != want {
+			t.Fatalf("targetID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// textLLM 返回固定文本
+type textLLM struct{ text string }
+
+func (l textLLM) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	return contract.Raw{Text: l.text}, nil
+}
+
+// 说话人标签：srt Splitter 剥离的标签由各内置解码器在译文前还原（含透传），且不作为 meta 写入边车
+func TestRunSpeakerLabelsAcrossDecoders(t *testing.T) {
+	src := "1\n00:00:01,000 --> 00:00:02,000\nJOHN: Hello\n"
+	cases := []struct {
+		name string
+		new  func(json.RawMessage) (contract.Decoder, error)
+		resp string
+		pass bool // 解码器支持原文透传
+	}{
+		{"srtjson", dsrt.New, `[{"id":0,"text":"Hola"}]`, true},
+		{"linemap", dline.New, "Hola", true},
+		{"textjson", dtext.New, `[{"id":0,"text":"Hola"}]`, true},
+		{"spanjson", dspan.New, `{"from":0,"to":0,"text":"Hola"}`, false},
+	}
+	for _, c := range cases {
+		dec, _ := c.new(nil)
+		llms := []contract.LLMClient{textLLM{text: c.resp}}
+		if c.pass {
+			llms = append(llms, blockedLLM{})
+		}
+		for _, llm := range llms {
+			w := &artifactWriter{out: map[string]string{}}
+			comp := Components{Reader: textReader{text: src}, Splitter: ssrt.New(&ssrt.Options{PreserveSpeakerLabels: true, AllowExts: []string{}}), Batcher: stubBatcher{}, PromptBuilder: stubPB{}, LLM: llm, Decoder: dec, Assembler: stubAssembler{}, Writer: w}
+			if err := Run(context.Background(), comp, Settings{Inputs: []string{"in"}, Concurrency: 1}, nil); err != nil {
+				t.Fatalf("%s %T: run: %v", c.name, llm, err)
+			}
+			want := "JOHN: Hola"
+			if _, ok := llm.(blockedLLM); ok {
+				want = "JOHN: Hello"
+			}
+			if out := w.out["f"]; !strings.Contains(out, want) {
+				t.Fatalf("%s %T: output %q lacks %q", c.name, llm, out, want)
+			}
+			if side := w.out["f.jsonl"]; !strings.Contains(side, want) || strings.Contains(side, contract.MetaSpeaker) || strings.Contains(side, contract.MetaSrcText) {
+				t.Fatalf("%s %T: sidecar = %s", c.name, llm, side)
+			}
+		}
+	}
+}
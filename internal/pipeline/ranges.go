@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"llmspt/pkg/contract"
+)
+
+// RecordRange 记录区间：文件内记录序号（1 起，按拆分顺序，闭区间）。
+// 对规范 SRT 即字幕序号；与 Record.Index 的起点无关。
+type RecordRange struct {
+	From, To int
+}
+
+// ParseRecordRanges 解析逗号分隔的区间列表，如 "100-150,200,310-320"；空串返回 nil。
+func ParseRecordRanges(s string) ([]RecordRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var out []RecordRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("record range %q: invalid start", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return nil, fmt.Errorf("record range %q: invalid end", part)
+			}
+		}
+		if from < 1 || to < from {
+			return nil, fmt.Errorf("record range %q: want 1 <= from <= to", part)
+		}
+		out = append(out, RecordRange{From: from, To: to})
+	}
+	return out, nil
+}
+
+// validateRecordRanges 检查区间合法性（供 Settings 直接构造时使用）。
+func validateRecordRanges(rs []RecordRange) error {
+	for _, r := range rs {
+		if r.From < 1 || r.To < r.From {
+			return fmt.Errorf("pipeline: record range %d-%d: want 1 <= from <= to", r.From, r.To)
+		}
+	}
+	return nil
+}
+
+// selectRanges 将整文件切批结果裁剪到选中区间：
+//   - 目标与选中区间相交的部分保留为翻译批（Records 不变，区间外的记录退化为上下文）；
+//   - 未选中的目标部分改为透传批（Records 仅含该部分，不调用 LLM，由 Decoder 以原文渲染）；
+//
+// 按目标顺序重编 BatchIndex。返回的 pass 标记透传批；recs 为该文件的全部记录（Index 连续）。
+func selectRanges(batches []contract.Batch, recs []contract.Record, ranges []RecordRange) ([]contract.Batch, map[int64]bool) {
+	if len(recs) == 0 {
+		return batches, nil
+	}
+	base := recs[0].Index
+	sel := mergeRanges(ranges, base)
+	selected := func(i contract.Index) bool {
+		k := sort.Search(len(sel), func(k int) bool { return sel[k][1] >= i })
+		return k < len(sel) && sel[k][0] <= i
+	}
+	out := make([]contract.Batch, 0, len(batches))
+	pass := make(map[int64]bool)
+	for _, b := range batches {
+		for from := b.TargetFrom; from <= b.TargetTo; {
+			in := selected(from)
+			to := from
+			for to < b.TargetTo && selected(to+1) == in {
+				to++
+			}
+			nb := contract.Batch{FileID: b.FileID, BatchIndex: int64(len(out)), Records: b.Records, TargetFrom: from, TargetTo: to}
+			if !in {
+				nb.Records = recs[from-base : to-base+1]
+				pass[nb.BatchIndex] = true
+			}
+			out = append(out, nb)
+			from = to + 1
+		}
+	}
+	return out, pass
+}
+
+// mergeRanges 将 1 起的记录序号区间换算为 Index 区间（base 为首条记录的 Index），排序并合并重叠/相邻区间。
+func mergeRanges(ranges []RecordRange, base contract.Index) [][2]contract.Index {
+	out := make([][2]contract.Index, 0, len(ranges))
+	for _, r := range ranges {
+		out = append(out, [2]contract.Index{base + contract.Index(r.From-1), base + contract.Index(r.To-1)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i][0] < out[j][0] })
+	merged := out[:0]
+	for _, r := range out {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1]+1 {
+			if r[1] > merged[n-1][1] {
+				merged[n-1][1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
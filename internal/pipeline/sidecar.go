@@ -0,0 +1,231 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"llmspt/pkg/contract"
+)
+
+// SidecarOptions JSONL 边车（<artifact>.jsonl）的行结构配置。
+// 固定字段：file_id、from、to、dst；可选字段按开关或 ExtraFields 追加。
+type SidecarOptions struct {
+	// IncludeSrc: 输出 src（目标区间源文本，按 \n 连接）。
+	IncludeSrc bool
+	// IncludeMeta: 输出 meta（SpanResult.Meta）。
+	IncludeMeta bool
+	// ExtraFields: 追加字段名，取值见 SidecarFields。
+	ExtraFields []string
+}
+
+// SidecarFields 可追加的边车字段：
+// - batch: 批序（BatchIndex）；
+// - model: 实际响应的模型名（客户端回报时）；
+// - attempts: 该批成功前的调用次数（含成功一次）；
+// - src_path: 源文件绝对路径（Reader 实现 contract.PathResolver 且可解析时）；
+// - out_path: 主工件绝对输出路径（Writer 实现 contract.PathResolver 且可解析时）。
+var SidecarFields = []string{"batch", "model", "attempts", "src_path", "out_path"}
+
+// DefaultSidecarOptions 返回与历史行结构一致的默认配置（file_id,from,to,src,dst,meta）。
+func DefaultSidecarOptions() SidecarOptions {
+	return SidecarOptions{IncludeSrc: true, IncludeMeta: true}
+}
+
+// DefaultSidecarExt 边车的默认扩展名（追加在主工件 ID 之后）。
+const DefaultSidecarExt = ".jsonl"
+
+// sidecarID 构造边车工件 ID：<dir>/<fileID><ext>；dir 为空时与主工件同路（<fileID>.jsonl）。
+// fileID 的绝对前缀与盘符被去除后挂到 dir 之下；最终路径的越界校验仍由 Writer 负责。
+func sidecarID(fileID contract.FileID, dir, ext string) contract.ArtifactID {
+	if ext == "" {
+		ext = DefaultSidecarExt
+	}
+	id := string(fileID)
+	if dir == "" {
+		return contract.ArtifactID(id + ext)
+	}
+	id = filepath.ToSlash(strings.TrimPrefix(id, filepath.VolumeName(id)))
+	return contract.ArtifactID(path.Clean(filepath.ToSlash(dir)) + "/" + strings.TrimLeft(id, "/") + ext)
+}
+
+// writeSidecar 以 contract.SidecarWriter 写出边车（Writer 未实现时回退为 Write）。
+func writeSidecar(ctx context.Context, w contract.Writer, id contract.ArtifactID, r io.Reader) error {
+	if sw, ok := w.(contract.SidecarWriter); ok {
+		return sw.WriteSidecar(ctx, id, r)
+	}
+	return w.Write(ctx, id, r)
+}
+
+// ValidateSidecarPath 校验边车目录与扩展名（Run 启动时与 config.Validate 共用）：dir 须为相对路径且不以 ".." 逃逸；
+// ext 须以 "." 开头且不含路径分隔符。
+func ValidateSidecarPath(dir, ext string) error {
+	if dir != "" {
+		d := path.Clean(filepath.ToSlash(dir))
+		if path.IsAbs(d) || filepath.VolumeName(dir) != "" || d == ".." || strings.HasPrefix(d, "../") {
+			return fmt.Errorf("pipeline: sidecar dir %q must be a relative path inside the output", dir)
+		}
+	}
+	if ext != "" && (!strings.HasPrefix(ext, ".") || len(ext) < 2 || strings.ContainsAny(ext, `/\`)) {
+		return fmt.Errorf("pipeline: sidecar ext %q must start with '.' and contain no path separators", ext)
+	}
+	return nil
+}
+
+// validateSidecar 拒绝未知的追加字段。
+func validateSidecar(o SidecarOptions) error {
+	for _, f := range o.ExtraFields {
+		known := false
+		for _, k := range SidecarFields {
+			if f == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("pipeline: unknown sidecar field %q", f)
+		}
+	}
+	return nil
+}
+
+// sidecarRow 单行结构；字段顺序即输出顺序，可选字段以 omitempty/指针控制出现与否。
+type sidecarRow struct {
+	FileID   string        `json:"file_id"`
+	SrcPath  string        `json:"src_path,omitempty"`
+	OutPath  string        `json:"out_path,omitempty"`
+	From     int64         `json:"from"`
+	To       int64         `json:"to"`
+	Src      *string       `json:"src,omitempty"`
+	Dst      string        `json:"dst"`
+	Meta     contract.Meta `json:"meta,omitempty"`
+	Batch    *int64        `json:"batch,omitempty"`
+	Model    string        `json:"model,omitempty"`
+	Attempts int           `json:"attempts,omitempty"`
+}
+
+// batchInfo 随批结果携带的诊断信息（供追加字段使用）。
+type batchInfo struct {
+	model    string
+	attempts int
+}
+
+// sidecar 按配置把批结果编码为 JSONL 行写入 w。
+type sidecar struct {
+	fileID   contract.FileID
+	enc      *json.Encoder
+	src      bool
+	meta     bool
+	batch    bool
+	model    bool
+	attempts bool
+	srcPath  bool
+	outPath  bool
+	// 已解析的路径（逐文件不变，每行复用）
+	srcAbs, outAbs string
+}
+
+func newSidecar(w io.Writer, fileID contract.FileID, o SidecarOptions) *sidecar {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	s := &sidecar{fileID: fileID, enc: enc, src: o.IncludeSrc, meta: o.IncludeMeta}
+	for _, f := range o.ExtraFields {
+		switch f {
+		case "batch":
+			s.batch = true
+		case "model":
+			s.model = true
+		case "attempts":
+			s.attempts = true
+		case "src_path":
+			s.srcPath = true
+		case "out_path":
+			s.outPath = true
+		}
+	}
+	return s
+}
+
+// resolvePaths 按启用的路径字段解析源/输出绝对路径（输出按主工件 ID artifact 解析）；解析器为 nil 或无法解析时对应字段省略。
+func (s *sidecar) resolvePaths(src, out contract.PathResolver, artifact contract.ArtifactID) {
+	if s.srcPath && src != nil {
+		s.srcAbs, _ = src.ResolvePath(s.fileID)
+	}
+	if s.outPath && out != nil {
+		s.outAbs, _ = out.ResolvePath(artifact)
+	}
+}
+
+// emit 为一批的每个 span 写出一行：src 取 span 区间内的源 Records 文本，
+// dst 优先取 Meta["dst_text"]（纯译文），否则为 Output。
+func (s *sidecar) emit(b contract.Batch, spans []contract.SpanResult, info batchInfo) error {
+	recs := b.Records
+	// 移动指针，减少重复扫描
+	pos := 0
+	for _, sp := range spans {
+		row := sidecarRow{
+			FileID:  string(s.fileID),
+			SrcPath: s.srcAbs,
+			OutPath: s.outAbs,
+			From:    int64(sp.From),
+			To:      int64(sp.To),
+			Dst:     sp.Output,
+		}
+		if sp.Meta != nil {
+			if v := sp.Meta[contract.MetaDstText]; strings.TrimSpace(v) != "" {
+				row.Dst = v
+			}
+		}
+		if s.src {
+			for pos < len(recs) && recs[pos].Index < sp.From {
+				pos++
+			}
+			var sb strings.Builder
+			for j := pos; j < len(recs) && recs[j].Index <= sp.To; j++ {
+				if j > pos {
+					sb.WriteByte('\n')
+				}
+				sb.WriteString(recs[j].Text)
+			}
+			src := sb.String()
+			row.Src = &src
+		}
+		if s.meta {
+			row.Meta = publicMeta(sp.Meta)
+		}
+		if s.batch {
+			bi := b.BatchIndex
+			row.Batch = &bi
+		}
+		if s.model {
+			row.Model = info.model
+		}
+		if s.attempts {
+			row.Attempts = info.attempts
+		}
+		if err := s.enc.Encode(&row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publicMeta 去除下划线前缀的内部键（如 _src_text、_speaker）；无内部键时原样返回。
+func publicMeta(m contract.Meta) contract.Meta {
+	for k := range m {
+		if strings.HasPrefix(k, "_") {
+			out := make(contract.Meta, len(m))
+			for k, v := range m {
+				if !strings.HasPrefix(k, "_") {
+					out[k] = v
+				}
+			}
+			return out
+		}
+	}
+	return m
+}
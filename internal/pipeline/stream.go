@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"llmspt/pkg/contract"
+)
+
+// streamBatches 分段切批：将流式 Splitter 逐条产出的记录按 seg 条累积为一段，
+// 每段调用 Batcher.Make 并校验，BatchIndex 以文件内全局偏移重编号后依次交给 emit。
+// 段与段之间不共享上下文（首批的 ContextFrom 截断于段首），内存占用与 seg 成正比。
+// emit 阻塞即形成背压：下游未消费时不再继续读取输入。
+func streamBatches(ctx context.Context, b contract.Batcher, lim contract.BatchLimit, seg int,
+	split func(emit func(contract.Record) error) error, emit func(contract.Batch) error) error {
+	var next int64
+	recs := make([]contract.Record, 0, seg)
+	flush := func() error {
+		if len(recs) == 0 {
+			return nil
+		}
+		batches, err := b.Make(ctx, recs, lim)
+		if err == nil {
+			err = validateBatches(batches)
+		}
+		if err != nil {
+			return fmt.Errorf("batcher make: %w", err)
+		}
+		for _, bt := range batches {
+			bt.BatchIndex = next
+			next++
+			if err := emit(bt); err != nil {
+				return err
+			}
+		}
+		// 批引用了本段记录切片，下一段使用新切片
+		recs = make([]contract.Record, 0, seg)
+		return nil
+	}
+	var ferr error
+	err := split(func(r contract.Record) error {
+		recs = append(recs, r)
+		if len(recs) < seg {
+			return nil
+		}
+		ferr = flush()
+		return ferr
+	})
+	if ferr != nil {
+		return ferr
+	}
+	if err != nil {
+		return fmt.Errorf("splitter split: %w", err)
+	}
+	return flush()
+}
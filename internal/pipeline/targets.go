@@ -0,0 +1,39 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"llmspt/pkg/contract"
+)
+
+// targetID 多目标语言（Settings.Targets）下某语言的输出 ID：在源文件扩展名前插入 ".<lang>"，
+// 如 "a/movie.srt" → "a/movie.zh.srt"；无扩展名（含以 "." 开头的隐藏文件名）时直接追加后缀。
+// 边车与无序分片在此 ID 上继续派生（movie.zh.srt.jsonl、movie.zh.part-000003.srt）。
+func targetID(fileID contract.FileID, lang string) contract.FileID {
+	id := string(fileID)
+	ext := filepath.Ext(id)
+	if ext == filepath.Base(id) {
+		ext = ""
+	}
+	return contract.FileID(id[:len(id)-len(ext)] + "." + lang + ext)
+}
+
+// validateTargets 校验目标语言：非空、不含路径分隔符且互不重复（各语言的工件 ID 必须互异）。
+func validateTargets(langs []string) error {
+	seen := make(map[string]bool, len(langs))
+	for i, l := range langs {
+		if strings.TrimSpace(l) == "" || l != strings.TrimSpace(l) {
+			return fmt.Errorf("pipeline: target %d: %q must be non-empty without surrounding spaces", i, l)
+		}
+		if strings.ContainsAny(l, `/\`) {
+			return fmt.Errorf("pipeline: target %d: %q must not contain path separators", i, l)
+		}
+		if seen[l] {
+			return fmt.Errorf("pipeline: duplicate target %q", l)
+		}
+		seen[l] = true
+	}
+	return nil
+}
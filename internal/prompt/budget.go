@@ -1,6 +1,10 @@
 package prompt
 
-import "llmspt/pkg/contract"
+import (
+	"fmt"
+
+	"llmspt/pkg/contract"
+)
 
 // MakeEstimator 返回一个近似 token 估算器：tokens ≈ ceil(len(utf8_bytes)/bytesPerToken)。
 // 当 bytesPerToken<=0 时采用默认 4。
@@ -19,13 +23,41 @@ func MakeEstimator(bytesPerToken int) contract.TokenEstimator {
 }
 
 // EffectiveMaxTokens 计算预扣“固定提示开销”后的有效预算。
+// fixedOverhead>0 时不调用 PromptBuilder 的估算，直接以其作为开销（模板与估算器不一致时的逃生口）。
 // 返回 (effectiveMax, overheadTokens)。若 maxTokens<=0，返回 (0,0)。
-func EffectiveMaxTokens(pb contract.PromptBuilder, bytesPerToken int, maxTokens int) (int, int) {
+func EffectiveMaxTokens(pb contract.PromptBuilder, bytesPerToken int, maxTokens int, fixedOverhead int) (int, int) {
 	if maxTokens <= 0 {
 		return 0, 0
 	}
-	est := MakeEstimator(bytesPerToken)
-	overhead := pb.EstimateOverheadTokens(est)
+	overhead := fixedOverhead
+	if overhead <= 0 {
+		overhead = pb.EstimateOverheadTokens(MakeEstimator(bytesPerToken))
+	}
 	eff := maxTokens - overhead
 	return eff, overhead
 }
+
+// ExampleEstimator: PromptBuilder 的可选扩展——报告 few-shot 示例的 token 开销。
+type ExampleEstimator interface {
+	EstimateExampleTokens(estimate contract.TokenEstimator) int
+}
+
+// MaxExampleShare: few-shot 示例允许占用 MaxTokens 的最大比例。
+const MaxExampleShare = 0.5
+
+// CheckExampleShare 校验示例开销不超过 MaxTokens 的 MaxExampleShare；未实现 ExampleEstimator 或 maxTokens<=0 时跳过。
+// 超限返回包装 ErrBudgetExceeded 的错误。
+func CheckExampleShare(pb contract.PromptBuilder, bytesPerToken int, maxTokens int) error {
+	if maxTokens <= 0 {
+		return nil
+	}
+	ee, ok := pb.(ExampleEstimator)
+	if !ok {
+		return nil
+	}
+	ex := ee.EstimateExampleTokens(MakeEstimator(bytesPerToken))
+	if float64(ex) > float64(maxTokens)*MaxExampleShare {
+		return fmt.Errorf("%w: few-shot examples use ~%d tokens, over %.0f%% of max_tokens(%d)", contract.ErrBudgetExceeded, ex, MaxExampleShare*100, maxTokens)
+	}
+	return nil
+}
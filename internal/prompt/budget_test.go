@@ -2,6 +2,7 @@ package prompt
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"llmspt/pkg/contract"
@@ -18,7 +19,7 @@ func TestMakeEstimatorDefault(t *testing.T) {
 // UT-PRM-02: 0 token 输入
 func TestEffectiveMaxTokensZero(t *testing.T) {
 	pb := &mockPB{overhead: 0}
-	eff, over := EffectiveMaxTokens(pb, 0, 0)
+	eff, over := EffectiveMaxTokens(pb, 0, 0, 0)
 	if eff != 0 || over != 0 {
 		t.Fatalf("应返回 0,0")
 	}
@@ -35,8 +36,37 @@ func (m *mockPB) EstimateOverheadTokens(est contract.TokenEstimator) int { retur
 // 补充覆盖: 非零开销
 func TestEffectiveMaxTokensOverhead(t *testing.T) {
 	pb := &mockPB{overhead: 5}
-	eff, over := EffectiveMaxTokens(pb, 4, 10)
+	eff, over := EffectiveMaxTokens(pb, 4, 10, 0)
 	if eff != 5 || over != 5 {
 		t.Fatalf("预期 5,5 得到 %d,%d", eff, over)
 	}
 }
+
+// 固定开销覆盖：>0 时不调用估算器
+func TestEffectiveMaxTokensFixedOverhead(t *testing.T) {
+	pb := &mockPB{overhead: 5}
+	eff, over := EffectiveMaxTokens(pb, 4, 10, 2)
+	if eff != 8 || over != 2 {
+		t.Fatalf("预期 8,2 得到 %d,%d", eff, over)
+	}
+}
+
+type mockExamplePB struct {
+	mockPB
+	examples int
+}
+
+func (m *mockExamplePB) EstimateExampleTokens(est contract.TokenEstimator) int { return m.examples }
+
+// 补充覆盖: few-shot 示例占比校验
+func TestCheckExampleShare(t *testing.T) {
+	if err := CheckExampleShare(&mockPB{}, 4, 100); err != nil {
+		t.Fatalf("未实现扩展接口应跳过: %v", err)
+	}
+	if err := CheckExampleShare(&mockExamplePB{examples: 50}, 4, 100); err != nil {
+		t.Fatalf("恰好一半应通过: %v", err)
+	}
+	if err := CheckExampleShare(&mockExamplePB{examples: 51}, 4, 100); !errors.Is(err, contract.ErrBudgetExceeded) {
+		t.Fatalf("超过一半应返回预算错误, got %v", err)
+	}
+}
@@ -16,8 +16,18 @@ type Limits struct {
 	RPM             int // requests per minute
 	TPM             int // tokens per minute
 	MaxTokensPerReq int // 单次请求 token 上限（含输入+预期输出），0 表示不限制
+	// MinSleep: Wait 额度不足时的最小睡眠粒度；0 表示默认 10ms。高 RPM 下调低可减少空等。
+	MinSleep time.Duration
+	// PollStep: 长等待的分片步长（影响取消响应速度）；0 表示默认 200ms。
+	PollStep time.Duration
 }
 
+// 默认睡眠粒度（Limits 对应字段为 0 时生效）。
+const (
+	DefaultMinSleep = 10 * time.Millisecond
+	DefaultPollStep = 200 * time.Millisecond
+)
+
 // Ask: 一次放行申请。
 type Ask struct {
 	Key      LimitKey
@@ -71,6 +81,12 @@ type bucket struct {
 }
 
 func newEntry(lim Limits, now time.Time) *entry {
+	if lim.MinSleep <= 0 {
+		lim.MinSleep = DefaultMinSleep
+	}
+	if lim.PollStep <= 0 {
+		lim.PollStep = DefaultPollStep
+	}
 	e := &entry{lim: lim}
 	if lim.RPM > 0 {
 		e.req = newBucket(lim.RPM, now)
@@ -182,7 +198,7 @@ func (g *gate) Wait(ctx context.Context, a Ask) error {
 		return contract.ErrInvalidInput
 	}
 	// 最小睡眠粒度，避免忙等
-	const minSleep = 10 * time.Millisecond
+	minSleep := e.lim.MinSleep
 	for {
 		// 快速取消
 		select {
@@ -218,15 +234,14 @@ func (g *gate) Wait(ctx context.Context, a Ask) error {
 			d = minSleep
 		}
 		// 分片睡眠以响应 ctx 取消
-		if err := sleepCtx(ctx, d); err != nil {
+		if err := sleepCtx(ctx, d, e.lim.PollStep); err != nil {
 			return err
 		}
 	}
 }
 
-func sleepCtx(ctx context.Context, d time.Duration) error {
-	// 若 d 很长，分片为最多 200ms 的步长，及时响应取消
-	const step = 200 * time.Millisecond
+func sleepCtx(ctx context.Context, d, step time.Duration) error {
+	// 若 d 很长，分片为最多 step 的步长，及时响应取消
 	for d > 0 {
 		s := d
 		if s > step {
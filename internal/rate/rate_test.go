@@ -48,3 +48,38 @@ func TestDeriveKeyFromProviderOptions(t *testing.T) {
 		t.Fatalf("缺少 key 应失败")
 	}
 }
+
+// 睡眠粒度：未设置时回落默认值，显式设置时生效
+func TestGateSleepDefaults(t *testing.T) {
+	g := NewGate(map[LimitKey]Limits{"d": {RPM: 1}, "c": {RPM: 1, MinSleep: time.Millisecond, PollStep: 50 * time.Millisecond}}, nil).(*gate)
+	if e := g.m["d"]; e.lim.MinSleep != DefaultMinSleep || e.lim.PollStep != DefaultPollStep {
+		t.Fatalf("默认粒度不符: %+v", e.lim)
+	}
+	if e := g.m["c"]; e.lim.MinSleep != time.Millisecond || e.lim.PollStep != 50*time.Millisecond {
+		t.Fatalf("自定义粒度未生效: %+v", e.lim)
+	}
+}
+
+// BenchmarkGateWaitRPM6000 模拟争用：每次 Wait 前桶已被其他消费者（Try）耗尽，
+// 比较默认 10ms 下限与 1ms 下限下该调用方的吞吐（req/s）。下限越大，每次等待的过冲越多。
+func BenchmarkGateWaitRPM6000(b *testing.B) {
+	for _, bc := range []struct {
+		name     string
+		minSleep time.Duration
+	}{{"default", 0}, {"floor1ms", time.Millisecond}} {
+		b.Run(bc.name, func(b *testing.B) {
+			g := NewGate(map[LimitKey]Limits{"k": {RPM: 6000, MinSleep: bc.minSleep}}, nil)
+			ctx := context.Background()
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				for g.Try(Ask{Key: "k", Requests: 1}) {
+				}
+				if err := g.Wait(ctx, Ask{Key: "k", Requests: 1}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "req/s")
+		})
+	}
+}
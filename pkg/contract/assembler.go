@@ -15,3 +15,10 @@ import (
 type Assembler interface {
 	Assemble(ctx context.Context, fileID FileID, spans []SpanResult) (io.Reader, error)
 }
+
+// FileFinisher: Assembler 的可选扩展——释放单个文件的跨批装配状态（如重编号进度、跨批衔接位置）。
+// 编排层在某文件（多目标语言时为每个目标）的全部批装配结束后调用一次，成功、失败或取消均调用；
+// 之后同一 FileID 再次装配视为重新开始。
+type FileFinisher interface {
+	FinishFile(fileID FileID)
+}
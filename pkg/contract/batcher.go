@@ -1,6 +1,9 @@
 package contract
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
 // BatchLimit: 最小必要限制集合（滑动窗口模型）。
 // 仅包含与“是否可装入批”直接相关的上限参数。
@@ -20,3 +23,23 @@ type BatchLimit struct {
 type Batcher interface {
 	Make(ctx context.Context, records []Record, limit BatchLimit) ([]Batch, error)
 }
+
+// ValidateBatch 校验 Batcher 产出的单个 Batch 窗口：
+// Records 非空且 Index 连续递增（起点任意，不要求从 0 开始），
+// TargetFrom<=TargetTo 且均落在 [Records[0].Index, Records[len-1].Index] 内。
+// 违例返回包装 ErrInvariantViolation 的错误。
+func ValidateBatch(b Batch) error {
+	if len(b.Records) == 0 {
+		return fmt.Errorf("batch %d: empty records: %w", b.BatchIndex, ErrInvariantViolation)
+	}
+	for i, r := range b.Records {
+		if i > 0 && r.Index != b.Records[i-1].Index+1 {
+			return fmt.Errorf("batch %d: record index %d not contiguous: %w", b.BatchIndex, r.Index, ErrInvariantViolation)
+		}
+	}
+	first, last := b.Records[0].Index, b.Records[len(b.Records)-1].Index
+	if b.TargetFrom > b.TargetTo || b.TargetFrom < first || b.TargetTo > last {
+		return fmt.Errorf("batch %d: target [%d,%d] outside records [%d,%d]: %w", b.BatchIndex, b.TargetFrom, b.TargetTo, first, last, ErrInvariantViolation)
+	}
+	return nil
+}
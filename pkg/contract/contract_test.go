@@ -2,8 +2,11 @@ package contract
 
 import (
     "errors"
+    "io"
     "path/filepath"
+    "strings"
     "testing"
+    "testing/iotest"
 )
 
 // TestNormalizeFileID 验证路径规范化逻辑。
@@ -186,3 +189,88 @@ func TestCloneMeta(t *testing.T) {
     }
 }
 
+
+// TestAttachDstText 拷贝后写入 dst_text，不修改入参
+func TestAttachDstText(t *testing.T) {
+	src := Meta{"seq": "1"}
+	m := AttachDstText(src, "hi")
+	if m["seq"] != "1" || m[MetaDstText] != "hi" || len(src) != 1 {
+		t.Fatalf("unexpected meta %v / src %v", m, src)
+	}
+	if m := AttachDstText(nil, "x"); len(m) != 1 || m[MetaDstText] != "x" {
+		t.Fatalf("nil meta: %v", m)
+	}
+}
+
+// TestDetectEcho 全部输出与非空源文本一致才判定为回显
+func TestDetectEcho(t *testing.T) {
+	idx := IndexMetaMap{1: {MetaSrcText: "Hello"}, 2: {MetaSrcText: "Bye "}, 3: {}}
+	if !DetectEcho(idx, []Index{1, 2}, []string{" Hello", "Bye"}) {
+		t.Fatalf("expect echo")
+	}
+	cases := []struct {
+		ids   []Index
+		texts []string
+	}{
+		{[]Index{1, 2}, []string{"Hello", "再见"}},
+		{[]Index{3}, []string{""}},
+		{[]Index{1}, nil},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		if DetectEcho(idx, c.ids, c.texts) {
+			t.Fatalf("unexpected echo for %v %v", c.ids, c.texts)
+		}
+	}
+	if DetectEcho(nil, []Index{1}, []string{"Hello"}) {
+		t.Fatalf("nil idxMeta should not detect echo")
+	}
+}
+
+// TestRawMaterialize Reader 变体读尽后填入 Text 并关闭；读取错误原样返回；Body 对两种形态一致
+func TestRawMaterialize(t *testing.T) {
+	rc := &closeCounter{Reader: strings.NewReader("abc")}
+	r, err := Raw{Reader: rc, Model: "m"}.Materialize()
+	if err != nil || r.Text != "abc" || r.Reader != nil || r.Model != "m" || rc.closed != 1 {
+		t.Fatalf("materialize: %+v %v closed=%d", r, err, rc.closed)
+	}
+	if same, _ := (Raw{Text: "x"}).Materialize(); same.Text != "x" {
+		t.Fatalf("text raw changed: %+v", same)
+	}
+	boom := errors.New("boom")
+	if _, err := (Raw{Reader: iotest.ErrReader(boom)}).Materialize(); !errors.Is(err, boom) {
+		t.Fatalf("read error = %v", err)
+	}
+	for _, raw := range []Raw{{Text: "body"}, {Reader: strings.NewReader("body")}} {
+		if b, _ := io.ReadAll(raw.Body()); string(b) != "body" {
+			t.Fatalf("body = %q", b)
+		}
+	}
+}
+
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeCounter) Close() error { c.closed++; return nil }
+
+// TestValidateBatch 起点任意的连续窗口合法；目标越出记录范围或索引不连续为不变量违例
+func TestValidateBatch(t *testing.T) {
+	recs := []Record{{Index: 100}, {Index: 101}, {Index: 102}}
+	if err := ValidateBatch(Batch{Records: recs, TargetFrom: 101, TargetTo: 102}); err != nil {
+		t.Fatalf("valid batch: %v", err)
+	}
+	bad := []Batch{
+		{Records: nil, TargetFrom: 0, TargetTo: 0},
+		{Records: recs, TargetFrom: 99, TargetTo: 100},
+		{Records: recs, TargetFrom: 102, TargetTo: 103},
+		{Records: recs, TargetFrom: 102, TargetTo: 101},
+		{Records: []Record{{Index: 100}, {Index: 102}}, TargetFrom: 100, TargetTo: 100},
+	}
+	for i, b := range bad {
+		if err := ValidateBatch(b); !errors.Is(err, ErrInvariantViolation) {
+			t.Fatalf("case %d: expect ErrInvariantViolation, got %v", i, err)
+		}
+	}
+}
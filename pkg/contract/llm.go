@@ -3,12 +3,49 @@ package contract
 import (
 	"context"
 	"errors"
+	"io"
+	"strings"
 )
 
 // Raw: LLM 客户端返回的原始文本载荷（万能容器）。
 // 约束：原样返回，不做清洗/截断/归一化。
 type Raw struct {
 	Text string
+	// Reader: 可选的流式变体（RawReader）：非 nil 时正文由其提供、Text 被忽略，客户端可移交响应流而不整体物化。
+	// 仅可消费一次；实现 io.Closer 时由消费方用毕关闭。编排层优先交由 StreamDecoder 边读边解析，
+	// 否则经 Materialize 读尽后再调用 Decode/DecodeWithMeta——传入二者的 Raw 总已物化（Reader 为 nil）。
+	Reader io.Reader
+	// Model: 可选，实际响应本次请求的模型名（例如发生模型回退时），仅用于诊断日志。
+	Model string
+	// SourceEcho: 可选，响应按约定逐字回显源文本（如 passthrough 客户端）；解码器据此跳过“原文回显”检测。
+	SourceEcho bool
+}
+
+// Materialize 读尽 Reader（可关闭时随后关闭）并填入 Text，返回 Reader 为 nil 的副本；Reader 为 nil 时原样返回。
+// 读取错误原样返回（便于区分网络错误与响应无效）。
+func (r Raw) Materialize() (Raw, error) {
+	if r.Reader == nil {
+		return r, nil
+	}
+	rd := r.Reader
+	r.Reader = nil
+	b, err := io.ReadAll(rd)
+	if c, ok := rd.(io.Closer); ok {
+		_ = c.Close()
+	}
+	if err != nil {
+		return r, err
+	}
+	r.Text = string(b)
+	return r, nil
+}
+
+// Body 返回正文的读取视图：Reader 非 nil 时即为 Reader，否则为 Text 的只读 Reader。
+func (r Raw) Body() io.Reader {
+	if r.Reader != nil {
+		return r.Reader
+	}
+	return strings.NewReader(r.Text)
 }
 
 // LLMClient: 以 Batch+Prompt 为单位与大模型交互，返回原始文本 Raw。
@@ -17,6 +54,12 @@ type LLMClient interface {
 	Invoke(ctx context.Context, b Batch, p Prompt) (Raw, error)
 }
 
+// 可选：区域设置提示（非核心契约）。客户端返回配置的目标区域（BCP 47，如 "zh-CN"；未配置为空），
+// 编排层据此向 Prompt 模板注入 locale 变量，使模型与上游（Accept-Language）对目标区域的认知一致。
+type LocaleHinter interface {
+	Locale() string
+}
+
 // 可选：流式接口（非核心契约）。
 type LLMStreamer interface {
 	InvokeStream(ctx context.Context, b Batch, p Prompt) (RawStream, error)
@@ -28,10 +71,51 @@ type RawStream interface {
 	Close() error
 }
 
+// 可选：RawStream 报告实际响应本次请求的模型名（语义同 Raw.Model，如发生模型回退时），仅用于诊断日志与清单。
+type ModelReporter interface {
+	Model() string
+}
+
+// NewStreamReader 将 RawStream 适配为 io.Reader（供 StreamDecoder 边读边解析）；
+// 流结束返回 io.EOF，Next 的错误原样返回。不负责 Close，由调用方关闭 rs。
+func NewStreamReader(rs RawStream) io.Reader {
+	return &streamReader{rs: rs}
+}
+
+type streamReader struct {
+	rs   RawStream
+	buf  string
+	done bool
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for r.buf == "" {
+		if r.done {
+			return 0, io.EOF
+		}
+		chunk, done, err := r.rs.Next()
+		if err != nil {
+			return 0, err
+		}
+		r.buf, r.done = chunk, done
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
 // 最小错误分类（用于上层策略判定）。
 var (
 	ErrRateLimited     = errors.New("rate limited")
 	ErrResponseInvalid = errors.New("response invalid")
 	ErrInvalidInput    = errors.New("invalid input")
 	ErrSeqInvalid      = errors.New("sequence invalid")
+	// ErrResponseBlocked: 上游因安全/合规策略拦截而返回空结果（区别于格式错误的 ErrResponseInvalid）。
+	ErrResponseBlocked = errors.New("response blocked")
+	// ErrSourcePassthrough: 客户端要求编排层以原文透传该批（通常与 ErrResponseBlocked 一同包装）；
+	// 解码器未实现 PassthroughDecoder 时按错误处理。
+	ErrSourcePassthrough = errors.New("source passthrough")
 )
@@ -32,3 +32,10 @@ type PromptBuilder interface {
 // TokenEstimator: 文本→token 的近似估算函数。
 // 典型实现：ceil(len(utf8_bytes)/BytesPerToken)。
 type TokenEstimator func(s string) int
+
+// ContextualPromptBuilder: 可选扩展——按文件上下文构造 Prompt。
+// vars 为逐文件模板变量（如目标语言），覆盖构造期同名变量；vars 为空时等价于 Build。
+type ContextualPromptBuilder interface {
+	PromptBuilder
+	BuildWithVars(ctx context.Context, b Batch, vars map[string]string) (Prompt, error)
+}
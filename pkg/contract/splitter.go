@@ -5,7 +5,7 @@ import (
 	"io"
 )
 
-// Splitter: 将单文件字节流拆分为有序 Record 序列，并分配 Index（0..n-1）。
+// Splitter: 将单文件字节流拆分为有序 Record 序列，并分配连续递增的 Index（通常为 0..n-1，起点可任意）。
 // 约束：
 // 1) 不跨文件合并；
 // 2) Index 严格递增且稳定；
@@ -15,3 +15,10 @@ import (
 type Splitter interface {
 	Split(ctx context.Context, fileID FileID, r io.Reader) ([]Record, error)
 }
+
+// StreamSplitter: 可选扩展接口。按读取进度逐条 emit Record（顺序与约束同 Split），
+// 供编排层以有界内存处理超大输入（如 STDIN 流）；emit 返回错误时应立即停止并返回该错误。
+// 未实现该接口的 Splitter 仍走一次性返回切片的 Split。
+type StreamSplitter interface {
+	SplitStream(ctx context.Context, fileID FileID, r io.Reader, emit func(Record) error) error
+}
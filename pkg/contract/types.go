@@ -3,7 +3,7 @@ package contract
 // FileID: 逻辑文档ID（通常为路径，需规范化，跨平台一致）。
 type FileID string
 
-// Index: 单文件内稳定递增的索引（0..n-1）。
+// Index: 单文件内稳定、连续递增的索引（内置 Splitter 为 0..n-1；自定义实现可从任意起点编号）。
 type Index int64
 
 // Meta: 可选的轻量元信息；核心流程不读取其键值。
@@ -1,6 +1,10 @@
 package contract
 
-import "context"
+import (
+	"context"
+	"io"
+	"strings"
+)
 
 // Target: 目标区间最小载体（等价于 Batch 的 TargetFrom/TargetTo 只读视图）。
 type Target struct {
@@ -80,8 +84,55 @@ func ValidateWhole(tgt Target, cands []SpanCandidate) ([]SpanResult, error) {
 	return []SpanResult{{FileID: tgt.FileID, From: c.From, To: c.To, Output: cloneString(c.Output), Meta: cloneMeta(c.Meta)}}, nil
 }
 
+// 解码协议约定的 Meta 键（下划线前缀为内部键：避免与业务字段冲突，且不写入 JSONL 边车的 meta）：
+// - MetaDstText: 纯译文（不含 seq/time 等容器渲染），JSONL 边车优先使用；
+// - MetaSrcText: 编排层经 IndexMetaMap 回填的源文本；
+// - MetaSpeaker: Splitter 剥离的说话人前缀（原样保留冒号及其后空白），解码器以 WithSpeaker 前置还原；
+// - MetaUntranslated: 值为 "true" 表示该 span 未经翻译（如拦截后原文透传），Output 为源文本。
+const (
+	MetaDstText      = "dst_text"
+	MetaSrcText      = "_src_text"
+	MetaSpeaker      = "_speaker"
+	MetaUntranslated = "untranslated"
+)
+
+// WithSpeaker 将源记录 Meta 中由 Splitter 剥离的说话人前缀（MetaSpeaker）原样前置到 text；无前缀时原样返回。
+// 逐条输出的解码器（含透传）在渲染前调用，使译文与源文本一样带有标签。
+func WithSpeaker(src Meta, text string) string {
+	if label := src[MetaSpeaker]; label != "" {
+		return label + text
+	}
+	return text
+}
+
+// AttachDstText 返回 m 的副本并写入 MetaDstText=text（m 可为 nil）；不修改入参。
+func AttachDstText(m Meta, text string) Meta {
+	out := make(Meta, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	out[MetaDstText] = text
+	return out
+}
+
+// DetectEcho 检测可疑的“原文回显”：ids 与 texts 一一对应，当每条输出都与 idxMeta 中的源文本
+// （MetaSrcText）在去首尾空白后完全一致且源文本非空时返回 true。
+// 空输入、长度不一致或缺少源文本时返回 false（不做判定）。
+func DetectEcho(idxMeta IndexMetaMap, ids []Index, texts []string) bool {
+	if len(ids) == 0 || len(ids) != len(texts) || idxMeta == nil {
+		return false
+	}
+	for i, id := range ids {
+		src := strings.TrimSpace(idxMeta[id][MetaSrcText])
+		if src == "" || src != strings.TrimSpace(texts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // Decoder: 将 Raw 解码并返回最终 []SpanResult；字段名/格式/回退策略由具体实现自决。
-// 解码策略属于业务/编排层扩展，架构仅定义协议。
+// 解码策略属于业务/编排层扩展，架构仅定义协议。编排层传入的 Raw 已物化（见 Raw.Reader）。
 type Decoder interface {
 	Decode(ctx context.Context, tgt Target, raw Raw) ([]SpanResult, error)
 }
@@ -92,6 +143,21 @@ type DecoderWithMeta interface {
 	DecodeWithMeta(ctx context.Context, tgt Target, raw Raw, idxMeta IndexMetaMap) ([]SpanResult, error)
 }
 
+// PassthroughDecoder: 可选扩展接口。LLM 客户端以 ErrSourcePassthrough 报告响应被拦截且要求原文透传时，
+// 编排层调用 Passthrough 以源文本（idxMeta 中的 "_src_text"）生成与 Decode 同形的 SpanResult。
+type PassthroughDecoder interface {
+	Passthrough(ctx context.Context, tgt Target, idxMeta IndexMetaMap) ([]SpanResult, error)
+}
+
+// StreamDecoder: 可选扩展接口。LLM 客户端同时实现 LLMStreamer，或 Invoke 返回携带 Reader 的 Raw
+// （SourceEcho 除外）时，编排层以 io.Reader 传入模型输出，
+// 解码器边读边解析，每得到一条已校验结果即调用 emit（按 From 严格升序）。
+// 仅当 DecodeStream 返回 nil 时已 emit 的结果才有效；返回错误时编排层丢弃该批结果并按错误分类处理（可重试）。
+// r 的读取错误应原样返回（便于区分网络错误与响应无效）。
+type StreamDecoder interface {
+	DecodeStream(ctx context.Context, tgt Target, r io.Reader, idxMeta IndexMetaMap, emit func(SpanResult) error) error
+}
+
 // cloneString: 强制拷贝字符串，避免底层共享导致生命周期耦合。
 func cloneString(s string) string {
 	if s == "" {
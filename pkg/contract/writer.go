@@ -18,3 +18,51 @@ type ArtifactID = FileID
 type Writer interface {
 	Write(ctx context.Context, id ArtifactID, r io.Reader) error
 }
+
+// SourceHashStore: Writer 的可选扩展——按工件持久化源内容摘要，供编排层在重跑时判断源文件是否变更。
+// 约束：
+//  1. Load 在工件或摘要缺失时返回 ok=false（非错误）；
+//  2. Save 仅在工件成功写出后由编排层调用；
+//  3. 摘要为不透明字符串（编排层约定为 sha256 十六进制）。
+type SourceHashStore interface {
+	LoadSourceHash(ctx context.Context, id ArtifactID) (hash string, ok bool, err error)
+	SaveSourceHash(ctx context.Context, id ArtifactID, hash string) error
+}
+
+// Flusher: Writer 的可选扩展——落盘被延迟的持久化工作（如批量合并的目录 fsync）。
+// 约束：
+//  1. 编排层在运行结束时调用一次，成功、失败或取消均调用；
+//  2. 编排层传入不随运行取消的 ctx，保证取消路径下已写出的工件同样完成落盘；
+//  3. 无待处理工作时为空操作，可重复调用；
+//  4. 失败与运行本身的错误（如文件失败、读取失败）经 errors.Join 一并返回，不被其掩盖。
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// PathResolver: Writer（亦可由 Reader 实现）的可选扩展——将标识解析为介质上的绝对路径，供边车等诊断输出引用。
+// 约束：
+//  1. Writer 实现须与 Write 的映射一致（同一 id 解析结果即实际写出位置）；Reader 实现返回源文件位置；
+//  2. 无法解析（如 stdin、非本地介质、映射冲突）时返回 ok=false（非错误）；
+//  3. 不做 I/O 写入，不要求目标已存在。
+type PathResolver interface {
+	ResolvePath(id FileID) (path string, ok bool)
+}
+
+// SidecarWriter: Writer 的可选扩展——编排层以 WriteSidecar 写出 JSONL 边车等诊断工件，
+// 使 Writer 无需按扩展名猜测工件类别。
+// 约束：
+//  1. 映射、原子/覆盖策略与 Write 一致；
+//  2. 不施加仅适用于主工件的内容变换（如 BOM）；
+//  3. 未实现时编排层回退为 Write。
+type SidecarWriter interface {
+	WriteSidecar(ctx context.Context, id ArtifactID, r io.Reader) error
+}
+
+// Preflighter: Writer 的可选扩展——运行前检查自身目标的可写性（目录/桶/子 Writer 等），尽早暴露配置或权限问题。
+// 约束：
+//  1. 由入口在装配后、处理任何输入前调用一次；
+//  2. 不写出工件，探测产生的临时对象须自行清理；
+//  3. 目标尚不存在但可按需创建时视为可写（不要求预先创建）。
+type Preflighter interface {
+	Preflight(ctx context.Context) error
+}
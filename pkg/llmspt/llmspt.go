@@ -0,0 +1,109 @@
+// Package llmspt 为嵌入式调用提供稳定的公共入口：在 Go 服务内直接运行翻译流水线，
+// 无需以子进程方式调用 CLI。类型以别名形式从内部包导出，CLI 同样构建于本包之上。
+package llmspt
+
+import (
+	"context"
+	"io"
+
+	"llmspt/internal/config"
+	"llmspt/internal/diag"
+	"llmspt/internal/pipeline"
+	"llmspt/pkg/contract"
+	"llmspt/pkg/registry"
+)
+
+// 配置类型（JSON 使用 snake_case，与 CLI 配置文件一致）。
+type (
+	Config       = config.Config
+	Logging      = config.Logging
+	Components   = config.Components
+	Options      = config.Options
+	Provider     = config.Provider
+	Limits       = config.Limits
+	Sidecar      = config.Sidecar
+	FileLang     = config.FileLang
+	FileLangRule = config.FileLangRule
+)
+
+// 运行期类型：装配后的组件集合与设置。
+type (
+	Pipeline    = pipeline.Components
+	Settings    = pipeline.Settings
+	BatchReport = pipeline.BatchReport
+	BatchDump   = pipeline.BatchDump
+)
+
+// ComponentKind: 一类组件（配置中的选择键）及其已注册实现名（升序）。
+type ComponentKind = registry.Kind
+
+// ListComponents 按固定顺序列出各类组件的已注册实现名。
+func ListComponents() []ComponentKind { return registry.Kinds() }
+
+// ErrCapReached: 运行级上限（max_batches/max_records）耗尽且仍有未调度的工作时 Run 返回的哨兵错误（errors.Is 判定）。
+var ErrCapReached = pipeline.ErrCapReached
+
+// Logger: 结构化日志（JSON 行，写入 logs/ 目录并按大小轮转）；nil 表示不记录。
+type Logger = diag.Logger
+
+// NewLogger 以关联 ID 与级别（debug|info|warn|error）创建 Logger；调用方负责 Close。
+func NewLogger(corrID, level string) *Logger { return diag.NewLogger(corrID, level) }
+
+// Defaults 返回带有安全默认值的 Config（LLM 与 Provider 需调用方补齐）。
+func Defaults() Config { return config.Defaults() }
+
+// Template 返回包含全部选项键的示例配置（mock provider，可直接运行）。
+func Template() Config { return config.DefaultTemplateConfig() }
+
+// LoadJSON 从文件路径或原始 JSON 解析 Config（严格拒绝未知字段；配置自身 allow_unknown=true 时忽略）。
+func LoadJSON(path string, raw []byte) (Config, error) { return config.LoadJSON(path, raw) }
+
+// LoadJSONAllowUnknown 同 LoadJSON；allowUnknown 为 true 时忽略未知字段，并返回被忽略的点分键路径（升序）。
+func LoadJSONAllowUnknown(path string, raw []byte, allowUnknown bool) (Config, []string, error) {
+	return config.LoadJSONAllowUnknown(path, raw, allowUnknown)
+}
+
+// Merge 以 over 中的非零值覆盖 base，返回新 Config。
+func Merge(base, over Config) Config { return config.Merge(base, over) }
+
+// Validate 对配置做静态校验。
+func Validate(cfg Config) error { return config.Validate(cfg) }
+
+// Assemble 按配置从注册表构造组件与运行设置。
+func Assemble(cfg Config) (Pipeline, Settings, error) {
+	comp, set, _, _, err := config.Assemble(cfg)
+	return comp, set, err
+}
+
+// Preflight 调用 Writer 的可选预检（contract.Preflighter），尽早报告输出目标不可写；未实现时返回 nil。
+func Preflight(ctx context.Context, comp Pipeline) error {
+	if pf, ok := comp.Writer.(contract.Preflighter); ok {
+		return pf.Preflight(ctx)
+	}
+	return nil
+}
+
+// Run 以已装配的组件执行流水线；返回首个错误（ctx 取消时返回 ctx 错误）。
+func Run(ctx context.Context, comp Pipeline, set Settings, logger *Logger) error {
+	return pipeline.Run(ctx, comp, set, logger)
+}
+
+// DumpBatches 仅执行 Reader → Splitter → Batcher，将各批边界与估算 token 的 JSON 报告写入 w；不调用 LLM。
+func DumpBatches(ctx context.Context, comp Pipeline, set Settings, w io.Writer) error {
+	return pipeline.DumpBatches(ctx, comp, set, w)
+}
+
+// RunConfig 校验并装配 cfg 后执行流水线，等价于 CLI 的 run 子命令（不含 .env/ENV/旗标合并）。
+func RunConfig(ctx context.Context, cfg Config, logger *Logger) error {
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	comp, set, err := Assemble(cfg)
+	if err != nil {
+		return err
+	}
+	if err := Preflight(ctx, comp); err != nil {
+		return err
+	}
+	return Run(ctx, comp, set, logger)
+}
@@ -0,0 +1,53 @@
+package llmspt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunConfigMock 使用 mock provider 端到端运行并写出译文
+func TestRunConfigMock(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "a.srt")
+	os.WriteFile(in, []byte("1\n00:00:01,000 --> 00:00:02,000\nhello\n\n"), 0o644)
+	out := filepath.Join(dir, "out")
+
+	cfg := Template()
+	cfg.Inputs = []string{in}
+	cfg.Options.Writer = json.RawMessage(fmt.Sprintf(`{"output_dir":%q}`, out))
+	if err := RunConfig(context.Background(), cfg, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(out, "a.srt"))
+	if err != nil || !strings.Contains(string(b), "MOCK: hello") {
+		t.Fatalf("unexpected output: %q %v", b, err)
+	}
+}
+
+// TestRunConfigInvalid 校验失败时不运行
+func TestRunConfigInvalid(t *testing.T) {
+	if err := RunConfig(context.Background(), Defaults(), nil); err == nil {
+		t.Fatalf("expect validation error")
+	}
+}
+
+// TestRunConfigPreflight 输出目标不可写时在处理任何输入前失败
+func TestRunConfigPreflight(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "a.srt")
+	os.WriteFile(in, []byte("1\n00:00:01,000 --> 00:00:02,000\nhello\n\n"), 0o644)
+	out := filepath.Join(dir, "file")
+	os.WriteFile(out, []byte("x"), 0o644)
+
+	cfg := Template()
+	cfg.Inputs = []string{in}
+	cfg.Options.Writer = json.RawMessage(fmt.Sprintf(`{"output_dir":%q}`, filepath.Join(out, "sub")))
+	if err := RunConfig(context.Background(), cfg, nil); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("expect preflight error, got %v", err)
+	}
+}
@@ -3,19 +3,30 @@ package registry
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"sort"
 
 	"llmspt/pkg/contract"
 	linear "llmspt/plugins/assembler/linear"
+	atext "llmspt/plugins/assembler/text"
 	psld "llmspt/plugins/batcher/sliding"
+	dline "llmspt/plugins/decoder/linemap"
+	dspan "llmspt/plugins/decoder/spanjson"
 	dsrt "llmspt/plugins/decoder/srtjson"
+	dtext "llmspt/plugins/decoder/textjson"
 	gmi "llmspt/plugins/llmclient/gemini"
         mock "llmspt/plugins/llmclient/mock"
         flaky "llmspt/plugins/llmclient/flaky"
 	oai "llmspt/plugins/llmclient/openai"
+	pass "llmspt/plugins/llmclient/passthrough"
+	psum "llmspt/plugins/prompt/summarize"
 	ppt "llmspt/plugins/prompt/translate"
 	rfs "llmspt/plugins/reader/filesystem"
+	rtar "llmspt/plugins/reader/tar"
 	ssrt "llmspt/plugins/splitter/srt"
 	wfs "llmspt/plugins/writer/filesystem"
+	wmulti "llmspt/plugins/writer/multi"
+	ws3 "llmspt/plugins/writer/s3"
 )
 
 // strictUnmarshal: 使用 DisallowUnknownFields 严格解码，拒绝未知字段。
@@ -44,6 +55,9 @@ type NewPromptBuilder func(raw json.RawMessage) (contract.PromptBuilder, error)
 // NewLLMClient 工厂签名：接收原样 JSON Options。
 type NewLLMClient func(raw json.RawMessage) (contract.LLMClient, error)
 
+// ValidateOptions 选项校验签名：配置期严格校验原样 JSON Options，不构造实例。
+type ValidateOptions func(raw json.RawMessage) error
+
 // NewDecoder 工厂签名：接收原样 JSON Options。
 type NewDecoder func(raw json.RawMessage) (contract.Decoder, error)
 
@@ -63,6 +77,14 @@ var Reader = map[string]NewReader{
 		}
 		return rfs.New(&opts), nil
 	},
+	// tar: tar / tar.gz 归档 Reader（FileID 为归档内相对路径）
+	"tar": func(raw json.RawMessage) (contract.Reader, error) {
+		var opts rtar.Options
+		if err := strictUnmarshal(raw, &opts); err != nil {
+			return nil, err
+		}
+		return rtar.New(&opts), nil
+	},
 }
 
 // Splitter 工厂注册表。
@@ -73,6 +95,9 @@ var Splitter = map[string]NewSplitter{
 		if err := strictUnmarshal(raw, &opts); err != nil {
 			return nil, err
 		}
+		if err := opts.Validate(); err != nil {
+			return nil, err
+		}
 		return ssrt.New(&opts), nil
 	},
 }
@@ -99,6 +124,14 @@ var PromptBuilder = map[string]NewPromptBuilder{
 		}
 		return ppt.New(&opts)
 	},
+	// summarize: 窗口化逐条摘要 PromptBuilder（输出与 translate 的 JSON 格式一致）
+	"summarize": func(raw json.RawMessage) (contract.PromptBuilder, error) {
+		var opts psum.Options
+		if err := strictUnmarshal(raw, &opts); err != nil {
+			return nil, err
+		}
+		return psum.New(&opts)
+	},
 }
 
 // LLMClient 工厂注册表。
@@ -107,18 +140,44 @@ var LLMClient = map[string]NewLLMClient{
         "gemini": func(raw json.RawMessage) (contract.LLMClient, error) { return gmi.New(raw) },
         "mock":   func(raw json.RawMessage) (contract.LLMClient, error) { return mock.New(raw) },
         "flaky":  func(raw json.RawMessage) (contract.LLMClient, error) { return flaky.New(raw) },
+        // passthrough: 不调用上游，原样回显目标源文本（仅做格式转换的任务）
+        "passthrough": func(raw json.RawMessage) (contract.LLMClient, error) { return pass.New(raw) },
+}
+
+// LLMClientOptions 与 LLMClient 同名注册的选项校验器（供 config.Validate 预检所有 Provider）。
+var LLMClientOptions = map[string]ValidateOptions{
+	"openai": oai.ValidateOptions,
+	"gemini": gmi.ValidateOptions,
+	"mock":   mock.ValidateOptions,
+	"flaky":  flaky.ValidateOptions,
+	"passthrough": pass.ValidateOptions,
+}
+
+// LLMClientHTTP 选项支持通用 HTTP 键（extra_headers/extra_query/timeout_seconds/proxy）的 client，
+// 供 config 合并顶层 http_defaults；未登记者（mock/flaky/passthrough）不合并。
+var LLMClientHTTP = map[string]bool{
+	"openai": true,
+	"gemini": true,
 }
 
 // Decoder 工厂注册表。
 var Decoder = map[string]NewDecoder{
 	// srt: 翻译（逐条 JSON 数组）解码器（每条 [{id:int,text:string,meta?:object}]）
 	"srt": func(raw json.RawMessage) (contract.Decoder, error) { return dsrt.New(raw) },
+	// span: 整段 JSON 解码器（单个 {from:int,to:int,text:string} 覆盖整个目标区间）
+	"span": func(raw json.RawMessage) (contract.Decoder, error) { return dspan.New(raw) },
+	// linemap: 逐行纯文本解码器（每个目标索引一行，按顺序对齐）
+	"linemap": func(raw json.RawMessage) (contract.Decoder, error) { return dline.New(raw) },
+	// textjson: 逐条 JSON 的纯文本解码器（Output 为原样译文，不做 SRT 块渲染）
+	"textjson": func(raw json.RawMessage) (contract.Decoder, error) { return dtext.New(raw) },
 }
 
 // Assembler 工厂注册表。
 var Assembler = map[string]NewAssembler{
 	// srt: 使用 Meta["seq"], Meta["time"] 还原 SRT 头两行并拼接 Output
 	"linear": func(raw json.RawMessage) (contract.Assembler, error) { return linear.New(raw) },
+	// text: 以分隔符连接记录的纯文本装配器（配合 textjson）
+	"text": func(raw json.RawMessage) (contract.Assembler, error) { return atext.New(raw) },
 }
 
 // Writer 工厂注册表。
@@ -131,4 +190,61 @@ var Writer = map[string]NewWriter{
 		}
 		return wfs.New(&opts)
 	},
+	// s3: S3/S3 兼容对象存储 Writer（基于 aws-sdk-go-v2，凭证按 SDK 默认链解析）
+	"s3": func(raw json.RawMessage) (contract.Writer, error) {
+		var opts ws3.Options
+		if err := strictUnmarshal(raw, &opts); err != nil {
+			return nil, err
+		}
+		return ws3.New(&opts)
+	},
+}
+
+// multi: 扇出 Writer（子 Writer 经本注册表按名构造）。
+// 在 init 中注册以避免 Writer 初始化表达式引用自身。
+func init() {
+	Writer["multi"] = func(raw json.RawMessage) (contract.Writer, error) {
+		var opts wmulti.Options
+		if err := strictUnmarshal(raw, &opts); err != nil {
+			return nil, err
+		}
+		return wmulti.New(&opts, func(name string, raw json.RawMessage) (contract.Writer, error) {
+			f := Writer[name]
+			if f == nil {
+				return nil, fmt.Errorf("writer %q not registered: %w", name, contract.ErrInvalidInput)
+			}
+			return f(raw)
+		})
+	}
+}
+
+// Kind 一类组件及其已注册的实现名（升序）。
+type Kind struct {
+	Kind  string
+	Names []string
+}
+
+// Kinds 按固定顺序列出各类组件的已注册实现名，供 CLI 自省（--list-components）。
+// Kind 取配置中的选择键：components.* 与 provider.*.client（llm_client）。
+func Kinds() []Kind {
+	return []Kind{
+		{Kind: "reader", Names: sortedNames(Reader)},
+		{Kind: "splitter", Names: sortedNames(Splitter)},
+		{Kind: "batcher", Names: sortedNames(Batcher)},
+		{Kind: "prompt_builder", Names: sortedNames(PromptBuilder)},
+		{Kind: "decoder", Names: sortedNames(Decoder)},
+		{Kind: "assembler", Names: sortedNames(Assembler)},
+		{Kind: "writer", Names: sortedNames(Writer)},
+		{Kind: "llm_client", Names: sortedNames(LLMClient)},
+	}
+}
+
+// sortedNames 返回注册表的键（升序）。
+func sortedNames[F any](m map[string]F) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
 }
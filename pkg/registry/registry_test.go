@@ -4,6 +4,8 @@ import (
     "encoding/json"
     "errors"
     "fmt"
+    "reflect"
+    "sort"
     "testing"
 
     "llmspt/pkg/contract"
@@ -33,6 +35,9 @@ func TestFactories(t *testing.T) {
         if _, err := Reader["fs"](json.RawMessage(`{"x":1}`)); err == nil {
             t.Fatalf("reader 未对未知字段报错")
         }
+        if _, err := Reader["tar"](json.RawMessage(`{"allow_exts":[".srt"]}`)); err != nil {
+            t.Fatalf("reader-tar: %v", err)
+        }
     })
     t.Run("splitter", func(t *testing.T) {
         if _, err := Splitter["srt"](json.RawMessage(`{}`)); err != nil {
@@ -58,16 +63,44 @@ func TestFactories(t *testing.T) {
             t.Fatalf("prompt 未对未知字段报错")
         }
     })
+    t.Run("prompt-summarize", func(t *testing.T) {
+        if _, err := PromptBuilder["summarize"](json.RawMessage(`{"max_words":8}`)); err != nil {
+            t.Fatalf("summarize: %v", err)
+        }
+        if _, err := PromptBuilder["summarize"](json.RawMessage(`{"x":1}`)); err == nil {
+            t.Fatalf("summarize 未对未知字段报错")
+        }
+    })
     t.Run("decoder", func(t *testing.T) {
         if _, err := Decoder["srt"](json.RawMessage(`{}`)); err != nil {
             t.Fatalf("decoder: %v", err)
         }
     })
+    t.Run("decoder-span", func(t *testing.T) {
+        if _, err := Decoder["span"](json.RawMessage(`{}`)); err != nil {
+            t.Fatalf("span: %v", err)
+        }
+    })
+    t.Run("decoder-linemap", func(t *testing.T) {
+        if _, err := Decoder["linemap"](json.RawMessage(`{}`)); err != nil {
+            t.Fatalf("linemap: %v", err)
+        }
+    })
+    t.Run("decoder-textjson", func(t *testing.T) {
+        if _, err := Decoder["textjson"](json.RawMessage(`{}`)); err != nil {
+            t.Fatalf("textjson: %v", err)
+        }
+    })
     t.Run("assembler", func(t *testing.T) {
         if _, err := Assembler["linear"](json.RawMessage(`{}`)); err != nil {
             t.Fatalf("assembler: %v", err)
         }
     })
+    t.Run("assembler-text", func(t *testing.T) {
+        if _, err := Assembler["text"](json.RawMessage(`{"separator":"\n\n"}`)); err != nil {
+            t.Fatalf("text: %v", err)
+        }
+    })
     t.Run("writer", func(t *testing.T) {
         tmp := t.TempDir()
         raw := json.RawMessage([]byte(fmt.Sprintf(`{"output_dir":%q}`, tmp)))
@@ -79,11 +112,34 @@ func TestFactories(t *testing.T) {
             t.Fatalf("writer 未对未知字段报错")
         }
     })
+    t.Run("writer-s3", func(t *testing.T) {
+        if _, err := Writer["s3"](json.RawMessage(`{}`)); !errors.Is(err, contract.ErrInvalidInput) {
+            t.Fatalf("s3 缺少 bucket 未按预期报错: %v", err)
+        }
+        if _, err := Writer["s3"](json.RawMessage(`{"bucket":"b","x":1}`)); err == nil {
+            t.Fatalf("s3 未对未知字段报错")
+        }
+    })
+    t.Run("writer-multi", func(t *testing.T) {
+        tmp := t.TempDir()
+        raw := json.RawMessage([]byte(fmt.Sprintf(`{"writers":[{"name":"fs","options":{"output_dir":%q}}]}`, tmp)))
+        if _, err := Writer["multi"](raw); err != nil {
+            t.Fatalf("multi: %v", err)
+        }
+        if _, err := Writer["multi"](json.RawMessage(`{"writers":[{"name":"nope"}]}`)); !errors.Is(err, contract.ErrInvalidInput) {
+            t.Fatalf("multi 未注册子 Writer 未按预期报错: %v", err)
+        }
+    })
     t.Run("llm-mock", func(t *testing.T) {
         if _, err := LLMClient["mock"](json.RawMessage(`{}`)); err != nil {
             t.Fatalf("mock: %v", err)
         }
     })
+    t.Run("llm-passthrough", func(t *testing.T) {
+        if _, err := LLMClient["passthrough"](json.RawMessage(`{}`)); err != nil {
+            t.Fatalf("passthrough: %v", err)
+        }
+    })
     t.Run("llm-openai", func(t *testing.T) {
         if _, err := LLMClient["openai"](json.RawMessage(`{}`)); !errors.Is(err, contract.ErrInvalidInput) {
             t.Fatalf("openai 未按预期报错: %v", err)
@@ -94,5 +150,33 @@ func TestFactories(t *testing.T) {
             t.Fatalf("gemini 未按预期报错: %v", err)
         }
     })
+    t.Run("llm-options", func(t *testing.T) {
+        for name := range LLMClient {
+            check := LLMClientOptions[name]
+            if check == nil {
+                t.Fatalf("%s 缺少选项校验器", name)
+            }
+            if err := check(json.RawMessage(`{"no_such_field":1}`)); err == nil {
+                t.Fatalf("%s 未对未知字段报错", name)
+            }
+        }
+        if err := LLMClientOptions["openai"](json.RawMessage(`{"on_empty_response":"skip"}`)); !errors.Is(err, contract.ErrInvalidInput) {
+            t.Fatalf("openai 非法枚举未按预期报错: %v", err)
+        }
+    })
 }
 
+func TestKinds(t *testing.T) {
+	kinds := Kinds()
+	if len(kinds) != 8 {
+		t.Fatalf("kinds: %d", len(kinds))
+	}
+	for _, k := range kinds {
+		if len(k.Names) == 0 || !sort.StringsAreSorted(k.Names) {
+			t.Fatalf("%s: unsorted or empty %v", k.Kind, k.Names)
+		}
+	}
+	if w := kinds[6]; w.Kind != "writer" || !reflect.DeepEqual(w.Names, []string{"fs", "multi", "s3"}) {
+		t.Fatalf("writer: %+v", w)
+	}
+}
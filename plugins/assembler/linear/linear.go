@@ -3,22 +3,81 @@ package linear
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
 
 	"llmspt/pkg/contract"
 )
 
-// Options: 预留占位，线性装配无需配置。
-type Options struct{}
+// Options: 线性装配选项。
+type Options struct {
+	// Renumber: 按输出顺序将 SRT 序号重写为 1..N（忽略 Meta["seq"]），消除合并/过滤后的序号空洞。
+	// 默认 false：保留原始序号。
+	Renumber bool `json:"renumber"`
+	// OnUntranslated: 带 Meta["untranslated"]="true" 标记（如拦截后原文透传）的 span 的处理：
+	// keep（默认，原样输出源文本）| drop（省略该字幕块；隐式启用 Renumber，保证输出序号连续）。
+	OnUntranslated string `json:"on_untranslated"`
+	// LineEnding: 输出换行符：lf（默认，原样输出）| crlf（将 "\n" 转为 "\r\n"，已有的 "\r\n" 不重复转换），
+	// 供要求 CRLF 的 Windows 媒体工具使用。逐批转换，无跨批状态，与流式写出兼容。
+	LineEnding string `json:"line_ending"`
+}
+
+// OnUntranslated 取值。
+const (
+	OnUntranslatedKeep = "keep"
+	OnUntranslatedDrop = "drop"
+)
+
+// LineEnding 取值。
+const (
+	LineEndingLF   = "lf"
+	LineEndingCRLF = "crlf"
+)
+
+type assembler struct {
+	renumber bool
+	drop     bool
+	crlf     bool
+	mu       sync.Mutex
+	// next: 每个 FileID 下一个待分配的序号；同一文件的批按 BatchIndex 顺序多次调用 Assemble，
+	// 文件结束时由 FinishFile 删除
+	next map[contract.FileID]*fileSeq
+}
 
-type assembler struct{}
+// fileSeq 单文件的重编号进度。
+type fileSeq struct {
+	n      int
+	lastTo contract.Index
+}
 
-// New 从原样 JSON Options 创建线性装配器（当前忽略选项）。
+// New 从原样 JSON Options 创建线性装配器。
 func New(raw json.RawMessage) (contract.Assembler, error) {
-	// 预留未来宽松度/策略扩展点；当前为无状态实现
-	_ = raw
-	return &assembler{}, nil
+	var opts Options
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &opts)
+	}
+	a := &assembler{renumber: opts.Renumber}
+	switch opts.OnUntranslated {
+	case "", OnUntranslatedKeep:
+	case OnUntranslatedDrop:
+		a.drop, a.renumber = true, true
+	default:
+		return nil, fmt.Errorf("linear: %w: unknown on_untranslated %q", contract.ErrInvalidInput, opts.OnUntranslated)
+	}
+	switch opts.LineEnding {
+	case "", LineEndingLF:
+	case LineEndingCRLF:
+		a.crlf = true
+	default:
+		return nil, fmt.Errorf("linear: %w: unknown line_ending %q", contract.ErrInvalidInput, opts.LineEnding)
+	}
+	if a.renumber {
+		a.next = make(map[contract.FileID]*fileSeq)
+	}
+	return a, nil
 }
 
 // Assemble 按 From 严格升序线性拼接 spans.Output；
@@ -51,13 +110,122 @@ func (a *assembler) Assemble(ctx context.Context, fileID contract.FileID, spans
 		prevTo = s.To
 	}
 
+	if a.drop {
+		spans = translated(spans)
+		if len(spans) == 0 {
+			return strings.NewReader(""), nil
+		}
+	}
+
+	if a.renumber {
+		return strings.NewReader(a.lineEnding(a.renumbered(fileID, spans))), nil
+	}
+
 	// 零拷贝倾向：拼接多个只读字符串 reader
 	rs := make([]io.Reader, 0, len(spans))
 	for _, s := range spans {
 		// 允许空 Output；不插入分隔符
-		rs = append(rs, strings.NewReader(s.Output))
+		rs = append(rs, strings.NewReader(a.lineEnding(s.Output)))
 	}
 	return io.MultiReader(rs...), nil
 }
 
+// FinishFile 删除该文件的重编号进度。
+func (a *assembler) FinishFile(fileID contract.FileID) {
+	a.mu.Lock()
+	delete(a.next, fileID)
+	a.mu.Unlock()
+}
+
+// lineEnding 按 LineEnding 转换换行符：crlf 时将不在 "\r" 之后的 "\n" 转为 "\r\n"。
+func (a *assembler) lineEnding(s string) string {
+	if !a.crlf || !strings.Contains(s, "\n") {
+		return s
+	}
+	var sb strings.Builder
+	sb.Grow(len(s) + strings.Count(s, "\n"))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' && (i == 0 || s[i-1] != '\r') {
+			sb.WriteByte('\r')
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// translated 返回去除未翻译标记 span 后的新切片（不修改入参）。
+func translated(spans []contract.SpanResult) []contract.SpanResult {
+	out := make([]contract.SpanResult, 0, len(spans))
+	for _, s := range spans {
+		if s.Meta[contract.MetaUntranslated] != "true" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// renumbered 拼接 spans.Output 并重写每个 SRT 块的序号行。
+// 编号跨同一文件的多次调用连续递增；若本次起点不大于上次终点，视为该文件重新开始，从 1 计数。
+func (a *assembler) renumbered(fileID contract.FileID, spans []contract.SpanResult) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st := a.next[fileID]
+	if st == nil || spans[0].From <= st.lastTo {
+		st = &fileSeq{n: 1}
+		a.next[fileID] = st
+	}
+	var sb strings.Builder
+	for _, s := range spans {
+		st.n = renumberBlocks(&sb, s.Output, st.n)
+	}
+	st.lastTo = spans[len(spans)-1].To
+	return sb.String()
+}
+
+// renumberBlocks 将 out 写入 sb，同时按块重写序号，返回下一个序号。
+// 块以空行分隔；块首行为纯数字且次行为时间轴（含 "-->"）时替换该数字；
+// 块首行即为时间轴（原序号缺失，如 formatSRTBlock 未写 seq）时在其前补写序号。
+// 其他块（非 SRT 文本）原样输出，不消耗序号。
+func renumberBlocks(sb *strings.Builder, out string, n int) int {
+	lines := strings.SplitAfter(out, "\n")
+	start := true
+	for i, ln := range lines {
+		body := strings.TrimRight(ln, "\r\n")
+		if strings.TrimSpace(body) == "" {
+			sb.WriteString(ln)
+			start = true
+			continue
+		}
+		if start {
+			start = false
+			if isDigits(strings.TrimSpace(body)) && i+1 < len(lines) && strings.Contains(lines[i+1], "-->") {
+				sb.WriteString(strconv.Itoa(n))
+				sb.WriteString(ln[len(body):])
+				n++
+				continue
+			}
+			if strings.Contains(body, "-->") {
+				sb.WriteString(strconv.Itoa(n))
+				sb.WriteString("\n")
+				n++
+			}
+		}
+		sb.WriteString(ln)
+	}
+	return n
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 var _ contract.Assembler = (*assembler)(nil)
+var _ contract.FileFinisher = (*assembler)(nil)
@@ -62,3 +62,120 @@ func TestAssembleEmpty(t *testing.T) {
 		t.Fatalf("expect empty, got %q", string(data))
 	}
 }
+
+// TestAssembleRenumber 重编号：忽略原序号，跨批连续 1..N；缺失序号的块补写，非 SRT 块原样保留；FinishFile 释放进度
+func TestAssembleRenumber(t *testing.T) {
+	a, err := New([]byte(`{"renumber":true}`))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	read := func(spans []contract.SpanResult) string {
+		t.Helper()
+		r, err := a.Assemble(context.Background(), "f", spans)
+		if err != nil {
+			t.Fatalf("assemble: %v", err)
+		}
+		b, _ := io.ReadAll(r)
+		return string(b)
+	}
+	got := read([]contract.SpanResult{
+		{FileID: "f", From: 0, To: 0, Output: "3\n00:00:01,000 --> 00:00:02,000\nA\n\n"},
+		{FileID: "f", From: 1, To: 1, Output: "00:00:03,000 --> 00:00:04,000\nB\n\n"},
+	})
+	if want := "1\n00:00:01,000 --> 00:00:02,000\nA\n\n2\n00:00:03,000 --> 00:00:04,000\nB\n\n"; got != want {
+		t.Fatalf("batch 1 = %q", got)
+	}
+	got = read([]contract.SpanResult{{FileID: "f", From: 2, To: 2, Output: "9\r\n00:00:05,000 --> 00:00:06,000\r\n10\r\n\r\n"}})
+	if want := "3\r\n00:00:05,000 --> 00:00:06,000\r\n10\r\n\r\n"; got != want {
+		t.Fatalf("batch 2 = %q", got)
+	}
+	// 新一轮（起点回退）从 1 重新计数；纯文本块不消耗序号
+	got = read([]contract.SpanResult{
+		{FileID: "f", From: 0, To: 0, Output: "plain\n\n"},
+		{FileID: "f", From: 1, To: 1, Output: "7\n00:00:01,000 --> 00:00:02,000\nC\n\n"},
+	})
+	if want := "plain\n\n1\n00:00:01,000 --> 00:00:02,000\nC\n\n"; got != want {
+		t.Fatalf("restart = %q", got)
+	}
+	// 文件结束后释放进度：再次装配（即便起点更大）从 1 计数
+	a.(contract.FileFinisher).FinishFile("f")
+	if n := len(a.(*assembler).next); n != 0 {
+		t.Fatalf("state not released: %d entries", n)
+	}
+	got = read([]contract.SpanResult{{FileID: "f", From: 5, To: 5, Output: "8\n00:00:01,000 --> 00:00:02,000\nD\n\n"}})
+	if want := "1\n00:00:01,000 --> 00:00:02,000\nD\n\n"; got != want {
+		t.Fatalf("after finish = %q", got)
+	}
+}
+
+// TestAssembleOnUntranslated keep 原样保留透传块；drop 省略带 untranslated 标记的块并保持序号连续；非法取值被拒绝
+func TestAssembleOnUntranslated(t *testing.T) {
+	un := contract.Meta{contract.MetaUntranslated: "true"}
+	spans := []contract.SpanResult{
+		{FileID: "f", From: 0, To: 0, Output: "1\n00:00:01,000 --> 00:00:02,000\nA\n\n"},
+		{FileID: "f", From: 1, To: 1, Output: "2\n00:00:03,000 --> 00:00:04,000\nsrc B\n\n", Meta: un},
+		{FileID: "f", From: 2, To: 2, Output: "3\n00:00:05,000 --> 00:00:06,000\nC\n\n"},
+	}
+	read := func(a contract.Assembler, spans []contract.SpanResult) string {
+		t.Helper()
+		r, err := a.Assemble(context.Background(), "f", spans)
+		if err != nil {
+			t.Fatalf("assemble: %v", err)
+		}
+		b, _ := io.ReadAll(r)
+		return string(b)
+	}
+	keep, err := New([]byte(`{"on_untranslated":"keep"}`))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if got, want := read(keep, spans), spans[0].Output+spans[1].Output+spans[2].Output; got != want {
+		t.Fatalf("keep = %q", got)
+	}
+	drop, err := New([]byte(`{"on_untranslated":"drop"}`))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if got, want := read(drop, spans), "1\n00:00:01,000 --> 00:00:02,000\nA\n\n2\n00:00:05,000 --> 00:00:06,000\nC\n\n"; got != want {
+		t.Fatalf("drop = %q", got)
+	}
+	// 整批均未翻译：输出为空，后续批序号接续
+	if got := read(drop, []contract.SpanResult{{FileID: "f", From: 3, To: 3, Output: "4\n00:00:07,000 --> 00:00:08,000\nsrc D\n\n", Meta: un}}); got != "" {
+		t.Fatalf("all dropped = %q", got)
+	}
+	if got, want := read(drop, []contract.SpanResult{{FileID: "f", From: 4, To: 4, Output: "5\n00:00:09,000 --> 00:00:10,000\nE\n\n"}}), "3\n00:00:09,000 --> 00:00:10,000\nE\n\n"; got != want {
+		t.Fatalf("next batch = %q", got)
+	}
+	if _, err := New([]byte(`{"on_untranslated":"skip"}`)); err == nil {
+		t.Fatalf("expect invalid on_untranslated rejected")
+	}
+}
+
+// TestAssembleLineEndingCRLF crlf 逐字节输出 "\r\n"：LF 转换、已有 CRLF 不重复转换，重编号补写的序号行同样为 CRLF；非法取值被拒绝
+func TestAssembleLineEndingCRLF(t *testing.T) {
+	spans := []contract.SpanResult{
+		{FileID: "f", From: 0, To: 0, Output: "1\n00:00:01,000 --> 00:00:02,000\nA\nB\n\n"},
+		{FileID: "f", From: 1, To: 1, Output: "2\r\n00:00:03,000 --> 00:00:04,000\r\nC\r\n\r\n"},
+		{FileID: "f", From: 2, To: 2, Output: "00:00:05,000 --> 00:00:06,000\nD\n\n"},
+	}
+	for _, tc := range []struct{ opts, want string }{
+		{`{"line_ending":"crlf"}`, "1\r\n00:00:01,000 --> 00:00:02,000\r\nA\r\nB\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nC\r\n\r\n00:00:05,000 --> 00:00:06,000\r\nD\r\n\r\n"},
+		{`{"line_ending":"crlf","renumber":true}`, "1\r\n00:00:01,000 --> 00:00:02,000\r\nA\r\nB\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nC\r\n\r\n3\r\n00:00:05,000 --> 00:00:06,000\r\nD\r\n\r\n"},
+		{`{"line_ending":"lf"}`, spans[0].Output + spans[1].Output + spans[2].Output},
+	} {
+		a, err := New([]byte(tc.opts))
+		if err != nil {
+			t.Fatalf("%s: new: %v", tc.opts, err)
+		}
+		r, err := a.Assemble(context.Background(), "f", spans)
+		if err != nil {
+			t.Fatalf("%s: assemble: %v", tc.opts, err)
+		}
+		if b, _ := io.ReadAll(r); string(b) != tc.want {
+			t.Fatalf("%s: got %q", tc.opts, b)
+		}
+	}
+	if _, err := New([]byte(`{"line_ending":"cr"}`)); err == nil {
+		t.Fatalf("expect invalid line_ending rejected")
+	}
+}
@@ -0,0 +1,88 @@
+package text
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"llmspt/pkg/contract"
+)
+
+// Options: 纯文本装配选项。
+type Options struct {
+	// Separator: 相邻记录之间插入的分隔符；为空时默认 "\n"。
+	Separator string `json:"separator"`
+}
+
+type assembler struct {
+	sep string
+	mu  sync.Mutex
+	// lastTo: 每个 FileID 已装配的最后索引；同一文件的批按 BatchIndex 顺序多次调用 Assemble，
+	// 跨批衔接处同样需要补写分隔符；文件结束时由 FinishFile 删除
+	lastTo map[contract.FileID]contract.Index
+}
+
+// New 从原样 JSON Options 创建纯文本装配器。
+func New(raw json.RawMessage) (contract.Assembler, error) {
+	var opts Options
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &opts)
+	}
+	sep := opts.Separator
+	if sep == "" {
+		sep = "\n"
+	}
+	return &assembler{sep: sep, lastTo: make(map[contract.FileID]contract.Index)}, nil
+}
+
+// Assemble 按 From 严格升序以分隔符连接 spans.Output（不追加首尾分隔符，跨批连续）；
+// 发现 FileID 混入、逆序或重叠即返回 ErrSeqInvalid。
+// 若本次起点不大于该文件上次终点，视为该文件重新开始（不补前导分隔符）。
+func (a *assembler) Assemble(ctx context.Context, fileID contract.FileID, spans []contract.SpanResult) (io.Reader, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	if len(spans) == 0 {
+		return strings.NewReader(""), nil
+	}
+	prevTo := spans[0].To
+	if spans[0].FileID != fileID || spans[0].From > prevTo {
+		return nil, contract.ErrSeqInvalid
+	}
+	for i := 1; i < len(spans); i++ {
+		s := spans[i]
+		if s.FileID != fileID || s.From > s.To || !(s.From > prevTo) {
+			return nil, contract.ErrSeqInvalid
+		}
+		prevTo = s.To
+	}
+
+	a.mu.Lock()
+	last, seen := a.lastTo[fileID]
+	cont := seen && spans[0].From > last
+	a.lastTo[fileID] = prevTo
+	a.mu.Unlock()
+
+	var sb strings.Builder
+	for i, s := range spans {
+		if i > 0 || cont {
+			sb.WriteString(a.sep)
+		}
+		sb.WriteString(s.Output)
+	}
+	return strings.NewReader(sb.String()), nil
+}
+
+// FinishFile 删除该文件的跨批衔接位置。
+func (a *assembler) FinishFile(fileID contract.FileID) {
+	a.mu.Lock()
+	delete(a.lastTo, fileID)
+	a.mu.Unlock()
+}
+
+var _ contract.Assembler = (*assembler)(nil)
+var _ contract.FileFinisher = (*assembler)(nil)
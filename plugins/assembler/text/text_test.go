@@ -0,0 +1,57 @@
+package text
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"llmspt/pkg/contract"
+)
+
+func assemble(t *testing.T, a contract.Assembler, spans []contract.SpanResult) string {
+	t.Helper()
+	r, err := a.Assemble(context.Background(), "f", spans)
+	if err != nil {
+		t.Fatalf("assemble: %v", err)
+	}
+	b, _ := io.ReadAll(r)
+	return string(b)
+}
+
+// TestAssembleSeparator 默认以 "\n" 连接，跨批衔接处补分隔符；文件重新开始或 FinishFile 后不补
+func TestAssembleSeparator(t *testing.T) {
+	a, _ := New(nil)
+	if got := assemble(t, a, []contract.SpanResult{{FileID: "f", From: 0, To: 0, Output: "a"}, {FileID: "f", From: 1, To: 1, Output: "b"}}); got != "a\nb" {
+		t.Fatalf("batch 0: %q", got)
+	}
+	if got := assemble(t, a, []contract.SpanResult{{FileID: "f", From: 2, To: 2, Output: "c"}}); got != "\nc" {
+		t.Fatalf("batch 1: %q", got)
+	}
+	if got := assemble(t, a, []contract.SpanResult{{FileID: "f", From: 0, To: 0, Output: "x"}}); got != "x" {
+		t.Fatalf("restart: %q", got)
+	}
+	// 文件结束后释放衔接位置：再次装配不补前导分隔符
+	a.(contract.FileFinisher).FinishFile("f")
+	if n := len(a.(*assembler).lastTo); n != 0 {
+		t.Fatalf("state not released: %d entries", n)
+	}
+	if got := assemble(t, a, []contract.SpanResult{{FileID: "f", From: 3, To: 3, Output: "y"}}); got != "y" {
+		t.Fatalf("after finish: %q", got)
+	}
+	a, _ = New([]byte(`{"separator":"\n\n"}`))
+	if got := assemble(t, a, []contract.SpanResult{{FileID: "f", From: 0, To: 0, Output: "p1"}, {FileID: "f", From: 1, To: 1, Output: "p2"}}); got != "p1\n\np2" {
+		t.Fatalf("custom: %q", got)
+	}
+}
+
+// TestAssembleSeqInvalid FileID 混入或重叠返回 ErrSeqInvalid
+func TestAssembleSeqInvalid(t *testing.T) {
+	a, _ := New(nil)
+	if _, err := a.Assemble(context.Background(), "g", []contract.SpanResult{{FileID: "f", From: 0, To: 0}}); err != contract.ErrSeqInvalid {
+		t.Fatalf("expect ErrSeqInvalid, got %v", err)
+	}
+	spans := []contract.SpanResult{{FileID: "f", From: 1, To: 2}, {FileID: "f", From: 2, To: 3}}
+	if _, err := a.Assemble(context.Background(), "f", spans); err != contract.ErrSeqInvalid {
+		t.Fatalf("expect ErrSeqInvalid, got %v", err)
+	}
+}
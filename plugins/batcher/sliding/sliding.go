@@ -3,7 +3,7 @@ package sliding
 import (
 	"context"
 	"errors"
-	"fmt"
+	"strconv"
 
 	"llmspt/pkg/contract"
 )
@@ -13,19 +13,30 @@ type Options struct {
     // ContextRadius: 上下文半径（左右各 ContextRadius 条）。< 0 视为 0。
     // 为提升可读性，替代原先的简写 C。
     ContextRadius int `json:"context_radius"`
+    // LeftRadius / RightRadius: 左（前文）/右（后文）上下文条数，分别覆盖 ContextRadius；
+    // 未设置（nil）时回退 ContextRadius，显式 0 表示该侧不带上下文。< 0 视为 0。
+    // 对白场景通常需要更多前文，如 left_radius=3、right_radius=1。
+    LeftRadius  *int `json:"left_radius,omitempty"`
+    RightRadius *int `json:"right_radius,omitempty"`
     // BytesPerToken: 估算系数，tokens ≈ ceil(utf8_bytes / BytesPerToken)。
     // 典型默认值为 4。<=0 时采用默认 4。
     BytesPerToken int `json:"bytes_per_token"`
     // ExtraBytesPerRecord: 每条记录在 Prompt 包装产生的额外字节估算（如 <seg id> 包裹、换行、targets 等）。
     // 仅用于预算估算，不影响实际内容；<=0 表示不额外加成。
     ExtraBytesPerRecord int `json:"extra_bytes_per_record"`
+    // SceneGapMs: >0 时按场景边界对齐批尾：在预算允许的目标区间后半段内，优先在其后空隙
+    // （下一条开始 - 本条结束）>= SceneGapMs 的记录处结束批（取空隙最大者）。
+    // 需记录 Meta["time"]（"HH:MM:SS,mmm --> HH:MM:SS,mmm"，如 srt Splitter 产出）；缺失时不参与对齐。0 关闭。
+    SceneGapMs int `json:"scene_gap_ms"`
 }
 
 // Batcher 实现滑动窗口批处理与上下文窗口。
 type Batcher struct {
-    ctxRadius     int
+    leftRadius    int
+    rightRadius   int
     bytesPerToken int
     extraPerRec   int
+    sceneGapMs    int64
 }
 
 // New 创建滑动窗口 Batcher。
@@ -44,12 +55,32 @@ func New(opts *Options) *Batcher {
             extra = opts.ExtraBytesPerRecord
         }
     }
-    return &Batcher{ctxRadius: r, bytesPerToken: bpt, extraPerRec: extra}
+    left, right := r, r
+    if opts != nil {
+        left = radiusOr(opts.LeftRadius, r)
+        right = radiusOr(opts.RightRadius, r)
+    }
+    var gap int64
+    if opts != nil && opts.SceneGapMs > 0 {
+        gap = int64(opts.SceneGapMs)
+    }
+    return &Batcher{leftRadius: left, rightRadius: right, bytesPerToken: bpt, extraPerRec: extra, sceneGapMs: gap}
+}
+
+// radiusOr: 已设置时取 v（负值按 0），否则回退 def。
+func radiusOr(v *int, def int) int {
+    if v == nil {
+        return def
+    }
+    if *v < 0 {
+        return 0
+    }
+    return *v
 }
 
 // Make 实现 3.3 的滑动窗口批处理：
 // - 同一 FileID 内按 Index 连续切片；
-// - 批内排列为 [L 上下文][Target][R 上下文]；
+// - 批内排列为 [L 上下文][Target][R 上下文]，左右上下文条数可不对称（leftRadius/rightRadius）；
 // - 仅 Target 区间参与最终装配；
 // - 使用简单的 token 估算与前缀和在 O(n) 时间内完成。
 func (b *Batcher) Make(ctx context.Context, records []contract.Record, limit contract.BatchLimit) ([]contract.Batch, error) {
@@ -60,11 +91,8 @@ func (b *Batcher) Make(ctx context.Context, records []contract.Record, limit con
 	if n == 0 {
 		return nil, nil
 	}
-	// 校验 FileID 一致与 Index 连续（0..n-1）。
+	// 校验 FileID 一致与 Index 连续（起点任意，如自定义 Splitter 从 100 开始编号）。
 	fid := records[0].FileID
-	if records[0].Index != 0 {
-		return nil, fmt.Errorf("batcher: first index must be 0, got %d", records[0].Index)
-	}
 	for i := 1; i < n; i++ {
 		if err := ctxErr(ctx); err != nil {
 			return nil, err
@@ -87,6 +115,12 @@ func (b *Batcher) Make(ctx context.Context, records []contract.Record, limit con
 		pref[i+1] = pref[i] + t
 	}
 
+	// 场景对齐：gaps[i] 为记录 i-1 结束到记录 i 开始的毫秒数（时间轴缺失为 -1）。
+	var gaps []int64
+	if b.sceneGapMs > 0 {
+		gaps = timeGaps(records)
+	}
+
 	// 有效预算。
 	budget := limit.MaxTokens
 	if budget <= 0 {
@@ -100,7 +134,7 @@ func (b *Batcher) Make(ctx context.Context, records []contract.Record, limit con
 		if err := ctxErr(ctx); err != nil {
 			return nil, err
 		}
-		L1 := l - b.ctxRadius
+		L1 := l - b.leftRadius
 		if L1 < 0 {
 			L1 = 0
 		}
@@ -113,7 +147,7 @@ func (b *Batcher) Make(ctx context.Context, records []contract.Record, limit con
 				return nil, err
 			}
 			R1 := r
-			R2 := r + b.ctxRadius - 1
+			R2 := r + b.rightRadius - 1
 			if R2 >= n {
 				R2 = n - 1
 			}
@@ -131,8 +165,12 @@ func (b *Batcher) Make(ctx context.Context, records []contract.Record, limit con
 		if bestR == l { // 连 1 条目标也放不下
 			return nil, errors.New("batcher: single target with contexts does not fit; decrease C or split")
 		}
+		// 场景对齐：扩展循环保证 (l, bestR] 内任一右端均在预算内，可直接回退到场景边界。
+		if gaps != nil && bestR < n {
+			bestR = sceneEnd(gaps, l, bestR, b.sceneGapMs)
+		}
 		// 依据最终 bestR 计算右上下文上界 R2，并发出批。
-		R2 := bestR + b.ctxRadius - 1
+		R2 := bestR + b.rightRadius - 1
 		if R2 >= n {
 			R2 = n - 1
 		}
@@ -150,6 +188,69 @@ func (b *Batcher) Make(ctx context.Context, records []contract.Record, limit con
 	return batches, nil
 }
 
+// sceneEnd 在目标区间后半段 [l+ceil((r-l)/2), r] 内寻找空隙 >= minGap 的批尾（半开右端），取空隙最大者（同值取靠后者）；
+// 限定后半段以免批过碎。无候选时返回 r。
+func sceneEnd(gaps []int64, l, r int, minGap int64) int {
+	best, bestGap := r, int64(-1)
+	for e := r; e >= l+(r-l+1)/2 && e > l; e-- {
+		if g := gaps[e]; g >= minGap && g > bestGap {
+			best, bestGap = e, g
+		}
+	}
+	return best
+}
+
+// timeGaps 解析各记录 Meta["time"] 的起止毫秒，返回相邻记录间的空隙；gaps[0] 与无法解析的位置为 -1。
+func timeGaps(records []contract.Record) []int64 {
+	gaps := make([]int64, len(records))
+	gaps[0] = -1
+	prevEnd := int64(-1)
+	for i, rec := range records {
+		start, end, ok := parseTiming(rec.Meta["time"])
+		if i > 0 {
+			gaps[i] = -1
+			if ok && prevEnd >= 0 {
+				gaps[i] = start - prevEnd
+			}
+		}
+		prevEnd = -1
+		if ok {
+			prevEnd = end
+		}
+	}
+	return gaps
+}
+
+// parseTiming 解析 "HH:MM:SS,mmm --> HH:MM:SS,mmm[附加内容]" 的起止毫秒。
+func parseTiming(line string) (start, end int64, ok bool) {
+	if len(line) < 29 || line[12:17] != " --> " {
+		return 0, 0, false
+	}
+	if start, ok = parseStamp(line[:12]); !ok {
+		return 0, 0, false
+	}
+	if end, ok = parseStamp(line[17:29]); !ok {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// parseStamp 解析 "HH:MM:SS,mmm"（亦接受 "." 作毫秒分隔）为毫秒。
+func parseStamp(st string) (int64, bool) {
+	if len(st) != 12 || st[2] != ':' || st[5] != ':' || (st[8] != ',' && st[8] != '.') {
+		return 0, false
+	}
+	var v [4]int64
+	for i, f := range []string{st[0:2], st[3:5], st[6:8], st[9:12]} {
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		v[i] = n
+	}
+	return ((v[0]*60+v[1])*60+v[2])*1000 + v[3], true
+}
+
 // estimateTokens: 近似估算 tokens ≈ ceil(utf8_bytes / bytesPerToken)。
 func (b *Batcher) estimateTokens(s string) int {
     // 使用字节长度（避免遍历 rune），保证 O(1) 开销。
@@ -2,6 +2,7 @@ package sliding
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -110,3 +111,116 @@ func TestSum(t *testing.T) {
 		t.Fatalf("b overflow")
 	}
 }
+
+// TestMakeAsymmetricRadius 左右上下文不对称：批内记录即 [L1..R2]，且实际包含记录的 token 总和不超预算
+func TestMakeAsymmetricRadius(t *testing.T) {
+	recs := make([]contract.Record, 10)
+	for i := range recs {
+		recs[i] = contract.Record{Index: contract.Index(i), FileID: "f", Text: "a"}
+	}
+	left, right := 2, 1
+	b := New(&Options{ContextRadius: 5, LeftRadius: &left, RightRadius: &right, BytesPerToken: 1})
+	batches, err := b.Make(context.Background(), recs, contract.BatchLimit{MaxTokens: 5})
+	if err != nil {
+		t.Fatalf("make: %v", err)
+	}
+	// 首批无前文：4 个目标 + 1 条后文；次批起：2 条前文 + 2 个目标 + 1 条后文
+	want := [][4]contract.Index{{0, 4, 0, 3}, {2, 6, 4, 5}, {4, 8, 6, 7}, {6, 9, 8, 9}}
+	if len(batches) != len(want) {
+		t.Fatalf("expect %d batches, got %d", len(want), len(batches))
+	}
+	for i, bt := range batches {
+		first, last := bt.Records[0].Index, bt.Records[len(bt.Records)-1].Index
+		if got := [4]contract.Index{first, last, bt.TargetFrom, bt.TargetTo}; got != want[i] {
+			t.Fatalf("batch %d: records/targets = %v, want %v", i, got, want[i])
+		}
+		tokens := 0
+		for _, r := range bt.Records {
+			tokens += b.estimateTokens(r.Text)
+		}
+		if tokens > 5 {
+			t.Fatalf("batch %d exceeds budget: %d tokens", i, tokens)
+		}
+	}
+}
+
+// TestNewRadiusFallback 未设置的一侧回退 ContextRadius，显式 0 关闭该侧，负值视为 0
+func TestNewRadiusFallback(t *testing.T) {
+	zero, neg := 0, -3
+	b := New(&Options{ContextRadius: 2, RightRadius: &zero})
+	if b.leftRadius != 2 || b.rightRadius != 0 {
+		t.Fatalf("fallback: left=%d right=%d", b.leftRadius, b.rightRadius)
+	}
+	b = New(&Options{ContextRadius: 2, LeftRadius: &neg})
+	if b.leftRadius != 0 || b.rightRadius != 2 {
+		t.Fatalf("negative: left=%d right=%d", b.leftRadius, b.rightRadius)
+	}
+}
+
+// TestMakeNonZeroBase 记录起点非 0（如从 100 开始编号）时按位置切批，目标区间落在批内记录中
+func TestMakeNonZeroBase(t *testing.T) {
+	b := New(&Options{ContextRadius: 1, BytesPerToken: 1})
+	var recs []contract.Record
+	for i := 100; i < 105; i++ {
+		recs = append(recs, contract.Record{Index: contract.Index(i), FileID: "f", Text: "abcd"})
+	}
+	batches, err := b.Make(context.Background(), recs, contract.BatchLimit{MaxTokens: 12})
+	if err != nil {
+		t.Fatalf("make: %v", err)
+	}
+	next := contract.Index(100)
+	for _, bt := range batches {
+		if err := contract.ValidateBatch(bt); err != nil {
+			t.Fatalf("invalid batch: %v", err)
+		}
+		if bt.TargetFrom != next {
+			t.Fatalf("batch %d starts at %d, want %d", bt.BatchIndex, bt.TargetFrom, next)
+		}
+		next = bt.TargetTo + 1
+	}
+	if next != 105 || len(batches) < 2 {
+		t.Fatalf("targets must cover 100..104 in several batches, got %d batches ending %d", len(batches), next-1)
+	}
+}
+
+// TestMakeSceneGap 场景对齐：预算内的后半段存在大空隙时批尾回退到该处；前半段空隙与无时间轴记录不影响
+func TestMakeSceneGap(t *testing.T) {
+	stamp := func(ms int) string {
+		return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+	}
+	// 每条 1s，间隔 0.5s；记录 0 之后与记录 3 之后分别有 5s 空隙
+	var recs []contract.Record
+	at := 0
+	for i := 0; i < 10; i++ {
+		if i == 1 || i == 4 {
+			at += 4500
+		}
+		recs = append(recs, contract.Record{Index: contract.Index(i), FileID: "f", Text: "a",
+			Meta: contract.Meta{"time": stamp(at) + " --> " + stamp(at+1000)}})
+		at += 1500
+	}
+	ranges := func(opts *Options, recs []contract.Record) string {
+		bs, err := New(opts).Make(context.Background(), recs, contract.BatchLimit{MaxTokens: 6})
+		if err != nil {
+			t.Fatalf("make: %v", err)
+		}
+		var sb strings.Builder
+		for _, b := range bs {
+			fmt.Fprintf(&sb, "[%d-%d]", b.TargetFrom, b.TargetTo)
+		}
+		return sb.String()
+	}
+	if got := ranges(&Options{BytesPerToken: 1}, recs); got != "[0-5][6-9]" {
+		t.Fatalf("without scene gap: %s", got)
+	}
+	if got := ranges(&Options{BytesPerToken: 1, SceneGapMs: 2000}, recs); got != "[0-3][4-9]" {
+		t.Fatalf("with scene gap: %s", got)
+	}
+	if got := ranges(&Options{BytesPerToken: 1, SceneGapMs: 6000}, recs); got != "[0-5][6-9]" {
+		t.Fatalf("gap below threshold: %s", got)
+	}
+	recs[4].Meta = nil
+	if got := ranges(&Options{BytesPerToken: 1, SceneGapMs: 2000}, recs); got != "[0-5][6-9]" {
+		t.Fatalf("untimed record: %s", got)
+	}
+}
@@ -0,0 +1,125 @@
+package linemap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"llmspt/pkg/contract"
+)
+
+// Options: 预留占位，逐行纯文本格式当前无配置。
+type Options struct{}
+
+type decoder struct{}
+
+// New 从原样 JSON Options 创建逐行解码器（当前忽略选项）。
+func New(raw json.RawMessage) (contract.Decoder, error) {
+	var opts Options
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &opts)
+	}
+	return &decoder{}, nil
+}
+
+// splitLines: 按 \n 切分响应文本（兼容 \r\n，忽略首尾多余换行）。
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.Trim(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// candidates: 将第 i 行对齐到 tgt.From+i，并校验行数与空行。
+func candidates(tgt contract.Target, raw contract.Raw, idxMeta contract.IndexMetaMap) ([]contract.SpanCandidate, error) {
+	lines := splitLines(raw.Text)
+	want := int(tgt.To-tgt.From) + 1
+	if len(lines) != want {
+		return nil, fmt.Errorf("line count mismatch: got %d want %d: %w", len(lines), want, contract.ErrResponseInvalid)
+	}
+	cands := make([]contract.SpanCandidate, 0, len(lines))
+	for i, ln := range lines {
+		id := tgt.From + contract.Index(i)
+		text := strings.TrimSpace(ln)
+		// 空行视为协议无效（失败）
+		if text == "" {
+			return nil, fmt.Errorf("empty text for id %d: %w", id, contract.ErrResponseInvalid)
+		}
+		// 还原 Splitter 剥离的说话人标签；纯译文放入 meta["dst_text"] 供边车优先使用
+		text = contract.WithSpeaker(idxMeta[id], text)
+		cands = append(cands, contract.SpanCandidate{From: id, To: id, Output: text, Meta: contract.AttachDstText(idxMeta[id], text)})
+	}
+	return cands, nil
+}
+
+// 期望 Raw.Text 为多行纯文本：每个目标索引一行，按顺序对应 [tgt.From, tgt.To]。
+// 输出按 [i,i] 逐条对齐的 SpanResult 切片。
+func (d *decoder) Decode(ctx context.Context, tgt contract.Target, raw contract.Raw) ([]contract.SpanResult, error) {
+	return d.DecodeWithMeta(ctx, tgt, raw, nil)
+}
+
+var _ contract.Decoder = (*decoder)(nil)
+
+// DecodeWithMeta: 利用 idxMeta 回填 seq/time，使输出成为完整 SRT 块。
+func (d *decoder) DecodeWithMeta(ctx context.Context, tgt contract.Target, raw contract.Raw, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	cands, err := candidates(tgt, raw, idxMeta)
+	if err != nil {
+		return nil, err
+	}
+	spans, err := contract.ValidatePerRecord(tgt, cands)
+	if err != nil {
+		return nil, err
+	}
+	for i := range spans {
+		spans[i].Output = formatBlock(spans[i].Meta, spans[i].Output)
+	}
+	return spans, nil
+}
+
+var _ contract.DecoderWithMeta = (*decoder)(nil)
+
+// Passthrough: 原文透传——以 idxMeta["_src_text"] 作为目标区间各条的输出（上游拦截时由编排层调用）。
+func (d *decoder) Passthrough(ctx context.Context, tgt contract.Target, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	cands := make([]contract.SpanCandidate, 0, int(tgt.To-tgt.From)+1)
+	for id := tgt.From; id <= tgt.To; id++ {
+		mm, ok := idxMeta[id]
+		if !ok {
+			return nil, fmt.Errorf("passthrough: missing source for id %d: %w", id, contract.ErrInvalidInput)
+		}
+		src := contract.WithSpeaker(mm, mm[contract.MetaSrcText])
+		meta := contract.AttachDstText(mm, src)
+		meta[contract.MetaUntranslated] = "true"
+		cands = append(cands, contract.SpanCandidate{From: id, To: id, Output: src, Meta: meta})
+	}
+	spans, err := contract.ValidatePerRecord(tgt, cands)
+	if err != nil {
+		return nil, err
+	}
+	for i := range spans {
+		spans[i].Output = formatBlock(spans[i].Meta, spans[i].Output)
+	}
+	return spans, nil
+}
+
+var _ contract.PassthroughDecoder = (*decoder)(nil)
+
+// formatBlock 渲染单条 span：存在 "seq"/"time" 时按行输出，随后为文本行，并以空行分隔。
+func formatBlock(meta contract.Meta, text string) string {
+	var sb strings.Builder
+	if v := meta["seq"]; v != "" {
+		sb.WriteString(v + "\n")
+	}
+	if v := meta["time"]; v != "" {
+		sb.WriteString(v + "\n")
+	}
+	sb.WriteString(text + "\n\n")
+	return sb.String()
+}
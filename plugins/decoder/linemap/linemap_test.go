@@ -0,0 +1,40 @@
+package linemap
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"llmspt/pkg/contract"
+)
+
+// TestDecodeSuccess 逐行对齐并回填 seq/time
+func TestDecodeSuccess(t *testing.T) {
+	d, _ := New(nil)
+	dm := d.(contract.DecoderWithMeta)
+	idx := contract.IndexMetaMap{
+		3: {"seq": "4", "time": "00:00:01,000 --> 00:00:02,000"},
+		4: {"seq": "5", "time": "00:00:02,000 --> 00:00:03,000"},
+	}
+	spans, err := dm.DecodeWithMeta(context.Background(), contract.Target{FileID: "f", From: 3, To: 4}, contract.Raw{Text: "甲\r\n乙\n"}, idx)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(spans) != 2 || spans[0].From != 3 || spans[1].To != 4 {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+	if spans[0].Output != "4\n00:00:01,000 --> 00:00:02,000\n甲\n\n" || spans[1].Meta["dst_text"] != "乙" {
+		t.Fatalf("unexpected output: %q / %v", spans[0].Output, spans[1].Meta)
+	}
+}
+
+// TestDecodeInvalid 行数不符或存在空行
+func TestDecodeInvalid(t *testing.T) {
+	d, _ := New(nil)
+	tgt := contract.Target{FileID: "f", From: 0, To: 2}
+	for _, src := range []string{"a\nb", "a\nb\nc\nd", "a\n \nc", ""} {
+		if _, err := d.Decode(context.Background(), tgt, contract.Raw{Text: src}); !errors.Is(err, contract.ErrResponseInvalid) {
+			t.Fatalf("expect ErrResponseInvalid for %q, got %v", src, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package spanjson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"llmspt/pkg/contract"
+)
+
+// Options: 预留占位，整段 JSON（{from:int,to:int,text:string}）当前无配置。
+type Options struct{}
+
+type decoder struct{}
+
+// New 从原样 JSON Options 创建整段解码器（当前忽略选项）。
+func New(raw json.RawMessage) (contract.Decoder, error) {
+	var opts Options
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &opts)
+	}
+	return &decoder{}, nil
+}
+
+// 期望 Raw.Text 为严格 JSON 对象：{"from": number, "to": number, "text": string}
+// 输出单个覆盖 [tgt.From,tgt.To] 的 SpanResult；译文作为整块文本（以换行结尾）线性装配。
+func (d *decoder) Decode(ctx context.Context, tgt contract.Target, raw contract.Raw) ([]contract.SpanResult, error) {
+	return d.DecodeWithMeta(ctx, tgt, raw, nil)
+}
+
+var _ contract.Decoder = (*decoder)(nil)
+
+// DecodeWithMeta: 同 Decode，并还原 Splitter 剥离的说话人标签：单条区间前置该条标签；
+// 整段译文无法按条定位标签，多条区间内存在标签时返回 ErrInvalidInput（应关闭 preserve_speaker_labels）。
+func (d *decoder) DecodeWithMeta(ctx context.Context, tgt contract.Target, raw contract.Raw, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	var obj struct {
+		From *int64 `json:"from"`
+		To   *int64 `json:"to"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal([]byte(raw.Text), &obj); err != nil {
+		return nil, fmt.Errorf("decode json span: %w", contract.ErrResponseInvalid)
+	}
+	if obj.From == nil || obj.To == nil {
+		return nil, fmt.Errorf("decode json span: missing from/to: %w", contract.ErrResponseInvalid)
+	}
+	if strings.TrimSpace(obj.Text) == "" {
+		return nil, fmt.Errorf("empty text for span [%d,%d]: %w", *obj.From, *obj.To, contract.ErrResponseInvalid)
+	}
+	if tgt.From == tgt.To {
+		obj.Text = contract.WithSpeaker(idxMeta[tgt.From], obj.Text)
+	} else {
+		for id := tgt.From; id <= tgt.To; id++ {
+			if idxMeta[id][contract.MetaSpeaker] != "" {
+				return nil, fmt.Errorf("span [%d,%d]: speaker labels cannot be restored in a multi-record span: %w", tgt.From, tgt.To, contract.ErrInvalidInput)
+			}
+		}
+	}
+	// 将纯译文放入 meta["dst_text"] 供边车优先使用
+	cand := contract.SpanCandidate{
+		From:   contract.Index(*obj.From),
+		To:     contract.Index(*obj.To),
+		Output: obj.Text,
+		Meta:   contract.AttachDstText(nil, obj.Text),
+	}
+	spans, err := contract.ValidateWhole(tgt, []contract.SpanCandidate{cand})
+	if err != nil {
+		return nil, err
+	}
+	// 整块渲染：保证以换行结尾，便于与相邻批线性拼接
+	if !strings.HasSuffix(spans[0].Output, "\n") {
+		spans[0].Output += "\n"
+	}
+	return spans, nil
+}
+
+var _ contract.DecoderWithMeta = (*decoder)(nil)
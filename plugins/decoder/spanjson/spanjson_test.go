@@ -0,0 +1,65 @@
+package spanjson
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"llmspt/pkg/contract"
+)
+
+// TestDecodeSuccess 整段对齐成功
+func TestDecodeSuccess(t *testing.T) {
+	d, _ := New(nil)
+	src := `{"from":2,"to":4,"text":"第一句\n第二句"}`
+	spans, err := d.Decode(context.Background(), contract.Target{FileID: "f", From: 2, To: 4}, contract.Raw{Text: src})
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(spans) != 1 || spans[0].From != 2 || spans[0].To != 4 || spans[0].FileID != "f" {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+	if spans[0].Output != "第一句\n第二句\n" || spans[0].Meta["dst_text"] != "第一句\n第二句" {
+		t.Fatalf("unexpected output: %q", spans[0].Output)
+	}
+}
+
+// TestDecodeMockShape 兼容 mock translate_json_span 的大写键
+func TestDecodeMockShape(t *testing.T) {
+	d, _ := New(nil)
+	src := `{"From":0,"To":1,"Text":"a\nb"}`
+	if _, err := d.Decode(context.Background(), contract.Target{FileID: "f", From: 0, To: 1}, contract.Raw{Text: src}); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+}
+
+// TestDecodeInvalid 区间不符、缺字段、空文本与非法 JSON
+func TestDecodeInvalid(t *testing.T) {
+	d, _ := New(nil)
+	tgt := contract.Target{FileID: "f", From: 0, To: 1}
+	for _, src := range []string{
+		`{"from":0,"to":0,"text":"x"}`,
+		`{"text":"x"}`,
+		`{"from":0,"to":1,"text":"  "}`,
+		`not json`,
+	} {
+		if _, err := d.Decode(context.Background(), tgt, contract.Raw{Text: src}); !errors.Is(err, contract.ErrResponseInvalid) {
+			t.Fatalf("expect ErrResponseInvalid for %s, got %v", src, err)
+		}
+	}
+}
+
+// TestDecodeSpeaker 单条区间前置说话人标签；多条区间含标签时无法定位，返回 ErrInvalidInput
+func TestDecodeSpeaker(t *testing.T) {
+	d, _ := New(nil)
+	dm := d.(contract.DecoderWithMeta)
+	idx := contract.IndexMetaMap{1: {contract.MetaSpeaker: "JOHN: "}, 2: {}}
+	spans, err := dm.DecodeWithMeta(context.Background(), contract.Target{FileID: "f", From: 1, To: 1}, contract.Raw{Text: `{"from":1,"to":1,"text":"Hola"}`}, idx)
+	if err != nil || spans[0].Output != "JOHN: Hola\n" || spans[0].Meta[contract.MetaDstText] != "JOHN: Hola" {
+		t.Fatalf("spans=%+v err=%v", spans, err)
+	}
+	_, err = dm.DecodeWithMeta(context.Background(), contract.Target{FileID: "f", From: 1, To: 2}, contract.Raw{Text: `{"from":1,"to":2,"text":"Hola\nAdiós"}`}, idx)
+	if !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+}
@@ -3,26 +3,254 @@ package srtjson
 import (
     "context"
     "encoding/json"
+    "errors"
     "fmt"
+    "io"
+    "sort"
     "strings"
+    "unicode"
 
     "llmspt/pkg/contract"
 )
 
-// Options: 预留占位，SRT 场景默认逐条 JSON（[{id:int,text:string}]）。
-// 当前无配置；保留以便未来扩展宽松度/字段名映射等。
-type Options struct{}
+// Options: SRT 场景默认逐条 JSON（[{id:int,text:string}]）。
+type Options struct {
+	// Lenient: 宽松模式。重复 id 时保留首次出现、丢弃其后重复项；默认严格（重复即失败）。
+	Lenient bool `json:"lenient"`
+	// PreserveLines: 校验译文行数（按 \n 分隔）与源文本（_src_text）一致，不一致视为响应无效以触发重试；
+	// 宽松模式下改为启发式重排为源行数，仍无法重排时才失败。仅在编排层提供 Index→Meta 映射时生效。
+	PreserveLines bool `json:"preserve_lines"`
+	// MetaFields: 逐条项中除 id/text/meta 外需保留的附加字段（如 ["notes"]），原样写入 SpanResult.Meta
+	// （字符串取其值，其他 JSON 值保留其文本），随 JSONL 边车的 meta 输出供 QA 使用；不进入装配后的字幕正文。
+	// 缺省或值为 null/空串的字段跳过；seq/time/dst_text/untranslated 与下划线前缀的保留键不可用（ErrInvalidInput）。
+	// 注意：默认 JSON Schema 禁止附加字段，启用时需配合自定义提示词/Schema。
+	MetaFields []string `json:"meta_fields"`
+	// FieldMap: 逻辑字段（id/text/meta）到模型实际输出键名的映射，适配输出 {"index":1,"translation":"..."}
+	// 之类的模型，如 {"id":"index","text":"translation"}；未映射的逻辑字段沿用原名。配置后逐项按对象解码，
+	// 缺少 id/text 键视为响应无效（而非静默解码为零值）。
+	FieldMap map[string]string `json:"field_map"`
+	// CaseInsensitiveKeys: 按 FieldMap（及 MetaFields）查找键时忽略大小写（如 "ID"、"Text"）；精确匹配优先。
+	// 未配置 FieldMap 时标准解码本身即对 id/text/meta 大小写不敏感。
+	CaseInsensitiveKeys bool `json:"case_insensitive_keys"`
+	// IgnoreExtraIDs: 丢弃目标区间 [From,To] 之外的项（如模型顺带翻译了上下文行）后再校验；
+	// 默认严格（多出的 id 视为响应无效并触发重试）。区间内的缺失/重复仍按原规则处理。
+	IgnoreExtraIDs bool `json:"ignore_extra_ids"`
+	// TrimInvisible: 解码后、构建结果前规范化每项 text：删除 BOM（U+FEFF）与零宽空格（U+200B），
+	// 并去除末尾空白与换行；默认关闭（保留模型原样输出）。
+	TrimInvisible bool `json:"trim_invisible"`
+}
+
+type decoder struct {
+	lenient       bool
+	preserveLines bool
+	metaFields    []string
+	// fields: 逻辑字段 → 实际键名；nil 表示按结构体标签直接解码
+	fields      map[string]string
+	foldKeys    bool
+	ignoreExtra bool
+	trim        bool
+}
 
-type decoder struct{}
+// 逻辑字段名（FieldMap 的键）。
+var logicalFields = []string{"id", "text", "meta"}
 
-// New 从原样 JSON Options 创建解码器（当前忽略选项）。
+// reservedMeta: 渲染与编排依赖的核心 Meta 键，不可作为 MetaFields（否则模型输出会覆盖 seq/time 等）；
+// 下划线前缀的内部键同样保留。
+var reservedMeta = map[string]bool{"seq": true, "time": true, contract.MetaDstText: true, contract.MetaUntranslated: true}
+
+// New 从原样 JSON Options 创建解码器（忽略解析错误与未知字段）；FieldMap 含未知逻辑字段或空键名、
+// MetaFields 含空名或保留键时返回 ErrInvalidInput。
 func New(raw json.RawMessage) (contract.Decoder, error) {
 	var opts Options
-	// 保留解析点：未来可在此解析宽松选项（当前忽略解析错误）
 	if len(raw) > 0 {
 		_ = json.Unmarshal(raw, &opts)
 	}
-	return &decoder{}, nil
+	for _, f := range opts.MetaFields {
+		if strings.TrimSpace(f) == "" || reservedMeta[strings.ToLower(f)] || strings.HasPrefix(f, "_") {
+			return nil, fmt.Errorf("srtjson: meta_fields %q: reserved or empty: %w", f, contract.ErrInvalidInput)
+		}
+	}
+	d := &decoder{lenient: opts.Lenient, preserveLines: opts.PreserveLines, metaFields: opts.MetaFields, foldKeys: opts.CaseInsensitiveKeys, ignoreExtra: opts.IgnoreExtraIDs, trim: opts.TrimInvisible}
+	if len(opts.FieldMap) > 0 {
+		d.fields = make(map[string]string, len(logicalFields))
+		for _, f := range logicalFields {
+			d.fields[f] = f
+		}
+		for k, v := range opts.FieldMap {
+			if _, ok := d.fields[k]; !ok || strings.TrimSpace(v) == "" {
+				return nil, fmt.Errorf("srtjson: field_map %q=%q: %w", k, v, contract.ErrInvalidInput)
+			}
+			d.fields[k] = v
+		}
+	}
+	return d, nil
+}
+
+// item: 上游逐条 JSON 数组的单项。
+type item struct {
+	ID   int64             `json:"id"`
+	Text string            `json:"text"`
+	Meta map[string]string `json:"meta,omitempty"`
+	// extra: 按 MetaFields 摘取的附加字段（不参与 JSON 解码）
+	extra map[string]string
+}
+
+// parse: 解码逐条 JSON 数组；配置了 MetaFields 时再按对象解析一次摘取附加字段（与 arr 按位置对齐）。
+// 配置了 FieldMap 时逐项按对象解码（见 decodeMapped）。
+func (d *decoder) parse(text string) ([]item, error) {
+	if d.fields != nil {
+		var raws []json.RawMessage
+		if err := json.Unmarshal([]byte(text), &raws); err != nil {
+			return nil, shapeErr(describeShape(text, err))
+		}
+		arr := make([]item, len(raws))
+		for i, raw := range raws {
+			it, got := d.decodeMapped(raw)
+			if got != "" {
+				return nil, shapeErr(fmt.Sprintf("element %d %s", i, got))
+			}
+			arr[i] = it
+		}
+		return arr, nil
+	}
+	var arr []item
+	if err := json.Unmarshal([]byte(text), &arr); err != nil {
+		return nil, shapeErr(describeShape(text, err))
+	}
+	if len(d.metaFields) == 0 {
+		return arr, nil
+	}
+	var objs []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &objs); err != nil || len(objs) != len(arr) {
+		return nil, fmt.Errorf("decode json per-record: %w", contract.ErrResponseInvalid)
+	}
+	for i, obj := range objs {
+		arr[i].extra = d.extras(obj)
+	}
+	return arr, nil
+}
+
+// decodeMapped: 按 FieldMap 从单项对象解码 id/text/meta 并摘取附加字段；
+// 失败时返回实际形状描述（非空）供 shapeErr 使用。
+func (d *decoder) decodeMapped(raw json.RawMessage) (item, string) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		var v any
+		_ = json.Unmarshal(raw, &v)
+		return item{}, "of type " + jsonKind(v)
+	}
+	var it item
+	for _, f := range logicalFields {
+		key := d.fields[f]
+		v, ok := d.lookup(obj, key)
+		if !ok {
+			if f == "meta" {
+				continue
+			}
+			return item{}, fmt.Sprintf("without %q key", key)
+		}
+		var dst any
+		switch f {
+		case "id":
+			dst = &it.ID
+		case "text":
+			dst = &it.Text
+		default:
+			dst = &it.Meta
+		}
+		if err := json.Unmarshal(v, dst); err != nil {
+			var x any
+			_ = json.Unmarshal(v, &x)
+			return item{}, fmt.Sprintf("field %q of type %s", key, jsonKind(x))
+		}
+	}
+	it.extra = d.extras(obj)
+	return it, ""
+}
+
+// lookup: 按键名取值；CaseInsensitiveKeys 时精确匹配失败再忽略大小写匹配。
+func (d *decoder) lookup(obj map[string]json.RawMessage, key string) (json.RawMessage, bool) {
+	if v, ok := obj[key]; ok {
+		return v, true
+	}
+	if d.foldKeys {
+		for k, v := range obj {
+			if strings.EqualFold(k, key) {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// extras: 按 MetaFields 从单项对象摘取附加字段；无命中时返回 nil。
+func (d *decoder) extras(obj map[string]json.RawMessage) map[string]string {
+	var out map[string]string
+	for _, f := range d.metaFields {
+		raw, _ := d.lookup(obj, f)
+		v := extraValue(raw)
+		if v == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string, len(d.metaFields))
+		}
+		out[f] = v
+	}
+	return out
+}
+
+// extraValue: JSON 字符串取其值，其他非 null 值保留紧凑文本。
+func extraValue(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// meta: 组装单条结果的 Meta（拷贝）：base + dst_text + 附加字段。
+func (it item) meta(base contract.Meta) contract.Meta {
+	m := contract.AttachDstText(base, it.Text)
+	for k, v := range it.extra {
+		m[k] = v
+	}
+	return m
+}
+
+// inTarget: IgnoreExtraIDs 时过滤掉目标区间外的项（保持原有顺序）；否则原样返回。
+func (d *decoder) inTarget(arr []item, tgt contract.Target) []item {
+	if !d.ignoreExtra {
+		return arr
+	}
+	out := arr[:0]
+	for _, it := range arr {
+		if id := contract.Index(it.ID); id >= tgt.From && id <= tgt.To {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// dedupe: 显式检测重复 id。严格模式返回携带重复 id 的 ErrResponseInvalid；
+// 宽松模式保留首次出现并丢弃其后重复项（保持原有顺序）。
+func (d *decoder) dedupe(arr []item) ([]item, error) {
+	seen := make(map[int64]struct{}, len(arr))
+	out := arr[:0:0]
+	for _, it := range arr {
+		if _, dup := seen[it.ID]; dup {
+			if !d.lenient {
+				return nil, fmt.Errorf("duplicate id %d: %w", it.ID, contract.ErrResponseInvalid)
+			}
+			continue
+		}
+		seen[it.ID] = struct{}{}
+		out = append(out, it)
+	}
+	return out, nil
 }
 
 // 期望 Raw.Text 为严格 JSON 数组：[{"id": number, "text": string}, ...]
@@ -33,15 +261,16 @@ func (d *decoder) Decode(ctx context.Context, tgt contract.Target, raw contract.
 		return nil, ctx.Err()
 	default:
 	}
-    type item struct {
-        ID   int64             `json:"id"`
-        Text string            `json:"text"`
-        Meta map[string]string `json:"meta,omitempty"`
+    // 解析错误归类为响应无效
+    arr, err := d.parse(raw.Text)
+    if err != nil {
+        return nil, err
     }
-    var arr []item
-    if err := json.Unmarshal([]byte(raw.Text), &arr); err != nil {
-        // 将解析错误归类为响应无效
-        return nil, fmt.Errorf("decode json per-record: %w", contract.ErrResponseInvalid)
+    d.trimItems(arr)
+    arr = d.inTarget(arr, tgt)
+    arr, err = d.dedupe(arr)
+    if err != nil {
+        return nil, err
     }
     // 空文本视为协议无效（失败）
     for _, it := range arr {
@@ -51,19 +280,8 @@ func (d *decoder) Decode(ctx context.Context, tgt contract.Target, raw contract.
     }
     cands := make([]contract.SpanCandidate, 0, len(arr))
     for _, it := range arr {
-        var m contract.Meta
-        if len(it.Meta) > 0 {
-            m = contract.Meta(it.Meta)
-        }
         // 将纯译文放入 meta["dst_text"] 供边车优先使用
-        if m == nil {
-            m = make(contract.Meta, 1)
-        } else {
-            mm := make(contract.Meta, len(m)+1)
-            for k, v := range m { mm[k] = v }
-            m = mm
-        }
-        m["dst_text"] = it.Text
+        m := it.meta(contract.Meta(it.Meta))
         cands = append(cands, contract.SpanCandidate{From: contract.Index(it.ID), To: contract.Index(it.ID), Output: it.Text, Meta: m})
     }
 	spans, err := contract.ValidatePerRecord(tgt, cands)
@@ -83,20 +301,20 @@ var _ contract.Decoder = (*decoder)(nil)
 
 // DecodeWithMeta: 可选扩展——当上游未返回 meta 时，利用 idxMeta 回填。
 func (d *decoder) DecodeWithMeta(ctx context.Context, tgt contract.Target, raw contract.Raw, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
-	// 复用 Decode 的解析逻辑
-	type item struct {
-		ID   int64             `json:"id"`
-		Text string            `json:"text"`
-		Meta map[string]string `json:"meta,omitempty"`
-	}
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
-    var arr []item
-    if err := json.Unmarshal([]byte(raw.Text), &arr); err != nil {
-        return nil, fmt.Errorf("decode json per-record: %w", contract.ErrResponseInvalid)
+    arr, err := d.parse(raw.Text)
+    if err != nil {
+        return nil, err
+    }
+    d.trimItems(arr)
+    arr = d.inTarget(arr, tgt)
+    arr, err = d.dedupe(arr)
+    if err != nil {
+        return nil, err
     }
     // 空文本直接视为协议无效（失败）；不做任何回退
     for _, it := range arr {
@@ -106,48 +324,32 @@ func (d *decoder) DecodeWithMeta(ctx context.Context, tgt contract.Target, raw c
     }
     // 检测可疑的“原文回显”：当上游对所有目标 id 的输出与源文本完全一致（在去首尾空白后）时，视为协议违例。
     // 注意：不做内容级回退，由上层决定如何处理。
-    if len(arr) > 0 && idxMeta != nil {
-        echo := true
-        for _, it := range arr {
-            src := ""
-            if mm, ok := idxMeta[contract.Index(it.ID)]; ok {
-                if t, ok2 := mm["_src_text"]; ok2 {
-                    src = t
-                }
-            }
-            if strings.TrimSpace(src) == "" || strings.TrimSpace(src) != strings.TrimSpace(it.Text) {
-                echo = false
-                break
+    ids := make([]contract.Index, len(arr))
+    texts := make([]string, len(arr))
+    for i, it := range arr {
+        ids[i], texts[i] = contract.Index(it.ID), it.Text
+    }
+    if !raw.SourceEcho && contract.DetectEcho(idxMeta, ids, texts) {
+        return nil, fmt.Errorf("echoed original detected: %w", contract.ErrResponseInvalid)
+    }
+    if d.preserveLines && idxMeta != nil {
+        for i := range arr {
+            fixed, err := d.checkLines(arr[i], idxMeta[contract.Index(arr[i].ID)][contract.MetaSrcText])
+            if err != nil {
+                return nil, err
             }
-        }
-        if echo {
-            return nil, fmt.Errorf("echoed original detected: %w", contract.ErrResponseInvalid)
+            arr[i].Text = fixed
         }
     }
     cands := make([]contract.SpanCandidate, 0, len(arr))
     for _, it := range arr {
-        var m contract.Meta
-        if len(it.Meta) > 0 {
-            m = contract.Meta(it.Meta)
-        } else if idxMeta != nil {
-            if mm, ok := idxMeta[contract.Index(it.ID)]; ok && len(mm) > 0 {
-                // 拷贝一份，避免共享
-                mm2 := make(contract.Meta, len(mm))
-                for k, v := range mm {
-                    mm2[k] = v
-                }
-                m = mm2
-            }
+        it.Text = contract.WithSpeaker(idxMeta[contract.Index(it.ID)], it.Text)
+        // 上游未返回 meta 时以 idxMeta 回填；AttachDstText 拷贝后写入纯译文，避免共享
+        m := contract.Meta(it.Meta)
+        if len(m) == 0 {
+            m = idxMeta[contract.Index(it.ID)]
         }
-        // 将纯译文放入 meta["dst_text"] 供边车优先使用
-        if m == nil {
-            m = make(contract.Meta, 1)
-        } else {
-            mm := make(contract.Meta, len(m)+1)
-            for k, v := range m { mm[k] = v }
-            m = mm
-        }
-        m["dst_text"] = it.Text
+        m = it.meta(m)
         cands = append(cands, contract.SpanCandidate{From: contract.Index(it.ID), To: contract.Index(it.ID), Output: it.Text, Meta: m})
     }
 	spans, err := contract.ValidatePerRecord(tgt, cands)
@@ -163,6 +365,379 @@ func (d *decoder) DecodeWithMeta(ctx context.Context, tgt contract.Target, raw c
 
 var _ contract.DecoderWithMeta = (*decoder)(nil)
 
+// DecodeStream: 流式解码逐条 JSON 数组——边读边解析，每得到一项即按 DecodeWithMeta 的规则校验并 emit。
+// 各项 id 须自 tgt.From 起连续升序（与 ValidatePerRecord 一致）；重复 id 严格模式失败，宽松模式跳过；
+// IgnoreExtraIDs 时目标区间外的项直接跳过。
+// 原文回显检测需要全部项，于数组结束后执行；返回错误时已 emit 的结果由调用方丢弃。
+func (d *decoder) DecodeStream(ctx context.Context, tgt contract.Target, r io.Reader, idxMeta contract.IndexMetaMap, emit func(contract.SpanResult) error) error {
+	if tgt.From > tgt.To {
+		return contract.ErrInvalidInput
+	}
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		// 读取错误（网络、取消）原样返回；仅结构问题归类为响应无效
+		if e := streamErr(err); err != nil && !errors.Is(e, contract.ErrResponseInvalid) {
+			return e
+		}
+		return shapeErr(describeFirstToken(tok, err))
+	}
+	expect := tgt.From
+	var ids []contract.Index
+	var texts []string
+	for dec.More() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		it, err := d.next(dec)
+		if err != nil {
+			return err
+		}
+		if d.trim {
+			it.Text = trimInvisible(it.Text)
+		}
+		id := contract.Index(it.ID)
+		if d.ignoreExtra && (id < tgt.From || id > tgt.To) {
+			continue
+		}
+		if id >= tgt.From && id < expect {
+			if !d.lenient {
+				return fmt.Errorf("duplicate id %d: %w", it.ID, contract.ErrResponseInvalid)
+			}
+			continue
+		}
+		if id != expect || id > tgt.To {
+			return fmt.Errorf("unexpected id %d (want %d): %w", it.ID, expect, contract.ErrResponseInvalid)
+		}
+		if strings.TrimSpace(it.Text) == "" {
+			return fmt.Errorf("empty text for id %d: %w", it.ID, contract.ErrResponseInvalid)
+		}
+		if d.preserveLines && idxMeta != nil {
+			fixed, err := d.checkLines(it, idxMeta[id][contract.MetaSrcText])
+			if err != nil {
+				return err
+			}
+			it.Text = fixed
+		}
+		// 回显检测比对的是剥离说话人标签后的源文本
+		plain := it.Text
+		it.Text = contract.WithSpeaker(idxMeta[id], it.Text)
+		m := contract.Meta(it.Meta)
+		if len(m) == 0 {
+			m = idxMeta[id]
+		}
+		m = it.meta(m)
+		if err := emit(contract.SpanResult{FileID: tgt.FileID, From: id, To: id, Output: formatSRTBlock(m, it.Text), Meta: m}); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		texts = append(texts, plain)
+		expect++
+	}
+	if _, err := dec.Token(); err != nil {
+		return streamErr(err)
+	}
+	// 数组之后不允许再有内容
+	if _, err := dec.Token(); err != io.EOF {
+		return streamErr(err)
+	}
+	if expect != tgt.To+1 {
+		return fmt.Errorf("missing id %d: %w", expect, contract.ErrResponseInvalid)
+	}
+	if contract.DetectEcho(idxMeta, ids, texts) {
+		return fmt.Errorf("echoed original detected: %w", contract.ErrResponseInvalid)
+	}
+	return nil
+}
+
+var _ contract.StreamDecoder = (*decoder)(nil)
+
+// next: 从流中解码一项；配置了 MetaFields 时同一项再按对象解析以摘取附加字段；配置了 FieldMap 时按映射解码。
+func (d *decoder) next(dec *json.Decoder) (item, error) {
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return item{}, streamErr(err)
+	}
+	if d.fields != nil {
+		it, got := d.decodeMapped(raw)
+		if got != "" {
+			return item{}, shapeErr("element " + got)
+		}
+		return it, nil
+	}
+	var it item
+	if err := json.Unmarshal(raw, &it); err != nil {
+		return item{}, streamErr(err)
+	}
+	if len(d.metaFields) > 0 {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return item{}, streamErr(err)
+		}
+		it.extra = d.extras(obj)
+	}
+	return it, nil
+}
+
+// trimItems: TrimInvisible 开启时就地规范化各项 text。
+func (d *decoder) trimItems(arr []item) {
+	if !d.trim {
+		return
+	}
+	for i := range arr {
+		arr[i].Text = trimInvisible(arr[i].Text)
+	}
+}
+
+// trimInvisible: 删除 BOM 与零宽空格，并去除末尾空白（含换行）。
+func trimInvisible(s string) string {
+	s = strings.NewReplacer("\uFEFF", "", "\u200B", "").Replace(s)
+	return strings.TrimRightFunc(s, unicode.IsSpace)
+}
+
+// streamErr: JSON 语法/类型错误与意外结束归类为响应无效；其他读取错误（网络、取消）原样返回。
+func streamErr(err error) error {
+	var se *json.SyntaxError
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) {
+		return shapeErr(describeTypeErr(te))
+	}
+	if err == nil || err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &se) {
+		return fmt.Errorf("decode json per-record stream: %w", contract.ErrResponseInvalid)
+	}
+	return err
+}
+
+// shapeErr: 结构不符的响应无效错误，说明实际形状与期望形状，便于区分代码围栏、包装对象与类型错误。
+func shapeErr(got string) error {
+	return fmt.Errorf("decode json per-record: got %s, want JSON array of {\"id\": number, \"text\": string}: %w", got, contract.ErrResponseInvalid)
+}
+
+// describeShape: 解码失败时描述响应的实际结构（仅在失败路径调用）。
+func describeShape(text string, err error) string {
+	t := strings.TrimSpace(text)
+	switch {
+	case t == "":
+		return "empty response"
+	case strings.HasPrefix(t, "```"):
+		return "markdown code fence around the JSON"
+	}
+	var v any
+	if json.Unmarshal([]byte(t), &v) != nil {
+		if t[0] == '[' || t[0] == '{' {
+			return "malformed JSON"
+		}
+		return fmt.Sprintf("non-JSON text %q", snippet(t, 40))
+	}
+	switch x := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return fmt.Sprintf("wrapper object with keys [%s]", strings.Join(keys, ", "))
+	case []any:
+		for i, e := range x {
+			if _, ok := e.(map[string]any); !ok {
+				return fmt.Sprintf("element %d of type %s", i, jsonKind(e))
+			}
+		}
+	default:
+		return "top-level " + jsonKind(v)
+	}
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) {
+		return describeTypeErr(te)
+	}
+	return "invalid array"
+}
+
+// describeFirstToken: 流式解码首个 token 不是 '[' 时描述实际结构（无法回看全文，仅按首 token 判断）。
+func describeFirstToken(tok json.Token, err error) string {
+	if err != nil {
+		if err == io.EOF {
+			return "empty response"
+		}
+		return "non-JSON text (prose or markdown code fence)"
+	}
+	if tok == json.Delim('{') {
+		return "wrapper object"
+	}
+	return "top-level " + jsonKind(tok)
+}
+
+// describeTypeErr: 字段类型不符（如 id 为字符串）。
+func describeTypeErr(te *json.UnmarshalTypeError) string {
+	if te.Field == "" {
+		return fmt.Sprintf("element of type %s", te.Value)
+	}
+	// 非流式解码时 Field 带数组下标前缀（如 "0.id"）
+	if i := strings.LastIndexByte(te.Field, '.'); i >= 0 {
+		return fmt.Sprintf("element %s field %q of type %s", te.Field[:i], te.Field[i+1:], te.Value)
+	}
+	return fmt.Sprintf("field %q of type %s", te.Field, te.Value)
+}
+
+// jsonKind: 解码后 JSON 值的类型名。
+func jsonKind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// snippet: 截取前 n 个字符用于错误信息。
+func snippet(s string, n int) string {
+	rs := []rune(s)
+	if len(rs) <= n {
+		return s
+	}
+	return string(rs[:n]) + "..."
+}
+
+// checkLines: 比较译文与源文本的行数；源文本缺失时跳过。
+// 不一致时严格模式返回 ErrResponseInvalid，宽松模式尝试启发式重排。
+func (d *decoder) checkLines(it item, src string) (string, error) {
+	if strings.TrimSpace(src) == "" {
+		return it.Text, nil
+	}
+	want := countLines(src)
+	got := countLines(it.Text)
+	if got == want {
+		return it.Text, nil
+	}
+	if d.lenient {
+		if fixed, ok := resplitLines(it.Text, want); ok {
+			return fixed, nil
+		}
+	}
+	return "", fmt.Errorf("line count mismatch for id %d: got %d want %d: %w", it.ID, got, want, contract.ErrResponseInvalid)
+}
+
+// countLines: 统计去除首尾换行后的行数。
+func countLines(s string) int {
+	return strings.Count(strings.Trim(s, "\n"), "\n") + 1
+}
+
+// resplitLines: 启发式地将文本重排为 n 行（n>=1）。
+// 先尝试按对话标记（行首 "-"）切分；否则按字符数均分，优先在空白处断行（无空白时按字符断开，适配 CJK）。
+// 无法得到 n 个非空行时返回 false。
+func resplitLines(text string, n int) (string, bool) {
+	flat := strings.Join(strings.Fields(text), " ")
+	if flat == "" {
+		return "", false
+	}
+	if n <= 1 {
+		return flat, true
+	}
+	if parts := splitDialogue(flat); len(parts) == n {
+		return strings.Join(parts, "\n"), true
+	}
+	rs := []rune(flat)
+	lines := make([]string, 0, n)
+	start := 0
+	for k := 1; k < n; k++ {
+		left := n - k // 本行之后仍需的行数
+		hi := len(rs) - left
+		if hi <= start {
+			return "", false
+		}
+		ideal := start + (len(rs)-start)/(left+1)
+		cut := nearestSpace(rs, start+1, hi, ideal)
+		line := strings.TrimSpace(string(rs[start:cut]))
+		if line == "" {
+			return "", false
+		}
+		lines = append(lines, line)
+		start = cut
+		for start < len(rs) && rs[start] == ' ' {
+			start++
+		}
+	}
+	last := strings.TrimSpace(string(rs[start:]))
+	if last == "" {
+		return "", false
+	}
+	lines = append(lines, last)
+	return strings.Join(lines, "\n"), true
+}
+
+// splitDialogue: 将以 "-" 开头的对话文本按 " -" 标记切分为多行。
+func splitDialogue(flat string) []string {
+	if !strings.HasPrefix(flat, "-") {
+		return nil
+	}
+	parts := strings.Split(flat, " -")
+	out := make([]string, 0, len(parts))
+	for i, p := range parts {
+		if i > 0 {
+			p = "-" + p
+		}
+		if p = strings.TrimSpace(p); p == "" || p == "-" {
+			return nil
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// nearestSpace: 在 [lo,hi] 内寻找离 ideal 最近的空格位置；不存在时返回夹紧后的 ideal。
+func nearestSpace(rs []rune, lo, hi, ideal int) int {
+	if ideal < lo {
+		ideal = lo
+	}
+	if ideal > hi {
+		ideal = hi
+	}
+	for off := 0; ideal-off >= lo || ideal+off <= hi; off++ {
+		if i := ideal - off; i >= lo && rs[i] == ' ' {
+			return i
+		}
+		if i := ideal + off; i <= hi && i < len(rs) && rs[i] == ' ' {
+			return i
+		}
+	}
+	return ideal
+}
+
+// Passthrough: 原文透传——以 idxMeta["_src_text"] 作为目标区间各条的译文并渲染为 SRT 块（上游拦截时由编排层调用）。
+func (d *decoder) Passthrough(ctx context.Context, tgt contract.Target, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	cands := make([]contract.SpanCandidate, 0, int(tgt.To-tgt.From)+1)
+	for id := tgt.From; id <= tgt.To; id++ {
+		mm, ok := idxMeta[id]
+		if !ok {
+			return nil, fmt.Errorf("passthrough: missing source for id %d: %w", id, contract.ErrInvalidInput)
+		}
+		src := contract.WithSpeaker(mm, mm[contract.MetaSrcText])
+		meta := contract.AttachDstText(mm, src)
+		meta[contract.MetaUntranslated] = "true"
+		cands = append(cands, contract.SpanCandidate{From: id, To: id, Output: src, Meta: meta})
+	}
+	spans, err := contract.ValidatePerRecord(tgt, cands)
+	if err != nil {
+		return nil, err
+	}
+	for i := range spans {
+		spans[i].Output = formatSRTBlock(spans[i].Meta, spans[i].Output)
+	}
+	return spans, nil
+}
+
+var _ contract.PassthroughDecoder = (*decoder)(nil)
+
 // formatSRTBlock 将单条 span 渲染为 SRT 块文本：
 // - 若 meta 中存在 "seq"/"time"，按行输出；
 // - 追加文本行；
@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"llmspt/pkg/contract"
 )
@@ -94,3 +98,333 @@ func TestDecodeCtxCancel(t *testing.T) {
 		t.Fatalf("expect ctx cancel, got %v", err)
 	}
 }
+
+// TestDecodeDuplicateIDStrict 严格模式下重复 id 报错并指明 id
+func TestDecodeDuplicateIDStrict(t *testing.T) {
+	d, _ := New(nil)
+	src := `[{"id":1,"text":"a"},{"id":1,"text":"b"},{"id":2,"text":"c"}]`
+	_, err := d.Decode(context.Background(), contract.Target{FileID: "f", From: 1, To: 2}, contract.Raw{Text: src})
+	if !errors.Is(err, contract.ErrResponseInvalid) || !strings.Contains(err.Error(), "duplicate id 1") {
+		t.Fatalf("expect duplicate id error, got %v", err)
+	}
+}
+
+// TestDecodeDuplicateIDLenient 宽松模式保留首次出现
+func TestDecodeDuplicateIDLenient(t *testing.T) {
+	d, _ := New(json.RawMessage(`{"lenient":true}`))
+	src := `[{"id":1,"text":"a"},{"id":1,"text":"b"},{"id":2,"text":"c"}]`
+	idx := contract.IndexMetaMap{1: {"_src_text": "x"}, 2: {"_src_text": "y"}}
+	spans, err := d.(*decoder).DecodeWithMeta(context.Background(), contract.Target{FileID: "f", From: 1, To: 2}, contract.Raw{Text: src}, idx)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(spans) != 2 || spans[0].Meta["dst_text"] != "a" {
+		t.Fatalf("expect first occurrence kept: %+v", spans)
+	}
+}
+
+// TestDecodePreserveLinesStrict 行数不一致视为响应无效
+func TestDecodePreserveLinesStrict(t *testing.T) {
+	d, _ := New(json.RawMessage(`{"preserve_lines":true}`))
+	idx := contract.IndexMetaMap{1: {"_src_text": "- Hi\n- Hello"}}
+	src := `[{"id":1,"text":"- 大家好！ - 你好！"}]`
+	_, err := d.(*decoder).DecodeWithMeta(context.Background(), contract.Target{FileID: "f", From: 1, To: 1}, contract.Raw{Text: src}, idx)
+	if !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("expect ErrResponseInvalid, got %v", err)
+	}
+}
+
+// TestDecodePreserveLinesLenient 宽松模式启发式重排
+func TestDecodePreserveLinesLenient(t *testing.T) {
+	d, _ := New(json.RawMessage(`{"preserve_lines":true,"lenient":true}`))
+	idx := contract.IndexMetaMap{1: {"_src_text": "- Hi\n- Hello"}, 2: {"_src_text": "Good\nmorning"}}
+	src := `[{"id":1,"text":"- 大家好！ - 你好！"},{"id":2,"text":"早上好呀"}]`
+	spans, err := d.(*decoder).DecodeWithMeta(context.Background(), contract.Target{FileID: "f", From: 1, To: 2}, contract.Raw{Text: src}, idx)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got := spans[0].Meta["dst_text"]; got != "- 大家好！\n- 你好！" {
+		t.Fatalf("dialogue not re-split: %q", got)
+	}
+	if got := spans[1].Meta["dst_text"]; got != "早上\n好呀" {
+		t.Fatalf("cjk not re-split: %q", got)
+	}
+}
+
+// TestPassthrough 原文透传：以源文本渲染 SRT 块并标记 untranslated；缺失源条目视为输入无效
+func TestPassthrough(t *testing.T) {
+	d, _ := New(nil)
+	idx := contract.IndexMetaMap{
+		1: {"_src_text": "Hello", "seq": "1", "time": "00:00:01,000 --> 00:00:02,000"},
+		2: {"_src_text": "World", "seq": "2", "time": "00:00:03,000 --> 00:00:04,000"},
+	}
+	spans, err := d.(*decoder).Passthrough(context.Background(), contract.Target{FileID: "f", From: 1, To: 2}, idx)
+	if err != nil {
+		t.Fatalf("passthrough: %v", err)
+	}
+	if spans[1].Output != "2\n00:00:03,000 --> 00:00:04,000\nWorld\n\n" || spans[0].Meta["dst_text"] != "Hello" || spans[0].Meta[contract.MetaUntranslated] != "true" {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+	if _, err := d.(*decoder).Passthrough(context.Background(), contract.Target{FileID: "f", From: 1, To: 3}, idx); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+}
+
+// TestSpeakerLabels 源 Meta 携带说话人前缀时在译文前还原（含 dst_text），无前缀的条目不变；
+// 回显检测仍以剥离标签后的源文本比对
+func TestSpeakerLabels(t *testing.T) {
+	dd, _ := New(nil)
+	d := dd.(*decoder)
+	idx := contract.IndexMetaMap{
+		1: {"_src_text": "Hello", "seq": "1", "time": "t1", contract.MetaSpeaker: "JOHN: "},
+		2: {"_src_text": "World", "seq": "2", "time": "t2"},
+	}
+	tgt := contract.Target{FileID: "f", From: 1, To: 2}
+	src := `[{"id":1,"text":"Bonjour"},{"id":2,"text":"Monde"}]`
+	spans, err := d.DecodeWithMeta(context.Background(), tgt, contract.Raw{Text: src}, idx)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if spans[0].Output != "1\nt1\nJOHN: Bonjour\n\n" || spans[0].Meta["dst_text"] != "JOHN: Bonjour" {
+		t.Fatalf("label not restored: %+v", spans[0])
+	}
+	if spans[1].Output != "2\nt2\nMonde\n\n" {
+		t.Fatalf("unlabeled cue changed: %+v", spans[1])
+	}
+	var got []string
+	err = d.DecodeStream(context.Background(), tgt, strings.NewReader(src), idx, func(s contract.SpanResult) error {
+		got = append(got, s.Output)
+		return nil
+	})
+	if err != nil || len(got) != 2 || got[0] != spans[0].Output || got[1] != spans[1].Output {
+		t.Fatalf("stream mismatch: %v %q", err, got)
+	}
+	echo := `[{"id":1,"text":"Hello"},{"id":2,"text":"World"}]`
+	if _, err := d.DecodeWithMeta(context.Background(), tgt, contract.Raw{Text: echo}, idx); !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("expect echo detected, got %v", err)
+	}
+	ps, err := d.Passthrough(context.Background(), tgt, idx)
+	if err != nil || ps[0].Output != "1\nt1\nJOHN: Hello\n\n" {
+		t.Fatalf("passthrough: %v %+v", err, ps)
+	}
+}
+
+// TestDecodeMetaFields 附加字段写入 Meta（字符串取值、其他保留 JSON 文本、null 跳过），不进入渲染后的 Output；保留键被拒绝
+func TestDecodeMetaFields(t *testing.T) {
+	d, _ := New(json.RawMessage(`{"meta_fields":["notes","score"]}`))
+	dm := d.(contract.DecoderWithMeta)
+	idx := contract.IndexMetaMap{
+		1: {"seq": "1", "time": "00:00:01,000 --> 00:00:02,000", "_src_text": "Hi"},
+		2: {"seq": "2", "time": "00:00:02,000 --> 00:00:03,000", "_src_text": "Bye"},
+	}
+	raw := contract.Raw{Text: `[{"id":1,"text":"你好","notes":"greeting","score":0.9},{"id":2,"text":"再见","notes":null}]`}
+	spans, err := dm.DecodeWithMeta(context.Background(), contract.Target{FileID: "f", From: 1, To: 2}, raw, idx)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if spans[0].Meta["notes"] != "greeting" || spans[0].Meta["score"] != "0.9" || spans[0].Meta["seq"] != "1" {
+		t.Fatalf("unexpected meta: %v", spans[0].Meta)
+	}
+	if _, ok := spans[1].Meta["notes"]; ok {
+		t.Fatalf("null notes should be skipped: %v", spans[1].Meta)
+	}
+	if strings.Contains(spans[0].Output, "greeting") || spans[0].Output != "1\n00:00:01,000 --> 00:00:02,000\n你好\n\n" {
+		t.Fatalf("notes leaked into output: %q", spans[0].Output)
+	}
+	plain, _ := New(nil)
+	spans, err = plain.Decode(context.Background(), contract.Target{FileID: "f", From: 1, To: 1}, contract.Raw{Text: `[{"id":1,"text":"你好","notes":"greeting"}]`})
+	if err != nil || spans[0].Meta["notes"] != "" {
+		t.Fatalf("notes should be dropped by default: %v %v", spans, err)
+	}
+	// 核心/内部键不可作为附加字段，否则模型输出会覆盖渲染所需的 seq/time
+	for _, bad := range []string{`["time"]`, `["Seq"]`, `["dst_text"]`, `["untranslated"]`, `["_speaker"]`, `[" "]`} {
+		if _, err := New(json.RawMessage(`{"meta_fields":` + bad + `}`)); !errors.Is(err, contract.ErrInvalidInput) {
+			t.Fatalf("%s: expect ErrInvalidInput, got %v", bad, err)
+		}
+	}
+}
+
+// TestDecodeStream 流式解码与整批解码结果一致；乱序/缺失/尾随内容判为响应无效，读取错误原样返回
+func TestDecodeStream(t *testing.T) {
+	dd, _ := New(json.RawMessage(`{"meta_fields":["notes"]}`))
+	d := dd.(*decoder)
+	tgt := contract.Target{FileID: "f", From: 1, To: 2}
+	idx := contract.IndexMetaMap{1: {"seq": "1", contract.MetaSrcText: "a"}, 2: {"seq": "2", contract.MetaSrcText: "b"}}
+	src := `[{"id":1,"text":"x","notes":"n1"},{"id":2,"text":"y"}]`
+	want, err := d.DecodeWithMeta(context.Background(), tgt, contract.Raw{Text: src}, idx)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	stream := func(text string) ([]contract.SpanResult, error) {
+		var got []contract.SpanResult
+		err := d.DecodeStream(context.Background(), tgt, iotest.OneByteReader(strings.NewReader(text)), idx, func(sp contract.SpanResult) error {
+			got = append(got, sp)
+			return nil
+		})
+		return got, err
+	}
+	got, err := stream(src)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("stream = %+v, want %+v", got, want)
+	}
+	for _, bad := range []string{
+		`[{"id":2,"text":"y"},{"id":1,"text":"x"}]`,
+		`[{"id":1,"text":"x"},{"id":1,"text":"x"},{"id":2,"text":"y"}]`,
+		`[{"id":1,"text":"x"}]`,
+		`[{"id":1,"text":"x"},{"id":2,"text":"y"}] extra`,
+		`[{"id":1,"text":"x"},{"id":2,`,
+		`[{"id":1,"text":"a"},{"id":2,"text":"b"}]`,
+	} {
+		if _, err := stream(bad); !errors.Is(err, contract.ErrResponseInvalid) {
+			t.Fatalf("%s: expect ErrResponseInvalid, got %v", bad, err)
+		}
+	}
+	boom := errors.New("boom")
+	r := io.MultiReader(strings.NewReader(`[{"id":1,`), iotest.ErrReader(boom))
+	if err := d.DecodeStream(context.Background(), tgt, r, idx, func(contract.SpanResult) error { return nil }); !errors.Is(err, boom) {
+		t.Fatalf("expect read error, got %v", err)
+	}
+}
+
+// TestDecodeShapeDiagnostics 结构不符的响应：错误信息指明实际形状（围栏、包装对象、类型错误等）
+func TestDecodeShapeDiagnostics(t *testing.T) {
+	d, _ := New(nil)
+	tgt := contract.Target{FileID: "f", From: 0, To: 0}
+	cases := []struct{ text, want string }{
+		{"", "empty response"},
+		{"```json\n[{\"id\":0,\"text\":\"a\"}]\n```", "markdown code fence"},
+		{`{"results":[{"id":0,"text":"a"}],"lang":"zh"}`, "wrapper object with keys [lang, results]"},
+		{`"hello"`, "top-level string"},
+		{`["a","b"]`, "element 0 of type string"},
+		{`[{"id":"0","text":"a"}]`, `field "id" of type string`},
+		{`[{"id":0,"text":"a"}`, "malformed JSON"},
+		{"Sure! Here is the translation:", `non-JSON text "Sure! Here is the translation:"`},
+	}
+	for _, c := range cases {
+		_, err := d.Decode(context.Background(), tgt, contract.Raw{Text: c.text})
+		if !errors.Is(err, contract.ErrResponseInvalid) || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("%q: expect %q, got %v", c.text, c.want, err)
+		}
+	}
+	sd := d.(contract.StreamDecoder)
+	stream := []struct{ text, want string }{
+		{`{"results":[]}`, "wrapper object"},
+		{"```json\n[]\n```", "non-JSON text"},
+		{`[{"id":"0","text":"a"}]`, `field "id" of type string`},
+	}
+	for _, c := range stream {
+		err := sd.DecodeStream(context.Background(), tgt, strings.NewReader(c.text), nil, func(contract.SpanResult) error { return nil })
+		if !errors.Is(err, contract.ErrResponseInvalid) || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("stream %q: expect %q, got %v", c.text, c.want, err)
+		}
+	}
+}
+
+// TestFieldMap 别名键按 FieldMap 解码（非流式与流式一致）；大写键需 CaseInsensitiveKeys；缺键与未知逻辑字段报错
+func TestFieldMap(t *testing.T) {
+	tgt := contract.Target{FileID: "f", From: 1, To: 2}
+	aliased := `[{"index":1,"translation":"a","notes":"n"},{"index":2,"translation":"b"}]`
+	dd, err := New(json.RawMessage(`{"field_map":{"id":"index","text":"translation"},"meta_fields":["notes"]}`))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	d := dd.(*decoder)
+	spans, err := d.Decode(context.Background(), tgt, contract.Raw{Text: aliased})
+	if err != nil || len(spans) != 2 || spans[1].Meta["dst_text"] != "b" || spans[0].Meta["notes"] != "n" {
+		t.Fatalf("aliased decode: %v %+v", err, spans)
+	}
+	var got []string
+	if err := d.DecodeStream(context.Background(), tgt, strings.NewReader(aliased), nil, func(s contract.SpanResult) error {
+		got = append(got, s.Meta["dst_text"])
+		return nil
+	}); err != nil || !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("aliased stream: %v %v", err, got)
+	}
+	// 别名缺失：明确报告缺少的键，而非解码为零值 id
+	_, err = d.Decode(context.Background(), tgt, contract.Raw{Text: `[{"id":1,"text":"a"}]`})
+	if !errors.Is(err, contract.ErrResponseInvalid) || !strings.Contains(err.Error(), `element 0 without "index" key`) {
+		t.Fatalf("missing key: %v", err)
+	}
+
+	capital := `[{"ID":1,"Translation":"a"},{"ID":2,"Translation":"b"}]`
+	if _, err := d.Decode(context.Background(), tgt, contract.Raw{Text: capital}); !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("expect case-sensitive miss, got %v", err)
+	}
+	dd, _ = New(json.RawMessage(`{"field_map":{"text":"translation"},"case_insensitive_keys":true}`))
+	spans, err = dd.Decode(context.Background(), tgt, contract.Raw{Text: capital})
+	if err != nil || spans[0].Meta["dst_text"] != "a" || spans[1].From != 2 {
+		t.Fatalf("case-insensitive decode: %v %+v", err, spans)
+	}
+	_, err = dd.Decode(context.Background(), tgt, contract.Raw{Text: `[{"id":"1","translation":"a"}]`})
+	if !errors.Is(err, contract.ErrResponseInvalid) || !strings.Contains(err.Error(), `element 0 field "id" of type string`) {
+		t.Fatalf("type error: %v", err)
+	}
+
+	for _, bad := range []string{`{"field_map":{"txt":"x"}}`, `{"field_map":{"id":" "}}`} {
+		if _, err := New(json.RawMessage(bad)); !errors.Is(err, contract.ErrInvalidInput) {
+			t.Fatalf("%s: expect ErrInvalidInput, got %v", bad, err)
+		}
+	}
+}
+
+// TestIgnoreExtraIDs 区间外的首尾多余 id 被丢弃后正常解码（含流式）；默认严格失败；区间内缺失仍失败
+func TestIgnoreExtraIDs(t *testing.T) {
+	tgt := contract.Target{FileID: "f", From: 2, To: 3}
+	src := `[{"id":1,"text":"ctx"},{"id":2,"text":"a"},{"id":3,"text":"b"},{"id":4,"text":""}]`
+	strict, _ := New(nil)
+	if _, err := strict.Decode(context.Background(), tgt, contract.Raw{Text: src}); !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("strict: expect ErrResponseInvalid, got %v", err)
+	}
+	dd, _ := New(json.RawMessage(`{"ignore_extra_ids":true}`))
+	d := dd.(*decoder)
+	spans, err := d.DecodeWithMeta(context.Background(), tgt, contract.Raw{Text: src}, nil)
+	if err != nil || len(spans) != 2 || spans[0].From != 2 || spans[1].Meta["dst_text"] != "b" {
+		t.Fatalf("decode: %v %+v", err, spans)
+	}
+	var got []contract.Index
+	if err := d.DecodeStream(context.Background(), tgt, strings.NewReader(src), nil, func(s contract.SpanResult) error {
+		got = append(got, s.From)
+		return nil
+	}); err != nil || !reflect.DeepEqual(got, []contract.Index{2, 3}) {
+		t.Fatalf("stream: %v %v", err, got)
+	}
+	if _, err := d.Decode(context.Background(), tgt, contract.Raw{Text: `[{"id":1,"text":"ctx"},{"id":2,"text":"a"}]`}); !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("missing target id: expect ErrResponseInvalid, got %v", err)
+	}
+}
+
+func TestTrimInvisible(t *testing.T) {
+	tgt := contract.Target{FileID: "f", From: 1, To: 2}
+	src := `[{"id":1,"text":"\uFEFFhello\u200B \n"},{"id":2,"text":"wo\u200Brld\n\uFEFF"}]`
+	raw, _ := New(nil)
+	spans, err := raw.Decode(context.Background(), tgt, contract.Raw{Text: src})
+	if err != nil || spans[0].Meta["dst_text"] != "\uFEFFhello\u200B \n" {
+		t.Fatalf("default keeps raw text: %v %+v", err, spans)
+	}
+	dd, _ := New(json.RawMessage(`{"trim_invisible":true}`))
+	d := dd.(*decoder)
+	want := []string{"hello", "world"}
+	spans, err = d.DecodeWithMeta(context.Background(), tgt, contract.Raw{Text: src}, nil)
+	if err != nil || len(spans) != 2 {
+		t.Fatalf("decode: %v %+v", err, spans)
+	}
+	for i, s := range spans {
+		if s.Meta["dst_text"] != want[i] {
+			t.Fatalf("span %d: got %q want %q", i, s.Meta["dst_text"], want[i])
+		}
+	}
+	var got []string
+	if err := d.DecodeStream(context.Background(), tgt, strings.NewReader(src), nil, func(s contract.SpanResult) error {
+		got = append(got, s.Meta["dst_text"])
+		return nil
+	}); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("stream: %v %q", err, got)
+	}
+	// 仅含不可见字符的文本规范化后为空，按响应无效处理
+	if _, err := d.Decode(context.Background(), contract.Target{FileID: "f", From: 1, To: 1}, contract.Raw{Text: `[{"id":1,"text":"\u200B\uFEFF"}]`}); !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("invisible-only: expect ErrResponseInvalid, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package textjson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"llmspt/pkg/contract"
+)
+
+// Options: 纯文本翻译场景的逐条 JSON（[{id:int,text:string}]）。
+type Options struct {
+	// Lenient: 宽松模式。重复 id 时保留首次出现、丢弃其后重复项；默认严格（重复即失败）。
+	Lenient bool `json:"lenient"`
+}
+
+type decoder struct {
+	lenient bool
+}
+
+// New 从原样 JSON Options 创建解码器（忽略解析错误与未知字段）。
+func New(raw json.RawMessage) (contract.Decoder, error) {
+	var opts Options
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &opts)
+	}
+	return &decoder{lenient: opts.Lenient}, nil
+}
+
+// item: 上游逐条 JSON 数组的单项。
+type item struct {
+	ID   int64  `json:"id"`
+	Text string `json:"text"`
+}
+
+// 期望 Raw.Text 为严格 JSON 数组：[{"id": number, "text": string}, ...]
+// 与 srtjson 不同，Output 即为原样译文（不渲染 seq/time、不追加块分隔空行），
+// 记录间的分隔交由装配层（如 text 装配器）决定。
+func (d *decoder) Decode(ctx context.Context, tgt contract.Target, raw contract.Raw) ([]contract.SpanResult, error) {
+	return d.DecodeWithMeta(ctx, tgt, raw, nil)
+}
+
+var _ contract.Decoder = (*decoder)(nil)
+
+// DecodeWithMeta: 同 Decode，并以 idxMeta 还原 Splitter 剥离的说话人标签。
+func (d *decoder) DecodeWithMeta(ctx context.Context, tgt contract.Target, raw contract.Raw, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	var arr []item
+	if err := json.Unmarshal([]byte(raw.Text), &arr); err != nil {
+		return nil, fmt.Errorf("decode json per-record: %w", contract.ErrResponseInvalid)
+	}
+	seen := make(map[int64]struct{}, len(arr))
+	cands := make([]contract.SpanCandidate, 0, len(arr))
+	for _, it := range arr {
+		if _, dup := seen[it.ID]; dup {
+			if !d.lenient {
+				return nil, fmt.Errorf("duplicate id %d: %w", it.ID, contract.ErrResponseInvalid)
+			}
+			continue
+		}
+		seen[it.ID] = struct{}{}
+		// 空文本视为协议无效（失败）
+		if strings.TrimSpace(it.Text) == "" {
+			return nil, fmt.Errorf("empty text for id %d: %w", it.ID, contract.ErrResponseInvalid)
+		}
+		id := contract.Index(it.ID)
+		text := contract.WithSpeaker(idxMeta[id], it.Text)
+		cands = append(cands, contract.SpanCandidate{From: id, To: id, Output: text, Meta: contract.AttachDstText(nil, text)})
+	}
+	return contract.ValidatePerRecord(tgt, cands)
+}
+
+var _ contract.DecoderWithMeta = (*decoder)(nil)
+
+// Passthrough: 原文透传——以 idxMeta["_src_text"] 作为目标区间各条的输出（上游拦截时由编排层调用）。
+func (d *decoder) Passthrough(ctx context.Context, tgt contract.Target, idxMeta contract.IndexMetaMap) ([]contract.SpanResult, error) {
+	cands := make([]contract.SpanCandidate, 0, int(tgt.To-tgt.From)+1)
+	for id := tgt.From; id <= tgt.To; id++ {
+		mm, ok := idxMeta[id]
+		if !ok {
+			return nil, fmt.Errorf("passthrough: missing source for id %d: %w", id, contract.ErrInvalidInput)
+		}
+		src := contract.WithSpeaker(mm, mm[contract.MetaSrcText])
+		meta := contract.AttachDstText(nil, src)
+		meta[contract.MetaUntranslated] = "true"
+		cands = append(cands, contract.SpanCandidate{From: id, To: id, Output: src, Meta: meta})
+	}
+	return contract.ValidatePerRecord(tgt, cands)
+}
+
+var _ contract.PassthroughDecoder = (*decoder)(nil)
@@ -0,0 +1,38 @@
+package textjson
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"llmspt/pkg/contract"
+)
+
+// TestDecodeRawText Output 为原样译文，不附加 seq/time 或块分隔空行
+func TestDecodeRawText(t *testing.T) {
+	d, _ := New(nil)
+	tgt := contract.Target{FileID: "f", From: 0, To: 1}
+	spans, err := d.Decode(context.Background(), tgt, contract.Raw{Text: `[{"id":0,"text":"甲"},{"id":1,"text":"乙\n丙"}]`})
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(spans) != 2 || spans[0].Output != "甲" || spans[1].Output != "乙\n丙" || spans[1].Meta["dst_text"] != "乙\n丙" {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+}
+
+// TestDecodeInvalid 非法 JSON、空文本、重复 id（严格）均为响应无效；宽松模式丢弃重复项
+func TestDecodeInvalid(t *testing.T) {
+	d, _ := New(nil)
+	tgt := contract.Target{FileID: "f", From: 0, To: 0}
+	for _, src := range []string{`nope`, `[{"id":0,"text":" "}]`, `[{"id":0,"text":"a"},{"id":0,"text":"b"}]`} {
+		if _, err := d.Decode(context.Background(), tgt, contract.Raw{Text: src}); !errors.Is(err, contract.ErrResponseInvalid) {
+			t.Fatalf("expect ErrResponseInvalid for %q, got %v", src, err)
+		}
+	}
+	d, _ = New([]byte(`{"lenient":true}`))
+	spans, err := d.Decode(context.Background(), tgt, contract.Raw{Text: `[{"id":0,"text":"a"},{"id":0,"text":"b"}]`})
+	if err != nil || len(spans) != 1 || spans[0].Output != "a" {
+		t.Fatalf("lenient: %+v %v", spans, err)
+	}
+}
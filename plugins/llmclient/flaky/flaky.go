@@ -1,9 +1,11 @@
 package flaky
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"sync/atomic"
 
@@ -27,6 +29,20 @@ type Client struct {
 	count   atomic.Int32
 }
 
+// ValidateOptions 严格校验原样 JSON 选项（拒绝未知字段与类型不符）。
+func ValidateOptions(raw json.RawMessage) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	var o Options
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o); err != nil {
+		return fmt.Errorf("flaky options: %w", err)
+	}
+	return nil
+}
+
 // New 构造 Client。
 func New(raw json.RawMessage) (contract.LLMClient, error) {
 	var o Options
@@ -14,12 +14,17 @@ import (
     "time"
 
     "llmspt/pkg/contract"
+    "llmspt/plugins/llmclient/internal/hdrtmpl"
+    "llmspt/plugins/llmclient/internal/llmhttp"
 )
 
 // Options: Google Generative Language API (Gemini) 最小必需。
 type Options struct {
     BaseURL   string `json:"base_url"`    // https://generativelanguage.googleapis.com
-    Model     string `json:"model"`       // 默认 gemini-1.5-flash
+    Model     string `json:"model"`       // 默认 gemini-2.5-flash
+    // ModelFallbacks: 候选模型（按序）；上游报告模型不存在（404/400）时在同一次调用内依次改用。
+    // 仅当 endpoint_path 含 {model} 占位时生效。
+    ModelFallbacks []string `json:"model_fallbacks"`
     APIKeyEnv string `json:"api_key_env"` // 默认 GOOGLE_API_KEY
     APIKey    string `json:"api_key"`
     // 客户端超时（秒）。未设置或 <=0 时采用默认 60 秒。
@@ -27,12 +32,38 @@ type Options struct {
 	// 第三方兼容（最小）
 	EndpointPath  string            `json:"endpoint_path"`    // 可覆盖默认 /v1beta/models/{model}:generateContent；支持 {model} 占位
 	APIKeyInQuery *bool             `json:"api_key_in_query"` // 默认 true；为 false 时使用 x-goog-api-key 头
-	ExtraHeaders  map[string]string `json:"extra_headers"`
+	ExtraHeaders  map[string]string `json:"extra_headers"`    // 值支持 ${env:NAME}/${timestamp}/${batch_index} 等模板，见 plugins/llmclient/internal/hdrtmpl
 	ExtraQuery    map[string]string `json:"extra_query"`
 	// JSON 输出 MIME（可选）：仅当 Prompt 携带 schema 时才会生效；为空则使用 application/json
 	ResponseMIMEType string `json:"response_mime_type,omitempty"`
+	// RetryableStatuses: 额外视为瞬时上游错误（网络类，可重试）的 HTTP 状态码；5xx 与 408 始终如此。
+	RetryableStatuses []int `json:"retryable_statuses"`
+	// AllowedHosts: 允许连接的主机白名单（主机名或 host:port，"*.example.com" 匹配子域）；为空不限制。
+	// 请求 URL 与重定向目标的主机不在名单内时以 ErrInvalidInput 失败，防止误配的 base_url 外泄提示词。
+	AllowedHosts []string `json:"allowed_hosts"`
+	// OnEmptyResponse: 上游因安全策略拦截而返回空结果时的处理：retry（默认，分类为 blocked，retry_on 含 blocked 时重试）|
+	// fail（不重试）|passthrough（原文透传该批）。格式错误的空响应始终视为无效响应。
+	// 运行级 on_blocked 设置优先于本选项。
+	OnEmptyResponse string `json:"on_empty_response"`
+	// MaxResponseBytes: 成功响应体的读取上限（字节）；超出视为无效响应。<=0 采用默认 16MiB。
+	MaxResponseBytes int64 `json:"max_response_bytes"`
+	// 连接池调优（高并发下复用到同一上游主机的长连接）：
+	// MaxIdleConns: 全部主机的空闲连接上限（默认 100）；
+	// MaxIdleConnsPerHost: 单主机空闲连接上限（默认 64，建议 >= 流水线并发度）；
+	// IdleConnTimeoutSeconds: 空闲连接保留时长（秒，默认 90）。
+	MaxIdleConns           int `json:"max_idle_conns"`
+	MaxIdleConnsPerHost    int `json:"max_idle_conns_per_host"`
+	IdleConnTimeoutSeconds int `json:"idle_conn_timeout_seconds"`
+	// Proxy: 显式代理 URL（如 http://proxy:3128），仅作用于本 Provider；为空时按 HTTP(S)_PROXY/NO_PROXY 环境变量。
+	Proxy string `json:"proxy"`
+	// Locale: 目标区域设置（BCP 47，如 "zh-CN"）；非空时发送 Accept-Language 头（extra_headers 同名项优先），
+	// 并作为模板变量 locale 注入 Prompt（需 PromptBuilder 支持逐文件变量）。
+	Locale string `json:"locale"`
 }
 
+// defaultMaxResponseBytes: 成功响应体的默认读取上限。
+const defaultMaxResponseBytes = 16 << 20
+
 func (o *Options) defaults() {
 	if o.BaseURL == "" {
 		o.BaseURL = "https://generativelanguage.googleapis.com"
@@ -51,18 +82,59 @@ func (o *Options) defaults() {
 		t := true
 		o.APIKeyInQuery = &t
 	}
+	if o.MaxResponseBytes <= 0 {
+		o.MaxResponseBytes = defaultMaxResponseBytes
+	}
 }
 
 type Client struct {
 	hc      *http.Client
-	url     string // 完整路径（包含模型路径或占位展开）
+	url     string // 完整路径（保留 {model} 占位，调用时按候选模型展开）
+	models  []string
 	apiKey  string
 	inQuery bool
-	extraH  map[string]string
+	extraH  []hdrtmpl.Header
 	extraQ  map[string]string
 	do      func(*http.Request) (*http.Response, error)
 	// JSON 输出配置：MIME 可配置，Schema 改由 Prompt 携带
 	respMIME string
+	// 额外可重试状态码
+	retryable map[int]bool
+	// 主机白名单（nil 不限制）
+	allowed []string
+	// 被拦截空响应的处理策略
+	onEmpty string
+	// 成功响应体读取上限
+	maxResp int64
+	// 目标区域设置（Accept-Language）
+	locale string
+}
+
+// ValidateOptions 配置期预检：严格解码（未知字段/类型不符即报错）并检查 on_empty_response 取值。
+// 不读取 api_key_env、不发起请求。
+func ValidateOptions(raw json.RawMessage) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	var opts Options
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&opts); err != nil {
+		return fmt.Errorf("gemini options: %w", err)
+	}
+	if _, err := llmhttp.ParseOnEmpty(opts.OnEmptyResponse); err != nil {
+		return fmt.Errorf("gemini options: %w", err)
+	}
+	if _, err := llmhttp.ParseProxy(opts.Proxy); err != nil {
+		return fmt.Errorf("gemini options: %w", err)
+	}
+	if _, err := llmhttp.ParseLocale(opts.Locale); err != nil {
+		return fmt.Errorf("gemini options: %w", err)
+	}
+	if _, err := hdrtmpl.Parse(opts.ExtraHeaders); err != nil {
+		return fmt.Errorf("gemini options: %w", err)
+	}
+	return nil
 }
 
 func New(raw json.RawMessage) (contract.LLMClient, error) {
@@ -80,7 +152,7 @@ func New(raw json.RawMessage) (contract.LLMClient, error) {
 	if key == "" {
 		return nil, fmt.Errorf("gemini: %w: missing api key", contract.ErrInvalidInput)
 	}
-	path := strings.ReplaceAll(opts.EndpointPath, "{model}", url.PathEscape(opts.Model))
+	path := opts.EndpointPath
 	if !(strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")) {
 		base := strings.TrimRight(opts.BaseURL, "/")
 		p := strings.TrimLeft(path, "/")
@@ -94,9 +166,31 @@ func New(raw json.RawMessage) (contract.LLMClient, error) {
     if opts.TimeoutSeconds <= 0 {
         opts.TimeoutSeconds = 60
     }
-    hc := &http.Client{Timeout: time.Duration(opts.TimeoutSeconds) * time.Second}
-    return &Client{hc: hc, url: path, apiKey: key, inQuery: inQuery, extraH: opts.ExtraHeaders, extraQ: opts.ExtraQuery, do: hc.Do,
-        respMIME: opts.ResponseMIMEType,
+	proxy, err := llmhttp.ParseProxy(opts.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+    hc := &http.Client{Timeout: time.Duration(opts.TimeoutSeconds) * time.Second, Transport: llmhttp.NewTransport(opts.MaxIdleConns, opts.MaxIdleConnsPerHost, opts.IdleConnTimeoutSeconds, proxy)}
+	onEmpty, err := llmhttp.ParseOnEmpty(opts.OnEmptyResponse)
+	if err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+	locale, err := llmhttp.ParseLocale(opts.Locale)
+	if err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+	extraH, err := hdrtmpl.Parse(opts.ExtraHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+	allowed := llmhttp.HostSet(opts.AllowedHosts)
+	if err := llmhttp.CheckHost(path, allowed); err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+	llmhttp.RestrictRedirects(hc, allowed)
+    return &Client{hc: hc, url: path, models: llmhttp.CandidateModels(opts.Model, opts.ModelFallbacks), apiKey: key, inQuery: inQuery, extraH: extraH, extraQ: opts.ExtraQuery, do: hc.Do,
+        respMIME: opts.ResponseMIMEType, retryable: llmhttp.StatusSet(opts.RetryableStatuses), allowed: allowed, onEmpty: onEmpty, maxResp: opts.MaxResponseBytes,
+        locale: locale,
     }, nil
 }
 
@@ -123,7 +217,31 @@ type gmResp struct {
 				Text string `json:"text"`
 			} `json:"parts"`
 		} `json:"content"`
+		FinishReason string `json:"finishReason"`
 	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+}
+
+// gmBlockedFinish: 表示候选被安全/合规策略拦截的 finishReason。
+var gmBlockedFinish = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+}
+
+// blockReason 返回拦截原因（提示词被拦截或候选因安全原因终止）；未拦截返回空串。
+func (r *gmResp) blockReason() string {
+	if r.PromptFeedback.BlockReason != "" {
+		return r.PromptFeedback.BlockReason
+	}
+	if len(r.Candidates) > 0 && gmBlockedFinish[r.Candidates[0].FinishReason] {
+		return r.Candidates[0].FinishReason
+	}
+	return ""
 }
 
 // upstreamError 实现 net.Error，用于将 HTTP 上游 5xx/408 映射为网络类错误。
@@ -131,7 +249,7 @@ type upstreamError struct{ status int; msg string }
 
 func (e upstreamError) Error() string { return fmt.Sprintf("gemini upstream %d: %s", e.status, e.msg) }
 func (e upstreamError) Timeout() bool { return e.status == http.StatusRequestTimeout }
-func (e upstreamError) Temporary() bool { return e.status/100 == 5 }
+func (e upstreamError) Temporary() bool { return e.status != http.StatusRequestTimeout }
 func (e upstreamError) UpstreamStatus() int { return e.status }
 func (e upstreamError) UpstreamMessage() string { return e.msg }
 
@@ -195,7 +313,29 @@ func normalizeGeminiRole(r string) string {
 	}
 }
 
+// Locale 实现 contract.LocaleHinter。
+func (c *Client) Locale() string { return c.locale }
+
+// Invoke: 单次调用，同步返回；主模型不存在时按 ModelFallbacks 顺序回退。
 func (c *Client) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	var raw contract.Raw
+	var err error
+	for i, model := range c.models {
+		raw, err = c.invokeModel(ctx, b, p, model)
+		if err == nil {
+			raw.Model = model
+			return raw, nil
+		}
+		// 无 {model} 占位时 URL 不随模型变化，回退无意义
+		if !errors.Is(err, llmhttp.ErrModelNotFound) || i+1 == len(c.models) || !strings.Contains(c.url, "{model}") {
+			break
+		}
+	}
+	return contract.Raw{}, err
+}
+
+// invokeModel: 使用指定模型发起一次请求。
+func (c *Client) invokeModel(ctx context.Context, b contract.Batch, p contract.Prompt, model string) (contract.Raw, error) {
 	// 从 Prompt 中抽取 JSON Schema（若存在）；默认不启用 JSON 模式，只有传入 schema 时才开启
 	pp, schema := extractJSONSchemaFromPrompt(p)
 	var genCfg *gmGenerationConfig
@@ -215,7 +355,7 @@ func (c *Client) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt
 		return contract.Raw{}, fmt.Errorf("encode: %v: %w", err, contract.ErrInvalidInput)
 	}
 	// 构造 URL 并安全追加 query 参数
-	u, err := url.Parse(c.url)
+	u, err := url.Parse(strings.ReplaceAll(c.url, "{model}", url.PathEscape(model)))
 	if err != nil {
 		return contract.Raw{}, fmt.Errorf("invalid url: %v: %w", err, contract.ErrInvalidInput)
 	}
@@ -240,10 +380,14 @@ func (c *Client) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt
 	if !c.inQuery {
 		req.Header.Set("x-goog-api-key", c.apiKey)
 	}
-	for k, v := range c.extraH {
-		if k != "" {
-			req.Header.Set(k, v)
-		}
+	if c.locale != "" {
+		req.Header.Set("Accept-Language", c.locale)
+	}
+	if err := hdrtmpl.Apply(req.Header, c.extraH, b); err != nil {
+		return contract.Raw{}, err
+	}
+	if !llmhttp.HostAllowed(c.allowed, req.URL) {
+		return contract.Raw{}, fmt.Errorf("%w: host %q not in allowed_hosts", contract.ErrInvalidInput, req.URL.Host)
 	}
 	resp, err := c.do(req)
 	if err != nil {
@@ -259,17 +403,34 @@ func (c *Client) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt
 	if resp.StatusCode/100 != 2 {
 		slurp, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
 		msg := strings.TrimSpace(string(slurp))
-		if resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode/100 == 5 {
+		if resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode/100 == 5 || c.retryable[resp.StatusCode] {
 			return contract.Raw{}, upstreamError{status: resp.StatusCode, msg: msg}
 		}
+		if llmhttp.IsModelNotFound(resp.StatusCode, msg, "not supported") {
+			return contract.Raw{}, fmt.Errorf("gemini upstream %d: model %q: %w: %w", resp.StatusCode, model, llmhttp.ErrModelNotFound, contract.ErrInvalidInput)
+		}
 		return contract.Raw{}, fmt.Errorf("gemini upstream %d: %w", resp.StatusCode, contract.ErrInvalidInput)
 	}
+	// 有界读取：超出上限视为无效响应，避免异常上游耗尽内存
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.maxResp+1))
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return contract.Raw{}, ctx.Err()
+		}
+		return contract.Raw{}, err
+	}
+	if int64(len(data)) > c.maxResp {
+		return contract.Raw{}, fmt.Errorf("response body exceeds %d bytes: %w", c.maxResp, contract.ErrResponseInvalid)
+	}
 	var gr gmResp
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&gr); err != nil {
+	if err := json.Unmarshal(data, &gr); err != nil {
 		return contract.Raw{}, fmt.Errorf("decode: %w", contract.ErrResponseInvalid)
 	}
 	if len(gr.Candidates) == 0 || len(gr.Candidates[0].Content.Parts) == 0 || gr.Candidates[0].Content.Parts[0].Text == "" {
+		// 区分拦截（promptFeedback/finishReason）与格式错误
+		if reason := gr.blockReason(); reason != "" {
+			return contract.Raw{}, llmhttp.BlockedErr(c.onEmpty, reason)
+		}
 		return contract.Raw{}, contract.ErrResponseInvalid
 	}
 	return contract.Raw{Text: gr.Candidates[0].Content.Parts[0].Text}, nil
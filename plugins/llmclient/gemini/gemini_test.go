@@ -0,0 +1,182 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llmspt/pkg/contract"
+)
+
+// TestInvokeModelFallback 主模型 404 时按候选展开 {model} 重试，全部不存在时返回无效输入
+func TestInvokeModelFallback(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if !strings.Contains(r.URL.Path, "/g2:") {
+			http.Error(w, `{"error":{"message":"models/x is not found for API version v1beta"}}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`)
+	}))
+	defer srv.Close()
+	raw, _ := json.Marshal(map[string]any{"base_url": srv.URL, "api_key": "k", "model": "g1", "model_fallbacks": []string{"g2"}})
+	c, err := New(raw)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	got, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	if err != nil || got.Text != "ok" || got.Model != "g2" || len(paths) != 2 {
+		t.Fatalf("unexpected: raw=%+v err=%v paths=%v", got, err, paths)
+	}
+
+	raw, _ = json.Marshal(map[string]any{"base_url": srv.URL, "api_key": "k", "model": "g1", "model_fallbacks": []string{"g3"}})
+	c, _ = New(raw)
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+}
+
+// TestInvokeRetryableStatuses 配置的非 5xx 状态映射为网络类上游错误
+func TestInvokeRetryableStatuses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "closed", 499)
+	}))
+	defer srv.Close()
+	raw, _ := json.Marshal(map[string]any{"base_url": srv.URL, "api_key": "k", "retryable_statuses": []int{499}})
+	c, _ := New(raw)
+	_, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	var ue contract.UpstreamError
+	if !errors.As(err, &ue) || ue.UpstreamStatus() != 499 {
+		t.Fatalf("expect upstream error, got %v", err)
+	}
+}
+
+// TestAllowedHosts 白名单外的 base_url 构造失败，白名单内（含端口条目）正常调用
+func TestAllowedHosts(t *testing.T) {
+	raw, _ := json.Marshal(map[string]any{"base_url": "https://evil.example.net", "api_key": "k", "allowed_hosts": []string{"generativelanguage.googleapis.com"}})
+	if _, err := New(raw); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	raw, _ = json.Marshal(map[string]any{"base_url": srv.URL, "api_key": "k", "allowed_hosts": []string{host}})
+	c, err := New(raw)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if got, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); err != nil || got.Text != "ok" {
+		t.Fatalf("unexpected: raw=%+v err=%v", got, err)
+	}
+}
+
+// TestOnEmptyResponse 提示词被拦截（promptFeedback.blockReason）时按 passthrough 策略要求原文透传
+func TestOnEmptyResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"promptFeedback":{"blockReason":"SAFETY"}}`)
+	}))
+	defer srv.Close()
+	raw, _ := json.Marshal(map[string]any{"base_url": srv.URL, "api_key": "k", "on_empty_response": "passthrough"})
+	c, err := New(raw)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	if !errors.Is(err, contract.ErrResponseBlocked) || !errors.Is(err, contract.ErrSourcePassthrough) {
+		t.Fatalf("expect blocked passthrough, got %v", err)
+	}
+}
+
+// TestMaxResponseBytes 超出上限的成功响应体视为无效响应
+func TestMaxResponseBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"candidates":[{"content":{"parts":[{"text":%q}]}}]}`, strings.Repeat("x", 1024))
+	}))
+	defer srv.Close()
+	raw, _ := json.Marshal(map[string]any{"base_url": srv.URL, "api_key": "k", "max_response_bytes": 512})
+	c, _ := New(raw)
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("expect ErrResponseInvalid, got %v", err)
+	}
+}
+
+// TestProxyOption 配置 proxy 时请求经由该代理发往上游
+func TestProxyOption(t *testing.T) {
+	var via string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		via = r.URL.Host
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`)
+	}))
+	defer proxy.Close()
+	raw, _ := json.Marshal(map[string]any{"base_url": "http://upstream.invalid", "api_key": "k", "proxy": proxy.URL})
+	c, err := New(raw)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	got, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	if err != nil || got.Text != "ok" || via != "upstream.invalid" {
+		t.Fatalf("unexpected: raw=%+v err=%v via=%q", got, err, via)
+	}
+	if _, err := New(json.RawMessage(`{"api_key":"k","proxy":"::bad"}`)); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+}
+
+// TestLocale 配置 locale 时发送 Accept-Language 并经 LocaleHinter 暴露；非法取值被拒绝
+func TestLocale(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Accept-Language")
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`)
+	}))
+	defer srv.Close()
+	raw, _ := json.Marshal(map[string]any{"base_url": srv.URL, "api_key": "k", "locale": "pt-BR"})
+	c, err := New(raw)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); err != nil || got != "pt-BR" {
+		t.Fatalf("header=%q err=%v", got, err)
+	}
+	if lh, ok := c.(contract.LocaleHinter); !ok || lh.Locale() != "pt-BR" {
+		t.Fatalf("locale hint not exposed")
+	}
+	if _, err := New(json.RawMessage(`{"api_key":"k","locale":"pt\nBR"}`)); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+}
+
+// TestExtraHeaderTemplates 占位符逐请求求值；静态值原样发送；非法模板被拒绝
+func TestExtraHeaderTemplates(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`)
+	}))
+	defer srv.Close()
+	t.Setenv("LLMSPT_TEST_SIG", "s3cr3t")
+	raw, _ := json.Marshal(map[string]any{"base_url": srv.URL, "api_key": "k", "extra_headers": map[string]string{
+		"X-Static": "plain", "X-Sig": "v1:${env:LLMSPT_TEST_SIG}", "X-Batch": "${batch_index}",
+	}})
+	c, err := New(raw)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := c.Invoke(context.Background(), contract.Batch{BatchIndex: 3}, contract.TextPrompt("hi")); err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if got.Get("X-Static") != "plain" || got.Get("X-Sig") != "v1:s3cr3t" || got.Get("X-Batch") != "3" {
+		t.Fatalf("unexpected headers %v", got)
+	}
+	if _, err := New(json.RawMessage(`{"api_key":"k","extra_headers":{"X":"${bogus}"}}`)); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+// Package hdrtmpl 解析并求值 HTTP 型 LLM 客户端的 extra_headers 值模板（openai/gemini 共用）。
+//
+// 不含 "${" 的值按静态字符串原样发送；占位符在每次请求（Invoke）时求值：
+//   - ${env:NAME}    环境变量 NAME（未设置时请求以 ErrInvalidInput 失败）
+//   - ${timestamp}   当前 Unix 秒；${timestamp_ms} 当前 Unix 毫秒
+//   - ${batch_index} 批序（Batch.BatchIndex）；${file_id} 文件标识
+//   - ${nonce}       32 位十六进制随机串
+//
+// 同一请求内各头共享同一时间戳与 nonce（便于网关按多个头校验签名）；"$${" 转义为字面 "${"。
+// 未知占位符或缺少 "}" 在构造期以 ErrInvalidInput 拒绝。
+package hdrtmpl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"llmspt/pkg/contract"
+)
+
+// tmplPart 模板片段：ref 为空时为字面文本，否则为占位符名。
+type tmplPart struct {
+	lit string
+	ref string
+}
+
+// Header 预解析的单个请求头。
+type Header struct {
+	name  string
+	parts []tmplPart
+}
+
+// Parse 预解析 extra_headers（按头名排序，忽略空头名）。
+func Parse(m map[string]string) ([]Header, error) {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		if k != "" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	out := make([]Header, 0, len(names))
+	for _, k := range names {
+		parts, err := parseTmpl(m[k])
+		if err != nil {
+			return nil, fmt.Errorf("%w: extra_headers %q: %v", contract.ErrInvalidInput, k, err)
+		}
+		out = append(out, Header{name: k, parts: parts})
+	}
+	return out, nil
+}
+
+// parseTmpl 将值切分为字面文本与占位符。
+func parseTmpl(s string) ([]tmplPart, error) {
+	var parts []tmplPart
+	var lit strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			lit.WriteString(s)
+			break
+		}
+		if i > 0 && s[i-1] == '$' {
+			lit.WriteString(s[:i-1])
+			lit.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		lit.WriteString(s[:i])
+		j := strings.IndexByte(s[i+2:], '}')
+		if j < 0 {
+			return nil, fmt.Errorf("unterminated ${")
+		}
+		ref := s[i+2 : i+2+j]
+		if !knownRef(ref) {
+			return nil, fmt.Errorf("unknown placeholder ${%s}", ref)
+		}
+		if lit.Len() > 0 {
+			parts = append(parts, tmplPart{lit: lit.String()})
+			lit.Reset()
+		}
+		parts = append(parts, tmplPart{ref: ref})
+		s = s[i+3+j:]
+	}
+	if lit.Len() > 0 || len(parts) == 0 {
+		parts = append(parts, tmplPart{lit: lit.String()})
+	}
+	return parts, nil
+}
+
+func knownRef(ref string) bool {
+	switch ref {
+	case "timestamp", "timestamp_ms", "batch_index", "file_id", "nonce":
+		return true
+	}
+	return strings.HasPrefix(ref, "env:") && len(ref) > len("env:")
+}
+
+// Apply 以本次请求上下文求值并设置全部模板头。
+func Apply(h http.Header, hs []Header, b contract.Batch) error {
+	var now time.Time
+	var nonce string
+	for _, ht := range hs {
+		var sb strings.Builder
+		for _, p := range ht.parts {
+			switch {
+			case p.ref == "":
+				sb.WriteString(p.lit)
+			case strings.HasPrefix(p.ref, "env:"):
+				v, ok := os.LookupEnv(p.ref[len("env:"):])
+				if !ok {
+					return fmt.Errorf("%w: extra_headers %q: env %s not set", contract.ErrInvalidInput, ht.name, p.ref[len("env:"):])
+				}
+				sb.WriteString(v)
+			case p.ref == "timestamp" || p.ref == "timestamp_ms":
+				if now.IsZero() {
+					now = time.Now()
+				}
+				if p.ref == "timestamp" {
+					sb.WriteString(strconv.FormatInt(now.Unix(), 10))
+				} else {
+					sb.WriteString(strconv.FormatInt(now.UnixMilli(), 10))
+				}
+			case p.ref == "batch_index":
+				sb.WriteString(strconv.FormatInt(b.BatchIndex, 10))
+			case p.ref == "file_id":
+				sb.WriteString(string(b.FileID))
+			case p.ref == "nonce":
+				if nonce == "" {
+					var buf [16]byte
+					if _, err := rand.Read(buf[:]); err != nil {
+						return fmt.Errorf("nonce: %w", err)
+					}
+					nonce = hex.EncodeToString(buf[:])
+				}
+				sb.WriteString(nonce)
+			}
+		}
+		h.Set(ht.name, sb.String())
+	}
+	return nil
+}
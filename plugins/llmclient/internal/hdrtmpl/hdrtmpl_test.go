@@ -0,0 +1,78 @@
+package hdrtmpl
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"llmspt/pkg/contract"
+)
+
+func mustParse(t *testing.T, m map[string]string) []Header {
+	t.Helper()
+	hs, err := Parse(m)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return hs
+}
+
+// TestApply 静态值原样发送；占位符逐次求值（env/批序/文件/时间戳/nonce）；"$${" 转义为字面量
+func TestApply(t *testing.T) {
+	t.Setenv("LLMSPT_TEST_SIG", "s3cr3t")
+	hs := mustParse(t, map[string]string{
+		"X-Static": "plain",
+		"X-Sig":    "v1:${env:LLMSPT_TEST_SIG}",
+		"X-Batch":  "${file_id}#${batch_index}",
+		"X-Ts":     "${timestamp}",
+		"X-Ms":     "${timestamp_ms}",
+		"X-Nonce":  "${nonce}",
+		"X-Nonce2": "${nonce}",
+		"X-Lit":    "$${env:X}",
+		"X-Empty":  "",
+		"":         "ignored",
+	})
+	if len(hs) != 9 {
+		t.Fatalf("empty header name should be skipped: %d", len(hs))
+	}
+	b := contract.Batch{FileID: "a.srt", BatchIndex: 7}
+	h := http.Header{}
+	if err := Apply(h, hs, b); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if h.Get("X-Static") != "plain" || h.Get("X-Sig") != "v1:s3cr3t" || h.Get("X-Batch") != "a.srt#7" || h.Get("X-Lit") != "${env:X}" {
+		t.Fatalf("unexpected headers %v", h)
+	}
+	if _, ok := h["X-Empty"]; !ok || h.Get("X-Empty") != "" {
+		t.Fatalf("empty value should be sent as-is: %v", h)
+	}
+	ts, ms := h.Get("X-Ts"), h.Get("X-Ms")
+	if len(ts) < 10 || strings.Trim(ts, "0123456789") != "" || !strings.HasPrefix(ms, ts) || len(ms) != len(ts)+3 {
+		t.Fatalf("timestamp=%q timestamp_ms=%q", ts, ms)
+	}
+	first := h.Get("X-Nonce")
+	if len(first) != 32 || h.Get("X-Nonce2") != first {
+		t.Fatalf("nonce should be shared within a request: %q %q", first, h.Get("X-Nonce2"))
+	}
+	if err := Apply(h, hs, b); err != nil || h.Get("X-Nonce") == first {
+		t.Fatalf("nonce should change per request: %q err=%v", h.Get("X-Nonce"), err)
+	}
+}
+
+// TestApplyUnsetEnv 求值时环境变量缺失返回 ErrInvalidInput
+func TestApplyUnsetEnv(t *testing.T) {
+	hs := mustParse(t, map[string]string{"X-Sig": "${env:LLMSPT_TEST_UNSET}"})
+	if err := Apply(http.Header{}, hs, contract.Batch{}); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+}
+
+// TestParseInvalid 未知占位符、空 env 名与缺少 "}" 在解析期拒绝
+func TestParseInvalid(t *testing.T) {
+	for _, v := range []string{"${unknown}", "${env:}", "${timestamp", "a${}b"} {
+		if _, err := Parse(map[string]string{"X": v}); !errors.Is(err, contract.ErrInvalidInput) {
+			t.Fatalf("%q: expect ErrInvalidInput, got %v", v, err)
+		}
+	}
+}
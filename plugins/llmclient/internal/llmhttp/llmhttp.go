@@ -0,0 +1,224 @@
+// Package llmhttp 汇集 HTTP 型 LLM 客户端（openai/gemini）共用的选项解析与请求行为：
+// 代理与连接池、主机白名单、区域设置、空响应策略与模型回退判定。
+package llmhttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"llmspt/pkg/contract"
+)
+
+// 连接池默认值。
+const (
+	DefaultMaxIdleConns           = 100
+	DefaultMaxIdleConnsPerHost    = 64
+	DefaultIdleConnTimeoutSeconds = 90
+)
+
+// StatusSet 将状态码列表转换为集合；空列表返回 nil。
+func StatusSet(codes []int) map[int]bool {
+	if len(codes) == 0 {
+		return nil
+	}
+	m := make(map[int]bool, len(codes))
+	for _, c := range codes {
+		m[c] = true
+	}
+	return m
+}
+
+// NewTransport 基于默认 Transport 克隆并按选项调整空闲连接池；<=0 的字段采用默认值。
+// proxy 非空时固定走该代理，否则按环境变量（HTTP_PROXY/HTTPS_PROXY/NO_PROXY）决定。
+// 默认 MaxIdleConnsPerHost=2 在高并发下会频繁建连/断连（单一上游主机），故此处放宽默认值。
+func NewTransport(maxIdle, maxIdlePerHost, idleTimeoutSeconds int, proxy *url.URL) *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = http.ProxyFromEnvironment
+	if proxy != nil {
+		tr.Proxy = http.ProxyURL(proxy)
+	}
+	if maxIdle <= 0 {
+		maxIdle = DefaultMaxIdleConns
+	}
+	if maxIdlePerHost <= 0 {
+		maxIdlePerHost = DefaultMaxIdleConnsPerHost
+	}
+	if idleTimeoutSeconds <= 0 {
+		idleTimeoutSeconds = DefaultIdleConnTimeoutSeconds
+	}
+	tr.MaxIdleConns = maxIdle
+	tr.MaxIdleConnsPerHost = maxIdlePerHost
+	tr.IdleConnTimeout = time.Duration(idleTimeoutSeconds) * time.Second
+	return tr
+}
+
+// ParseLocale 规范化区域设置（去空白）；拒绝含空白或控制字符的取值（作为请求头发送）。
+func ParseLocale(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsFunc(s, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		return "", fmt.Errorf("%w: invalid locale %q", contract.ErrInvalidInput, s)
+	}
+	return s, nil
+}
+
+// ParseProxy 解析显式代理 URL；为空返回 nil。要求带 scheme 与主机（如 http://host:port）。
+func ParseProxy(s string) (*url.URL, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%w: invalid proxy %q", contract.ErrInvalidInput, s)
+	}
+	return u, nil
+}
+
+// HostSet 规范化主机白名单（去空白、小写）；空列表返回 nil（不限制）。
+func HostSet(hosts []string) []string {
+	var out []string
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// HostAllowed 判断 URL 主机是否在白名单内：条目可为主机名或 host:port；
+// "*.example.com" 匹配其任意子域（不含 example.com 本身）。白名单为空时恒为 true。
+func HostAllowed(allowed []string, u *url.URL) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	if u == nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	hostPort := strings.ToLower(u.Host)
+	for _, a := range allowed {
+		switch {
+		case strings.HasPrefix(a, "*."):
+			if strings.HasSuffix(host, a[1:]) {
+				return true
+			}
+		case a == host || a == hostPort:
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHost 解析 rawURL 并校验主机白名单；不允许时返回 ErrInvalidInput。
+func CheckHost(rawURL string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: invalid url %q", contract.ErrInvalidInput, rawURL)
+	}
+	if !HostAllowed(allowed, u) {
+		return fmt.Errorf("%w: host %q not in allowed_hosts", contract.ErrInvalidInput, u.Host)
+	}
+	return nil
+}
+
+// RestrictRedirects 令 HTTP 客户端拒绝跳转到白名单之外的主机（保留默认 10 次上限）。
+func RestrictRedirects(hc *http.Client, allowed []string) {
+	if len(allowed) == 0 {
+		return
+	}
+	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !HostAllowed(allowed, req.URL) {
+			return fmt.Errorf("%w: redirect to host %q not in allowed_hosts", contract.ErrInvalidInput, req.URL.Host)
+		}
+		return nil
+	}
+}
+
+// 被拦截空响应的处理策略（on_empty_response）。
+const (
+	OnEmptyRetry       = "retry"
+	OnEmptyFail        = "fail"
+	OnEmptyPassthrough = "passthrough"
+)
+
+// ParseOnEmpty 规范化策略名；空值为 retry，未知值返回 ErrInvalidInput。
+func ParseOnEmpty(s string) (string, error) {
+	switch v := strings.ToLower(strings.TrimSpace(s)); v {
+	case "":
+		return OnEmptyRetry, nil
+	case OnEmptyRetry, OnEmptyFail, OnEmptyPassthrough:
+		return v, nil
+	}
+	return "", fmt.Errorf("%w: on_empty_response %q", contract.ErrInvalidInput, s)
+}
+
+// BlockedErr 按策略映射“被拦截的空响应”：
+// - retry：ErrResponseBlocked + ErrResponseInvalid（分类为 blocked；仅 retry_on 含 blocked 时重试）；
+// - fail：ErrResponseBlocked + ErrInvalidInput（不可重试）；
+// - passthrough：ErrResponseBlocked + ErrSourcePassthrough（编排层以原文透传该批）。
+func BlockedErr(policy, reason string) error {
+	switch policy {
+	case OnEmptyFail:
+		return fmt.Errorf("blocked (%s): %w: %w", reason, contract.ErrResponseBlocked, contract.ErrInvalidInput)
+	case OnEmptyPassthrough:
+		return fmt.Errorf("blocked (%s): %w: %w", reason, contract.ErrResponseBlocked, contract.ErrSourcePassthrough)
+	}
+	return fmt.Errorf("blocked (%s): %w: %w", reason, contract.ErrResponseBlocked, contract.ErrResponseInvalid)
+}
+
+// ErrModelNotFound: 上游报告模型不存在；Invoke 据此切换到下一个候选模型。
+var ErrModelNotFound = errors.New("model not found")
+
+// IsModelNotFound: 依据状态码与响应体判断是否为“模型不存在/不可用”。
+// 404 且提及 model 即视为命中；400 还需出现通用关键词或供应商补充的 extra 关键词之一。
+func IsModelNotFound(status int, msg string, extra ...string) bool {
+	if status != http.StatusNotFound && status != http.StatusBadRequest {
+		return false
+	}
+	m := strings.ToLower(msg)
+	if !strings.Contains(m, "model") {
+		return false
+	}
+	if status == http.StatusNotFound {
+		return true
+	}
+	for _, k := range append([]string{"not found", "does not exist", "unknown model", "invalid model"}, extra...) {
+		if strings.Contains(m, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// CandidateModels 返回按序去重的候选模型：主模型在前，其后为回退列表。
+func CandidateModels(primary string, fallbacks []string) []string {
+	out := []string{primary}
+	for _, m := range fallbacks {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		dup := false
+		for _, x := range out {
+			if x == m {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -0,0 +1,168 @@
+package llmhttp
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"llmspt/pkg/contract"
+)
+
+// TestHostAllowed 主机名、host:port 与通配子域匹配；空白名单不限制
+func TestHostAllowed(t *testing.T) {
+	allowed := HostSet([]string{" API.openai.com ", "", "127.0.0.1:8080", "*.example.com"})
+	if !reflect.DeepEqual(allowed, []string{"api.openai.com", "127.0.0.1:8080", "*.example.com"}) {
+		t.Fatalf("host set=%v", allowed)
+	}
+	cases := map[string]bool{
+		"https://api.openai.com/v1":   true,
+		"https://API.OPENAI.COM:443/": true,
+		"http://127.0.0.1:8080/x":     true,
+		"http://127.0.0.1:9090/x":     false,
+		"https://eu.api.example.com/": true,
+		"https://example.com/":        false,
+		"https://evil.example.net/":   false,
+	}
+	for raw, want := range cases {
+		u, _ := url.Parse(raw)
+		if got := HostAllowed(allowed, u); got != want {
+			t.Fatalf("%s: got %v want %v", raw, got, want)
+		}
+	}
+	if !HostAllowed(nil, nil) || HostAllowed(allowed, nil) {
+		t.Fatalf("nil handling")
+	}
+	if err := CheckHost("https://evil.example.net/v1", allowed); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+	if err := CheckHost("relative/path", allowed); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput for hostless url, got %v", err)
+	}
+	if err := CheckHost("relative/path", nil); err != nil {
+		t.Fatalf("empty allow list should not check: %v", err)
+	}
+}
+
+// TestRestrictRedirects 跳转至白名单外主机被拒绝；空白名单保留默认策略
+func TestRestrictRedirects(t *testing.T) {
+	hc := &http.Client{}
+	RestrictRedirects(hc, nil)
+	if hc.CheckRedirect != nil {
+		t.Fatalf("empty allow list should keep default redirect policy")
+	}
+	RestrictRedirects(hc, []string{"api.openai.com"})
+	req := func(raw string) *http.Request {
+		u, _ := url.Parse(raw)
+		return &http.Request{URL: u}
+	}
+	if err := hc.CheckRedirect(req("https://api.openai.com/v2"), nil); err != nil {
+		t.Fatalf("allowed redirect: %v", err)
+	}
+	if err := hc.CheckRedirect(req("https://evil.example.net/"), nil); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+	if err := hc.CheckRedirect(req("https://api.openai.com/"), make([]*http.Request, 10)); err == nil {
+		t.Fatalf("expect redirect limit")
+	}
+}
+
+// TestOnEmpty 策略名规范化；各策略映射到对应的错误组合
+func TestOnEmpty(t *testing.T) {
+	for in, want := range map[string]string{"": OnEmptyRetry, " Fail ": OnEmptyFail, "passthrough": OnEmptyPassthrough} {
+		if got, err := ParseOnEmpty(in); err != nil || got != want {
+			t.Fatalf("%q: got %q err=%v", in, got, err)
+		}
+	}
+	if _, err := ParseOnEmpty("skip"); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+	cases := map[string]error{OnEmptyRetry: contract.ErrResponseInvalid, OnEmptyFail: contract.ErrInvalidInput, OnEmptyPassthrough: contract.ErrSourcePassthrough}
+	for policy, want := range cases {
+		err := BlockedErr(policy, "SAFETY")
+		if !errors.Is(err, contract.ErrResponseBlocked) || !errors.Is(err, want) {
+			t.Fatalf("%s: unexpected %v", policy, err)
+		}
+	}
+}
+
+// TestParseProxyLocale 代理需带 scheme 与主机；区域设置去空白并拒绝空白/控制字符
+func TestParseProxyLocale(t *testing.T) {
+	if u, err := ParseProxy(" "); u != nil || err != nil {
+		t.Fatalf("empty proxy: %v %v", u, err)
+	}
+	if u, err := ParseProxy("http://proxy:3128"); err != nil || u.Host != "proxy:3128" {
+		t.Fatalf("proxy: %v %v", u, err)
+	}
+	for _, bad := range []string{"proxy:3128", "::bad"} {
+		if _, err := ParseProxy(bad); !errors.Is(err, contract.ErrInvalidInput) {
+			t.Fatalf("%q: expect ErrInvalidInput, got %v", bad, err)
+		}
+	}
+	if got, err := ParseLocale(" zh-CN "); err != nil || got != "zh-CN" {
+		t.Fatalf("locale=%q err=%v", got, err)
+	}
+	for _, bad := range []string{"zh CN", "pt\nBR", "a\x7f"} {
+		if _, err := ParseLocale(bad); !errors.Is(err, contract.ErrInvalidInput) {
+			t.Fatalf("%q: expect ErrInvalidInput, got %v", bad, err)
+		}
+	}
+}
+
+// TestNewTransport 未配置项采用连接池默认值；显式代理优先于环境变量
+func TestNewTransport(t *testing.T) {
+	tr := NewTransport(0, 0, 0, nil)
+	if tr.MaxIdleConns != DefaultMaxIdleConns || tr.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost || tr.IdleConnTimeout != DefaultIdleConnTimeoutSeconds*time.Second {
+		t.Fatalf("defaults: %d %d %v", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+	proxy, _ := url.Parse("http://proxy:3128")
+	tr = NewTransport(5, 3, 7, proxy)
+	if tr.MaxIdleConns != 5 || tr.MaxIdleConnsPerHost != 3 || tr.IdleConnTimeout != 7*time.Second {
+		t.Fatalf("explicit: %d %d %v", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+	got, err := tr.Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "api.openai.com"}})
+	if err != nil || got.String() != proxy.String() {
+		t.Fatalf("proxy=%v err=%v", got, err)
+	}
+}
+
+// TestIsModelNotFound 404 提及 model 即命中；400 需命中通用或补充关键词
+func TestIsModelNotFound(t *testing.T) {
+	cases := []struct {
+		status int
+		msg    string
+		extra  []string
+		want   bool
+	}{
+		{404, `{"error":"model gpt-x"}`, nil, true},
+		{404, `{"error":"route"}`, nil, false},
+		{400, `The model "x" does not exist`, nil, true},
+		{400, `model_not_found`, nil, false},
+		{400, `model_not_found`, []string{"model_not_found"}, true},
+		{400, `model x is not supported for generateContent`, nil, false},
+		{400, `model x is not supported for generateContent`, []string{"not supported"}, true},
+		{400, `max_tokens too large for model`, nil, false},
+		{500, `model not found`, nil, false},
+	}
+	for _, c := range cases {
+		if got := IsModelNotFound(c.status, c.msg, c.extra...); got != c.want {
+			t.Fatalf("%d %q %v: got %v", c.status, c.msg, c.extra, got)
+		}
+	}
+}
+
+// TestCandidateModels 主模型在前，回退去空白、去重
+func TestCandidateModels(t *testing.T) {
+	got := CandidateModels("a", []string{" b ", "", "a", "c", "b"})
+	if !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Fatalf("candidates=%v", got)
+	}
+	if s := StatusSet(nil); s != nil {
+		t.Fatalf("empty status set should be nil")
+	}
+	if s := StatusSet([]int{409, 425}); !s[409] || !s[425] || s[500] {
+		t.Fatalf("status set=%v", s)
+	}
+}
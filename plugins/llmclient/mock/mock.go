@@ -1,10 +1,14 @@
 package mock
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"strings"
+	"sync"
+	"time"
 
 	"llmspt/pkg/contract"
 )
@@ -21,11 +25,75 @@ type Options struct {
     //  - "translate_json_span": 产出 {from:int,to:int,text:string}，text 为 Target 文本拼接（每条以 \n 连接）。
     //  - "line_map": 按行映射 Target 文本，直接返回多行文本。
     ResponseMode string `json:"response_mode,omitempty"`
+	// FailOnIndices: 按 BatchIndex 确定性注入失败（与 worker 调度无关），便于测试顺序门闩与错误路径。
+	FailOnIndices []int64 `json:"fail_on_indices,omitempty"`
+	// FailMode: 注入的失败类型：
+	//  - "rate_limited"（默认）: 返回 ErrRateLimited；
+	//  - "invalid_json": 返回无法解析的响应文本（由解码器判定为无效响应）；
+	//  - "timeout": 返回超时类网络错误；
+	//  - "upstream_5xx": 返回状态 503 的上游错误（contract.UpstreamError）。
+	FailMode string `json:"fail_mode,omitempty"`
+	// FailTimes: 每个 (FileID, BatchIndex) 注入失败的次数，之后正常返回；0 表示始终失败。
+	FailTimes int `json:"fail_times,omitempty"`
+	// StreamChunkBytes: >0 时客户端额外实现 contract.LLMStreamer，将响应按该字节数切块流式返回
+	// （用于联调流式解码路径）；0 表示不支持流式。
+	StreamChunkBytes int `json:"stream_chunk_bytes,omitempty"`
+	// DelayMs: 每次调用在响应（含注入的失败）前等待的毫秒数，期间响应 ctx 取消；用于联调并发、限流背压与超时。
+	DelayMs int `json:"delay_ms,omitempty"`
+	// DelayJitterMs: 在 DelayMs 之上追加 [0, DelayJitterMs] 毫秒的抖动；取值由 (FileID, BatchIndex)
+	// 确定性派生（与 worker 调度无关），重复运行时各批延迟一致。
+	DelayJitterMs int `json:"delay_jitter_ms,omitempty"`
 }
 
+// 注入失败类型。
+const (
+	FailRateLimited = "rate_limited"
+	FailInvalidJSON = "invalid_json"
+	FailTimeout     = "timeout"
+	FailUpstream5xx = "upstream_5xx"
+)
+
 type Client struct {
 	prefix string
 	mode   string
+	delay  time.Duration
+	jitter time.Duration
+
+	failOn    map[int64]bool
+	failMode  string
+	failTimes int
+	mu        sync.Mutex
+	failed    map[failKey]int
+}
+
+type failKey struct {
+	file  contract.FileID
+	batch int64
+}
+
+// ValidateOptions 严格校验原样 JSON 选项（拒绝未知字段与类型不符，检查 fail_mode 取值）。
+func ValidateOptions(raw json.RawMessage) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	var o Options
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o); err != nil {
+		return fmt.Errorf("mock options: %w", err)
+	}
+	switch o.FailMode {
+	case "", FailRateLimited, FailInvalidJSON, FailTimeout, FailUpstream5xx:
+	default:
+		return fmt.Errorf("mock options: %w: unknown fail_mode %q", contract.ErrInvalidInput, o.FailMode)
+	}
+	if o.StreamChunkBytes < 0 {
+		return fmt.Errorf("mock options: %w: stream_chunk_bytes must be >= 0", contract.ErrInvalidInput)
+	}
+	if o.DelayMs < 0 || o.DelayJitterMs < 0 {
+		return fmt.Errorf("mock options: %w: delay_ms/delay_jitter_ms must be >= 0", contract.ErrInvalidInput)
+	}
+	return nil
 }
 
 func New(raw json.RawMessage) (contract.LLMClient, error) {
@@ -44,10 +112,151 @@ func New(raw json.RawMessage) (contract.LLMClient, error) {
         // 新默认：逐条 JSON，便于与 srtjson 解码器直接联调
         mode = "translate_json_per_record"
     }
-    return &Client{prefix: o.Prefix, mode: mode}, nil
+    c := &Client{prefix: o.Prefix, mode: mode}
+	if o.DelayMs > 0 {
+		c.delay = time.Duration(o.DelayMs) * time.Millisecond
+	}
+	if o.DelayJitterMs > 0 {
+		c.jitter = time.Duration(o.DelayJitterMs) * time.Millisecond
+	}
+	if len(o.FailOnIndices) > 0 {
+		switch o.FailMode {
+		case "":
+			o.FailMode = FailRateLimited
+		case FailRateLimited, FailInvalidJSON, FailTimeout, FailUpstream5xx:
+		default:
+			return nil, fmt.Errorf("mock: %w: unknown fail_mode %q", contract.ErrInvalidInput, o.FailMode)
+		}
+		c.failOn = make(map[int64]bool, len(o.FailOnIndices))
+		for _, i := range o.FailOnIndices {
+			c.failOn[i] = true
+		}
+		c.failMode = o.FailMode
+		c.failTimes = o.FailTimes
+		c.failed = make(map[failKey]int)
+	}
+	if o.StreamChunkBytes > 0 {
+		return &StreamClient{Client: c, chunk: o.StreamChunkBytes}, nil
+	}
+    return c, nil
+}
+
+// StreamClient: 配置 stream_chunk_bytes 时返回的流式变体；Invoke 与 Client 一致，
+// InvokeStream 将同一响应按固定字节数切块返回（注入的失败在建立流时返回）。
+type StreamClient struct {
+	*Client
+	chunk int
+}
+
+func (c *StreamClient) InvokeStream(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.RawStream, error) {
+	raw, err := c.Invoke(ctx, b, p)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkStream{ctx: ctx, text: raw.Text, size: c.chunk}, nil
+}
+
+var _ contract.LLMStreamer = (*StreamClient)(nil)
+
+// chunkStream 按固定字节数切分文本的 RawStream（最后一块携带 done=true）。
+type chunkStream struct {
+	ctx  context.Context
+	text string
+	size int
+}
+
+func (s *chunkStream) Next() (string, bool, error) {
+	if err := s.ctx.Err(); err != nil {
+		return "", false, err
+	}
+	n := s.size
+	if n >= len(s.text) {
+		n = len(s.text)
+	}
+	chunk := s.text[:n]
+	s.text = s.text[n:]
+	return chunk, s.text == "", nil
+}
+
+func (s *chunkStream) Close() error { return nil }
+
+// inject 判断本次调用是否注入失败；返回替代的 Raw/错误。
+func (c *Client) inject(b contract.Batch) (contract.Raw, bool, error) {
+	if !c.failOn[b.BatchIndex] {
+		return contract.Raw{}, false, nil
+	}
+	c.mu.Lock()
+	k := failKey{file: b.FileID, batch: b.BatchIndex}
+	n := c.failed[k]
+	if c.failTimes > 0 && n >= c.failTimes {
+		c.mu.Unlock()
+		return contract.Raw{}, false, nil
+	}
+	c.failed[k] = n + 1
+	c.mu.Unlock()
+	switch c.failMode {
+	case FailInvalidJSON:
+		return contract.Raw{Text: "invalid"}, true, nil
+	case FailTimeout:
+		return contract.Raw{}, true, timeoutError{}
+	case FailUpstream5xx:
+		return contract.Raw{}, true, upstreamError{status: 503, msg: "mock: injected upstream failure"}
+	}
+	return contract.Raw{}, true, contract.ErrRateLimited
+}
+
+// timeoutError 模拟 HTTP 客户端超时（net.Error，Timeout=true）。
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "mock: injected timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// upstreamError 模拟上游 HTTP 5xx（实现 net.Error 与 contract.UpstreamError）。
+type upstreamError struct {
+	status int
+	msg    string
+}
+
+func (e upstreamError) Error() string           { return fmt.Sprintf("mock upstream %d: %s", e.status, e.msg) }
+func (e upstreamError) Timeout() bool           { return false }
+func (e upstreamError) Temporary() bool         { return true }
+func (e upstreamError) UpstreamStatus() int     { return e.status }
+func (e upstreamError) UpstreamMessage() string { return e.msg }
+
+// wait 按 delay + jitter 等待；ctx 取消时提前返回其错误。
+func (c *Client) wait(ctx context.Context, b contract.Batch) error {
+	d := c.delay + c.jitterFor(b)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// jitterFor 由 (FileID, BatchIndex) 哈希派生 [0, jitter] 内的抖动（毫秒粒度）。
+func (c *Client) jitterFor(b contract.Batch) time.Duration {
+	if c.jitter <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s#%d", b.FileID, b.BatchIndex)
+	return time.Duration(h.Sum64()%uint64(c.jitter/time.Millisecond+1)) * time.Millisecond
 }
 
 func (c *Client) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	if err := c.wait(ctx, b); err != nil {
+		return contract.Raw{}, err
+	}
+	if raw, ok, err := c.inject(b); ok {
+		return raw, err
+	}
 	// 仅用于模块/流程调试：把 Prompt 原样或简化回显为 Raw。
 	switch c.mode {
 	case "translate_json_per_record":
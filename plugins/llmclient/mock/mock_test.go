@@ -3,7 +3,11 @@ package mock
 import (
     "context"
     "encoding/json"
+    "errors"
+    "io"
+    "net"
     "testing"
+    "time"
 
     "llmspt/pkg/contract"
 )
@@ -83,3 +87,108 @@ func TestDefaultPrompt(t *testing.T) {
         t.Fatalf("unexpected default items: %#v", arr)
     }
 }
+
+// TestFailOnIndices 按批序确定性注入失败；fail_times 次后恢复正常
+func TestFailOnIndices(t *testing.T) {
+	batch := func(idx int64) contract.Batch {
+		return contract.Batch{FileID: "f", BatchIndex: idx, TargetFrom: 0, TargetTo: 0, Records: []contract.Record{{Index: 0, Text: "a"}}}
+	}
+	c, err := New(json.RawMessage(`{"fail_on_indices":[1],"fail_times":2}`))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := c.Invoke(context.Background(), batch(0), nil); err != nil {
+		t.Fatalf("batch 0 must succeed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Invoke(context.Background(), batch(1), nil); !errors.Is(err, contract.ErrRateLimited) {
+			t.Fatalf("attempt %d: expect ErrRateLimited, got %v", i, err)
+		}
+	}
+	if _, err := c.Invoke(context.Background(), batch(1), nil); err != nil {
+		t.Fatalf("after fail_times must succeed: %v", err)
+	}
+
+	c, _ = New(json.RawMessage(`{"fail_on_indices":[0],"fail_mode":"timeout"}`))
+	var ne net.Error
+	if _, err := c.Invoke(context.Background(), batch(0), nil); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("expect timeout net.Error, got %v", err)
+	}
+	c, _ = New(json.RawMessage(`{"fail_on_indices":[0],"fail_mode":"upstream_5xx"}`))
+	var ue contract.UpstreamError
+	if _, err := c.Invoke(context.Background(), batch(0), nil); !errors.As(err, &ue) || ue.UpstreamStatus() != 503 {
+		t.Fatalf("expect upstream 503, got %v", err)
+	}
+	c, _ = New(json.RawMessage(`{"fail_on_indices":[0],"fail_mode":"invalid_json"}`))
+	if raw, err := c.Invoke(context.Background(), batch(0), nil); err != nil || json.Valid([]byte(raw.Text)) {
+		t.Fatalf("expect invalid json raw, got %q %v", raw.Text, err)
+	}
+	if _, err := New(json.RawMessage(`{"fail_on_indices":[0],"fail_mode":"boom"}`)); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+}
+
+// TestStreamChunkBytes 配置 stream_chunk_bytes 时实现 LLMStreamer，拼接各块等于 Invoke 的响应
+func TestStreamChunkBytes(t *testing.T) {
+	c, err := New(json.RawMessage(`{"stream_chunk_bytes":4}`))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	s, ok := c.(contract.LLMStreamer)
+	if !ok {
+		t.Fatalf("expect LLMStreamer")
+	}
+	batch := contract.Batch{FileID: "f", TargetFrom: 0, TargetTo: 0, Records: []contract.Record{{Index: 0, Text: "a"}}}
+	raw, _ := c.Invoke(context.Background(), batch, nil)
+	rs, err := s.InvokeStream(context.Background(), batch, nil)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer rs.Close()
+	b, err := io.ReadAll(contract.NewStreamReader(rs))
+	if err != nil || string(b) != raw.Text {
+		t.Fatalf("stream = %q (%v), want %q", b, err, raw.Text)
+	}
+	plain, _ := New(json.RawMessage(`{}`))
+	if _, ok := plain.(contract.LLMStreamer); ok {
+		t.Fatalf("streaming must be opt-in")
+	}
+}
+
+// TestNonZeroBase 记录起点非 0 时以 Records[0].Index 为基准取目标文本
+func TestNonZeroBase(t *testing.T) {
+	c, _ := New(json.RawMessage(`{"prefix":"X"}`))
+	batch := contract.Batch{FileID: "f", TargetFrom: 101, TargetTo: 102, Records: []contract.Record{{Index: 100, Text: "a"}, {Index: 101, Text: "b"}, {Index: 102, Text: "c"}}}
+	raw, err := c.Invoke(context.Background(), batch, nil)
+	if err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if want := `[{"id":101,"text":"X: b"},{"id":102,"text":"X: c"}]`; raw.Text != want {
+		t.Fatalf("raw = %s, want %s", raw.Text, want)
+	}
+}
+
+// TestDelay 延迟生效、抖动按批确定，且等待期间响应 ctx 取消
+func TestDelay(t *testing.T) {
+	if err := ValidateOptions(json.RawMessage(`{"delay_ms":-1}`)); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("negative delay: %v", err)
+	}
+	batch := contract.Batch{FileID: "f", BatchIndex: 3, TargetFrom: 0, TargetTo: 0, Records: []contract.Record{{Index: 0, Text: "a"}}}
+	c, _ := New(json.RawMessage(`{"delay_ms":20}`))
+	start := time.Now()
+	if _, err := c.Invoke(context.Background(), batch, nil); err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("delay: %v after %v", err, time.Since(start))
+	}
+	jc, _ := New(json.RawMessage(`{"delay_jitter_ms":1000}`))
+	cl := jc.(*Client)
+	d1, d2 := cl.jitterFor(batch), cl.jitterFor(batch)
+	if d1 != d2 || d1 < 0 || d1 > time.Second {
+		t.Fatalf("jitter not deterministic/bounded: %v %v", d1, d2)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	slow, _ := New(json.RawMessage(`{"delay_ms":5000}`))
+	if _, err := slow.Invoke(ctx, batch, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+}
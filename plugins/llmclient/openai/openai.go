@@ -8,27 +8,79 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
 
 	"llmspt/pkg/contract"
+	"llmspt/plugins/llmclient/internal/hdrtmpl"
+	"llmspt/plugins/llmclient/internal/llmhttp"
 )
 
 // Options: 最小必需配置。
 type Options struct {
 	BaseURL        string   `json:"base_url"`        // 例如 https://api.openai.com/v1
 	Model          string   `json:"model"`           // 为空则使用默认
+	// ModelFallbacks: 候选模型（按序）；上游报告模型不存在（404/400）时在同一次调用内依次改用。
+	ModelFallbacks []string `json:"model_fallbacks"`
 	APIKeyEnv      string   `json:"api_key_env"`     // 优先从环境变量读取
 	APIKey         string   `json:"api_key"`         // 明文传入（不推荐，按需用于测试）
     TimeoutSeconds int      `json:"timeout_seconds"` // 可选 client 级超时（秒）
 	Temperature    *float64 `json:"temperature,omitempty"`
+	// 推理模型（o 系列）：启用时省略 temperature、system 角色改为 developer、输出上限使用 max_completion_tokens。
+	// Reasoning 显式开关优先；未设置时 ReasoningEffort 非空即启用，否则按模型名前缀（o1/o3/o4…）推断。
+	Reasoning       *bool  `json:"reasoning,omitempty"`
+	ReasoningEffort string `json:"reasoning_effort"` // low|medium|high；为空不发送
+	// MaxOutputTokens: 输出 token 上限；常规模型发送 max_tokens，推理模型发送 max_completion_tokens。0 表示不发送。
+	MaxOutputTokens int `json:"max_output_tokens"`
 	// 第三方兼容（最小）：
 	EndpointPath       string            `json:"endpoint_path"`        // 覆盖默认 /chat/completions；可为完整 URL（以 http 开头）
 	DisableDefaultAuth bool              `json:"disable_default_auth"` // 关闭默认 Authorization: Bearer 注入
-	ExtraHeaders       map[string]string `json:"extra_headers"`        // 追加/覆盖请求头（用于 OpenAI 兼容服务，如 Azure/OpenRouter 等）
+	ExtraHeaders       map[string]string `json:"extra_headers"`        // 追加/覆盖请求头（用于 OpenAI 兼容服务，如 Azure/OpenRouter 等）；值支持 ${env:NAME}/${timestamp}/${batch_index} 等模板，见 plugins/llmclient/internal/hdrtmpl
+	// ExtraQuery: 追加到请求 URL 的查询参数（如 Azure 的 api-version）；与 endpoint 中已有的同名参数冲突时覆盖。
+	ExtraQuery map[string]string `json:"extra_query"`
+	// RetryableStatuses: 额外视为瞬时上游错误（网络类，可重试）的 HTTP 状态码；5xx 与 408 始终如此。
+	// 用于网关返回的非标准状态（如 409/425/499）。
+	RetryableStatuses []int `json:"retryable_statuses"`
+	// AllowedHosts: 允许连接的主机白名单（主机名或 host:port，"*.example.com" 匹配子域）；为空不限制。
+	// 请求 URL 与重定向目标的主机不在名单内时以 ErrInvalidInput 失败，防止误配的 base_url 外泄提示词。
+	AllowedHosts []string `json:"allowed_hosts"`
+	// OnEmptyResponse: 上游因安全策略拦截而返回空结果时的处理：retry（默认，分类为 blocked，retry_on 含 blocked 时重试）|
+	// fail（不重试）|passthrough（原文透传该批）。格式错误的空响应始终视为无效响应。
+	// 运行级 on_blocked 设置优先于本选项。
+	OnEmptyResponse string `json:"on_empty_response"`
+	// MaxResponseBytes: 成功响应体的读取上限（字节）；超出视为无效响应。<=0 采用默认 16MiB。
+	MaxResponseBytes int64 `json:"max_response_bytes"`
+	// 连接池调优（高并发下复用到同一上游主机的长连接）：
+	// MaxIdleConns: 全部主机的空闲连接上限（默认 100）；
+	// MaxIdleConnsPerHost: 单主机空闲连接上限（默认 64，建议 >= 流水线并发度）；
+	// IdleConnTimeoutSeconds: 空闲连接保留时长（秒，默认 90）。
+	MaxIdleConns           int `json:"max_idle_conns"`
+	MaxIdleConnsPerHost    int `json:"max_idle_conns_per_host"`
+	IdleConnTimeoutSeconds int `json:"idle_conn_timeout_seconds"`
+	// Proxy: 显式代理 URL（如 http://proxy:3128），仅作用于本 Provider；为空时按 HTTP(S)_PROXY/NO_PROXY 环境变量。
+	Proxy string `json:"proxy"`
+	// Locale: 目标区域设置（BCP 47，如 "zh-CN"）；非空时发送 Accept-Language 头（extra_headers 同名项优先），
+	// 并作为模板变量 locale 注入 Prompt（需 PromptBuilder 支持逐文件变量）。
+	Locale string `json:"locale"`
+	// Stream: 启用时客户端额外实现 contract.LLMStreamer，以 SSE（stream=true）边收边交给流式解码器。
+	Stream bool `json:"stream"`
+	// StreamIdleTimeoutSeconds: 流式响应的块间空闲超时（秒，默认 30）：等待下一段数据超过该时长即中止，
+	// 以网络类错误返回（可重试），避免停滞的连接拖到 client 级超时。仅在 Stream 启用时生效。
+	StreamIdleTimeoutSeconds int `json:"stream_idle_timeout_seconds"`
+	// JSONMode: Prompt 携带 JSON Schema 时的结构化输出方式：schema（默认，response_format=json_schema；
+	// 上游以 400 拒绝 response_format 时同一次调用内改用 json_object 重发一次）|object（始终 json_object）|
+	// off（不发送 response_format，仅依赖提示词约束）。
+	JSONMode string `json:"json_mode"`
 }
 
+// defaultMaxResponseBytes: 成功响应体的默认读取上限。
+const defaultMaxResponseBytes = 16 << 20
+
+// defaultStreamIdleTimeoutSeconds: 流式响应的默认块间空闲超时。
+const defaultStreamIdleTimeoutSeconds = 30
+
 func (o *Options) defaults() {
 	if o.BaseURL == "" {
 		o.BaseURL = "https://api.openai.com/v1"
@@ -43,6 +95,12 @@ func (o *Options) defaults() {
 	if o.EndpointPath == "" {
 		o.EndpointPath = "/chat/completions"
 	}
+	if o.MaxResponseBytes <= 0 {
+		o.MaxResponseBytes = defaultMaxResponseBytes
+	}
+	if o.StreamIdleTimeoutSeconds <= 0 {
+		o.StreamIdleTimeoutSeconds = defaultStreamIdleTimeoutSeconds
+	}
 }
 
 type Client struct {
@@ -50,12 +108,51 @@ type Client struct {
 	url         string
 	apiKey      string
 	temp        *float64
-	model       string
-	extraH      map[string]string
+	reasoning   *bool
+	effort      string
+	maxOut      int
+	models      []string // 候选模型（主模型 + 回退，按序去重）
+	extraH      []hdrtmpl.Header
 	disableAuth bool
+	retryable   map[int]bool
+	allowed     []string
+	onEmpty     string
+	maxResp     int64
+	locale      string
+	jsonMode    string
 	do          func(*http.Request) (*http.Response, error)
 }
 
+// ValidateOptions 严格校验原样 JSON 选项（拒绝未知字段与类型不符，检查枚举取值），不触发网络与环境变量读取。
+// 供配置期预检使用；New 仍按宽松解析构造客户端。
+func ValidateOptions(raw json.RawMessage) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	var opts Options
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&opts); err != nil {
+		return fmt.Errorf("openai options: %w", err)
+	}
+	if _, err := llmhttp.ParseOnEmpty(opts.OnEmptyResponse); err != nil {
+		return fmt.Errorf("openai options: %w", err)
+	}
+	if _, err := llmhttp.ParseProxy(opts.Proxy); err != nil {
+		return fmt.Errorf("openai options: %w", err)
+	}
+	if _, err := llmhttp.ParseLocale(opts.Locale); err != nil {
+		return fmt.Errorf("openai options: %w", err)
+	}
+	if _, err := hdrtmpl.Parse(opts.ExtraHeaders); err != nil {
+		return fmt.Errorf("openai options: %w", err)
+	}
+	if _, err := parseJSONMode(opts.JSONMode); err != nil {
+		return fmt.Errorf("openai options: %w", err)
+	}
+	return nil
+}
+
 // New 从原样 JSON 选项构造客户端。
 func New(raw json.RawMessage) (contract.LLMClient, error) {
 	var opts Options
@@ -76,7 +173,11 @@ func New(raw json.RawMessage) (contract.LLMClient, error) {
     if opts.TimeoutSeconds <= 0 {
         opts.TimeoutSeconds = 60
     }
-    hc := &http.Client{Timeout: time.Duration(opts.TimeoutSeconds) * time.Second}
+	proxy, err := llmhttp.ParseProxy(opts.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+    hc := &http.Client{Timeout: time.Duration(opts.TimeoutSeconds) * time.Second, Transport: llmhttp.NewTransport(opts.MaxIdleConns, opts.MaxIdleConnsPerHost, opts.IdleConnTimeoutSeconds, proxy)}
 	// 解析 URL：允许 endpoint_path 为完整 URL
 	fullURL := opts.EndpointPath
 	if !(strings.HasPrefix(fullURL, "http://") || strings.HasPrefix(fullURL, "https://")) {
@@ -85,16 +186,53 @@ func New(raw json.RawMessage) (contract.LLMClient, error) {
 		path := strings.TrimLeft(opts.EndpointPath, "/")
 		fullURL = base + "/" + path
 	}
-	return &Client{
+	if fullURL, err = withQuery(fullURL, opts.ExtraQuery); err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	onEmpty, err := llmhttp.ParseOnEmpty(opts.OnEmptyResponse)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	locale, err := llmhttp.ParseLocale(opts.Locale)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	extraH, err := hdrtmpl.Parse(opts.ExtraHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	jsonMode, err := parseJSONMode(opts.JSONMode)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	allowed := llmhttp.HostSet(opts.AllowedHosts)
+	if err := llmhttp.CheckHost(fullURL, allowed); err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	llmhttp.RestrictRedirects(hc, allowed)
+	c := &Client{
 		hc:          hc,
 		url:         fullURL,
 		apiKey:      key,
 		temp:        opts.Temperature,
-		model:       opts.Model,
-		extraH:      opts.ExtraHeaders,
+		reasoning:   opts.Reasoning,
+		effort:      strings.TrimSpace(opts.ReasoningEffort),
+		maxOut:      opts.MaxOutputTokens,
+		models:      llmhttp.CandidateModels(opts.Model, opts.ModelFallbacks),
+		extraH:      extraH,
 		disableAuth: opts.DisableDefaultAuth,
+		retryable:   llmhttp.StatusSet(opts.RetryableStatuses),
+		allowed:     allowed,
+		onEmpty:     onEmpty,
+		maxResp:     opts.MaxResponseBytes,
+		locale:      locale,
+		jsonMode:    jsonMode,
 		do:          hc.Do,
-	}, nil
+	}
+	if opts.Stream {
+		return &StreamClient{Client: c, idle: time.Duration(opts.StreamIdleTimeoutSeconds) * time.Second}, nil
+	}
+	return c, nil
 }
 
 type oaMessage struct {
@@ -105,13 +243,19 @@ type oaReq struct {
     Model       string      `json:"model"`
     Messages    []oaMessage `json:"messages"`
     Temperature *float64    `json:"temperature,omitempty"`
+    MaxTokens           int    `json:"max_tokens,omitempty"`
+    MaxCompletionTokens int    `json:"max_completion_tokens,omitempty"`
+    ReasoningEffort     string `json:"reasoning_effort,omitempty"`
     ResponseFormat *oaResponseFormat `json:"response_format,omitempty"`
+    Stream         bool              `json:"stream,omitempty"`
 }
 type oaResp struct {
 	Choices []struct {
 		Message struct {
 			Content string `json:"content"`
+			Refusal string `json:"refusal"`
 		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
 }
 
@@ -133,7 +277,7 @@ type upstreamError struct{ status int; msg string }
 
 func (e upstreamError) Error() string { return fmt.Sprintf("openai upstream %d: %s", e.status, e.msg) }
 func (e upstreamError) Timeout() bool { return e.status == http.StatusRequestTimeout }
-func (e upstreamError) Temporary() bool { return e.status/100 == 5 }
+func (e upstreamError) Temporary() bool { return e.status != http.StatusRequestTimeout }
 func (e upstreamError) UpstreamStatus() int { return e.status }
 func (e upstreamError) UpstreamMessage() string { return e.msg }
 
@@ -159,10 +303,31 @@ func extractJSONSchemaFromPrompt(p contract.Prompt) (contract.Prompt, json.RawMe
     return out, schema
 }
 
-func (c *Client) encodePrompt(p contract.Prompt, model string, rf *oaResponseFormat) ([]byte, error) {
+// isReasoningModel: 是否按推理模型（o 系列）构造请求；显式选项优先，模型名前缀推断仅作兜底。
+func (c *Client) isReasoningModel(model string) bool {
+	if c.reasoning != nil {
+		return *c.reasoning
+	}
+	if c.effort != "" {
+		return true
+	}
+	m := strings.ToLower(strings.TrimSpace(model))
+	return len(m) >= 2 && m[0] == 'o' && m[1] >= '1' && m[1] <= '9'
+}
+
+func (c *Client) encodePrompt(p contract.Prompt, model string, rf *oaResponseFormat, stream bool) ([]byte, error) {
     var req oaReq
     req.Model = model
-    req.Temperature = c.temp
+    req.Stream = stream
+    reasoning := c.isReasoningModel(model)
+    if reasoning {
+        // 推理模型拒绝 temperature；输出上限改用 max_completion_tokens
+        req.MaxCompletionTokens = c.maxOut
+        req.ReasoningEffort = c.effort
+    } else {
+        req.Temperature = c.temp
+        req.MaxTokens = c.maxOut
+    }
     switch v := p.(type) {
     case contract.TextPrompt:
         req.Messages = []oaMessage{{Role: "user", Content: string(v)}}
@@ -173,7 +338,11 @@ func (c *Client) encodePrompt(p contract.Prompt, model string, rf *oaResponseFor
             if strings.EqualFold(strings.TrimSpace(m.Role), "json_schema") {
                 continue
             }
-            req.Messages = append(req.Messages, oaMessage{Role: m.Role, Content: m.Content})
+            role := m.Role
+            if reasoning && strings.EqualFold(strings.TrimSpace(role), "system") {
+                role = "developer"
+            }
+            req.Messages = append(req.Messages, oaMessage{Role: role, Content: m.Content})
         }
     default:
         return nil, contract.ErrInvalidInput
@@ -184,73 +353,185 @@ func (c *Client) encodePrompt(p contract.Prompt, model string, rf *oaResponseFor
     return json.Marshal(&req)
 }
 
-// Invoke: 单次调用，同步返回。
-func (c *Client) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
-	// 提取模型：允许通过 Prompt 的 Meta/类型携带，但按“最小必需”不做读取；统一使用默认/Options 中的模型。
-	// 为了避免在 Client 中保存模型，我们从 encode 中编码。
-	// 这里读取默认模型作为占位：
-	model := c.model
-	if model == "" {
-		model = "gpt-4.1-mini"
+// Locale 实现 contract.LocaleHinter。
+func (c *Client) Locale() string { return c.locale }
+
+// withQuery 将 extra 合并进 u 的查询串（同名覆盖）；extra 为空时原样返回。
+func withQuery(u string, extra map[string]string) (string, error) {
+	if len(extra) == 0 {
+		return u, nil
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid endpoint %q", contract.ErrInvalidInput, u)
+	}
+	q := pu.Query()
+	for k, v := range extra {
+		q.Set(k, v)
+	}
+	pu.RawQuery = q.Encode()
+	return pu.String(), nil
+}
+
+// 结构化输出方式（json_mode）。
+const (
+	jsonModeSchema = "schema"
+	jsonModeObject = "object"
+	jsonModeOff    = "off"
+)
+
+// parseJSONMode 规范化 json_mode；空值为 schema，未知值返回 ErrInvalidInput。
+func parseJSONMode(s string) (string, error) {
+	switch v := strings.ToLower(strings.TrimSpace(s)); v {
+	case "":
+		return jsonModeSchema, nil
+	case jsonModeSchema, jsonModeObject, jsonModeOff:
+		return v, nil
+	}
+	return "", fmt.Errorf("%w: json_mode %q", contract.ErrInvalidInput, s)
+}
+
+// responseFormat 按 json_mode 为携带 schema 的 Prompt 选择 response_format；无 schema 或 off 时返回 nil。
+func (c *Client) responseFormat(schema json.RawMessage) *oaResponseFormat {
+	if len(schema) == 0 {
+		return nil
+	}
+	switch c.jsonMode {
+	case jsonModeOff:
+		return nil
+	case jsonModeObject:
+		return &oaResponseFormat{Type: "json_object"}
 	}
+	return &oaResponseFormat{Type: "json_schema", JSONSchema: &oaJSONSchema{Name: "srtjson", Schema: schema, Strict: true}}
+}
+
+// isFormatUnsupported: 400 且响应体提及 response_format/json_schema，视为上游不支持该结构化输出方式。
+func isFormatUnsupported(status int, msg string) bool {
+	if status != http.StatusBadRequest {
+		return false
+	}
+	m := strings.ToLower(msg)
+	return strings.Contains(m, "response_format") || strings.Contains(m, "json_schema")
+}
+
+// Invoke: 单次调用，同步返回；主模型不存在时按 ModelFallbacks 顺序回退。
+func (c *Client) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
     // 从 Prompt 中抽取 JSON Schema；若存在则启用 OpenAI 的 json_schema 响应格式
     pp, schema := extractJSONSchemaFromPrompt(p)
-    var rf *oaResponseFormat
-    if len(schema) > 0 {
-        rf = &oaResponseFormat{Type: "json_schema", JSONSchema: &oaJSONSchema{Name: "srtjson", Schema: schema, Strict: true}}
-    }
-    body, err := c.encodePrompt(pp, model, rf)
+    rf := c.responseFormat(schema)
+	var raw contract.Raw
+	var err error
+	for i, model := range c.models {
+		raw, err = c.invokeModel(ctx, b, pp, model, rf)
+		if err == nil {
+			raw.Model = model
+			return raw, nil
+		}
+		if !errors.Is(err, llmhttp.ErrModelNotFound) || i+1 == len(c.models) {
+			break
+		}
+	}
+	return contract.Raw{}, err
+}
+
+// invokeModel: 使用指定模型发起一次请求。
+func (c *Client) invokeModel(ctx context.Context, b contract.Batch, pp contract.Prompt, model string, rf *oaResponseFormat) (contract.Raw, error) {
+	resp, err := c.send(ctx, b, pp, model, rf, false)
+	if err != nil {
+		return contract.Raw{}, err
+	}
+	defer resp.Body.Close()
+	// 有界读取：超出上限视为无效响应，避免异常上游耗尽内存
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.maxResp+1))
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return contract.Raw{}, ctx.Err()
+		}
+		return contract.Raw{}, err
+	}
+	if int64(len(data)) > c.maxResp {
+		return contract.Raw{}, fmt.Errorf("response body exceeds %d bytes: %w", c.maxResp, contract.ErrResponseInvalid)
+	}
+	var or oaResp
+	if err := json.Unmarshal(data, &or); err != nil {
+		return contract.Raw{}, fmt.Errorf("decode: %w", contract.ErrResponseInvalid)
+	}
+	if len(or.Choices) == 0 {
+		return contract.Raw{}, contract.ErrResponseInvalid
+	}
+	if ch := or.Choices[0]; ch.Message.Content == "" {
+		// 区分拦截（内容过滤/拒答）与格式错误
+		switch {
+		case ch.FinishReason == "content_filter":
+			return contract.Raw{}, llmhttp.BlockedErr(c.onEmpty, ch.FinishReason)
+		case ch.Message.Refusal != "":
+			return contract.Raw{}, llmhttp.BlockedErr(c.onEmpty, "refusal")
+		}
+		return contract.Raw{}, contract.ErrResponseInvalid
+	}
+	return contract.Raw{Text: or.Choices[0].Message.Content}, nil
+}
+
+// send: 编码并发出请求；仅 2xx 返回响应（调用方负责关闭 Body），其余状态按分类映射为错误。
+func (c *Client) send(ctx context.Context, b contract.Batch, pp contract.Prompt, model string, rf *oaResponseFormat, stream bool) (*http.Response, error) {
+	body, err := c.encodePrompt(pp, model, rf, stream)
 	if err != nil {
 		if errors.Is(err, contract.ErrInvalidInput) {
-			return contract.Raw{}, err
+			return nil, err
 		}
-		return contract.Raw{}, fmt.Errorf("encode: %v: %w", err, contract.ErrInvalidInput)
+		return nil, fmt.Errorf("encode: %v: %w", err, contract.ErrInvalidInput)
 	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
 	if err != nil {
-		return contract.Raw{}, fmt.Errorf("new request: %v: %w", err, contract.ErrInvalidInput)
+		return nil, fmt.Errorf("new request: %v: %w", err, contract.ErrInvalidInput)
 	}
 	if !c.disableAuth {
 		req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	for k, v := range c.extraH {
-		if k == "" {
-			continue
-		}
-		req.Header.Set(k, v)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	} else {
+		req.Header.Set("Accept", "application/json")
+	}
+	if c.locale != "" {
+		req.Header.Set("Accept-Language", c.locale)
+	}
+	if err := hdrtmpl.Apply(req.Header, c.extraH, b); err != nil {
+		return nil, err
 	}
 
+	if !llmhttp.HostAllowed(c.allowed, req.URL) {
+		return nil, fmt.Errorf("%w: host %q not in allowed_hosts", contract.ErrInvalidInput, req.URL.Host)
+	}
 	resp, err := c.do(req)
 	if err != nil {
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			return contract.Raw{}, ctx.Err()
+			return nil, ctx.Err()
 		}
-		return contract.Raw{}, err
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusTooManyRequests {
-		return contract.Raw{}, contract.ErrRateLimited
-	}
-	if resp.StatusCode/100 != 2 {
-		// 读取少量响应体辅助定位
-		slurp, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
-		msg := strings.TrimSpace(string(slurp))
-		// 分类：4xx 视为输入/配置无效；5xx 视为网络/上游问题；408 特判为网络
-		if resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode/100 == 5 {
-			return contract.Raw{}, upstreamError{status: resp.StatusCode, msg: msg}
-		}
-		return contract.Raw{}, fmt.Errorf("openai upstream %d: %w", resp.StatusCode, contract.ErrInvalidInput)
+		return nil, contract.ErrRateLimited
 	}
-	var or oaResp
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&or); err != nil {
-		return contract.Raw{}, fmt.Errorf("decode: %w", contract.ErrResponseInvalid)
+	// 读取少量响应体辅助定位
+	slurp, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	msg := strings.TrimSpace(string(slurp))
+	// 分类：4xx 视为输入/配置无效；5xx 视为网络/上游问题；408 特判为网络
+	if resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode/100 == 5 || c.retryable[resp.StatusCode] {
+		return nil, upstreamError{status: resp.StatusCode, msg: msg}
 	}
-	if len(or.Choices) == 0 || or.Choices[0].Message.Content == "" {
-		return contract.Raw{}, contract.ErrResponseInvalid
+	// json_schema 被拒绝：降级为 json_object 重发一次（仅此一次；降级后的失败按常规分类）
+	if rf != nil && rf.Type == "json_schema" && isFormatUnsupported(resp.StatusCode, msg) {
+		return c.send(ctx, b, pp, model, &oaResponseFormat{Type: "json_object"}, stream)
 	}
-	return contract.Raw{Text: or.Choices[0].Message.Content}, nil
+	if llmhttp.IsModelNotFound(resp.StatusCode, msg, "model_not_found") {
+		return nil, fmt.Errorf("openai upstream %d: model %q: %w: %w", resp.StatusCode, model, llmhttp.ErrModelNotFound, contract.ErrInvalidInput)
+	}
+	return nil, fmt.Errorf("openai upstream %d: %w", resp.StatusCode, contract.ErrInvalidInput)
 }
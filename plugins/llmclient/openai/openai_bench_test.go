@@ -0,0 +1,65 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llmspt/pkg/contract"
+)
+
+// BenchmarkInvokeConcurrent 基准测试 32 路并发 Invoke 下的连接复用。
+// 每个 op 为一波 32 个并发请求（近似流水线 worker 池按波次领取批次）；
+// 波次间连接全部归还空闲池：per_host=2 近似 net/http 默认上限，超出部分被关闭、下一波重建；
+// default 为本客户端默认连接池。conns/op 为每波新建的 TCP 连接数，越少越好。
+func BenchmarkInvokeConcurrent(b *testing.B) {
+	const workers = 32
+	cases := []struct {
+		name  string
+		extra map[string]any
+	}{
+		{"per_host=2", map[string]any{"max_idle_conns_per_host": 2}},
+		{"default", nil},
+	}
+	for _, tc := range cases {
+		b.Run(fmt.Sprintf("%s/workers=%d", tc.name, workers), func(b *testing.B) {
+			var conns atomic.Int64
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// 模拟上游处理时延，使 32 路请求真正同时在途
+				time.Sleep(time.Millisecond)
+				_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+			}))
+			srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+				if s == http.StateNew {
+					conns.Add(1)
+				}
+			}
+			srv.Start()
+			defer srv.Close()
+			c := newTestClient(b, srv.URL, tc.extra)
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for w := 0; w < workers; w++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if _, err := c.Invoke(ctx, contract.Batch{}, contract.TextPrompt("hi")); err != nil {
+							b.Error(err)
+						}
+					}()
+				}
+				wg.Wait()
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+		})
+	}
+}
@@ -0,0 +1,478 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"llmspt/pkg/contract"
+	"llmspt/plugins/llmclient/internal/llmhttp"
+)
+
+// newTestClient 指向本地测试服务的客户端。
+func newTestClient(t testing.TB, url string, extra map[string]any) contract.LLMClient {
+	t.Helper()
+	opts := map[string]any{"base_url": url, "api_key": "k"}
+	for k, v := range extra {
+		opts[k] = v
+	}
+	raw, _ := json.Marshal(opts)
+	c, err := New(raw)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	return c
+}
+
+// TestInvokeModelFallback 主模型 404 时改用下一候选，并回报实际模型
+func TestInvokeModelFallback(t *testing.T) {
+	var tried []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req oaReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		tried = append(tried, req.Model)
+		if req.Model != "m3" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error":{"message":"The model %s does not exist","code":"model_not_found"}}`, req.Model)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+	}))
+	defer srv.Close()
+	c := newTestClient(t, srv.URL, map[string]any{"model": "m1", "model_fallbacks": []string{"m2", "m1", "m3"}})
+	raw, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	if err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if raw.Text != "ok" || raw.Model != "m3" || fmt.Sprint(tried) != "[m1 m2 m3]" {
+		t.Fatalf("unexpected: raw=%+v tried=%v", raw, tried)
+	}
+}
+
+// TestExtraQuery extra_query 追加到请求 URL，与 endpoint 中已有的参数并存、同名覆盖
+func TestExtraQuery(t *testing.T) {
+	var q url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q = r.URL.Query()
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+	}))
+	defer srv.Close()
+	c := newTestClient(t, srv.URL, map[string]any{"endpoint_path": "/chat/completions?a=1&v=old", "extra_query": map[string]string{"v": "new", "b": "2"}})
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if q.Get("a") != "1" || q.Get("v") != "new" || q.Get("b") != "2" {
+		t.Fatalf("query = %v", q)
+	}
+}
+
+// TestInvokeNoFallbackOnOtherErrors 非模型类 4xx 不触发回退
+func TestInvokeNoFallbackOnOtherErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, `{"error":{"message":"bad messages"}}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	c := newTestClient(t, srv.URL, map[string]any{"model_fallbacks": []string{"m2"}})
+	_, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	if !errors.Is(err, contract.ErrInvalidInput) || errors.Is(err, llmhttp.ErrModelNotFound) || calls != 1 {
+		t.Fatalf("unexpected: err=%v calls=%d", err, calls)
+	}
+}
+
+// TestEncodeReasoningShape 推理模型：省略 temperature，system→developer，使用 max_completion_tokens
+func TestEncodeReasoningShape(t *testing.T) {
+	prompt := contract.ChatPrompt{{Role: "system", Content: "sys"}, {Role: "user", Content: "u"}}
+	cases := []struct {
+		name      string
+		opts      map[string]any
+		model     string
+		reasoning bool
+	}{
+		{"effort", map[string]any{"reasoning_effort": "low"}, "gpt-4.1", true},
+		{"explicit-off", map[string]any{"reasoning": false}, "o3-mini", false},
+		{"prefix", map[string]any{}, "o1", true},
+		{"regular", map[string]any{}, "gpt-4o", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts["temperature"] = 0.2
+			tc.opts["max_output_tokens"] = 512
+			c := newTestClient(t, "http://127.0.0.1:1", tc.opts).(*Client)
+			body, err := c.encodePrompt(prompt, tc.model, nil, false)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			var got map[string]any
+			_ = json.Unmarshal(body, &got)
+			role := got["messages"].([]any)[0].(map[string]any)["role"]
+			_, hasTemp := got["temperature"]
+			_, hasMCT := got["max_completion_tokens"]
+			_, hasMT := got["max_tokens"]
+			if tc.reasoning {
+				if hasTemp || hasMT || !hasMCT || role != "developer" {
+					t.Fatalf("unexpected reasoning request: %s", body)
+				}
+			} else if !hasTemp || !hasMT || hasMCT || role != "system" {
+				t.Fatalf("unexpected regular request: %s", body)
+			}
+		})
+	}
+}
+
+// TestInvokeRetryableStatuses 529 映射为网络类上游错误；配置的非 5xx 状态同样如此，其余 4xx 仍为无效输入
+func TestInvokeRetryableStatuses(t *testing.T) {
+	status := 529
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", status)
+	}))
+	defer srv.Close()
+	c := newTestClient(t, srv.URL, map[string]any{"retryable_statuses": []int{529, 499}})
+	for _, st := range []int{529, 499} {
+		status = st
+		_, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+		var ne net.Error
+		var ue contract.UpstreamError
+		if !errors.As(err, &ne) || !ne.Temporary() || !errors.As(err, &ue) || ue.UpstreamStatus() != st {
+			t.Fatalf("status %d: expect temporary upstream error, got %v", st, err)
+		}
+	}
+	status = 409
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("status 409: expect ErrInvalidInput, got %v", err)
+	}
+}
+
+// TestAllowedHosts 白名单外的 base_url 构造失败；重定向至白名单外主机同样被拒绝
+func TestAllowedHosts(t *testing.T) {
+	raw, _ := json.Marshal(map[string]any{"base_url": "https://evil.example.net/v1", "api_key": "k", "allowed_hosts": []string{"api.openai.com"}})
+	if _, err := New(raw); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+	raw, _ = json.Marshal(map[string]any{"base_url": "https://eu.api.example.com/v1", "api_key": "k", "allowed_hosts": []string{"*.example.com"}})
+	if _, err := New(raw); err != nil {
+		t.Fatalf("wildcard host: %v", err)
+	}
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("redirect target must not be contacted")
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 127.0.0.1 在白名单内，localhost 不在
+		http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1)+"/x", http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+	c := newTestClient(t, srv.URL, map[string]any{"allowed_hosts": []string{"127.0.0.1"}})
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput on redirect, got %v", err)
+	}
+}
+
+// TestOnEmptyResponse 内容过滤按策略映射；无拦截原因的空响应始终为无效响应
+func TestOnEmptyResponse(t *testing.T) {
+	body := `{"choices":[{"message":{"content":""},"finish_reason":"content_filter"}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+	cases := []struct {
+		policy string
+		want   []error
+	}{
+		{"", []error{contract.ErrResponseBlocked, contract.ErrResponseInvalid}},
+		{"fail", []error{contract.ErrResponseBlocked, contract.ErrInvalidInput}},
+		{"passthrough", []error{contract.ErrResponseBlocked, contract.ErrSourcePassthrough}},
+	}
+	for _, tc := range cases {
+		c := newTestClient(t, srv.URL, map[string]any{"on_empty_response": tc.policy})
+		_, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+		for _, w := range tc.want {
+			if !errors.Is(err, w) {
+				t.Fatalf("policy %q: expect %v, got %v", tc.policy, w, err)
+			}
+		}
+	}
+	body = `{"choices":[{"message":{"content":""},"finish_reason":"stop"}]}`
+	c := newTestClient(t, srv.URL, map[string]any{"on_empty_response": "passthrough"})
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); !errors.Is(err, contract.ErrResponseInvalid) || errors.Is(err, contract.ErrSourcePassthrough) {
+		t.Fatalf("malformed empty: got %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"api_key": "k", "on_empty_response": "ignore"})
+	if _, err := New(raw); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("unknown policy: got %v", err)
+	}
+}
+
+// TestMaxResponseBytes 超出上限的成功响应体视为无效响应
+func TestMaxResponseBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"choices":[{"message":{"content":%q}}]}`, strings.Repeat("x", 1024))
+	}))
+	defer srv.Close()
+	c := newTestClient(t, srv.URL, map[string]any{"max_response_bytes": 512})
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("expect ErrResponseInvalid, got %v", err)
+	}
+	c = newTestClient(t, srv.URL, nil)
+	if raw, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); err != nil || len(raw.Text) != 1024 {
+		t.Fatalf("default cap: raw=%d err=%v", len(raw.Text), err)
+	}
+}
+
+// TestProxyOption 配置 proxy 时请求经由该代理发往上游；非法 URL 在构造期拒绝
+func TestProxyOption(t *testing.T) {
+	var via string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		via = r.URL.Host
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+	}))
+	defer proxy.Close()
+	c := newTestClient(t, "http://upstream.invalid", map[string]any{"proxy": proxy.URL})
+	raw, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	if err != nil || raw.Text != "ok" || via != "upstream.invalid" {
+		t.Fatalf("unexpected: raw=%+v err=%v via=%q", raw, err, via)
+	}
+	bad := json.RawMessage(`{"api_key":"k","proxy":"proxy:3128"}`)
+	if _, err := New(bad); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+	if err := ValidateOptions(bad); err == nil {
+		t.Fatalf("validate should reject invalid proxy")
+	}
+}
+
+// TestLocale 配置 locale 时发送 Accept-Language 并经 LocaleHinter 暴露；extra_headers 同名项优先；非法取值被拒绝
+func TestLocale(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Accept-Language")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+	}))
+	defer srv.Close()
+	c := newTestClient(t, srv.URL, map[string]any{"locale": " zh-CN "})
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); err != nil || got != "zh-CN" {
+		t.Fatalf("header=%q err=%v", got, err)
+	}
+	if lh, ok := c.(contract.LocaleHinter); !ok || lh.Locale() != "zh-CN" {
+		t.Fatalf("locale hint not exposed")
+	}
+	c = newTestClient(t, srv.URL, map[string]any{"locale": "zh-CN", "extra_headers": map[string]string{"Accept-Language": "ja"}})
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, contract.TextPrompt("hi")); err != nil || got != "ja" {
+		t.Fatalf("extra header should win: %q err=%v", got, err)
+	}
+	bad := json.RawMessage(`{"api_key":"k","locale":"zh CN"}`)
+	if _, err := New(bad); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+	if err := ValidateOptions(bad); err == nil {
+		t.Fatalf("validate should reject invalid locale")
+	}
+}
+
+// TestExtraHeaderTemplates extra_headers 经 hdrtmpl 逐请求求值后随请求发送；非法模板在构造期与预检中拒绝
+func TestExtraHeaderTemplates(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+	}))
+	defer srv.Close()
+	t.Setenv("LLMSPT_TEST_SIG", "s3cr3t")
+	c := newTestClient(t, srv.URL, map[string]any{"extra_headers": map[string]string{
+		"X-Static": "plain",
+		"X-Sig":    "${env:LLMSPT_TEST_SIG}",
+		"X-Batch":  "${file_id}#${batch_index}",
+	}})
+	b := contract.Batch{FileID: "a.srt", BatchIndex: 7}
+	if _, err := c.Invoke(context.Background(), b, contract.TextPrompt("hi")); err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if got.Get("X-Static") != "plain" || got.Get("X-Sig") != "s3cr3t" || got.Get("X-Batch") != "a.srt#7" {
+		t.Fatalf("unexpected headers %v", got)
+	}
+
+	c = newTestClient(t, srv.URL, map[string]any{"extra_headers": map[string]string{"X-Sig": "${env:LLMSPT_TEST_UNSET}"}})
+	if _, err := c.Invoke(context.Background(), b, contract.TextPrompt("hi")); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput for unset env, got %v", err)
+	}
+	bad := json.RawMessage(`{"api_key":"k","extra_headers":{"X":"${unknown}"}}`)
+	if _, err := New(bad); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+	if err := ValidateOptions(bad); err == nil {
+		t.Fatalf("validate should reject invalid template")
+	}
+}
+
+// TestStreamIdleTimeout stream=true 时按 SSE 逐块返回 delta；上游停滞超过空闲窗口即以可重试的网络类超时中止
+func TestStreamIdleTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req oaReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream || r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("expect stream request, got stream=%v accept=%q", req.Stream, r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"he\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		if r.URL.Query().Get("stall") != "" {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"llo\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv.URL, map[string]any{"stream": true})
+	sc, ok := c.(*StreamClient)
+	if !ok {
+		t.Fatalf("stream=true should return *StreamClient, got %T", c)
+	}
+	sc.idle = 50 * time.Millisecond
+	rs, err := sc.InvokeStream(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	if err != nil {
+		t.Fatalf("invoke stream: %v", err)
+	}
+	var sb strings.Builder
+	for {
+		chunk, done, err := rs.Next()
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		sb.WriteString(chunk)
+		if done {
+			break
+		}
+	}
+	rs.Close()
+	if sb.String() != "hello" {
+		t.Fatalf("text=%q", sb.String())
+	}
+	if m := rs.(contract.ModelReporter).Model(); m != "gpt-4.1-mini" {
+		t.Fatalf("stream model=%q", m)
+	}
+
+	sc = newTestClient(t, srv.URL+"/?stall=1", map[string]any{"stream": true, "endpoint_path": srv.URL + "/?stall=1"}).(*StreamClient)
+	sc.idle = 50 * time.Millisecond
+	rs, err = sc.InvokeStream(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	if err != nil {
+		t.Fatalf("invoke stream: %v", err)
+	}
+	defer rs.Close()
+	if chunk, _, err := rs.Next(); err != nil || chunk != "he" {
+		t.Fatalf("first chunk=%q err=%v", chunk, err)
+	}
+	t0 := time.Now()
+	_, _, err = rs.Next()
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("expect idle timeout net.Error, got %v", err)
+	}
+	if d := time.Since(t0); d > 2*time.Second {
+		t.Fatalf("idle timeout took %s", d)
+	}
+}
+
+// TestStreamLimits 首字节前的等待不计入块间空闲超时；max_response_bytes 限制整个流式响应体而非单行
+func TestStreamLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(150 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 20; i++ {
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"0123456789\"}}]}\n\n")
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+	drain := func(rs contract.RawStream) (string, error) {
+		defer rs.Close()
+		var sb strings.Builder
+		for {
+			chunk, done, err := rs.Next()
+			if err != nil {
+				return sb.String(), err
+			}
+			sb.WriteString(chunk)
+			if done {
+				return sb.String(), nil
+			}
+		}
+	}
+
+	sc := newTestClient(t, srv.URL, map[string]any{"stream": true, "endpoint_path": srv.URL + "/?slow=1"}).(*StreamClient)
+	sc.idle = 50 * time.Millisecond
+	rs, err := sc.InvokeStream(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	if err != nil {
+		t.Fatalf("slow first byte should not trip the idle timeout: %v", err)
+	}
+	if text, err := drain(rs); err != nil || len(text) != 200 {
+		t.Fatalf("text=%d err=%v", len(text), err)
+	}
+
+	sc = newTestClient(t, srv.URL, map[string]any{"stream": true, "max_response_bytes": 512}).(*StreamClient)
+	rs, err = sc.InvokeStream(context.Background(), contract.Batch{}, contract.TextPrompt("hi"))
+	if err != nil {
+		t.Fatalf("invoke stream: %v", err)
+	}
+	if _, err := drain(rs); !errors.Is(err, contract.ErrResponseInvalid) {
+		t.Fatalf("expect ErrResponseInvalid for oversized stream, got %v", err)
+	}
+}
+
+// TestJSONModeDowngrade json_schema 被 400 拒绝时改用 json_object 重发一次；object/off 按配置直接发送
+func TestJSONModeDowngrade(t *testing.T) {
+	var sent []string
+	reject := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req oaReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		typ := "none"
+		if req.ResponseFormat != nil {
+			typ = req.ResponseFormat.Type
+		}
+		sent = append(sent, typ)
+		if typ == "json_schema" || (reject && typ == "json_object") {
+			http.Error(w, `{"error":{"message":"response_format type is not supported by this model"}}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"[]"}}]}`)
+	}))
+	defer srv.Close()
+	prompt := contract.ChatPrompt{{Role: "user", Content: "u"}, {Role: "json_schema", Content: `{"type":"array"}`}}
+
+	reject = false
+	c := newTestClient(t, srv.URL, nil)
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, prompt); err != nil || fmt.Sprint(sent) != "[json_schema json_object]" {
+		t.Fatalf("downgrade: err=%v sent=%v", err, sent)
+	}
+
+	// 降级后仍被拒绝：不再重试，按输入无效返回
+	reject, sent = true, nil
+	if _, err := c.Invoke(context.Background(), contract.Batch{}, prompt); !errors.Is(err, contract.ErrInvalidInput) || len(sent) != 2 {
+		t.Fatalf("rejected twice: err=%v sent=%v", err, sent)
+	}
+
+	reject = false
+	for mode, want := range map[string]string{"object": "[json_object]", "off": "[none]"} {
+		sent = nil
+		c := newTestClient(t, srv.URL, map[string]any{"json_mode": mode})
+		if _, err := c.Invoke(context.Background(), contract.Batch{}, prompt); err != nil || fmt.Sprint(sent) != want {
+			t.Fatalf("%s: err=%v sent=%v", mode, err, sent)
+		}
+	}
+	if err := ValidateOptions(json.RawMessage(`{"json_mode":"strict"}`)); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("unknown json_mode: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"llmspt/pkg/contract"
+	"llmspt/plugins/llmclient/internal/llmhttp"
+)
+
+// StreamClient: 配置 stream=true 时返回的流式变体；Invoke 与 Client 一致，
+// InvokeStream 以 SSE 逐块返回 delta 文本，块间超过 idle 未收到数据即中止。
+// 建立阶段（至响应头）不受 idle 约束，仅受整体 timeout_seconds 限制。
+type StreamClient struct {
+	*Client
+	idle time.Duration
+}
+
+var _ contract.LLMStreamer = (*StreamClient)(nil)
+
+// InvokeStream: 建立流式请求；主模型不存在时按 ModelFallbacks 顺序回退（仅在建立阶段）。
+func (c *StreamClient) InvokeStream(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.RawStream, error) {
+	pp, schema := extractJSONSchemaFromPrompt(p)
+	rf := c.responseFormat(schema)
+	var err error
+	for i, model := range c.models {
+		// 空闲计时器取消的是派生 ctx：据此区分空闲超时与调用方取消
+		sctx, cancel := context.WithCancel(ctx)
+		resp, serr := c.send(sctx, b, pp, model, rf, true)
+		if serr == nil {
+			s := &sseStream{ctx: ctx, cancel: cancel, idle: c.idle, onEmpty: c.onEmpty, max: c.maxResp, body: resp.Body, model: model}
+			// 计时器仅在 idleReader 阻塞读取期间运行
+			s.timer = time.AfterFunc(c.idle, s.expire)
+			s.timer.Stop()
+			s.sc = bufio.NewScanner(&idleReader{r: resp.Body, s: s})
+			s.sc.Buffer(make([]byte, 0, 64<<10), int(c.maxResp))
+			return s, nil
+		}
+		cancel()
+		err = serr
+		if !errors.Is(err, llmhttp.ErrModelNotFound) || i+1 == len(c.models) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// sseStream: 解析 "data: {...}" 事件中的 choices[0].delta.content；"data: [DONE]" 结束。
+type sseStream struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	idle    time.Duration
+	timer   *time.Timer
+	idled   atomic.Bool
+	body    io.ReadCloser
+	sc      *bufio.Scanner
+	onEmpty string
+	max     int64
+	read    int64 // 已读取的响应体字节数（与非流式路径一致，整体不超过 max）
+	model   string
+	got     bool
+	done    bool
+}
+
+type oaChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+			Refusal string `json:"refusal"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+var _ contract.ModelReporter = (*sseStream)(nil)
+
+// Model: 建立流时实际使用的模型（含回退后的模型）。
+func (s *sseStream) Model() string { return s.model }
+
+func (s *sseStream) expire() {
+	s.idled.Store(true)
+	s.cancel()
+}
+
+// wrap: 空闲超时触发的取消映射为 idleTimeoutError；调用方取消返回 ctx.Err()。
+func (s *sseStream) wrap(err error) error {
+	if s.idled.Load() {
+		return idleTimeoutError{d: s.idle}
+	}
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	return err
+}
+
+func (s *sseStream) Next() (string, bool, error) {
+	if s.done {
+		return "", true, nil
+	}
+	for s.sc.Scan() {
+		line := s.sc.Text()
+		if !strings.HasPrefix(line, "data:") {
+			// 空行（事件分隔）、注释（": keep-alive"）与其他字段忽略
+			continue
+		}
+		data := strings.TrimSpace(line[len("data:"):])
+		if data == "[DONE]" {
+			return s.finish()
+		}
+		var ch oaChunk
+		if err := json.Unmarshal([]byte(data), &ch); err != nil {
+			return "", false, fmt.Errorf("decode stream event: %w", contract.ErrResponseInvalid)
+		}
+		if len(ch.Choices) == 0 {
+			continue
+		}
+		c0 := ch.Choices[0]
+		if !s.got {
+			switch {
+			case c0.FinishReason == "content_filter":
+				return "", false, llmhttp.BlockedErr(s.onEmpty, c0.FinishReason)
+			case c0.Delta.Refusal != "":
+				return "", false, llmhttp.BlockedErr(s.onEmpty, "refusal")
+			}
+		}
+		if c0.Delta.Content != "" {
+			s.got = true
+			return c0.Delta.Content, false, nil
+		}
+	}
+	if err := s.sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) || errors.Is(err, errStreamTooLarge) {
+			return "", false, fmt.Errorf("response body exceeds %d bytes: %w", s.max, contract.ErrResponseInvalid)
+		}
+		return "", false, s.wrap(err)
+	}
+	// 未收到 [DONE] 即断开：响应不完整
+	return "", false, fmt.Errorf("stream ended without [DONE]: %w", contract.ErrResponseInvalid)
+}
+
+func (s *sseStream) finish() (string, bool, error) {
+	s.done = true
+	if !s.got {
+		return "", false, contract.ErrResponseInvalid
+	}
+	return "", true, nil
+}
+
+func (s *sseStream) Close() error {
+	s.timer.Stop()
+	s.cancel()
+	return s.body.Close()
+}
+
+// errStreamTooLarge: 流式响应体累计超过 max_response_bytes。
+var errStreamTooLarge = errors.New("stream body too large")
+
+// idleReader: 仅在阻塞读取期间计时；每次 Read 前重置为 idle，返回后停止（消费方处理耗时不计入）。
+// 同时累计读取字节数，超过上限即以 errStreamTooLarge 中止。
+type idleReader struct {
+	r io.Reader
+	s *sseStream
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	// 至多多读 1 字节以判定越限；越限部分不交给扫描器（否则已缓冲的 [DONE] 仍会被解析）
+	rem := r.s.max - r.s.read
+	if rem < 0 {
+		return 0, errStreamTooLarge
+	}
+	if int64(len(p)) > rem+1 {
+		p = p[:rem+1]
+	}
+	r.s.timer.Reset(r.s.idle)
+	n, err := r.r.Read(p)
+	r.s.timer.Stop()
+	if r.s.read += int64(n); r.s.read > r.s.max {
+		return n - int(r.s.read-r.s.max), errStreamTooLarge
+	}
+	return n, err
+}
+
+// idleTimeoutError: 流式响应块间空闲超时（net.Error，Timeout=true），分类为网络错误，可重试。
+type idleTimeoutError struct{ d time.Duration }
+
+func (e idleTimeoutError) Error() string   { return fmt.Sprintf("openai stream idle for %s", e.d) }
+func (e idleTimeoutError) Timeout() bool   { return true }
+func (e idleTimeoutError) Temporary() bool { return true }
@@ -0,0 +1,69 @@
+package passthrough
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"llmspt/pkg/contract"
+)
+
+// Options 无可配置项；保留结构以便严格拒绝未知字段。
+type Options struct{}
+
+// Client 不调用任何上游：将目标区间的源文本原样编码为 [{"id","text"}] 返回，
+// 与 srtjson 等 JSON 解码器兼容。用于仅做拆分/装配/格式转换（如 SRT→VTT）的任务，无网络与费用。
+type Client struct{}
+
+// ValidateOptions 严格校验原样 JSON 选项（拒绝未知字段与类型不符）。
+func ValidateOptions(raw json.RawMessage) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	var o Options
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o); err != nil {
+		return fmt.Errorf("passthrough options: %w", err)
+	}
+	return nil
+}
+
+// New 构造 Client。
+func New(raw json.RawMessage) (contract.LLMClient, error) {
+	if err := ValidateOptions(raw); err != nil {
+		return nil, err
+	}
+	return &Client{}, nil
+}
+
+// Invoke 实现 contract.LLMClient：忽略 Prompt，按 id 升序回显目标记录的源文本。
+// Raw.SourceEcho 置位，解码器据此跳过“原文回显”检测。
+func (c *Client) Invoke(ctx context.Context, b contract.Batch, p contract.Prompt) (contract.Raw, error) {
+	select {
+	case <-ctx.Done():
+		return contract.Raw{}, ctx.Err()
+	default:
+	}
+	type item struct {
+		ID   int64  `json:"id"`
+		Text string `json:"text"`
+	}
+	items := make([]item, 0, int(b.TargetTo-b.TargetFrom+1))
+	for _, r := range b.Records {
+		if r.Index >= b.TargetFrom && r.Index <= b.TargetTo {
+			items = append(items, item{ID: int64(r.Index), Text: r.Text})
+		}
+	}
+	if len(items) == 0 {
+		return contract.Raw{}, fmt.Errorf("passthrough: %w: empty target window", contract.ErrInvalidInput)
+	}
+	bts, err := json.Marshal(items)
+	if err != nil {
+		return contract.Raw{}, err
+	}
+	return contract.Raw{Text: string(bts), SourceEcho: true}, nil
+}
+
+var _ contract.LLMClient = (*Client)(nil)
@@ -0,0 +1,50 @@
+package passthrough
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"llmspt/pkg/contract"
+	"llmspt/plugins/decoder/srtjson"
+)
+
+// TestInvokeRoundTrip 回显目标源文本，且可被 srtjson 解码（不触发原文回显检测）
+func TestInvokeRoundTrip(t *testing.T) {
+	c, err := New(nil)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	b := contract.Batch{FileID: "f", Records: []contract.Record{
+		{Index: 0, Text: "ctx"},
+		{Index: 1, Text: "Hello", Meta: contract.Meta{"seq": "2", "time": "00:00:01,000 --> 00:00:02,000"}},
+		{Index: 2, Text: "World", Meta: contract.Meta{"seq": "3", "time": "00:00:03,000 --> 00:00:04,000"}},
+	}, TargetFrom: 1, TargetTo: 2}
+	raw, err := c.Invoke(context.Background(), b, nil)
+	if err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if raw.Text != `[{"id":1,"text":"Hello"},{"id":2,"text":"World"}]` || !raw.SourceEcho {
+		t.Fatalf("raw = %+v", raw)
+	}
+	dec, _ := srtjson.New(nil)
+	idxMeta := contract.IndexMetaMap{}
+	for _, r := range b.Records {
+		m := contract.Meta{contract.MetaSrcText: r.Text}
+		for k, v := range r.Meta {
+			m[k] = v
+		}
+		idxMeta[r.Index] = m
+	}
+	spans, err := dec.(contract.DecoderWithMeta).DecodeWithMeta(context.Background(), contract.Target{FileID: "f", From: 1, To: 2}, raw, idxMeta)
+	if err != nil || len(spans) != 2 || spans[0].Output != "2\n00:00:01,000 --> 00:00:02,000\nHello\n\n" {
+		t.Fatalf("decode: %v %#v", err, spans)
+	}
+	raw.SourceEcho = false
+	if _, err := dec.(contract.DecoderWithMeta).DecodeWithMeta(context.Background(), contract.Target{FileID: "f", From: 1, To: 2}, raw, idxMeta); err == nil {
+		t.Fatal("未标记 SourceEcho 的回显应被拒绝")
+	}
+	if err := ValidateOptions(json.RawMessage(`{"x":1}`)); err == nil {
+		t.Fatal("未知选项应被拒绝")
+	}
+}
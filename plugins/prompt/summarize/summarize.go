@@ -0,0 +1,210 @@
+package summarize
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/template"
+
+	"llmspt/pkg/contract"
+)
+
+// Options 为“窗口化逐条摘要（批处理 + Chat）” PromptBuilder 的最小配置。
+// 输出协议与 translate 的 JSON 格式一致（[{"id":..,"text":..}]），可直接搭配 srtjson 等 JSON 解码器。
+type Options struct {
+	// MaxWords: 每条摘要的词数上限；<=0 采用默认（12）。在模板中以 {{.MaxWords}} 引用。
+	MaxWords int `json:"max_words"`
+	// InlineSystemTemplate / SystemTemplatePath: system 提示模板（二选一，内联优先，均为空时使用内置默认模板）。
+	InlineSystemTemplate string `json:"inline_system_template"`
+	SystemTemplatePath   string `json:"system_template_path"`
+	// Vars: 模板变量（可选），以 {{.Vars.key}} 引用（如 target_lang 指定摘要语言）；引用未提供的键构造期快速失败。
+	Vars map[string]string `json:"vars"`
+}
+
+const defaultMaxWords = 12
+
+// Builder: 以 Batch 构造摘要 ChatPrompt（system+user+json_schema）。
+// 运行期不做 I/O；模板在构造期解析。
+type Builder struct {
+	sysT *template.Template
+	data tplData
+}
+
+// tplData: system 模板渲染的数据对象。
+type tplData struct {
+	MaxWords int
+	Vars     map[string]string
+}
+
+// New 创建逐条摘要 PromptBuilder（批处理 + Chat）。
+func New(opts *Options) (*Builder, error) {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxWords <= 0 {
+		o.MaxWords = defaultMaxWords
+	}
+
+	// 加载 system 模板（构造期 I/O）。
+	src := defaultSystemTemplate
+	if o.InlineSystemTemplate != "" {
+		src = o.InlineSystemTemplate
+	} else if o.SystemTemplatePath != "" {
+		b, err := os.ReadFile(o.SystemTemplatePath)
+		if err != nil {
+			return nil, fmt.Errorf("system template read: %w", err)
+		}
+		src = string(b)
+	}
+	tpl, err := template.New("system").Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("system template parse: %w", err)
+	}
+	// 复制变量并试渲染一次：模板与变量不匹配时在构造期快速失败。
+	data := tplData{MaxWords: o.MaxWords, Vars: make(map[string]string, len(o.Vars))}
+	for k, v := range o.Vars {
+		data.Vars[k] = v
+	}
+	if err := tpl.Execute(io.Discard, data); err != nil {
+		return nil, fmt.Errorf("system template render: %w", err)
+	}
+	return &Builder{sysT: tpl, data: data}, nil
+}
+
+// Build: 基于 Batch 构造 ChatPrompt。
+func (b *Builder) Build(ctx context.Context, batch contract.Batch) (contract.Prompt, error) {
+	return b.BuildWithVars(ctx, batch, nil)
+}
+
+// BuildWithVars: 以逐文件变量覆盖构造期 Vars 后渲染 system，其余同 Build。
+func (b *Builder) BuildWithVars(ctx context.Context, batch contract.Batch, vars map[string]string) (contract.Prompt, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	if len(batch.Records) == 0 {
+		return nil, fmt.Errorf("prompt: %w: empty batch records", contract.ErrInvalidInput)
+	}
+	var target []contract.Record
+	for _, r := range batch.Records {
+		if r.Index >= batch.TargetFrom && r.Index <= batch.TargetTo {
+			target = append(target, r)
+		}
+	}
+	if len(target) == 0 {
+		return nil, fmt.Errorf("prompt: %w: empty target window", contract.ErrInvalidInput)
+	}
+
+	data := b.data
+	if len(vars) > 0 {
+		data = tplData{MaxWords: b.data.MaxWords, Vars: make(map[string]string, len(b.data.Vars)+len(vars))}
+		for k, v := range b.data.Vars {
+			data.Vars[k] = v
+		}
+		for k, v := range vars {
+			data.Vars[k] = v
+		}
+	}
+	var sys bytes.Buffer
+	if err := b.sysT.Execute(&sys, data); err != nil {
+		return nil, fmt.Errorf("system render: %w: %w", contract.ErrInvalidInput, err)
+	}
+
+	// user 组装：整个窗口（含上下文）+ 规则 + targets
+	var uw bytes.Buffer
+	uw.Grow(1024)
+	uw.WriteString("### Context Window\n\n<window>\n")
+	writeSegs(&uw, batch.Records)
+	uw.WriteString("</window>\n")
+	writeRules(&uw, b.data.MaxWords)
+	uw.WriteString("targets: [")
+	for i, r := range target {
+		if i > 0 {
+			uw.WriteByte(',')
+		}
+		uw.WriteString(strconv.FormatInt(int64(r.Index), 10))
+	}
+	uw.WriteString("]\n")
+
+	return contract.ChatPrompt{
+		{Role: "system", Content: sys.String()},
+		{Role: "user", Content: uw.String()},
+		{Role: "json_schema", Content: jsonSchema},
+	}, nil
+}
+
+// EstimateOverheadTokens: 估算与批无关的固定提示词开销（system+固定 user 规则+schema）。
+func (b *Builder) EstimateOverheadTokens(estimate contract.TokenEstimator) int {
+	if estimate == nil {
+		return 0
+	}
+	var sys bytes.Buffer
+	_ = b.sysT.Execute(&sys, b.data)
+	var userFixed bytes.Buffer
+	userFixed.WriteString("### Context Window\n\n<window>\n")
+	userFixed.WriteString("</window>\n")
+	writeRules(&userFixed, b.data.MaxWords)
+	userFixed.WriteString("targets: []\n")
+	return estimate(sys.String()) + estimate(userFixed.String()) + estimate(jsonSchema)
+}
+
+// 静态接口断言
+var _ contract.PromptBuilder = (*Builder)(nil)
+var _ contract.ContextualPromptBuilder = (*Builder)(nil)
+
+// writeRules: 写出 IMPORTANT OUTPUT RULES（Build 与开销估算共用）。
+func writeRules(w *bytes.Buffer, maxWords int) {
+	w.WriteString("\nIMPORTANT OUTPUT RULES:\n")
+	w.WriteString("1) Summarize ONLY segs whose ids are listed in 'targets' below; use other segs as context only.\n")
+	w.WriteString("2) Each summary has at most ")
+	w.WriteString(strconv.Itoa(maxWords))
+	w.WriteString(" words.\n")
+	w.WriteString("3) Return ONLY strict JSON (no markdown, no code fences, no commentary).\n")
+	w.WriteString("4) Schema: an array of objects [{\"id\": number, \"text\": string}] in ascending id order, one per target id.\n")
+}
+
+// writeSegs: 输出 <seg id="...">\n<text>\n</seg> 形式。
+func writeSegs(w *bytes.Buffer, recs []contract.Record) {
+	for _, r := range recs {
+		w.WriteString("<seg id=\"")
+		w.WriteString(strconv.FormatInt(int64(r.Index), 10))
+		w.WriteString("\">\n")
+		w.WriteString(r.Text)
+		w.WriteString("\n</seg>\n")
+	}
+}
+
+// 默认 system 模板。
+const defaultSystemTemplate = `
+## Role Definition
+You condense subtitle lines. For every target seg, write a short summary of what is said, keeping names and key facts and dropping filler.
+
+## I/O Protocol (Very Important)
+- The user message contains a <window> with multiple <seg id="..."> blocks; read the whole window for context.
+- Only summarize the seg ids listed in "targets". Do NOT summarize or rewrite other segs.
+- Each summary must not exceed {{.MaxWords}} words.
+- Output ONLY strict JSON according to the schema; do not include markdown/code fences.
+{{- with index .Vars "target_lang"}}
+
+## Output Language
+Write every summary in {{.}}.
+{{- end}}
+
+<example>
+user: <window>
+<seg id="7">Where were you last night?</seg>
+<seg id="8">I told you already, I was at my sister's place until late, we were watching the game.</seg>
+</window>
+targets: [8]
+
+assistant: [{"id": 8, "text": "Was at sister's watching the game."}]
+</example>
+`
+
+// 摘要批处理的 JSON Schema：数组，每项含 {id:int, text:string}
+const jsonSchema = `{"type":"array","items":{"type":"object","additionalProperties":false,"properties":{"id":{"type":"integer"},"text":{"type":"string"}},"required":["id","text"]}}`
@@ -0,0 +1,62 @@
+package summarize
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"llmspt/pkg/contract"
+)
+
+// TestBuildDefault 测试默认模板：窗口含上下文、targets 仅目标、附带词数上限与 schema
+func TestBuildDefault(t *testing.T) {
+	b, err := New(&Options{MaxWords: 5})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	batch := contract.Batch{Records: []contract.Record{
+		{Index: 0, Text: "L"},
+		{Index: 1, Text: "T"},
+		{Index: 2, Text: "R"},
+	}, TargetFrom: 1, TargetTo: 1}
+	p, err := b.Build(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	cp, ok := p.(contract.ChatPrompt)
+	if !ok || len(cp) != 3 || cp[2].Role != "json_schema" {
+		t.Fatalf("unexpected prompt %#v", p)
+	}
+	if !strings.Contains(cp[0].Content, "must not exceed 5 words") {
+		t.Fatalf("max words missing in system: %s", cp[0].Content)
+	}
+	u := cp[1].Content
+	if !strings.Contains(u, "<seg id=\"0\">") || !strings.Contains(u, "<seg id=\"2\">") || !strings.Contains(u, "targets: [1]") {
+		t.Fatalf("window/targets not built correctly: %s", u)
+	}
+	if !strings.Contains(u, "at most 5 words") {
+		t.Fatalf("rules missing max words: %s", u)
+	}
+}
+
+// TestTemplateOverride 测试模板覆盖与逐文件变量
+func TestTemplateOverride(t *testing.T) {
+	b, err := New(&Options{InlineSystemTemplate: "sum {{.MaxWords}} in {{.Vars.target_lang}}", Vars: map[string]string{"target_lang": "en"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	batch := contract.Batch{Records: []contract.Record{{Index: 3, Text: "x"}}, TargetFrom: 3, TargetTo: 3}
+	p, err := b.BuildWithVars(context.Background(), batch, map[string]string{"target_lang": "zh"})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if got := p.(contract.ChatPrompt)[0].Content; got != "sum 12 in zh" {
+		t.Fatalf("system = %q", got)
+	}
+	if _, err := New(&Options{InlineSystemTemplate: "{{.Vars.missing}}"}); err == nil {
+		t.Fatal("引用未提供的变量应在构造期失败")
+	}
+	if b.EstimateOverheadTokens(func(s string) int { return len(s) }) == 0 {
+		t.Fatal("expect positive estimate")
+	}
+}
@@ -3,9 +3,12 @@ package translate
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
 	"text/template"
 
 	"llmspt/pkg/contract"
@@ -19,13 +22,66 @@ type Options struct {
 	// 术语对照表（可选）：与 inline/system 一样的二选一优先级；若提供则自动拼接进 system 提示尾部。
 	InlineGlossary string `json:"inline_glossary"`
 	GlossaryPath   string `json:"glossary_path"`
+	// Vars: 模板变量（可选），以 {{.Vars.key}} 形式在 system 模板中引用（如目标语言、语气、领域）。
+	// 构造期以该变量集试渲染一次模板；引用未提供的键将快速失败（逐文件变量除外，见 FileVars）。
+	Vars map[string]string `json:"vars"`
+	// FileVars: 运行期由编排层逐文件提供的变量名（target_lang、locale 恒视为逐文件变量；自定义 file_lang.var 时在此列出）。
+	// 构造期试渲染以空串占位；渲染时仍未提供则以 ErrInvalidInput 失败并指明缺失的键。
+	FileVars []string `json:"file_vars"`
+	// Examples / ExamplesPath: few-shot 示例（二选一，内联优先）；文件为 JSON 数组 [{"source":..,"target":..}]。
+	// 以 user/assistant 消息对的形式插入在 system 之后、真实批之前，沿用与批处理一致的协议格式。
+	Examples     []Example `json:"examples"`
+	ExamplesPath string    `json:"examples_path"`
+	// MaxExamples / MaxExampleBytes: 示例条数与总字节上限；<=0 采用默认（3 条 / 4KiB），超限构造失败。
+	MaxExamples     int `json:"max_examples"`
+	MaxExampleBytes int `json:"max_example_bytes"`
+	// OutputFormat: 要求模型返回的格式（影响 IMPORTANT OUTPUT RULES 与示例应答）：
+	//  - "json"（默认）: [{"id":..,"text":..}] 数组，并附带 json_schema 消息供客户端启用 JSON 模式；
+	//    须搭配 JSON 解码器（srtjson/spanjson/textjson）。
+	//  - "lines": 每个目标一行纯文本、按 id 升序，不附带 json_schema；须搭配 linemap 解码器。
+	// 本选项不切换解码器，二者需在配置中同时调整。
+	OutputFormat string `json:"output_format"`
+	// IncludeMetaKeys: 以属性形式渲染到 <seg> 上的 Record.Meta 键（按列出顺序，如 ["speaker"] →
+	// <seg id="21" speaker="JOHN">）；记录缺失或值为空的键省略。键须为合法属性名且不得为 "id"。
+	IncludeMetaKeys []string `json:"include_meta_keys"`
 }
 
+// 输出格式。
+const (
+	FormatJSON  = "json"
+	FormatLines = "lines"
+)
+
+// Example: 单条 few-shot 示例（原文 → 译文）。
+type Example struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+const (
+	defaultMaxExamples     = 3
+	defaultMaxExampleBytes = 4 << 10
+)
+
 // Builder: 以 Batch 构造 ChatPrompt（system+user），仅支持批处理语义。
 // 运行期不做 I/O；模板在构造期解析。
 type Builder struct {
 	sysT *template.Template
+	data tplData
+	// est: 估算开销用的渲染数据（逐文件变量以空串占位）
+	est  tplData
 	glos string
+	// few-shot 示例消息（构造期渲染，按 user/assistant 成对排列）
+	shots []contract.Message
+	// lines: 逐行纯文本输出（OutputFormat=lines）
+	lines bool
+	// metaKeys: 渲染为 <seg> 属性的 Meta 键
+	metaKeys []string
+}
+
+// tplData: system 模板渲染的数据对象。
+type tplData struct {
+	Vars map[string]string
 }
 
 // New 创建字幕翻译 PromptBuilder（批处理 + Chat）。
@@ -35,6 +91,15 @@ func New(opts *Options) (*Builder, error) {
 		o = *opts
 	}
 
+	var lines bool
+	switch o.OutputFormat {
+	case "", FormatJSON:
+	case FormatLines:
+		lines = true
+	default:
+		return nil, fmt.Errorf("prompt: %w: unknown output_format %q", contract.ErrInvalidInput, o.OutputFormat)
+	}
+
 	// 加载 system 模板（构造期 I/O）。
 	src := defaultSystemTemplate
 	if o.InlineSystemTemplate != "" {
@@ -46,10 +111,25 @@ func New(opts *Options) (*Builder, error) {
 		}
 		src = string(b)
 	}
-	tpl, err := template.New("system").Parse(src)
+	tpl, err := template.New("system").Option("missingkey=error").Parse(src)
 	if err != nil {
 		return nil, fmt.Errorf("system template parse: %w", err)
 	}
+	// 复制变量并试渲染一次：模板与变量不匹配时在构造期快速失败；逐文件变量以空串占位。
+	data := tplData{Vars: make(map[string]string, len(o.Vars))}
+	for k, v := range o.Vars {
+		data.Vars[k] = v
+	}
+	est := tplData{Vars: make(map[string]string, len(o.Vars)+len(o.FileVars)+len(builtinFileVars))}
+	for _, k := range append(append([]string(nil), builtinFileVars...), o.FileVars...) {
+		est.Vars[k] = ""
+	}
+	for k, v := range o.Vars {
+		est.Vars[k] = v
+	}
+	if err := tpl.Execute(io.Discard, est); err != nil {
+		return nil, fmt.Errorf("system template render: %w", err)
+	}
 	// 加载 glossary（构造期 I/O）。
 	var glos string
 	if o.InlineGlossary != "" {
@@ -62,11 +142,126 @@ func New(opts *Options) (*Builder, error) {
 		glos = string(b)
 	}
 
-	return &Builder{sysT: tpl, glos: glos}, nil
+	// 加载 few-shot 示例（构造期 I/O）。
+	exs := o.Examples
+	if len(exs) == 0 && o.ExamplesPath != "" {
+		b, err := os.ReadFile(o.ExamplesPath)
+		if err != nil {
+			return nil, fmt.Errorf("examples read: %w", err)
+		}
+		if err := json.Unmarshal(b, &exs); err != nil {
+			return nil, fmt.Errorf("examples parse: %w", err)
+		}
+	}
+	shots, err := renderExamples(exs, o.MaxExamples, o.MaxExampleBytes, lines)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range o.IncludeMetaKeys {
+		if !validAttrName(k) {
+			return nil, fmt.Errorf("prompt: %w: invalid include_meta_keys entry %q", contract.ErrInvalidInput, k)
+		}
+	}
+
+	return &Builder{sysT: tpl, data: data, est: est, glos: glos, shots: shots, lines: lines,
+		metaKeys: append([]string(nil), o.IncludeMetaKeys...)}, nil
+}
+
+// builtinFileVars: 编排层逐文件注入的内置变量名（文件语言/多目标语言与 locale）。
+var builtinFileVars = []string{"target_lang", "locale"}
+
+// validAttrName: 属性名须以字母或下划线开头，其余为字母/数字/下划线/连字符/点；"id" 保留。
+func validAttrName(k string) bool {
+	if k == "" || k == "id" {
+		return false
+	}
+	for i, c := range k {
+		switch {
+		case c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+		case i > 0 && (c == '-' || c == '.' || ('0' <= c && c <= '9')):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// renderExamples: 校验条数/字节上限，并将示例渲染为与批处理一致的 user/assistant 消息对。
+// lines 为 true 时应答为单行纯文本，否则为 JSON 数组。
+func renderExamples(exs []Example, maxN, maxBytes int, lines bool) ([]contract.Message, error) {
+	if len(exs) == 0 {
+		return nil, nil
+	}
+	if maxN <= 0 {
+		maxN = defaultMaxExamples
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxExampleBytes
+	}
+	if len(exs) > maxN {
+		return nil, fmt.Errorf("prompt: %w: %d examples exceed max_examples(%d)", contract.ErrInvalidInput, len(exs), maxN)
+	}
+	total := 0
+	for i, ex := range exs {
+		if ex.Source == "" || ex.Target == "" {
+			return nil, fmt.Errorf("prompt: %w: example %d has empty source or target", contract.ErrInvalidInput, i)
+		}
+		total += len(ex.Source) + len(ex.Target)
+	}
+	if total > maxBytes {
+		return nil, fmt.Errorf("prompt: %w: examples total %d bytes exceed max_example_bytes(%d)", contract.ErrInvalidInput, total, maxBytes)
+	}
+	out := make([]contract.Message, 0, 2*len(exs))
+	for i, ex := range exs {
+		rec := contract.Record{Index: contract.Index(i), Text: ex.Source}
+		var uw bytes.Buffer
+		uw.WriteString("### Context Window\n\n<window>\n")
+		writeSegs(&uw, []contract.Record{rec}, nil)
+		uw.WriteString("</window>\n")
+		uw.WriteString("targets: [")
+		uw.WriteString(strconv.Itoa(i))
+		uw.WriteString("]\n")
+		var ans string
+		if lines {
+			ans = strings.Join(strings.Fields(ex.Target), " ")
+		} else {
+			b, err := json.Marshal([]struct {
+				ID   int    `json:"id"`
+				Text string `json:"text"`
+			}{{ID: i, Text: ex.Target}})
+			if err != nil {
+				return nil, fmt.Errorf("examples render: %w", err)
+			}
+			ans = string(b)
+		}
+		out = append(out,
+			contract.Message{Role: "user", Content: uw.String()},
+			contract.Message{Role: "assistant", Content: ans},
+		)
+	}
+	return out, nil
+}
+
+// EstimateExampleTokens: 估算 few-shot 示例的 token 开销（已包含在 EstimateOverheadTokens 中）。
+// 供编排层校验示例占总预算的比例。
+func (b *Builder) EstimateExampleTokens(estimate contract.TokenEstimator) int {
+	if estimate == nil {
+		return 0
+	}
+	tokens := 0
+	for _, m := range b.shots {
+		tokens += estimate(m.Content)
+	}
+	return tokens
 }
 
 // Build: 基于 Batch 构造 ChatPrompt（system+user）。
 func (b *Builder) Build(ctx context.Context, batch contract.Batch) (contract.Prompt, error) {
+	return b.BuildWithVars(ctx, batch, nil)
+}
+
+// BuildWithVars: 以逐文件变量覆盖构造期 Vars 后渲染 system（如 target_lang），其余同 Build。
+func (b *Builder) BuildWithVars(ctx context.Context, batch contract.Batch, vars map[string]string) (contract.Prompt, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
@@ -82,8 +277,18 @@ func (b *Builder) Build(ctx context.Context, batch contract.Batch) (contract.Pro
 
 	// system 渲染
 	var sysBuf bytes.Buffer
-	if err := b.sysT.Execute(&sysBuf, nil); err != nil {
-		return nil, fmt.Errorf("system render: %w", contract.ErrInvalidInput)
+	data := b.data
+	if len(vars) > 0 {
+		data = tplData{Vars: make(map[string]string, len(b.data.Vars)+len(vars))}
+		for k, v := range b.data.Vars {
+			data.Vars[k] = v
+		}
+		for k, v := range vars {
+			data.Vars[k] = v
+		}
+	}
+	if err := b.sysT.Execute(&sysBuf, data); err != nil {
+		return nil, fmt.Errorf("system render: %w: %w", contract.ErrInvalidInput, err)
 	}
 	sys := sysBuf.String()
 	if b.glos != "" {
@@ -104,15 +309,12 @@ func (b *Builder) Build(ctx context.Context, batch contract.Batch) (contract.Pro
 	var uw bytes.Buffer
 	uw.Grow(1024)
 	uw.WriteString("### Context Window\n\n<window>\n")
-	writeSegs(&uw, left)
-	writeSegs(&uw, target)
-	writeSegs(&uw, right)
+	writeSegs(&uw, left, b.metaKeys)
+	writeSegs(&uw, target, b.metaKeys)
+	writeSegs(&uw, right, b.metaKeys)
 	uw.WriteString("</window>\n")
 
-	uw.WriteString("\nIMPORTANT OUTPUT RULES:\n")
-	uw.WriteString("1) Translate ONLY segs whose ids are listed in 'targets' below.\n")
-	uw.WriteString("2) Return ONLY strict JSON (no markdown, no code fences, no commentary).\n")
-	uw.WriteString("3) Schema: an array of objects [{\"id\": number, \"text\": string}] in ascending id order.\n")
+	writeRules(&uw, b.lines)
 	uw.WriteString("targets: [")
 	for i, r := range target {
 		if i > 0 {
@@ -122,23 +324,26 @@ func (b *Builder) Build(ctx context.Context, batch contract.Batch) (contract.Pro
 	}
 	uw.WriteString("]\n")
 
-	// 输出 ChatPrompt：system + user + json_schema（用于 Gemini/OpenAI JSON 模式）
-	return contract.ChatPrompt([]contract.Message{
-		{Role: "system", Content: sys},
-		{Role: "user", Content: uw.String()},
-		{Role: "json_schema", Content: defaultTranslateJSONSchema},
-	}), nil
+	// 输出 ChatPrompt：system + [few-shot 示例] + user + json_schema（用于 Gemini/OpenAI JSON 模式；lines 格式省略）
+	msgs := make([]contract.Message, 0, 3+len(b.shots))
+	msgs = append(msgs, contract.Message{Role: "system", Content: sys})
+	msgs = append(msgs, b.shots...)
+	msgs = append(msgs, contract.Message{Role: "user", Content: uw.String()})
+	if !b.lines {
+		msgs = append(msgs, contract.Message{Role: "json_schema", Content: defaultTranslateJSONSchema})
+	}
+	return contract.ChatPrompt(msgs), nil
 }
 
-// EstimateOverheadTokens: 估算与批无关的固定提示词开销（system+glossary+固定 user 规则+schema）。
-// 注：不包含窗口与 targets 的动态部分；返回近似 token 数。
+// EstimateOverheadTokens: 估算与批无关的固定提示词开销（system+glossary+固定 user 规则+schema+few-shot 示例）。
+// 注：不包含窗口（含 <seg> 的 Meta 属性）与 targets 的动态部分；返回近似 token 数。
 func (b *Builder) EstimateOverheadTokens(estimate contract.TokenEstimator) int {
 	if estimate == nil {
 		return 0
 	}
 	// system 渲染（与 Build 保持一致）
 	var sysBuf bytes.Buffer
-	_ = b.sysT.Execute(&sysBuf, nil)
+	_ = b.sysT.Execute(&sysBuf, b.est)
 	sys := sysBuf.String()
 	if b.glos != "" {
 		var sb bytes.Buffer
@@ -157,10 +362,7 @@ func (b *Builder) EstimateOverheadTokens(estimate contract.TokenEstimator) int {
 	var userFixed bytes.Buffer
 	userFixed.WriteString("### Context Window\n\n<window>\n")
 	userFixed.WriteString("</window>\n")
-	userFixed.WriteString("\nIMPORTANT OUTPUT RULES:\n")
-	userFixed.WriteString("1) Translate ONLY segs whose ids are listed in 'targets' below.\n")
-	userFixed.WriteString("2) Return ONLY strict JSON (no markdown, no code fences, no commentary).\n")
-	userFixed.WriteString("3) Schema: an array of objects [{\"id\": number, \"text\": string}] in ascending id order.\n")
+	writeRules(&userFixed, b.lines)
 	userFixed.WriteString("targets: []\n")
 
 	// schema 固定部分（若 LLM 客户端忽略该消息，不会造成问题；预扣略有冗余但安全）
@@ -170,12 +372,16 @@ func (b *Builder) EstimateOverheadTokens(estimate contract.TokenEstimator) int {
 	tokens := 0
 	tokens += estimate(sys)
 	tokens += estimate(userFixed.String())
-	tokens += estimate(schema)
+	if !b.lines {
+		tokens += estimate(schema)
+	}
+	tokens += b.EstimateExampleTokens(estimate)
 	return tokens
 }
 
 // 静态接口断言
 var _ contract.PromptBuilder = (*Builder)(nil)
+var _ contract.ContextualPromptBuilder = (*Builder)(nil)
 
 // splitView: 按 Batch.TargetFrom/To 切分为 left/target/right（只读）。
 func splitView(b contract.Batch) (left, target, right []contract.Record) {
@@ -196,17 +402,43 @@ func splitView(b contract.Batch) (left, target, right []contract.Record) {
 	return
 }
 
-// writeSegs: 输出 <seg id="...">\n<text>\n</seg> 形式。
-func writeSegs(w *bytes.Buffer, recs []contract.Record) {
+// writeRules: 写出 IMPORTANT OUTPUT RULES（Build 与开销估算共用），按输出格式区分。
+func writeRules(w *bytes.Buffer, lines bool) {
+	w.WriteString("\nIMPORTANT OUTPUT RULES:\n")
+	w.WriteString("1) Translate ONLY segs whose ids are listed in 'targets' below.\n")
+	if lines {
+		w.WriteString("2) Return ONLY plain text (no JSON, no ids, no markdown, no commentary).\n")
+		w.WriteString("3) Exactly one line per target id in ascending id order; join multi-line segs with a space.\n")
+		return
+	}
+	w.WriteString("2) Return ONLY strict JSON (no markdown, no code fences, no commentary).\n")
+	w.WriteString("3) Schema: an array of objects [{\"id\": number, \"text\": string}] in ascending id order.\n")
+}
+
+// writeSegs: 输出 <seg id="..." key="...">\n<text>\n</seg> 形式；keys 为渲染为属性的 Meta 键（值已转义）。
+func writeSegs(w *bytes.Buffer, recs []contract.Record, keys []string) {
 	for _, r := range recs {
 		w.WriteString("<seg id=\"")
 		w.WriteString(strconv.FormatInt(int64(r.Index), 10))
-		w.WriteString("\">\n")
+		w.WriteByte('"')
+		for _, k := range keys {
+			if v := r.Meta[k]; v != "" {
+				w.WriteByte(' ')
+				w.WriteString(k)
+				w.WriteString("=\"")
+				attrEscaper.WriteString(w, v)
+				w.WriteByte('"')
+			}
+		}
+		w.WriteString(">\n")
 		w.WriteString(r.Text)
 		w.WriteString("\n</seg>\n")
 	}
 }
 
+// attrEscaper: 属性值转义（含换行，保持 <seg> 起始标签单行）。
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\n", "&#10;", "\r", "&#13;")
+
 // 默认 system 模板。
 const defaultSystemTemplate = `
 ## Role Definition
@@ -218,6 +450,16 @@ You are a master translator tasked with translating an entire movie's subtitle c
   - Only translate the seg ids listed by the user message in "targets". Do NOT translate or rewrite other segs.
   - If a <glossary> is present, its term mappings MUST take precedence.
 - When explicitly asked to return JSON (batch mode), output ONLY strict JSON according to the schema; do not include markdown/code fences.
+{{- with index .Vars "target_lang"}}
+
+## Target Language
+Translate every target seg into {{.}}, regardless of the language used in the example below.
+{{- end}}
+{{- with index .Vars "locale"}}
+
+## Target Locale
+Follow the regional conventions of locale {{.}} (spelling, punctuation, quotation marks, number formats).
+{{- end}}
 
 <example>
 user: <window>
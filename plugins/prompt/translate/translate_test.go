@@ -2,6 +2,7 @@ package translate
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -87,3 +88,204 @@ func TestNewTemplateParseError(t *testing.T) {
 		t.Fatalf("expect parse error")
 	}
 }
+
+// TestBuildWithVars 模板变量渲染
+func TestBuildWithVars(t *testing.T) {
+	b, err := New(&Options{InlineSystemTemplate: "lang={{.Vars.lang}}", Vars: map[string]string{"lang": "zh"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	batch := contract.Batch{Records: []contract.Record{{Index: 0, Text: "x"}}, TargetFrom: 0, TargetTo: 0}
+	p, err := b.Build(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	cp := p.(contract.ChatPrompt)
+	if cp[0].Content != "lang=zh" {
+		t.Fatalf("vars not rendered: %q", cp[0].Content)
+	}
+	if est := b.EstimateOverheadTokens(func(s string) int { return len(s) }); est < len("lang=zh") {
+		t.Fatalf("overhead should include rendered vars: %d", est)
+	}
+}
+
+// TestBuildWithFileVars 逐文件变量覆盖构造期 Vars；默认模板仅在提供 target_lang/locale 时追加对应段
+func TestBuildWithFileVars(t *testing.T) {
+	batch := contract.Batch{Records: []contract.Record{{Index: 0, Text: "x"}}, TargetFrom: 0, TargetTo: 0}
+	b, _ := New(&Options{InlineSystemTemplate: "lang={{.Vars.lang}} tone={{.Vars.tone}}", Vars: map[string]string{"lang": "zh", "tone": "calm"}})
+	p, err := b.BuildWithVars(context.Background(), batch, map[string]string{"lang": "ja"})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if got := p.(contract.ChatPrompt)[0].Content; got != "lang=ja tone=calm" {
+		t.Fatalf("file vars not applied: %q", got)
+	}
+	plain, _ := New(nil)
+	p, _ = plain.Build(context.Background(), batch)
+	if strings.Contains(p.(contract.ChatPrompt)[0].Content, "## Target Language") {
+		t.Fatalf("default template should omit target language section")
+	}
+	p, _ = plain.BuildWithVars(context.Background(), batch, map[string]string{"target_lang": "Japanese"})
+	if !strings.Contains(p.(contract.ChatPrompt)[0].Content, "Translate every target seg into Japanese") {
+		t.Fatalf("target_lang not rendered: %q", p.(contract.ChatPrompt)[0].Content)
+	}
+	if strings.Contains(p.(contract.ChatPrompt)[0].Content, "## Target Locale") {
+		t.Fatalf("default template should omit locale section")
+	}
+	p, _ = plain.BuildWithVars(context.Background(), batch, map[string]string{"locale": "zh-TW"})
+	if !strings.Contains(p.(contract.ChatPrompt)[0].Content, "conventions of locale zh-TW") {
+		t.Fatalf("locale not rendered: %q", p.(contract.ChatPrompt)[0].Content)
+	}
+}
+
+// TestNewVarsMissing 模板引用未提供的变量
+func TestNewVarsMissing(t *testing.T) {
+	if _, err := New(&Options{InlineSystemTemplate: "{{.Vars.tone}}"}); err == nil {
+		t.Fatalf("expect render error for missing var")
+	}
+}
+
+// TestFileVars 逐文件变量（内置 target_lang/locale 与 file_vars 列出的键）不要求构造期提供；
+// 渲染时缺失则以 ErrInvalidInput 失败且错误指明缺失的键
+func TestFileVars(t *testing.T) {
+	batch := contract.Batch{Records: []contract.Record{{Index: 0, Text: "a"}}, TargetFrom: 0, TargetTo: 0}
+	b, err := New(&Options{InlineSystemTemplate: "lang={{.Vars.target_lang}} reg={{.Vars.region}}", FileVars: []string{"region"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	p, err := b.BuildWithVars(context.Background(), batch, map[string]string{"target_lang": "ja", "region": "JP"})
+	if err != nil || p.(contract.ChatPrompt)[0].Content != "lang=ja reg=JP" {
+		t.Fatalf("render: %v %v", p, err)
+	}
+	_, err = b.Build(context.Background(), batch)
+	if !errors.Is(err, contract.ErrInvalidInput) || !strings.Contains(err.Error(), "target_lang") {
+		t.Fatalf("expect wrapped missing-key error, got %v", err)
+	}
+	if b.EstimateOverheadTokens(func(s string) int { return len(s) }) == 0 {
+		t.Fatal("overhead estimate must render with placeholders")
+	}
+}
+
+// TestBuildWithExamples few-shot 示例以消息对插入并计入开销
+func TestBuildWithExamples(t *testing.T) {
+	plain, _ := New(nil)
+	b, err := New(&Options{Examples: []Example{{Source: "Hello", Target: "你好"}}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	batch := contract.Batch{Records: []contract.Record{{Index: 5, Text: "x"}}, TargetFrom: 5, TargetTo: 5}
+	p, err := b.Build(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	cp := p.(contract.ChatPrompt)
+	if len(cp) != 5 || cp[1].Role != "user" || cp[2].Role != "assistant" {
+		t.Fatalf("unexpected messages: %#v", cp)
+	}
+	if !strings.Contains(cp[1].Content, "Hello") || !strings.Contains(cp[2].Content, "你好") {
+		t.Fatalf("example not rendered: %#v", cp[1:3])
+	}
+	if !strings.Contains(cp[3].Content, "targets: [5]") {
+		t.Fatalf("real batch should follow examples: %s", cp[3].Content)
+	}
+	est := func(s string) int { return len(s) }
+	if b.EstimateOverheadTokens(est) <= plain.EstimateOverheadTokens(est) || b.EstimateExampleTokens(est) == 0 {
+		t.Fatalf("overhead should include examples")
+	}
+}
+
+// TestNewExamplesLimits 示例条数/字节超限
+func TestNewExamplesLimits(t *testing.T) {
+	exs := []Example{{Source: "a", Target: "b"}, {Source: "c", Target: "d"}}
+	if _, err := New(&Options{Examples: exs, MaxExamples: 1}); err == nil {
+		t.Fatalf("expect max_examples error")
+	}
+	if _, err := New(&Options{Examples: exs, MaxExampleBytes: 3}); err == nil {
+		t.Fatalf("expect max_example_bytes error")
+	}
+	if _, err := New(&Options{Examples: []Example{{Source: "a"}}}); err == nil {
+		t.Fatalf("expect empty target error")
+	}
+}
+
+// TestNewExamplesPath 从文件加载示例
+func TestNewExamplesPath(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "ex.json")
+	os.WriteFile(p, []byte(`[{"source":"Hi","target":"嗨"}]`), 0o644)
+	b, err := New(&Options{ExamplesPath: p})
+	if err != nil || len(b.shots) != 2 {
+		t.Fatalf("new examples path: %v", err)
+	}
+}
+
+// TestOutputFormatLines lines 格式：规则改为逐行纯文本、省略 json_schema 消息，示例应答为纯文本；未知格式构造失败
+func TestOutputFormatLines(t *testing.T) {
+	b, err := New(&Options{OutputFormat: FormatLines, Examples: []Example{{Source: "Hi", Target: "你好\n朋友"}}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	batch := contract.Batch{Records: []contract.Record{{Index: 0, Text: "x"}}, TargetFrom: 0, TargetTo: 0}
+	p, err := b.Build(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	cp := p.(contract.ChatPrompt)
+	if len(cp) != 4 || cp[len(cp)-1].Role != "user" {
+		t.Fatalf("expect system+example pair+user without json_schema, got %d messages", len(cp))
+	}
+	if cp[2].Content != "你好 朋友" {
+		t.Fatalf("example answer = %q", cp[2].Content)
+	}
+	user := cp[3].Content
+	if !strings.Contains(user, "one line per target id") || strings.Contains(user, "strict JSON") {
+		t.Fatalf("unexpected rules: %s", user)
+	}
+	js, _ := New(nil)
+	est := func(s string) int { return len(s) }
+	if b2, _ := New(&Options{OutputFormat: FormatLines}); b2.EstimateOverheadTokens(est) >= js.EstimateOverheadTokens(est) {
+		t.Fatalf("lines overhead should exclude the schema")
+	}
+	if _, err := New(&Options{OutputFormat: "xml"}); err == nil {
+		t.Fatalf("expect error for unknown output_format")
+	}
+}
+
+// TestIncludeMetaKeys 选中的 Meta 键按序渲染为 <seg> 属性（值转义，缺失/空值省略），其余键不出现；开销估算不受影响
+func TestIncludeMetaKeys(t *testing.T) {
+	plain, _ := New(nil)
+	b, err := New(&Options{IncludeMetaKeys: []string{"speaker", "scene"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	batch := contract.Batch{Records: []contract.Record{
+		{Index: 20, Text: "L", Meta: contract.Meta{"speaker": "ANN", "time": "00:01"}},
+		{Index: 21, Text: "T", Meta: contract.Meta{"scene": "bar", "speaker": `JO "J" <&>`}},
+		{Index: 22, Text: "R", Meta: contract.Meta{"speaker": ""}},
+	}, TargetFrom: 21, TargetTo: 21}
+	p, err := b.Build(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	user := p.(contract.ChatPrompt)[1].Content
+	for _, want := range []string{
+		`<seg id="20" speaker="ANN">`,
+		`<seg id="21" speaker="JO &quot;J&quot; &lt;&amp;&gt;" scene="bar">`,
+		`<seg id="22">`,
+	} {
+		if !strings.Contains(user, want) {
+			t.Fatalf("missing %s in:\n%s", want, user)
+		}
+	}
+	if strings.Contains(user, "time=") || strings.Contains(user, "00:01") {
+		t.Fatalf("未选中的 Meta 键不应出现: %s", user)
+	}
+	est := func(s string) int { return len(s) }
+	if b.EstimateOverheadTokens(est) != plain.EstimateOverheadTokens(est) {
+		t.Fatal("开销估算不应包含 Meta 属性")
+	}
+	for _, bad := range []string{"id", "", "1x", "a b"} {
+		if _, err := New(&Options{IncludeMetaKeys: []string{bad}}); err == nil {
+			t.Fatalf("非法键 %q 应被拒绝", bad)
+		}
+	}
+}
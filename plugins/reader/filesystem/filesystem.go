@@ -4,11 +4,13 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"llmspt/pkg/contract"
 )
@@ -21,6 +23,16 @@ type Options struct {
 	// 例如 [".git","node_modules","vendor"]。
 	// 仅影响目录递归，不影响单文件 root。
 	ExcludeDirNames []string `json:"exclude_dir_names"`
+	// MaxOpenFiles: 同时处于打开状态的文件句柄上限（含已交给 yield、尚未 Close 的句柄）；<=0 表示不限制。
+	// 达到上限时 Iterate 阻塞直到消费方 Close 某个句柄或 ctx 取消，因此消费方必须关闭每个句柄。
+	// 流水线在回调内同步读完并关闭文件，正常情况下只占用 1 个；该上限用于约束异步持有句柄的
+	// 消费方（如并发处理多个文件或慢速 Writer），与流水线的批并发（Concurrency）相互独立。
+	MaxOpenFiles int `json:"max_open_files"`
+	// IndexExts: 索引文件扩展名（如 [".m3u", ".m3u8"]，不区分大小写，可省略前导点）。
+	// 命中的文件不作为输入产出，而是展开为其列出的条目：每行一个路径，相对路径相对索引文件所在目录解析；
+	// 空行与 '#' 开头的行（注释/m3u 指令）忽略。条目须为常规文件（或指向常规文件的符号链接），
+	// 缺失或为目录/另一索引文件时快速失败。默认为空（不识别索引文件）。
+	IndexExts []string `json:"index_exts"`
 }
 
 // FileSystem 实现基于文件系统与 STDIN 的 Reader。
@@ -29,6 +41,10 @@ type FileSystem struct {
 	bufSize int
 	// 以小写形式保存，比较时按小写基名匹配。
 	excludeDir map[string]struct{}
+	// sem: 打开句柄信号量；nil 表示不限制。
+	sem chan struct{}
+	// indexExt: 索引文件扩展名（小写，含前导点）；空表示不识别。
+	indexExt map[string]struct{}
 }
 
 // New 创建 FileSystem Reader。
@@ -48,7 +64,24 @@ func New(opts *Options) *FileSystem {
 			ex[strings.ToLower(name)] = struct{}{}
 		}
 	}
-	return &FileSystem{bufSize: b, excludeDir: ex}
+	var sem chan struct{}
+	if opts != nil && opts.MaxOpenFiles > 0 {
+		sem = make(chan struct{}, opts.MaxOpenFiles)
+	}
+	idx := make(map[string]struct{})
+	if opts != nil {
+		for _, ext := range opts.IndexExts {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext == "" || ext == "." {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			idx[ext] = struct{}{}
+		}
+	}
+	return &FileSystem{bufSize: b, excludeDir: ex, sem: sem, indexExt: idx}
 }
 
 // Iterate 遍历 roots，按稳定顺序对每个常规文件调用 yield。
@@ -81,6 +114,21 @@ func (r *FileSystem) Iterate(ctx context.Context, roots []string, yield func(fil
 	return nil
 }
 
+var _ contract.PathResolver = (*FileSystem)(nil)
+
+// ResolvePath 返回 FileID 对应的源文件绝对路径（FileID 即遍历时的规范化路径，相对路径以当前工作目录为基准）；
+// STDIN 无路径，返回 ok=false。
+func (r *FileSystem) ResolvePath(id contract.FileID) (string, bool) {
+	if id == "stdin" {
+		return "", false
+	}
+	abs, err := filepath.Abs(filepath.FromSlash(string(id)))
+	if err != nil {
+		return "", false
+	}
+	return abs, true
+}
+
 func (r *FileSystem) iterateOne(ctx context.Context, root string, yield func(contract.FileID, io.ReadCloser) error) error {
 	select {
 	case <-ctx.Done():
@@ -99,16 +147,7 @@ func (r *FileSystem) iterateOne(ctx context.Context, root string, yield func(con
 			return err
 		}
 		if t.Mode().IsRegular() {
-			f, err := os.Open(root)
-			if err != nil {
-				return err
-			}
-			brc := newBufferedCloser(f, r.bufSize)
-			if err := yield(contract.NormalizeFileID(root), brc); err != nil {
-				_ = brc.Close()
-				return err
-			}
-			return nil
+			return r.yieldFile(ctx, root, yield)
 		}
 		// 非常规目标（含目录）：忽略，不报错
 		return nil
@@ -120,16 +159,7 @@ func (r *FileSystem) iterateOne(ctx context.Context, root string, yield func(con
 	if !info.Mode().IsRegular() { // 跳过非常规文件
 		return nil
 	}
-	f, err := os.Open(root)
-	if err != nil {
-		return err
-	}
-	brc := newBufferedCloser(f, r.bufSize)
-	if err := yield(contract.NormalizeFileID(root), brc); err != nil {
-		_ = brc.Close()
-		return err
-	}
-	return nil
+	return r.yieldFile(ctx, root, yield)
 }
 
 func (r *FileSystem) walkDir(ctx context.Context, dir string, yield func(contract.FileID, io.ReadCloser) error) error {
@@ -193,23 +223,142 @@ func (r *FileSystem) walkDir(ctx context.Context, dir string, yield func(contrac
 			// 非常规且不是符号链接（如设备等）跳过
 			continue
 		}
-		f, err := os.Open(p)
-		if err != nil {
+		if err := r.yieldFile(ctx, p, yield); err != nil {
 			return err
 		}
-		brc := newBufferedCloser(f, r.bufSize)
-		if err := yield(contract.NormalizeFileID(p), brc); err != nil {
-			_ = brc.Close()
+	}
+	return nil
+}
+
+// yieldFile 产出常规文件 p；扩展名命中 IndexExts 时改为展开其列出的条目。
+func (r *FileSystem) yieldFile(ctx context.Context, p string, yield func(contract.FileID, io.ReadCloser) error) error {
+	if r.isIndex(p) {
+		return r.expandIndex(ctx, p, yield)
+	}
+	return r.yieldOpen(ctx, p, yield)
+}
+
+// yieldOpen 打开 p 并以其规范化路径为 FileID 交给 yield；yield 失败时代为关闭句柄。
+func (r *FileSystem) yieldOpen(ctx context.Context, p string, yield func(contract.FileID, io.ReadCloser) error) error {
+	brc, err := r.open(ctx, p)
+	if err != nil {
+		return err
+	}
+	if err := yield(contract.NormalizeFileID(p), brc); err != nil {
+		_ = brc.Close()
+		return err
+	}
+	return nil
+}
+
+func (r *FileSystem) isIndex(p string) bool {
+	if len(r.indexExt) == 0 {
+		return false
+	}
+	_, ok := r.indexExt[strings.ToLower(filepath.Ext(p))]
+	return ok
+}
+
+// expandIndex 按行序产出索引文件 idx 列出的条目（相对路径以 idx 所在目录为基准）。
+// 先完整读取并校验全部条目再逐个产出，条目缺失时不产出任何文件；不展开嵌套索引。
+func (r *FileSystem) expandIndex(ctx context.Context, idx string, yield func(contract.FileID, io.ReadCloser) error) error {
+	entries, err := readIndex(idx)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		t, err := os.Stat(e.path)
+		if err != nil {
+			return fmt.Errorf("index %s:%d: %w", idx, e.line, err)
+		}
+		if !t.Mode().IsRegular() {
+			return fmt.Errorf("index %s:%d: %s is not a regular file", idx, e.line, e.path)
+		}
+		if r.isIndex(e.path) {
+			return fmt.Errorf("index %s:%d: nested index %s not supported", idx, e.line, e.path)
+		}
+	}
+	for _, e := range entries {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if err := r.yieldOpen(ctx, e.path, yield); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// indexEntry 索引文件中的一个条目：解析后的路径与所在行号（1 起）。
+type indexEntry struct {
+	path string
+	line int
+}
+
+// readIndex 解析索引文件：忽略 UTF-8 BOM、空行与 '#' 开头的行；接受 '/' 或平台分隔符。
+func readIndex(idx string) ([]indexEntry, error) {
+	f, err := os.Open(idx)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	base := filepath.Dir(idx)
+	var out []indexEntry
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := filepath.FromSlash(line)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(base, p)
+		}
+		out = append(out, indexEntry{path: p, line: n})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("index %s: %w", idx, err)
+	}
+	return out, nil
+}
+
+// open 在信号量许可下打开文件；句柄首次 Close 时归还许可。
+func (r *FileSystem) open(ctx context.Context, p string) (*bufferedCloser, error) {
+	if r.sem != nil {
+		select {
+		case r.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		r.release()
+		return nil, err
+	}
+	brc := newBufferedCloser(f, r.bufSize)
+	brc.release = r.release
+	return brc, nil
+}
+
+func (r *FileSystem) release() {
+	if r.sem != nil {
+		<-r.sem
+	}
+}
+
 // bufferedCloser 将 bufio.Reader 与底层 Closer 组合为 ReadCloser。
 type bufferedCloser struct {
 	*bufio.Reader
 	c io.Closer
+	// release: 可选，首次 Close 时调用一次（归还打开句柄许可）。
+	release func()
+	once    sync.Once
 }
 
 func newBufferedCloser(c io.ReadCloser, bufSize int) *bufferedCloser {
@@ -219,4 +368,10 @@ func newBufferedCloser(c io.ReadCloser, bufSize int) *bufferedCloser {
 	return &bufferedCloser{Reader: bufio.NewReaderSize(c, bufSize), c: c}
 }
 
-func (b *bufferedCloser) Close() error { return b.c.Close() }
+func (b *bufferedCloser) Close() error {
+	err := b.c.Close()
+	if b.release != nil {
+		b.once.Do(b.release)
+	}
+	return err
+}
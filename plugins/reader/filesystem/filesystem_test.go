@@ -7,7 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"llmspt/pkg/contract"
 )
@@ -33,6 +35,18 @@ func TestIterateSingleFile(t *testing.T) {
 	}
 }
 
+// TestResolvePath 相对 FileID 按工作目录解析为绝对路径；stdin 不可解析
+func TestResolvePath(t *testing.T) {
+	r := New(nil)
+	wd, _ := os.Getwd()
+	if got, ok := r.ResolvePath("sub/a.srt"); !ok || got != filepath.Join(wd, "sub", "a.srt") {
+		t.Fatalf("got %q %v", got, ok)
+	}
+	if _, ok := r.ResolvePath("stdin"); ok {
+		t.Fatal("stdin 不应可解析")
+	}
+}
+
 // TestExcludeDir 跳过目录
 func TestExcludeDir(t *testing.T) {
 	dir := t.TempDir()
@@ -142,3 +156,120 @@ func TestNewBufferedCloserDefault(t *testing.T) {
 }
 
 
+
+// TestMaxOpenFiles 异步持有句柄时并发打开数不超过上限，且全部关闭后许可归还
+func TestMaxOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{"a", "b", "c", "d", "e"} {
+		os.WriteFile(filepath.Join(dir, n+".txt"), []byte(n), 0o644)
+	}
+	r := New(&Options{MaxOpenFiles: 2})
+	var wg sync.WaitGroup
+	var peak, yielded int
+	err := r.Iterate(context.Background(), []string{dir}, func(id contract.FileID, rc io.ReadCloser) error {
+		yielded++
+		if n := len(r.sem); n > peak {
+			peak = n
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(5 * time.Millisecond)
+			_, _ = io.ReadAll(rc)
+			rc.Close()
+			rc.Close() // 重复关闭不应重复归还
+		}()
+		return nil
+	})
+	wg.Wait()
+	if err != nil || yielded != 5 {
+		t.Fatalf("iterate: %v yielded=%d", err, yielded)
+	}
+	if peak > 2 || len(r.sem) != 0 {
+		t.Fatalf("unbalanced: peak=%d open=%d", peak, len(r.sem))
+	}
+}
+
+// TestMaxOpenFilesCancel 句柄耗尽时 ctx 取消可解除阻塞
+func TestMaxOpenFilesCancel(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0o644)
+	r := New(&Options{MaxOpenFiles: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	err := r.Iterate(ctx, []string{dir}, func(id contract.FileID, rc io.ReadCloser) error {
+		cancel() // 持有句柄不关闭
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+}
+
+// TestIndexExpand 索引文件展开为其列出的条目（相对索引所在目录、按行序），索引本身不产出；
+// 注释/空行/BOM 忽略，扩展名不区分大小写且可省略前导点；未配置时索引按普通文件产出
+func TestIndexExpand(t *testing.T) {
+	dir := t.TempDir()
+	show := filepath.Join(dir, "show")
+	os.MkdirAll(filepath.Join(show, "subs"), 0o755)
+	os.WriteFile(filepath.Join(show, "subs", "ep1.srt"), []byte("1"), 0o644)
+	os.WriteFile(filepath.Join(show, "subs", "ep2.srt"), []byte("2"), 0o644)
+	os.WriteFile(filepath.Join(dir, "top.srt"), []byte("t"), 0o644)
+	idx := filepath.Join(show, "list.M3U")
+	os.WriteFile(idx, []byte("\ufeff#EXTM3U\r\n#EXTINF:-1,Episode 2\r\nsubs/ep2.srt\r\n\r\n  subs/ep1.srt  \n../top.srt\n"), 0o644)
+
+	collect := func(r *FileSystem, roots ...string) ([]string, error) {
+		var got []string
+		err := r.Iterate(context.Background(), roots, func(id contract.FileID, rc io.ReadCloser) error {
+			defer rc.Close()
+			b, _ := io.ReadAll(rc)
+			got = append(got, string(id)+"="+string(b))
+			return nil
+		})
+		return got, err
+	}
+	want := []string{
+		string(contract.NormalizeFileID(filepath.Join(show, "subs", "ep2.srt"))) + "=2",
+		string(contract.NormalizeFileID(filepath.Join(show, "subs", "ep1.srt"))) + "=1",
+		string(contract.NormalizeFileID(filepath.Join(dir, "top.srt"))) + "=t",
+	}
+	r := New(&Options{IndexExts: []string{"m3u"}})
+	got, err := collect(r, idx)
+	if err != nil || strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("index root: %v %v", got, err)
+	}
+	// 目录遍历中发现的索引同样展开（条目可与遍历结果重复，由调用方决定取舍）
+	got, err = collect(r, show)
+	if err != nil || len(got) != 5 || got[2] != want[0] {
+		t.Fatalf("walk: %v %v", got, err)
+	}
+	got, err = collect(New(nil), idx)
+	if err != nil || len(got) != 1 || !strings.HasPrefix(got[0], string(contract.NormalizeFileID(idx))+"=") {
+		t.Fatalf("unconfigured: %v %v", got, err)
+	}
+}
+
+// TestIndexInvalidEntry 条目缺失/为目录/为嵌套索引时快速失败且不产出任何条目
+func TestIndexInvalidEntry(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.srt"), []byte("a"), 0o644)
+	os.Mkdir(filepath.Join(dir, "sub"), 0o755)
+	os.WriteFile(filepath.Join(dir, "inner.m3u"), []byte("a.srt\n"), 0o644)
+	r := New(&Options{IndexExts: []string{".m3u"}})
+	for _, entry := range []string{"missing.srt", "sub", "inner.m3u"} {
+		idx := filepath.Join(dir, "list.m3u")
+		os.WriteFile(idx, []byte("a.srt\n"+entry+"\n"), 0o644)
+		n := 0
+		err := r.Iterate(context.Background(), []string{idx}, func(id contract.FileID, rc io.ReadCloser) error {
+			rc.Close()
+			n++
+			return nil
+		})
+		if err == nil || n != 0 || !strings.Contains(err.Error(), "list.m3u:2") {
+			t.Fatalf("%s: expect error before yielding, got %v (yielded %d)", entry, err, n)
+		}
+		if entry == "missing.srt" && !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expect ErrNotExist, got %v", err)
+		}
+	}
+}
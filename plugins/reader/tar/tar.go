@@ -0,0 +1,157 @@
+package tar
+
+import (
+	archtar "archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"llmspt/pkg/contract"
+)
+
+// Options 为 tar Reader 的可选配置。
+type Options struct {
+	// BufSize 为归档文件读缓冲区大小（字节）。默认 64KiB。
+	BufSize int `json:"buf_size"`
+	// AllowExts: 仅产出这些扩展名的条目（不区分大小写，如 [".srt"]）；为空表示不过滤。
+	AllowExts []string `json:"allow_exts"`
+	// ExcludeDirNames: 跳过路径中任一目录段（基名完全匹配，不区分大小写）命中的条目。
+	ExcludeDirNames []string `json:"exclude_dir_names"`
+}
+
+// Reader 将每个 root 视为 tar 或 tar.gz 归档（按 gzip 魔数自动识别），
+// 按归档内顺序对每个常规文件条目调用 yield；FileID 为条目在归档内的相对路径。
+// 条目句柄的 Close 为空操作（真正的资源是归档本身），归档在遍历结束后关闭。
+// 条目内容仅在 yield 返回前有效：进入下一条目后，未读完的剩余内容被跳过。
+type Reader struct {
+	bufSize    int
+	allowExt   map[string]struct{}
+	excludeDir map[string]struct{}
+}
+
+// New 创建 tar Reader。
+func New(opts *Options) *Reader {
+	const defaultBuf = 64 * 1024
+	r := &Reader{bufSize: defaultBuf}
+	if opts == nil {
+		return r
+	}
+	if opts.BufSize > 0 {
+		r.bufSize = opts.BufSize
+	}
+	if len(opts.AllowExts) > 0 {
+		r.allowExt = make(map[string]struct{}, len(opts.AllowExts))
+		for _, e := range opts.AllowExts {
+			if e != "" {
+				r.allowExt[strings.ToLower(e)] = struct{}{}
+			}
+		}
+	}
+	if len(opts.ExcludeDirNames) > 0 {
+		r.excludeDir = make(map[string]struct{}, len(opts.ExcludeDirNames))
+		for _, name := range opts.ExcludeDirNames {
+			if name != "" {
+				r.excludeDir[strings.ToLower(name)] = struct{}{}
+			}
+		}
+	}
+	return r
+}
+
+// Iterate 依次遍历每个归档；不支持 STDIN（"-"）。
+func (r *Reader) Iterate(ctx context.Context, roots []string, yield func(fileID contract.FileID, rc io.ReadCloser) error) error {
+	for _, root := range roots {
+		if root == "-" {
+			return errors.New("tar reader: stdin '-' is not supported")
+		}
+		if err := r.iterateArchive(ctx, root, yield); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reader) iterateArchive(ctx context.Context, root string, yield func(contract.FileID, io.ReadCloser) error) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	f, err := os.Open(root)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, r.bufSize)
+	var src io.Reader = br
+	// gzip 魔数 1f 8b：透明解压
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("tar reader %s: %w", root, err)
+		}
+		defer zr.Close()
+		src = zr
+	}
+
+	tr := archtar.NewReader(src)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("tar reader %s: %w", root, err)
+		}
+		if hdr.Typeflag != archtar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.ReplaceAll(hdr.Name, "\\", "/"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("tar reader %s: entry %q: %w", root, hdr.Name, contract.ErrPathInvalid)
+		}
+		if !r.keep(name) {
+			continue
+		}
+		if err := yield(contract.FileID(name), entryReader{tr}); err != nil {
+			return err
+		}
+	}
+}
+
+// keep 依据扩展名白名单与排除目录名判断是否产出该条目。
+func (r *Reader) keep(name string) bool {
+	if r.allowExt != nil {
+		if _, ok := r.allowExt[strings.ToLower(path.Ext(name))]; !ok {
+			return false
+		}
+	}
+	if r.excludeDir != nil {
+		dirs := strings.Split(path.Dir(name), "/")
+		for _, d := range dirs {
+			if _, skip := r.excludeDir[strings.ToLower(d)]; skip {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// entryReader 以空操作 Close 暴露当前条目内容。
+type entryReader struct{ io.Reader }
+
+func (entryReader) Close() error { return nil }
+
+var _ contract.Reader = (*Reader)(nil)
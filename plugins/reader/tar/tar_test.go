@@ -0,0 +1,82 @@
+package tar
+
+import (
+	archtar "archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"llmspt/pkg/contract"
+)
+
+// writeArchive 生成测试归档；gz 为 true 时以 gzip 压缩。
+func writeArchive(t *testing.T, gz bool, entries map[string]string, order []string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if gz {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	tw := archtar.NewWriter(w)
+	for _, name := range order {
+		if name[len(name)-1] == '/' {
+			_ = tw.WriteHeader(&archtar.Header{Name: name, Typeflag: archtar.TypeDir, Mode: 0o755})
+			continue
+		}
+		body := entries[name]
+		_ = tw.WriteHeader(&archtar.Header{Name: name, Typeflag: archtar.TypeReg, Mode: 0o644, Size: int64(len(body))})
+		_, _ = tw.Write([]byte(body))
+	}
+	_ = tw.Close()
+	if zw != nil {
+		_ = zw.Close()
+	}
+	p := filepath.Join(t.TempDir(), "bundle.tar")
+	if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return p
+}
+
+// TestIterate 遍历 tar 与 tar.gz：按归档顺序产出常规文件，过滤扩展名与排除目录
+func TestIterate(t *testing.T) {
+	entries := map[string]string{"a.srt": "A", "sub/b.srt": "B", "sub/c.txt": "C", ".git/d.srt": "D"}
+	order := []string{"a.srt", "sub/", "sub/b.srt", "sub/c.txt", ".git/d.srt"}
+	for _, gz := range []bool{false, true} {
+		p := writeArchive(t, gz, entries, order)
+		r := New(&Options{AllowExts: []string{".SRT"}, ExcludeDirNames: []string{".git"}})
+		var ids []string
+		var bodies []string
+		err := r.Iterate(context.Background(), []string{p}, func(id contract.FileID, rc io.ReadCloser) error {
+			b, _ := io.ReadAll(rc)
+			ids = append(ids, string(id))
+			bodies = append(bodies, string(b))
+			return rc.Close()
+		})
+		if err != nil {
+			t.Fatalf("gz=%v: %v", gz, err)
+		}
+		if len(ids) != 2 || ids[0] != "a.srt" || ids[1] != "sub/b.srt" || bodies[0] != "A" || bodies[1] != "B" {
+			t.Fatalf("gz=%v: ids=%v bodies=%v", gz, ids, bodies)
+		}
+	}
+}
+
+// TestIterateUnsafePath 逃逸归档根的条目路径视为无效
+func TestIterateUnsafePath(t *testing.T) {
+	p := writeArchive(t, false, map[string]string{"../evil.srt": "x"}, []string{"../evil.srt"})
+	err := New(nil).Iterate(context.Background(), []string{p}, func(id contract.FileID, rc io.ReadCloser) error {
+		t.Fatalf("unexpected entry %s", id)
+		return nil
+	})
+	if !errors.Is(err, contract.ErrPathInvalid) {
+		t.Fatalf("expect ErrPathInvalid, got %v", err)
+	}
+}
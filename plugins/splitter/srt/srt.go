@@ -22,11 +22,49 @@ type Options struct {
 	// AllowExts: 允许处理的文件扩展名（大小写不敏感，包含点，如 [".srt"]）。
 	// 为空时采用默认 [".srt"]；显式设为空切片则表示不限制。
 	AllowExts []string `json:"allow_exts"`
+	// StripTags: 移除文本中的 HTML/SRT 标签（<...>，保留内部文本），不做还原；Meta 不受影响。
+	// 仅剥离形如 <x…>、</x>、<!…> 的片段，"a < b"、"<-" 等普通文本保留；剥离后为空的行丢弃。
+	StripTags bool `json:"strip_tags"`
+	// LenientTiming: 放宽时间轴格式：接受 '.' 作为毫秒分隔符、1 位小时与 2 位毫秒，
+	// 并规范化为 HH:MM:SS,mmm 写入 Meta["time"]。默认严格匹配。
+	LenientTiming bool `json:"lenient_timing"`
+	// PreserveSpeakerLabels: 将首行开头的说话人标签（如 "JOHN: "）从 Text 剥离并原样写入
+	// Meta["_speaker"]（contract.MetaSpeaker），不送模型翻译；由解码器在译文前还原。剥离后无剩余文本时保留原样。
+	PreserveSpeakerLabels bool `json:"preserve_speaker_labels"`
+	// CheckMonotonic: 解析时间轴并检查单调性：块内结束早于开始（reversed）、开始早于上一块结束（overlap）。
+	// 默认 false 不检查。
+	CheckMonotonic bool `json:"check_monotonic"`
+	// OnNonMonotonic: 检查失败时的处理：error（默认，返回格式错误）| warn（继续拆分，
+	// 将问题描述写入该块 Meta["timing_warning"]，随 JSONL 边车 meta 输出）。
+	OnNonMonotonic string `json:"on_non_monotonic"`
+}
+
+// OnNonMonotonic 取值。
+const (
+	OnNonMonotonicError = "error"
+	OnNonMonotonicWarn  = "warn"
+)
+
+// MetaTimingWarning: warn 模式下记录时间轴问题的 Meta 键。
+const MetaTimingWarning = "timing_warning"
+
+// Validate 检查枚举取值。
+func (o *Options) Validate() error {
+	switch o.OnNonMonotonic {
+	case "", OnNonMonotonicError, OnNonMonotonicWarn:
+		return nil
+	}
+	return fmt.Errorf("srt splitter: %w: unknown on_non_monotonic %q", contract.ErrInvalidInput, o.OnNonMonotonic)
 }
 
 // Splitter 实现 SRT 拆分。
 type Splitter struct {
-	maxBytes int
+	maxBytes      int
+	stripTags     bool
+	lenientTiming bool
+	speakers      bool
+	monotonic     bool
+	warnTiming    bool
 	// 允许扩展名（小写），若为 nil 表示不限制。
 	allow map[string]struct{}
 }
@@ -53,130 +91,291 @@ func New(opts *Options) *Splitter {
 		// 显式空切片：不限制
 		allow = nil
 	}
-	return &Splitter{maxBytes: mb, allow: allow}
+	return &Splitter{
+		maxBytes:      mb,
+		allow:         allow,
+		stripTags:     opts != nil && opts.StripTags,
+		lenientTiming: opts != nil && opts.LenientTiming,
+		speakers:      opts != nil && opts.PreserveSpeakerLabels,
+		monotonic:     opts != nil && opts.CheckMonotonic,
+		warnTiming:    opts != nil && opts.OnNonMonotonic == OnNonMonotonicWarn,
+	}
+}
+
+var _ contract.StreamSplitter = (*Splitter)(nil)
+
+// speakerRe: 说话人标签——大写字母开头，由大写字母/数字/空格/.'_- 组成（至多 32 字符），
+// 后接冒号与空白或行尾；限定大写以避免误伤 "Note: ..." 之类的普通句子。
+var speakerRe = regexp.MustCompile(`^\p{Lu}[\p{Lu}\p{N} .'_-]{0,31}:(?:[ \t]+|\n|$)`)
+
+// splitSpeaker 拆出 text 开头的说话人前缀；无标签或剥离后为空时返回 ("", text)。
+func splitSpeaker(text string) (string, string) {
+	loc := speakerRe.FindStringIndex(text)
+	if loc == nil || strings.TrimSpace(text[loc[1]:]) == "" {
+		return "", text
+	}
+	return text[:loc[1]], text[loc[1]:]
 }
 
 var timeLineRe = regexp.MustCompile(`^\d{2}:\d{2}:\d{2},\d{3} --> \d{2}:\d{2}:\d{2},\d{3}`)
 
+// lenientTimeRe: 宽松时间轴（1-2 位小时、',' 或 '.'、2-3 位毫秒）；末组保留其后的附加内容（如坐标）。
+var lenientTimeRe = regexp.MustCompile(`^(\d{1,2}):(\d{2}):(\d{2})[,.](\d{2,3})\s*-->\s*(\d{1,2}):(\d{2}):(\d{2})[,.](\d{2,3})(.*)$`)
+
+// normalizeTimeLine 将宽松时间轴规范化为 "HH:MM:SS,mmm --> HH:MM:SS,mmm"（附加内容原样保留）。
+// 2 位毫秒按小数位解释（".50" → 500）。不匹配时返回 false。
+func normalizeTimeLine(line string) (string, bool) {
+	m := lenientTimeRe.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return "", false
+	}
+	stamp := func(h, mi, s, ms string) string {
+		if len(h) == 1 {
+			h = "0" + h
+		}
+		for len(ms) < 3 {
+			ms += "0"
+		}
+		return h + ":" + mi + ":" + s + "," + ms
+	}
+	return stamp(m[1], m[2], m[3], m[4]) + " --> " + stamp(m[5], m[6], m[7], m[8]) + m[9], true
+}
+
+// parseStamp 解析规范化时间戳 "HH:MM:SS,mmm" 为毫秒；分、秒须小于 60。
+func parseStamp(st string) (int64, error) {
+	if len(st) != 12 || st[2] != ':' || st[5] != ':' || st[8] != ',' {
+		return 0, fmt.Errorf("invalid timestamp %q", st)
+	}
+	var v [4]int64
+	for i, f := range []string{st[0:2], st[3:5], st[6:8], st[9:12]} {
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", st)
+		}
+		v[i] = n
+	}
+	if v[1] >= 60 || v[2] >= 60 {
+		return 0, fmt.Errorf("invalid timestamp %q", st)
+	}
+	return ((v[0]*60+v[1])*60+v[2])*1000 + v[3], nil
+}
+
+// parseTiming 解析规范化时间轴行（"HH:MM:SS,mmm --> HH:MM:SS,mmm[附加内容]"）的起止毫秒。
+func parseTiming(line string) (start, end int64, err error) {
+	if len(line) < 29 || line[12:17] != " --> " {
+		return 0, 0, fmt.Errorf("invalid time line %q", line)
+	}
+	if start, err = parseStamp(line[:12]); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseStamp(line[17:29]); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// timingIssue 比较本块与上一块的时间轴，返回问题描述（无问题为空）。prevEnd<0 表示无上一块。
+func timingIssue(seq string, start, end, prevEnd int64, prevSeq string) string {
+	switch {
+	case end < start:
+		return fmt.Sprintf("cue %s: end %s precedes start %s", seq, fmtStamp(end), fmtStamp(start))
+	case prevEnd >= 0 && start < prevEnd:
+		return fmt.Sprintf("cue %s: start %s precedes end %s of cue %s", seq, fmtStamp(start), fmtStamp(prevEnd), prevSeq)
+	}
+	return ""
+}
+
+// fmtStamp 将毫秒格式化为 "HH:MM:SS,mmm"。
+func fmtStamp(ms int64) string {
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
 // Split 将单个 SRT 文件拆分为 []Record。
 func (s *Splitter) Split(ctx context.Context, fileID contract.FileID, r io.Reader) ([]contract.Record, error) {
+	var recs []contract.Record
+	err := s.SplitStream(ctx, fileID, r, func(rec contract.Record) error {
+		recs = append(recs, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// SplitStream 逐块解析 SRT 并在每块结束时 emit 对应 Record（不缓存整个文件）。
+func (s *Splitter) SplitStream(ctx context.Context, fileID contract.FileID, r io.Reader, emit func(contract.Record) error) error {
 	// 根据扩展名提前判定是否处理
 	if s.allow != nil {
 		ext := strings.ToLower(path.Ext(string(fileID)))
 		if _, ok := s.allow[ext]; !ok {
-			return nil, nil
+			return nil
 		}
 	}
 	br := bufio.NewReader(r)
-	var recs []contract.Record
+	// 去除文件开头的 UTF-8 BOM，避免混入首个序号行
+	if head, _ := br.Peek(3); len(head) == 3 && head[0] == 0xEF && head[1] == 0xBB && head[2] == 0xBF {
+		_, _ = br.Discard(3)
+	}
 	var idx contract.Index
+	// 上一块的结束时间与序号（CheckMonotonic）
+	prevEnd, prevSeq := int64(-1), ""
 
 	for {
 		if err := ctxErr(ctx); err != nil {
-			return nil, err
+			return err
 		}
 
-		// 读取一个块：序号行、时间轴行、文本若干行，空行结束
-		seqLine, eof, err := readTrimmedLine(br)
+		// 读取一个块：序号行、时间轴行、文本若干行，空行或 EOF 结束。
+		// readTrimmedLine 的 last 表示该行之后输入已结束（末行无换行符，或已无内容）。
+		seqLine, last, err := readTrimmedLine(br)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if eof {
-			break
-		}
-		if seqLine == "" { // 跳过多余空行
-			continue
+		if seqLine == "" {
+			if last {
+				break
+			}
+			continue // 跳过多余空行
 		}
 		// 验证序号
 		if _, err := strconv.Atoi(seqLine); err != nil {
-			return nil, fmt.Errorf("srt format error: invalid sequence line: %q", seqLine)
+			return fmt.Errorf("srt format error: invalid sequence line: %q", seqLine)
+		}
+		if last {
+			return fmt.Errorf("srt format error: unexpected end of file after sequence line %q", seqLine)
 		}
 
-		timeLine, _, err := readTrimmedLine(br)
+		timeLine, last, err := readTrimmedLine(br)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if !timeLineRe.MatchString(timeLine) {
-			return nil, fmt.Errorf("srt format error: invalid time line: %q", timeLine)
+			norm, ok := "", false
+			if s.lenientTiming {
+				norm, ok = normalizeTimeLine(timeLine)
+			}
+			if !ok {
+				return fmt.Errorf("srt format error: invalid time line: %q", timeLine)
+			}
+			timeLine = norm
+		}
+		var timingWarn string
+		if s.monotonic {
+			start, end, err := parseTiming(timeLine)
+			if err != nil {
+				return fmt.Errorf("srt format error: %v", err)
+			}
+			if issue := timingIssue(seqLine, start, end, prevEnd, prevSeq); issue != "" {
+				if !s.warnTiming {
+					return fmt.Errorf("srt timing error: %s", issue)
+				}
+				timingWarn = issue
+			}
+			prevEnd, prevSeq = end, seqLine
 		}
 
-		// 收集文本行直到遇到空行或 EOF
+		// 收集文本行直到遇到空行或 EOF；时间轴行即为末行时该块无文本。
+		// 末行无换行符时仍是完整的文本行，与其前各行一样计入尺寸并追加。
 		var texts []string
-		// 维护累积字节数用于 MaxFragmentBytes 早返回。
-		sumBytes := 0
-		for {
+		// 维护拼接后的字节数（文本 + 行间 '\n'）用于 MaxFragmentBytes 早返回。
+		size := 0
+		for !last {
 			if err := ctxErr(ctx); err != nil {
-				return nil, err
+				return err
 			}
-			line, e, err := readTrimmedLine(br)
+			var line string
+			line, last, err = readTrimmedLine(br)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			if line == "" || e { // 空行或 EOF 结束当前块
-				if e && line != "" {
-					// 在 EOF 且最后一行非空时也累计并检查
-					// 预测拼接后的总长度：已有文本字节 + 新行字节 + 现有行数作为分隔符 '\n'
-					if s.maxBytes > 0 {
-						predicted := sumBytes + len(line)
-						if len(texts) > 0 {
-							predicted += len(texts)
-						} // 加上分隔符数量
-						if predicted > s.maxBytes {
-							return nil, fmt.Errorf("fragment too large: %d > %d", predicted, s.maxBytes)
-						}
-					}
-					texts = append(texts, line)
+			if s.stripTags && line != "" {
+				if line = stripTags(line); strings.TrimSpace(line) == "" {
+					// 整行均为标签：丢弃该行但不视为块结束
+					continue
 				}
+			}
+			if line == "" { // 空行结束当前块
 				break
 			}
-			// 早期尺寸检查：预测 join 后的大小（分隔符个数为当前行数）。
-			if s.maxBytes > 0 {
-				predicted := sumBytes + len(line)
-				if len(texts) > 0 {
-					predicted += len(texts)
-				}
-				if predicted > s.maxBytes {
-					return nil, fmt.Errorf("fragment too large: %d > %d", predicted, s.maxBytes)
-				}
+			next := size + len(line)
+			if len(texts) > 0 {
+				next++ // 行间分隔符
+			}
+			if s.maxBytes > 0 && next > s.maxBytes {
+				return fmt.Errorf("fragment too large: %d > %d", next, s.maxBytes)
 			}
 			texts = append(texts, line)
-			sumBytes += len(line)
+			size = next
 		}
 
 		text := strings.Join(texts, "\n")
 		// UTF-8 校验（最小必要：非法字节快速失败）
 		if !utf8.ValidString(text) {
-			return nil, errors.New("decode error: invalid UTF-8 in text block")
-		}
-		if s.maxBytes > 0 && len(text) > s.maxBytes {
-			return nil, fmt.Errorf("fragment too large: %d > %d", len(text), s.maxBytes)
+			return errors.New("decode error: invalid UTF-8 in text block")
 		}
 
-		recs = append(recs, contract.Record{
+		meta := contract.Meta{"seq": seqLine, "time": timeLine}
+		if timingWarn != "" {
+			meta[MetaTimingWarning] = timingWarn
+		}
+		if s.speakers {
+			if label, rest := splitSpeaker(text); label != "" {
+				meta[contract.MetaSpeaker] = label
+				text = rest
+			}
+		}
+		if err := emit(contract.Record{
 			Index:  idx,
 			FileID: fileID,
 			Text:   text,
-			Meta:   contract.Meta{"seq": seqLine, "time": timeLine},
-		})
+			Meta:   meta,
+		}); err != nil {
+			return err
+		}
 		idx++
 	}
-	return recs, nil
+	return nil
+}
+
+// stripTags 移除 s 中的标签片段，保留标签之间的文本。
+// 标签判定：'<' 后紧跟字母、'/' 或 '!'，且在下一个 '<' 之前出现 '>'；否则 '<' 按普通字符保留。
+func stripTags(s string) string {
+	if !strings.Contains(s, "<") {
+		return s
+	}
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for i := 0; i < len(s); {
+		if s[i] == '<' && i+1 < len(s) && isTagStart(s[i+1]) {
+			if end := strings.IndexAny(s[i+1:], "<>"); end >= 0 && s[i+1+end] == '>' {
+				i += end + 2
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+		i++
+	}
+	return sb.String()
+}
+
+func isTagStart(c byte) bool {
+	return c == '/' || c == '!' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
 }
 
-// readTrimmedLine 读取一行，归一 CRLF→LF，并去除结尾换行符；返回该行、是否 EOF。
-func readTrimmedLine(br *bufio.Reader) (line string, eof bool, err error) {
+// readTrimmedLine 读取一行并去除结尾换行符（\n 或 \r\n）；last 表示输入在该行结束：
+// 末行无换行符时返回该行且 last=true，已无内容时返回 ("", true)。
+func readTrimmedLine(br *bufio.Reader) (line string, last bool, err error) {
 	s, err := br.ReadString('\n')
 	if err != nil {
-		if errors.Is(err, io.EOF) {
-			eof = true
-		} else {
+		if !errors.Is(err, io.EOF) {
 			return "", false, err
 		}
+		last = true
 	}
-	// 去除尾部换行（\n 或 \r\n）
 	s = strings.TrimSuffix(s, "\n")
 	s = strings.TrimSuffix(s, "\r")
-	return s, eof && s == "", nil
+	return s, last, nil
 }
 
 func ctxErr(ctx context.Context) error {
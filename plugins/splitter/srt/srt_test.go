@@ -5,6 +5,8 @@ import (
 	"errors"
 	"strings"
 	"testing"
+
+	"llmspt/pkg/contract"
 )
 
 const sample = "1\n00:00:01,000 --> 00:00:02,000\nhello\n\n2\n00:00:02,000 --> 00:00:03,000\nworld\n\n"
@@ -98,3 +100,206 @@ func TestSplitCtxCancel(t *testing.T) {
 		t.Fatalf("expect ctx cancel, got %v", err)
 	}
 }
+
+// TestSplitStripTags 剥离嵌套/未闭合标签，保留比较符与时间轴
+func TestSplitStripTags(t *testing.T) {
+	src := "1\n00:00:01,000 --> 00:00:02,000\n<font color=\"red\"><b>hello</b></font>\n<i>a < b and c > d\n<br/>\n\n" +
+		"2\n00:00:02,000 --> 00:00:03,000\n<-- back <unclosed\n\n"
+	recs, err := New(&Options{StripTags: true}).Split(context.Background(), "a.srt", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("unexpected recs %+v", recs)
+	}
+	if recs[0].Text != "hello\na < b and c > d" {
+		t.Fatalf("unexpected text: %q", recs[0].Text)
+	}
+	if recs[1].Text != "<-- back <unclosed" || recs[1].Meta["time"] != "00:00:02,000 --> 00:00:03,000" {
+		t.Fatalf("unexpected rec: %+v", recs[1])
+	}
+	// 默认不剥离
+	recs, _ = New(nil).Split(context.Background(), "a.srt", strings.NewReader(src))
+	if !strings.Contains(recs[0].Text, "<b>") {
+		t.Fatalf("tags stripped without option: %q", recs[0].Text)
+	}
+}
+
+// TestSplitSpeakerLabels 首行说话人标签剥离进 Meta；无标签、普通句首与仅含标签的块保持原样
+func TestSplitSpeakerLabels(t *testing.T) {
+	src := "1\n00:00:01,000 --> 00:00:02,000\nJOHN: Hello there.\nHow are you?\n\n" +
+		"2\n00:00:02,000 --> 00:00:03,000\nNo label here\n\n" +
+		"3\n00:00:03,000 --> 00:00:04,000\nNote: lower case\n\n" +
+		"4\n00:00:04,000 --> 00:00:05,000\nMARY J.:\nFine.\n\n" +
+		"5\n00:00:05,000 --> 00:00:06,000\nBOB:\n\n"
+	recs, err := New(&Options{PreserveSpeakerLabels: true}).Split(context.Background(), "a.srt", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	want := []struct{ label, text string }{
+		{"JOHN: ", "Hello there.\nHow are you?"},
+		{"", "No label here"},
+		{"", "Note: lower case"},
+		{"MARY J.:\n", "Fine."},
+		{"", "BOB:"},
+	}
+	if len(recs) != len(want) {
+		t.Fatalf("unexpected recs %+v", recs)
+	}
+	for i, w := range want {
+		if recs[i].Meta[contract.MetaSpeaker] != w.label || recs[i].Text != w.text {
+			t.Fatalf("rec %d: label=%q text=%q", i, recs[i].Meta[contract.MetaSpeaker], recs[i].Text)
+		}
+	}
+	// 默认不剥离
+	recs, _ = New(nil).Split(context.Background(), "a.srt", strings.NewReader(src))
+	if recs[0].Text != "JOHN: Hello there.\nHow are you?" || recs[0].Meta[contract.MetaSpeaker] != "" {
+		t.Fatalf("label stripped without option: %+v", recs[0])
+	}
+}
+
+// TestSplitLenientTiming 宽松时间轴规范化；默认仍严格拒绝
+func TestSplitLenientTiming(t *testing.T) {
+	src := "1\n0:00:01.5 --> 0:00:02.50\nhello\n\n2\n00:00:02.000-->00:00:03,250 X1:10\nworld\n\n"
+	recs, err := New(&Options{LenientTiming: true}).Split(context.Background(), "a.srt", strings.NewReader(src))
+	if err == nil {
+		t.Fatalf("1 位毫秒应被拒绝")
+	}
+	src = strings.Replace(src, "01.5 ", "01.05 ", 1)
+	recs, err = New(&Options{LenientTiming: true}).Split(context.Background(), "a.srt", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if recs[0].Meta["time"] != "00:00:01,050 --> 00:00:02,500" {
+		t.Fatalf("unexpected time: %q", recs[0].Meta["time"])
+	}
+	if recs[1].Meta["time"] != "00:00:02,000 --> 00:00:03,250 X1:10" {
+		t.Fatalf("unexpected time: %q", recs[1].Meta["time"])
+	}
+	if _, err := New(nil).Split(context.Background(), "a.srt", strings.NewReader(src)); err == nil {
+		t.Fatalf("默认应严格拒绝")
+	}
+}
+
+// TestSplitBOM 带 UTF-8 BOM 的输入：BOM 被去除，首条序号与文本干净
+func TestSplitBOM(t *testing.T) {
+	recs, err := New(nil).Split(context.Background(), "a.srt", strings.NewReader("\ufeff"+sample))
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if len(recs) != 2 || recs[0].Meta["seq"] != "1" || recs[0].Text != "hello" {
+		t.Fatalf("unexpected recs %+v", recs)
+	}
+}
+
+// TestSplitStream 逐条 emit 与 Split 结果一致；emit 错误立即终止并原样返回
+func TestSplitStream(t *testing.T) {
+	var got []contract.Record
+	err := New(nil).SplitStream(context.Background(), "a.srt", strings.NewReader(sample), func(r contract.Record) error {
+		got = append(got, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("split stream: %v", err)
+	}
+	want, _ := New(nil).Split(context.Background(), "a.srt", strings.NewReader(sample))
+	if len(got) != len(want) || got[1].Text != want[1].Text || got[1].Index != 1 {
+		t.Fatalf("unexpected recs %+v", got)
+	}
+	stop := errors.New("stop")
+	n := 0
+	err = New(nil).SplitStream(context.Background(), "a.srt", strings.NewReader(sample), func(contract.Record) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Fatalf("expect stop after first record, n=%d err=%v", n, err)
+	}
+}
+
+// TestSplitCheckMonotonic 时间轴单调性：相接不算重叠；重叠与块内倒置按 error 失败、按 warn 写入 Meta；默认不检查
+func TestSplitCheckMonotonic(t *testing.T) {
+	overlap := "1\n00:00:01,000 --> 00:00:03,000\na\n\n2\n00:00:02,500 --> 00:00:04,000\nb\n\n"
+	reversed := "1\n00:00:05,000 --> 00:00:04,000\na\n\n"
+	strict := New(&Options{CheckMonotonic: true})
+	if _, err := strict.Split(context.Background(), "a.srt", strings.NewReader(sample)); err != nil {
+		t.Fatalf("touching cues should pass: %v", err)
+	}
+	for _, in := range []string{overlap, reversed, "1\n00:61:00,000 --> 00:62:00,000\na\n\n"} {
+		if _, err := strict.Split(context.Background(), "a.srt", strings.NewReader(in)); err == nil {
+			t.Fatalf("expect timing error for %q", in)
+		}
+	}
+	if _, err := New(nil).Split(context.Background(), "a.srt", strings.NewReader(overlap)); err != nil {
+		t.Fatalf("default should not check: %v", err)
+	}
+
+	warn := New(&Options{CheckMonotonic: true, OnNonMonotonic: OnNonMonotonicWarn})
+	recs, err := warn.Split(context.Background(), "a.srt", strings.NewReader(overlap))
+	if err != nil || len(recs) != 2 {
+		t.Fatalf("warn split: %v %+v", err, recs)
+	}
+	if recs[0].Meta[MetaTimingWarning] != "" || recs[1].Meta[MetaTimingWarning] != "cue 2: start 00:00:02,500 precedes end 00:00:03,000 of cue 1" {
+		t.Fatalf("unexpected warnings %+v", recs)
+	}
+	recs, _ = warn.Split(context.Background(), "a.srt", strings.NewReader(reversed))
+	if recs[0].Meta[MetaTimingWarning] != "cue 1: end 00:00:04,000 precedes start 00:00:05,000" {
+		t.Fatalf("unexpected warning %+v", recs)
+	}
+	if err := (&Options{OnNonMonotonic: "ignore"}).Validate(); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+}
+
+// TestSplitFinalBlock 末块收尾：无换行结尾的多行文本、以文本行/空行/CRLF 结尾、单块文件结果一致；
+// 时间轴行即末行时为空文本块；序号行即末行报格式错误
+func TestSplitFinalBlock(t *testing.T) {
+	head := "1\n00:00:01,000 --> 00:00:02,000\nhello\n\n2\n00:00:02,000 --> 00:00:03,000\n"
+	for name, in := range map[string]string{
+		"no trailing newline": head + "line one\nline two",
+		"ends at text line":   head + "line one\nline two\n",
+		"ends at blank line":  head + "line one\nline two\n\n\n",
+		"crlf":                strings.ReplaceAll(head+"line one\nline two", "\n", "\r\n"),
+	} {
+		recs, err := New(nil).Split(context.Background(), "a.srt", strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(recs) != 2 || recs[1].Text != "line one\nline two" || recs[1].Meta["seq"] != "2" {
+			t.Fatalf("%s: unexpected recs %+v", name, recs)
+		}
+	}
+	for _, in := range []string{"1\n00:00:01,000 --> 00:00:02,000\nonly", "1\n00:00:01,000 --> 00:00:02,000\nonly\n", "\n\n1\n00:00:01,000 --> 00:00:02,000\nonly\n\n"} {
+		recs, err := New(nil).Split(context.Background(), "a.srt", strings.NewReader(in))
+		if err != nil || len(recs) != 1 || recs[0].Text != "only" || recs[0].Index != 0 {
+			t.Fatalf("single cue %q: %v %+v", in, err, recs)
+		}
+	}
+	recs, err := New(nil).Split(context.Background(), "a.srt", strings.NewReader(head[:len(head)-1]))
+	if err != nil || len(recs) != 2 || recs[1].Text != "" {
+		t.Fatalf("cue without text: %v %+v", err, recs)
+	}
+	if _, err := New(nil).Split(context.Background(), "a.srt", strings.NewReader("1\n00:00:01,000 --> 00:00:02,000\na\n\n2")); err == nil || !strings.Contains(err.Error(), "unexpected end of file") {
+		t.Fatalf("expect truncated cue error, got %v", err)
+	}
+	// 标签行为末行：整行剥离后块仍正常结束
+	recs, err = New(&Options{StripTags: true}).Split(context.Background(), "a.srt", strings.NewReader("1\n00:00:01,000 --> 00:00:02,000\nhi\n<i></i>"))
+	if err != nil || len(recs) != 1 || recs[0].Text != "hi" {
+		t.Fatalf("strip tags at EOF: %v %+v", err, recs)
+	}
+}
+
+// TestSplitTooLargeAtEOF MaxFragmentBytes 在末块无换行结尾时按拼接后的字节数（含行间 '\n'）计算
+func TestSplitTooLargeAtEOF(t *testing.T) {
+	in := "1\n00:00:01,000 --> 00:00:02,000\nabc\ndef"
+	recs, err := New(&Options{MaxFragmentBytes: 7}).Split(context.Background(), "a.srt", strings.NewReader(in))
+	if err != nil || len(recs) != 1 || recs[0].Text != "abc\ndef" {
+		t.Fatalf("exact limit: %v %+v", err, recs)
+	}
+	if _, err := New(&Options{MaxFragmentBytes: 6}).Split(context.Background(), "a.srt", strings.NewReader(in)); err == nil || !strings.Contains(err.Error(), "7 > 6") {
+		t.Fatalf("expect size error, got %v", err)
+	}
+	if _, err := New(&Options{MaxFragmentBytes: 6}).Split(context.Background(), "a.srt", strings.NewReader(in+"\n\n")); err == nil || !strings.Contains(err.Error(), "7 > 6") {
+		t.Fatalf("expect same size error with trailing blank line, got %v", err)
+	}
+}
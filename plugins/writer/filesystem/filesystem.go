@@ -2,11 +2,20 @@ package filesystem
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"llmspt/pkg/contract"
 )
@@ -26,6 +35,67 @@ type Options struct {
 	PermDir  os.FileMode `json:"perm_dir,omitempty"`
 	// BufSize: 写缓冲区大小；<=0 使用实现默认。
 	BufSize int `json:"buf_size,omitempty"`
+	// Route: 按源路径分流到输出子目录；按序匹配，首条命中生效，未命中则直接写到输出根。
+	Route []Route `json:"route,omitempty"`
+	// Fsync: 原子写的落盘策略（非原子写不做 fsync）：
+	//  - "always"（默认）: 每个文件 fsync 临时文件，rename 后 fsync 父目录；崩溃后已返回成功的工件均完整可见。
+	//  - "batch": 仍 fsync 文件内容，但父目录 fsync 延迟并按目录合并，每累计 FsyncBatchSize 次写出
+	//    或运行结束（Flush）时执行；崩溃时最近一批 rename 可能丢失（回退为旧文件或不存在），但不会出现半截文件。
+	//  - "none": 不做任何 fsync，完全依赖操作系统回写；崩溃后可能出现空文件或截断内容，仅适合可重跑的临时输出。
+	Fsync string `json:"fsync,omitempty"`
+	// FsyncBatchSize: batch 模式下触发目录同步的写出次数；<=0 使用默认 256。
+	FsyncBatchSize int `json:"fsync_batch_size,omitempty"`
+	// OnCollision: 扁平模式下不同源映射到同一输出文件名时的处理：
+	//  - "error"（默认）: 后到的源写出失败（ErrPathInvalid），避免静默覆盖；
+	//  - "parent": 后到的源改写到以其父目录名命名的子目录（如 b/a.srt），边车与 .meta 随之同路；
+	//    父目录名仍冲突时按 error 处理。
+	OnCollision string `json:"on_collision,omitempty"`
+	// WriteBOM: 在主工件开头写入 UTF-8 BOM（部分播放器依赖）；内容已带 BOM 时不重复添加。
+	// JSONL 边车（.jsonl）与源摘要（.meta）不受影响。
+	WriteBOM bool `json:"write_bom,omitempty"`
+	// EmitChecksum: 为每个工件（含 JSONL 边车，不含 .meta）写出校验文件 <artifact>.<算法>，
+	// 取值 "sha256" | "md5"，空表示关闭。摘要在写入时对实际落盘字节（含 BOM）流式计算，
+	// 内容为 "<hex>  <文件名>\n"（兼容 sha256sum/md5sum -c），于工件写出（或 rename）成功后写入。
+	EmitChecksum string `json:"emit_checksum,omitempty"`
+	// PartSuffix: 非原子写时先写入 <artifact><suffix>（如 ".part"），完整写出并关闭后重命名为目标名；
+	// 失败时删除该文件，读方不会在目标名下看到半截内容。不做 fsync（比原子写轻量，但不保证崩溃后内容落盘）。
+	// 需以 "." 开头且不含路径分隔符；原子写（Atomic=true）下忽略。写入矩阵：
+	//  - atomic=true：同目录隐藏临时文件 + fsync（按 Fsync 策略）+ rename；
+	//  - atomic=false 且 part_suffix 非空：<artifact><suffix> + rename，无 fsync；崩溃可能残留 <suffix> 文件；
+	//  - atomic=false 且 part_suffix 为空：原地截断覆盖，失败或崩溃可能留下部分内容。
+	// 例外：映射后的目标（Flat/Route 规则照常生效，须位于输出根内）为已存在的命名管道（FIFO）或字符设备时，
+	// 忽略上述策略直接写入该目标（如供 ffmpeg 读取的 mkfifo），且不写校验文件；边车与 .meta 仍按常规文件写出。
+	PartSuffix string `json:"part_suffix,omitempty"`
+}
+
+// 落盘策略。
+const (
+	FsyncAlways = "always"
+	FsyncBatch  = "batch"
+	FsyncNone   = "none"
+)
+
+const defaultFsyncBatchSize = 256
+
+// 校验文件算法。
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumMD5    = "md5"
+)
+
+// 扁平模式冲突处理策略。
+const (
+	CollisionError  = "error"
+	CollisionParent = "parent"
+)
+
+// Route: 单条分流规则。
+// Match 为 glob（path.Match 语法，'/' 分隔，'*' 不跨目录），与工件 ID 或其任一尾部子路径比较，
+// 因而 "movies/*" 同时命中 "movies/a.srt" 与 "/data/movies/a.srt"；以 "/**" 结尾时匹配任意深度。
+// Dest 为输出根下的相对子目录（禁止绝对路径与 ".." 逃逸）。
+type Route struct {
+	Match string `json:"match"`
+	Dest  string `json:"dest"`
 }
 
 type FS struct {
@@ -35,6 +105,19 @@ type FS struct {
 	permF   os.FileMode
 	permD   os.FileMode
 	bufSize int
+	routes  []Route
+	fsync   string
+	batchN  int
+	// 扁平模式：输出路径 → 首个占用它的源 ID（Clean 后），用于冲突检测
+	onCollision string
+	claims      map[string]string
+	bom         bool
+	checksum    string
+	part        string
+	// batch 模式：待同步的目录集合与自上次同步以来的写出次数
+	mu      sync.Mutex
+	dirty   map[string]struct{}
+	pending int
 }
 
 // New 创建文件系统 Writer 实现。
@@ -62,13 +145,141 @@ func New(opts *Options) (*FS, error) {
     if opts.Atomic != nil {
         atomic = *opts.Atomic
     }
-    return &FS{root: opts.OutputDir, atomic: atomic, flat: flat, permF: pf, permD: pd, bufSize: bsz}, nil
+    routes := make([]Route, 0, len(opts.Route))
+    for _, rt := range opts.Route {
+        pat := strings.TrimSuffix(rt.Match, "/**")
+        if _, err := path.Match(pat, ""); err != nil || strings.TrimSpace(rt.Match) == "" {
+            return nil, os.ErrInvalid
+        }
+        dest := filepath.Clean(filepath.FromSlash(rt.Dest))
+        if !isLocalRel(dest) {
+            return nil, os.ErrInvalid
+        }
+        routes = append(routes, Route{Match: rt.Match, Dest: dest})
+    }
+    fsync := strings.ToLower(strings.TrimSpace(opts.Fsync))
+    switch fsync {
+    case "":
+        fsync = FsyncAlways
+    case FsyncAlways, FsyncBatch, FsyncNone:
+    default:
+        return nil, os.ErrInvalid
+    }
+    batchN := opts.FsyncBatchSize
+    if batchN <= 0 {
+        batchN = defaultFsyncBatchSize
+    }
+    onCollision := strings.ToLower(strings.TrimSpace(opts.OnCollision))
+    switch onCollision {
+    case "":
+        onCollision = CollisionError
+    case CollisionError, CollisionParent:
+    default:
+        return nil, os.ErrInvalid
+    }
+    checksum := strings.ToLower(strings.TrimSpace(opts.EmitChecksum))
+    switch checksum {
+    case "", ChecksumSHA256, ChecksumMD5:
+    default:
+        return nil, os.ErrInvalid
+    }
+    part := strings.TrimSpace(opts.PartSuffix)
+    if part != "" && (!strings.HasPrefix(part, ".") || part == "." || strings.ContainsAny(part, `/\`)) {
+        return nil, os.ErrInvalid
+    }
+    w := &FS{root: opts.OutputDir, atomic: atomic, flat: flat, permF: pf, permD: pd, bufSize: bsz, routes: routes, fsync: fsync, batchN: batchN, onCollision: onCollision, bom: opts.WriteBOM, checksum: checksum, part: part}
+    if flat {
+        w.claims = make(map[string]string)
+    }
+    if fsync == FsyncBatch {
+        w.dirty = make(map[string]struct{})
+    }
+    return w, nil
 }
 
 var _ contract.Writer = (*FS)(nil)
+var _ contract.SourceHashStore = (*FS)(nil)
+var _ contract.Flusher = (*FS)(nil)
+
+var _ contract.PathResolver = (*FS)(nil)
+
+// ResolvePath 返回 id 映射后的绝对输出路径（与 Write 相同的路由/扁平/越界规则）；映射失败时 ok=false。
+// 只读查询：扁平模式下不登记路径归属，不影响后续 Write 的撞名判定。
+func (w *FS) ResolvePath(id contract.FileID) (string, bool) {
+	dest, err := w.lookupPath(id)
+	if err != nil {
+		return "", false
+	}
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return "", false
+	}
+	return abs, true
+}
+
+// sourceMeta: 工件旁路 .meta 文件内容。
+type sourceMeta struct {
+	SourceSHA256 string `json:"source_sha256"`
+}
+
+// LoadSourceHash 读取 <artifact>.meta 中记录的源内容摘要；工件或 .meta 缺失/损坏时返回 ok=false。
+func (w *FS) LoadSourceHash(ctx context.Context, id contract.ArtifactID) (string, bool, error) {
+	select {
+	case <-ctx.Done():
+		return "", false, ctx.Err()
+	default:
+	}
+	dest, err := w.mapPath(id)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := os.Stat(dest); err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	metaPath, err := w.mapPath(id + ".meta")
+	if err != nil {
+		return "", false, err
+	}
+	b, err := os.ReadFile(metaPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	var m sourceMeta
+	if json.Unmarshal(b, &m) != nil || m.SourceSHA256 == "" {
+		return "", false, nil
+	}
+	return m.SourceSHA256, true, nil
+}
+
+// SaveSourceHash 将源内容摘要写入 <artifact>.meta（沿用 Write 的原子/覆盖策略）。
+func (w *FS) SaveSourceHash(ctx context.Context, id contract.ArtifactID, hash string) error {
+	b, err := json.Marshal(sourceMeta{SourceSHA256: hash})
+	if err != nil {
+		return err
+	}
+	return w.put(ctx, id+".meta", bytes.NewReader(append(b, '\n')), false)
+}
 
 // Write 将 r 的全部字节写入到基于 id 映射的目标路径。
 func (w *FS) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	return w.put(ctx, id, r, w.bom)
+}
+
+var _ contract.SidecarWriter = (*FS)(nil)
+
+// WriteSidecar 与 Write 相同，但不写 BOM（边车为机器读取的 JSONL）。
+func (w *FS) WriteSidecar(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	return w.put(ctx, id, r, false)
+}
+
+// put 写出单个工件；bom 为 true 时在开头补 UTF-8 BOM。
+func (w *FS) put(ctx context.Context, id contract.ArtifactID, r io.Reader, bom bool) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -83,40 +294,201 @@ func (w *FS) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) err
 		return err
 	}
 
+	if bom {
+		r = withBOM(r)
+	}
+	// 目标为已存在的命名管道/字符设备：直接写入，不走临时文件与 rename，也不写校验文件
+	if special(dest) {
+		return w.writeDirect(ctx, dest, r)
+	}
+	var h hash.Hash
+	if w.checksum != "" && !strings.HasSuffix(string(id), ".meta") {
+		h = newHash(w.checksum)
+	}
+	if err := w.write(ctx, dest, r, h); err != nil {
+		return err
+	}
+	if h == nil {
+		return nil
+	}
+	// 工件已完整落盘后再写校验文件：存在校验文件即意味着对应工件写出成功
+	line := hex.EncodeToString(h.Sum(nil)) + "  " + filepath.Base(dest) + "\n"
+	return w.write(ctx, dest+"."+w.checksum, strings.NewReader(line), nil)
+}
+
+// write 按原子/覆盖策略写出；h 非 nil 时同步累计写入的字节。
+func (w *FS) write(ctx context.Context, dest string, r io.Reader, h hash.Hash) error {
 	if w.atomic {
-		return w.writeAtomic(ctx, dest, r)
+		return w.writeAtomic(ctx, dest, r, h)
+	}
+	if w.part != "" {
+		return w.writePart(ctx, dest, r, h)
 	}
-	return w.writeOverwrite(ctx, dest, r)
+	return w.writeOverwrite(ctx, dest, r, h)
 }
 
-// mapPath: Clean + Join + 越界校验。
+// newHash 按算法名构造摘要器（算法已在 New 中校验）。
+func newHash(algo string) hash.Hash {
+	if algo == ChecksumMD5 {
+		return md5.New()
+	}
+	return sha256.New()
+}
+
+// teeHash 返回同时写入 dst 与 h（非 nil 时）的 Writer。
+func teeHash(dst io.Writer, h hash.Hash) io.Writer {
+	if h == nil {
+		return dst
+	}
+	return io.MultiWriter(dst, h)
+}
+
+// utf8BOM: UTF-8 字节序标记。
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// withBOM 返回以 BOM 开头的 r；内容已带 BOM 时原样返回。
+func withBOM(r io.Reader) io.Reader {
+	br := bufio.NewReaderSize(r, 16)
+	if head, _ := br.Peek(len(utf8BOM)); bytes.Equal(head, utf8BOM) {
+		return br
+	}
+	return io.MultiReader(bytes.NewReader(utf8BOM), br)
+}
+
+// mapPath: 路由 + Clean + Join + 越界校验（校验作用于路由后的最终路径）；扁平模式下登记路径归属。
 func (w *FS) mapPath(id contract.ArtifactID) (string, error) {
+    return w.resolve(id, true)
+}
+
+// lookupPath: 与 mapPath 规则相同，但不登记归属（供只读查询）。
+func (w *FS) lookupPath(id contract.ArtifactID) (string, error) {
+    return w.resolve(id, false)
+}
+
+// resolve 实现 mapPath/lookupPath；commit 为 false 时扁平撞名判定只读 claims。
+func (w *FS) resolve(id contract.ArtifactID, commit bool) (string, error) {
+    root := w.root
+    if dest, ok := w.route(id); ok {
+        root = filepath.Join(w.root, dest)
+    }
     rel := filepath.Clean(string(id))
     // Flat 优先：若扁平化，则仅保留文件名并在此后校验名称合法
     if w.flat {
+        src := rel
         rel = filepath.Base(rel)
         if rel == "." || rel == ".." || rel == "" {
             return "", contract.ErrPathInvalid
         }
-        return filepath.Join(w.root, rel), nil
+        return w.claim(root, src, rel, commit)
     }
     // 非扁平：禁止绝对路径、父级逃逸、Windows 卷名
     if rel == "." || rel == "" {
         return "", contract.ErrPathInvalid
     }
-    if filepath.IsAbs(rel) {
+    if !isLocalRel(rel) {
         return "", contract.ErrPathInvalid
     }
-    if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
-        return "", contract.ErrPathInvalid
+    return filepath.Join(root, rel), nil
+}
+
+// claim 扁平模式下登记输出路径的归属源：同一源重复映射（重写、边车、.meta）直接复用；
+// 不同源撞名时按 onCollision 报错或改用父目录名子目录。commit 为 false 时只判定不登记。
+func (w *FS) claim(root, src, name string, commit bool) (string, error) {
+	dest := filepath.Join(root, name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	prev, taken := w.claims[dest]
+	if !taken || prev == src {
+		if commit {
+			w.claims[dest] = src
+		}
+		return dest, nil
+	}
+	if w.onCollision == CollisionParent {
+		parent := filepath.Base(filepath.Dir(src))
+		if parent != "." && parent != ".." && parent != string(filepath.Separator) && filepath.VolumeName(parent) == "" {
+			alt := filepath.Join(root, parent, name)
+			if owner, ok := w.claims[alt]; !ok || owner == src {
+				if commit {
+					w.claims[alt] = src
+				}
+				return alt, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: flat output %s of %s collides with %s", contract.ErrPathInvalid, name, src, prev)
+}
+
+// isLocalRel: 已 Clean 的相对路径，且不含卷名、不以 ".." 逃逸。
+func isLocalRel(rel string) bool {
+    if filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+        return false
     }
-    if vol := filepath.VolumeName(rel); vol != "" {
-        return "", contract.ErrPathInvalid
+    return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// route 返回首条命中规则的目标子目录。
+func (w *FS) route(id contract.ArtifactID) (string, bool) {
+    if len(w.routes) == 0 {
+        return "", false
+    }
+    p := path.Clean(filepath.ToSlash(string(id)))
+    for _, rt := range w.routes {
+        if routeMatch(rt.Match, p) {
+            return rt.Dest, true
+        }
     }
-    return filepath.Join(w.root, rel), nil
+    return "", false
 }
 
-func (w *FS) writeOverwrite(ctx context.Context, dest string, r io.Reader) error {
+// routeMatch: pattern 与 p 或其任一尾部子路径（按 '/' 边界）匹配即命中；"/**" 后缀匹配任意深度。
+func routeMatch(pattern, p string) bool {
+    deep := strings.HasSuffix(pattern, "/**")
+    pattern = strings.TrimSuffix(pattern, "/**")
+    n := strings.Count(pattern, "/") + 1
+    segs := strings.Split(strings.TrimPrefix(p, "/"), "/")
+    for i := range segs {
+        tail := segs[i:]
+        if deep {
+            // 前 n 段匹配模式，且其后至少还有一段
+            if len(tail) <= n {
+                continue
+            }
+            tail = tail[:n]
+        }
+        if ok, _ := path.Match(pattern, strings.Join(tail, "/")); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// special 报告 dest 是否为已存在的命名管道（FIFO）或字符设备（跟随符号链接，如指向 /dev/stdout 的链接）。
+func special(dest string) bool {
+	fi, err := os.Stat(dest)
+	return err == nil && fi.Mode()&(os.ModeNamedPipe|os.ModeCharDevice) != 0
+}
+
+// writeDirect 以只写方式打开非常规目标并顺序写入（不创建、不截断、不做 fsync）。
+// 打开 FIFO 会阻塞直至另一端有读者，期间无法响应 ctx 取消。
+func (w *FS) writeDirect(ctx context.Context, dest string, r io.Reader) error {
+	f, err := os.OpenFile(dest, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(f, w.bufSize)
+	if _, err := io.Copy(bw, readerWithCtx(ctx, r)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (w *FS) writeOverwrite(ctx context.Context, dest string, r io.Reader, h hash.Hash) error {
 	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, w.permF)
 	if err != nil {
 		return err
@@ -125,13 +497,42 @@ func (w *FS) writeOverwrite(ctx context.Context, dest string, r io.Reader) error
 	defer f.Close()
 
 	bw := bufio.NewWriterSize(f, w.bufSize)
-	if _, err := io.Copy(bw, readerWithCtx(ctx, r)); err != nil {
+	if _, err := io.Copy(teeHash(bw, h), readerWithCtx(ctx, r)); err != nil {
 		return err
 	}
 	return bw.Flush()
 }
 
-func (w *FS) writeAtomic(ctx context.Context, dest string, r io.Reader) error {
+// writePart 写入 dest+part 后重命名为 dest（不做 fsync）；任一步失败删除中间文件。
+func (w *FS) writePart(ctx context.Context, dest string, r io.Reader, h hash.Hash) error {
+	part := dest + w.part
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, w.permF)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(f, w.bufSize)
+	if _, err := io.Copy(teeHash(bw, h), readerWithCtx(ctx, r)); err != nil {
+		_ = f.Close()
+		_ = os.Remove(part)
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(part)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(part)
+		return err
+	}
+	if err := osReplace(part, dest); err != nil {
+		_ = os.Remove(part)
+		return err
+	}
+	return nil
+}
+
+func (w *FS) writeAtomic(ctx context.Context, dest string, r io.Reader, h hash.Hash) error {
     dir := filepath.Dir(dest)
     tmp, err := os.CreateTemp(dir, ".tmp-*")
     if err != nil {
@@ -142,7 +543,7 @@ func (w *FS) writeAtomic(ctx context.Context, dest string, r io.Reader) error {
     _ = os.Chmod(tmpPath, w.permF)
 
 	bw := bufio.NewWriterSize(tmp, w.bufSize)
-	if _, err := io.Copy(bw, readerWithCtx(ctx, r)); err != nil {
+	if _, err := io.Copy(teeHash(bw, h), readerWithCtx(ctx, r)); err != nil {
 		_ = bw.Flush()
 		_ = tmp.Close()
 		_ = os.Remove(tmpPath)
@@ -153,10 +554,12 @@ func (w *FS) writeAtomic(ctx context.Context, dest string, r io.Reader) error {
 		_ = os.Remove(tmpPath)
 		return err
 	}
-	if err := tmp.Sync(); err != nil {
-		_ = tmp.Close()
-		_ = os.Remove(tmpPath)
-		return err
+	if w.fsync != FsyncNone {
+		if err := tmp.Sync(); err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmpPath)
+			return err
+		}
 	}
     if err := tmp.Close(); err != nil {
         _ = os.Remove(tmpPath)
@@ -168,10 +571,103 @@ func (w *FS) writeAtomic(ctx context.Context, dest string, r io.Reader) error {
         return err
     }
     // 最佳努力：在部分平台同步父目录，提升崩溃安全性
-    _ = syncDir(dir)
+    switch w.fsync {
+    case FsyncAlways:
+        _ = syncDir(dir)
+    case FsyncBatch:
+        w.markDirty(dir)
+    }
     return nil
 }
 
+// markDirty 记录待同步目录；累计写出达到批大小时立即同步一轮。
+func (w *FS) markDirty(dir string) {
+	w.mu.Lock()
+	w.dirty[dir] = struct{}{}
+	w.pending++
+	full := w.pending >= w.batchN
+	w.mu.Unlock()
+	if full {
+		_ = w.syncDirty()
+	}
+}
+
+// syncDirty 同步并清空待同步目录集合（每个目录一次），返回首个错误。
+func (w *FS) syncDirty() error {
+	w.mu.Lock()
+	dirs := w.dirty
+	w.dirty = make(map[string]struct{})
+	w.pending = 0
+	w.mu.Unlock()
+	var first error
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Flush 同步 batch 模式下延迟的目录；其他模式为空操作。
+// 不检查 ctx：取消路径下也需完成已写出工件的落盘（编排层传入不随运行取消的 ctx）。
+func (w *FS) Flush(ctx context.Context) error {
+	if w.fsync != FsyncBatch {
+		return nil
+	}
+	return w.syncDirty()
+}
+
+var _ contract.Preflighter = (*FS)(nil)
+
+// Preflight 检查输出根目录及各分流子目录可写；目录尚不存在时检查最近的已存在祖先目录（Write 将按需创建）。
+func (w *FS) Preflight(ctx context.Context) error {
+	dirs := []string{w.root}
+	for _, rt := range w.routes {
+		dirs = append(dirs, filepath.Join(w.root, rt.Dest))
+	}
+	for _, dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := checkWritableDir(dir); err != nil {
+			return fmt.Errorf("fs writer: %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// checkWritableDir: 在 dir（或其最近的已存在祖先）中创建并删除临时文件/目录；路径上存在非目录时返回错误。
+func checkWritableDir(dir string) error {
+	probe := dir
+	for {
+		fi, err := os.Stat(probe)
+		if err == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("%s is not a directory", probe)
+			}
+			break
+		}
+		parent := filepath.Dir(probe)
+		if !os.IsNotExist(err) || parent == probe {
+			return err
+		}
+		probe = parent
+	}
+	if probe == dir {
+		f, err := os.CreateTemp(dir, ".llmspt-preflight-*")
+		if err != nil {
+			return err
+		}
+		_ = f.Close()
+		return os.Remove(f.Name())
+	}
+	tmp, err := os.MkdirTemp(probe, ".llmspt-preflight-*")
+	if err != nil {
+		return err
+	}
+	return os.Remove(tmp)
+}
+
 // readerWithCtx: 在每次 Read 前检查 ctx 是否已取消。
 func readerWithCtx(ctx context.Context, r io.Reader) io.Reader {
 	return &ctxReader{ctx: ctx, r: r}
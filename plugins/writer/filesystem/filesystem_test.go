@@ -3,7 +3,11 @@ package filesystem
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -143,3 +147,324 @@ func TestReaderWithCtxCancel(t *testing.T) {
 		t.Fatalf("expect ctx error")
 	}
 }
+
+// TestSourceHashRoundTrip 源摘要写入 .meta 并可读回；工件缺失时视为无记录
+func TestSourceHashRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	w, err := New(&Options{OutputDir: dir})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ctx := context.Background()
+	if _, ok, err := w.LoadSourceHash(ctx, "a.srt"); ok || err != nil {
+		t.Fatalf("expect no hash before write: %v %v", ok, err)
+	}
+	if err := w.SaveSourceHash(ctx, "a.srt", "abc"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if _, ok, _ := w.LoadSourceHash(ctx, "a.srt"); ok {
+		t.Fatalf("expect no hash while artifact missing")
+	}
+	if err := w.Write(ctx, "a.srt", strings.NewReader("x")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if h, ok, err := w.LoadSourceHash(ctx, "a.srt"); !ok || err != nil || h != "abc" {
+		t.Fatalf("load: %q %v %v", h, ok, err)
+	}
+}
+
+// TestRoute 按源路径分流到子目录；首条命中生效，未命中写到根
+func TestRoute(t *testing.T) {
+	dir := t.TempDir()
+	w, err := New(&Options{OutputDir: dir, Route: []Route{
+		{Match: "movies/**", Dest: "film"},
+		{Match: "tv/*", Dest: "series/tv"},
+	}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	cases := map[contract.ArtifactID]string{
+		"/data/movies/x/a.srt": filepath.Join(dir, "film", "a.srt"),
+		"tv/a.srt":             filepath.Join(dir, "series", "tv", "a.srt"),
+		"tv/s1/a.srt":          filepath.Join(dir, "a.srt"),
+		"other/b.srt":          filepath.Join(dir, "b.srt"),
+	}
+	for id, want := range cases {
+		if got, err := w.mapPath(id); err != nil || got != want {
+			t.Fatalf("%s: got %q %v, want %q", id, got, err, want)
+		}
+	}
+	// 非扁平：路由后仍保留相对路径并执行越界校验
+	nf := false
+	w, _ = New(&Options{OutputDir: dir, Flat: &nf, Route: []Route{{Match: "tv/**", Dest: "series"}}})
+	if got, _ := w.mapPath("tv/s1/a.srt"); got != filepath.Join(dir, "series", "tv", "s1", "a.srt") {
+		t.Fatalf("unexpected non-flat route: %q", got)
+	}
+	if _, err := w.mapPath("tv/../../x.srt"); !errors.Is(err, contract.ErrPathInvalid) {
+		t.Fatalf("expect ErrPathInvalid, got %v", err)
+	}
+}
+
+// TestResolvePath 解析结果与 Write 的映射一致（绝对路径）；越界时 ok=false
+func TestResolvePath(t *testing.T) {
+	dir := t.TempDir()
+	w, err := New(&Options{OutputDir: dir, Route: []Route{{Match: "tv/**", Dest: "series"}}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	got, ok := w.ResolvePath("tv/s1/a.srt")
+	if want := filepath.Join(dir, "series", "a.srt"); !ok || got != want || !filepath.IsAbs(got) {
+		t.Fatalf("got %q %v, want %q", got, ok, want)
+	}
+	nf := false
+	w, _ = New(&Options{OutputDir: dir, Flat: &nf})
+	if _, ok := w.ResolvePath("../x.srt"); ok {
+		t.Fatal("越界路径应不可解析")
+	}
+}
+
+// TestResolvePathNoClaim 扁平模式下 ResolvePath 只读：不登记归属，不改变后续 Write 的撞名判定
+func TestResolvePathNoClaim(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	w, err := New(&Options{OutputDir: dir})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if p, ok := w.ResolvePath("x/a.srt"); !ok || p != filepath.Join(dir, "a.srt") {
+		t.Fatalf("resolve: %q %v", p, ok)
+	}
+	if err := w.Write(ctx, "y/a.srt", strings.NewReader("y")); err != nil {
+		t.Fatalf("write after resolve must not collide: %v", err)
+	}
+	if _, ok := w.ResolvePath("x/a.srt"); ok {
+		t.Fatal("resolve of a colliding id should fail")
+	}
+	if err := w.Write(ctx, "x/a.srt", strings.NewReader("x")); !errors.Is(err, contract.ErrPathInvalid) {
+		t.Fatalf("expect ErrPathInvalid, got %v", err)
+	}
+}
+
+// TestRouteInvalid 非法 glob 或越界目标目录
+func TestRouteInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for _, rt := range []Route{{Match: "[", Dest: "a"}, {Match: "a/*", Dest: "../x"}, {Match: "a/*", Dest: "/abs"}, {Match: "", Dest: "a"}} {
+		if _, err := New(&Options{OutputDir: dir, Route: []Route{rt}}); !errors.Is(err, os.ErrInvalid) {
+			t.Fatalf("expect ErrInvalid for %+v, got %v", rt, err)
+		}
+	}
+}
+
+// TestWriteFsyncModes 非法策略被拒绝；batch 模式按批大小合并目录同步，Flush 清空待同步集合
+func TestWriteFsyncModes(t *testing.T) {
+	if _, err := New(&Options{OutputDir: t.TempDir(), Fsync: "sometimes"}); err == nil {
+		t.Fatalf("expect error for unknown fsync mode")
+	}
+	dir := t.TempDir()
+	w, err := New(&Options{OutputDir: dir, Fsync: FsyncBatch, FsyncBatchSize: 2})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ctx := context.Background()
+	for _, id := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := w.Write(ctx, contract.ArtifactID(id), strings.NewReader(id)); err != nil {
+			t.Fatalf("write %s: %v", id, err)
+		}
+	}
+	if w.pending != 1 || len(w.dirty) != 1 {
+		t.Fatalf("expect one pending write after batch sync, got pending=%d dirty=%d", w.pending, len(w.dirty))
+	}
+	if err := w.Flush(ctx); err != nil || w.pending != 0 || len(w.dirty) != 0 {
+		t.Fatalf("flush: err=%v pending=%d dirty=%d", err, w.pending, len(w.dirty))
+	}
+	for _, mode := range []string{FsyncAlways, FsyncNone} {
+		w, _ := New(&Options{OutputDir: dir, Fsync: mode})
+		if err := w.Write(ctx, "d.txt", strings.NewReader(mode)); err != nil {
+			t.Fatalf("%s write: %v", mode, err)
+		}
+		if b, _ := os.ReadFile(filepath.Join(dir, "d.txt")); string(b) != mode {
+			t.Fatalf("%s: unexpected content %q", mode, b)
+		}
+	}
+}
+
+// TestFlatCollision 扁平模式下不同源撞名：默认报错；parent 策略改写到父目录名子目录；同源重写与不同名不受影响
+func TestFlatCollision(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	w, err := New(&Options{OutputDir: dir})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	for _, id := range []contract.ArtifactID{"x/a.srt", "x/a.srt", "x/a.srt.jsonl", "y/b.srt"} {
+		if err := w.Write(ctx, id, strings.NewReader(string(id))); err != nil {
+			t.Fatalf("no collision %s: %v", id, err)
+		}
+	}
+	if err := w.Write(ctx, "y/a.srt", strings.NewReader("y")); !errors.Is(err, contract.ErrPathInvalid) {
+		t.Fatalf("expect ErrPathInvalid, got %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "a.srt")); string(b) != "x/a.srt" {
+		t.Fatalf("first output overwritten: %q", b)
+	}
+
+	dir = t.TempDir()
+	w, _ = New(&Options{OutputDir: dir, OnCollision: CollisionParent})
+	for _, id := range []contract.ArtifactID{"x/a.srt", "x/a.srt.jsonl", "y/a.srt", "y/a.srt.jsonl"} {
+		if err := w.Write(ctx, id, strings.NewReader(string(id))); err != nil {
+			t.Fatalf("write %s: %v", id, err)
+		}
+	}
+	for name, want := range map[string]string{"a.srt": "x/a.srt", "a.srt.jsonl": "x/a.srt.jsonl", "y/a.srt": "y/a.srt", "y/a.srt.jsonl": "y/a.srt.jsonl"} {
+		if b, _ := os.ReadFile(filepath.Join(dir, name)); string(b) != want {
+			t.Fatalf("%s = %q, want %q", name, b, want)
+		}
+	}
+	if err := w.Write(ctx, "z/y/a.srt", strings.NewReader("z")); !errors.Is(err, contract.ErrPathInvalid) {
+		t.Fatalf("parent collision: expect ErrPathInvalid, got %v", err)
+	}
+	if _, err := New(&Options{OutputDir: dir, OnCollision: "rename"}); !errors.Is(err, os.ErrInvalid) {
+		t.Fatalf("expect ErrInvalid for unknown on_collision, got %v", err)
+	}
+}
+
+// TestWriteBOM 开启 write_bom 时主工件带 BOM（不重复添加）；边车（任意扩展名，经 WriteSidecar）与 .meta 不带
+func TestWriteBOM(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	w, err := New(&Options{OutputDir: dir, WriteBOM: true})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	inputs := map[contract.ArtifactID]string{"a.srt": "x", "b.srt": "\ufeffy"}
+	for id, s := range inputs {
+		if err := w.Write(ctx, id, strings.NewReader(s)); err != nil {
+			t.Fatalf("write %s: %v", id, err)
+		}
+	}
+	for _, id := range []contract.ArtifactID{"a.srt.jsonl", "a.srt.qa"} {
+		if err := w.WriteSidecar(ctx, id, strings.NewReader("{}")); err != nil {
+			t.Fatalf("write sidecar %s: %v", id, err)
+		}
+	}
+	if err := w.SaveSourceHash(ctx, "a.srt", "h"); err != nil {
+		t.Fatalf("save hash: %v", err)
+	}
+	for name, want := range map[string]string{"a.srt": "\ufeffx", "b.srt": "\ufeffy", "a.srt.jsonl": "{}", "a.srt.qa": "{}"} {
+		if b, _ := os.ReadFile(filepath.Join(dir, name)); string(b) != want {
+			t.Fatalf("%s = %q, want %q", name, b, want)
+		}
+	}
+	if h, ok, err := w.LoadSourceHash(ctx, "a.srt"); err != nil || !ok || h != "h" {
+		t.Fatalf("meta must stay parseable: %q %v %v", h, ok, err)
+	}
+}
+
+// TestEmitChecksum 校验文件与实际落盘字节（含 BOM）一致；原子与覆盖路径均生效，.meta 不生成校验文件
+func TestEmitChecksum(t *testing.T) {
+	ctx := context.Background()
+	sum := map[string]func([]byte) string{
+		ChecksumSHA256: func(b []byte) string { s := sha256.Sum256(b); return hex.EncodeToString(s[:]) },
+		ChecksumMD5:    func(b []byte) string { s := md5.Sum(b); return hex.EncodeToString(s[:]) },
+	}
+	for _, atomic := range []bool{true, false} {
+		for algo, fn := range sum {
+			dir := t.TempDir()
+			a := atomic
+			w, err := New(&Options{OutputDir: dir, Atomic: &a, WriteBOM: true, EmitChecksum: strings.ToUpper(algo)})
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			for _, s := range []string{"old", "new content"} {
+				if err := w.Write(ctx, "sub/a.srt", strings.NewReader(s)); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+			}
+			if err := w.SaveSourceHash(ctx, "sub/a.srt", "h"); err != nil {
+				t.Fatalf("save hash: %v", err)
+			}
+			b, _ := os.ReadFile(filepath.Join(dir, "a.srt"))
+			got, err := os.ReadFile(filepath.Join(dir, "a.srt."+algo))
+			if err != nil {
+				t.Fatalf("atomic=%v %s: %v", atomic, algo, err)
+			}
+			if want := fn(b) + "  a.srt\n"; string(got) != want {
+				t.Fatalf("atomic=%v %s: checksum %q, want %q", atomic, algo, got, want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "a.srt.meta."+algo)); !os.IsNotExist(err) {
+				t.Fatalf("unexpected checksum for .meta: %v", err)
+			}
+		}
+	}
+	if _, err := New(&Options{OutputDir: t.TempDir(), EmitChecksum: "crc32"}); err == nil {
+		t.Fatalf("expect invalid algorithm error")
+	}
+}
+
+// TestWritePartSuffix 非原子 .part 写：成功后仅见目标文件；拷贝失败不留下可见输出且保留旧内容；
+// 对照：无 part_suffix 的覆盖写失败会留下半截文件
+func TestWritePartSuffix(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a := false
+	w, err := New(&Options{OutputDir: dir, Atomic: &a, PartSuffix: ".part"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if err := w.Write(ctx, "a.srt", strings.NewReader("v1")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Write(ctx, "b.srt", io.MultiReader(strings.NewReader("partial"), errReader{})); err == nil {
+		t.Fatalf("expect copy error")
+	}
+	if err := w.Write(ctx, "a.srt", io.MultiReader(strings.NewReader("partial"), errReader{})); err == nil {
+		t.Fatalf("expect copy error")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "a.srt" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "a.srt")); string(b) != "v1" {
+		t.Fatalf("previous content lost: %q", b)
+	}
+
+	plain := t.TempDir()
+	w, _ = New(&Options{OutputDir: plain, Atomic: &a})
+	_ = w.Write(ctx, "b.srt", io.MultiReader(strings.NewReader("partial"), errReader{}))
+	if _, err := os.Stat(filepath.Join(plain, "b.srt")); err != nil {
+		t.Fatalf("plain overwrite expected to leave partial output: %v", err)
+	}
+
+	for _, bad := range []string{"part", ".", "./x", `.a\b`} {
+		if _, err := New(&Options{OutputDir: dir, PartSuffix: bad}); err == nil {
+			t.Fatalf("expect suffix %q rejected", bad)
+		}
+	}
+}
+
+// TestPreflight 已存在目录与尚不存在的嵌套目录（含路由子目录）可写且不残留探测文件；路径上存在普通文件时报错
+func TestPreflight(t *testing.T) {
+	dir := t.TempDir()
+	for _, out := range []string{dir, filepath.Join(dir, "new", "nested")} {
+		w, err := New(&Options{OutputDir: out, Route: []Route{{Match: "tv/**", Dest: "series/tv"}}})
+		if err != nil {
+			t.Fatalf("new: %v", err)
+		}
+		if err := w.Preflight(context.Background()); err != nil {
+			t.Fatalf("%s: preflight: %v", out, err)
+		}
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 0 {
+		t.Fatalf("preflight left entries: %v", ents)
+	}
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, out := range []string{file, filepath.Join(file, "sub")} {
+		w, _ := New(&Options{OutputDir: out})
+		if err := w.Preflight(context.Background()); err == nil {
+			t.Fatalf("%s: expect preflight error", out)
+		}
+	}
+}
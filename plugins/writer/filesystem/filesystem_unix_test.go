@@ -3,6 +3,11 @@
 package filesystem
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 
 	"llmspt/pkg/contract"
@@ -19,4 +24,66 @@ func TestMapPathInvalidUnix(t *testing.T) {
 			t.Fatalf("id %s expect invalid", id)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// TestWriteFIFO 目标为已存在的 FIFO 时绕过原子写直接写入 (Unix only - uses mkfifo)：
+// 扁平与非扁平映射均定位到输出根内的 FIFO，写后仍为 FIFO、不残留临时文件、不写校验文件
+func TestWriteFIFO(t *testing.T) {
+	for _, flat := range []bool{true, false} {
+		dir := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(dir, "a"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		id, fifo := "src/a/out.srt", filepath.Join(dir, "out.srt")
+		if !flat {
+			id, fifo = "a/out.srt", filepath.Join(dir, "a", "out.srt")
+		}
+		if err := syscall.Mkfifo(fifo, 0o644); err != nil {
+			t.Fatalf("mkfifo: %v", err)
+		}
+		f := flat
+		w, err := New(&Options{OutputDir: dir, Flat: &f, EmitChecksum: ChecksumSHA256})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(chan string, 1)
+		go func() {
+			b, _ := os.ReadFile(fifo)
+			got <- string(b)
+		}()
+		if err := w.Write(context.Background(), contract.ArtifactID(id), strings.NewReader("hello")); err != nil {
+			t.Fatalf("flat=%v write: %v", flat, err)
+		}
+		if s := <-got; s != "hello" {
+			t.Fatalf("flat=%v read %q", flat, s)
+		}
+		fi, err := os.Stat(fifo)
+		if err != nil || fi.Mode()&os.ModeNamedPipe == 0 {
+			t.Fatalf("flat=%v fifo replaced: %v %v", flat, fi, err)
+		}
+		entries, _ := os.ReadDir(filepath.Dir(fifo))
+		for _, e := range entries {
+			if e.Name() != "out.srt" && e.Name() != "a" {
+				t.Fatalf("flat=%v unexpected file %s", flat, e.Name())
+			}
+		}
+	}
+}
+
+// TestPreflightReadOnly 只读目录（及其下尚不存在的子目录）预检失败（root 忽略权限位，跳过）
+func TestPreflightReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root bypasses permission bits")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0o755)
+	for _, out := range []string{dir, filepath.Join(dir, "new")} {
+		w, _ := New(&Options{OutputDir: out})
+		if err := w.Preflight(context.Background()); err == nil {
+			t.Fatalf("%s: expect preflight error", out)
+		}
+	}
+}
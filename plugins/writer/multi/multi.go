@@ -0,0 +1,214 @@
+package multi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"llmspt/pkg/contract"
+)
+
+// Options: 子 Writer 列表（按注册名 + 原样 Options 构造）。
+type Options struct {
+	Writers []Child `json:"writers"`
+}
+
+// Child: 单个子 Writer 的注册名与选项。
+type Child struct {
+	Name    string          `json:"name"`
+	Options json.RawMessage `json:"options"`
+}
+
+// Factory: 按注册名构造子 Writer（由注册表注入，避免 plugins → registry 的循环依赖）。
+type Factory func(name string, raw json.RawMessage) (contract.Writer, error)
+
+// Writer: 扇出 Writer，将同一工件写到全部子 Writer。
+//
+// 分流策略：每个子 Writer 在独立 goroutine 中读取各自的 io.Pipe；主协程通过 io.MultiWriter
+// 把源一次性流式复制到全部管道，不整体缓冲。管道无缓冲，最慢的子 Writer 决定整体速度。
+// 任一子 Writer 失败（或未读完即返回）时其管道以错误关闭，复制随之中止，
+// 其余子 Writer 读到 ErrTeeAborted；最终返回失败子 Writer 的错误（多个时合并）。
+// 注意：已成功提交的子 Writer 不做回滚，各后端的原子性由其自身保证。
+type Writer struct {
+	names    []string
+	children []contract.Writer
+}
+
+// ErrTeeAborted: 因兄弟子 Writer 失败或源读取失败而中止分流时，传给其余子 Writer 的错误。
+var ErrTeeAborted = errors.New("multi: tee aborted")
+
+// errStopped: 子 Writer 未读完输入即成功返回（视为失败，避免各后端内容不一致）。
+var errStopped = errors.New("multi: child returned before consuming input")
+
+// New 按 Options 依次构造子 Writer；列表为空或名称缺失时返回 ErrInvalidInput。
+func New(opts *Options, build Factory) (*Writer, error) {
+	if opts == nil || len(opts.Writers) == 0 || build == nil {
+		return nil, fmt.Errorf("multi: writers empty: %w", contract.ErrInvalidInput)
+	}
+	w := &Writer{}
+	for i, c := range opts.Writers {
+		name := strings.TrimSpace(c.Name)
+		if name == "" {
+			return nil, fmt.Errorf("multi: writers[%d] missing name: %w", i, contract.ErrInvalidInput)
+		}
+		cw, err := build(name, c.Options)
+		if err != nil {
+			return nil, fmt.Errorf("multi: writers[%d] %s: %w", i, name, err)
+		}
+		w.names = append(w.names, name)
+		w.children = append(w.children, cw)
+	}
+	return w, nil
+}
+
+var _ contract.Writer = (*Writer)(nil)
+var _ contract.SourceHashStore = (*Writer)(nil)
+
+// Write 将 r 同时写入全部子 Writer；任一失败即整体失败。
+func (w *Writer) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	return w.tee(ctx, id, r, false)
+}
+
+var _ contract.SidecarWriter = (*Writer)(nil)
+
+// WriteSidecar 同 Write，但对实现 contract.SidecarWriter 的子 Writer 调用其 WriteSidecar。
+func (w *Writer) WriteSidecar(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	return w.tee(ctx, id, r, true)
+}
+
+// childWrite 返回子 Writer 的写入函数；sidecar 为 true 时优先使用 WriteSidecar。
+func childWrite(c contract.Writer, sidecar bool) func(context.Context, contract.ArtifactID, io.Reader) error {
+	if sw, ok := c.(contract.SidecarWriter); ok && sidecar {
+		return sw.WriteSidecar
+	}
+	return c.Write
+}
+
+// tee 将 r 扇出到全部子 Writer。
+func (w *Writer) tee(ctx context.Context, id contract.ArtifactID, r io.Reader, sidecar bool) error {
+	if len(w.children) == 1 {
+		return childWrite(w.children[0], sidecar)(ctx, id, r)
+	}
+	pws := make([]*io.PipeWriter, len(w.children))
+	dsts := make([]io.Writer, len(w.children))
+	errs := make([]error, len(w.children))
+	var wg sync.WaitGroup
+	for i, c := range w.children {
+		pr, pw := io.Pipe()
+		pws[i], dsts[i] = pw, pw
+		wg.Add(1)
+		go func(i int, c contract.Writer, pr *io.PipeReader) {
+			defer wg.Done()
+			err := childWrite(c, sidecar)(ctx, id, pr)
+			errs[i] = err
+			if err == nil {
+				err = errStopped
+			}
+			// 解除主协程在该管道上的阻塞；已读完时无影响
+			pr.CloseWithError(err)
+		}(i, c, pr)
+	}
+	_, cerr := io.Copy(io.MultiWriter(dsts...), r)
+	for _, pw := range pws {
+		if cerr != nil {
+			pw.CloseWithError(fmt.Errorf("%w: %v", ErrTeeAborted, cerr))
+		} else {
+			pw.Close()
+		}
+	}
+	wg.Wait()
+
+	var failed []error
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, ErrTeeAborted) {
+			failed = append(failed, fmt.Errorf("multi: writer %s: %w", w.names[i], err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Join(failed...)
+	}
+	if cerr != nil {
+		return fmt.Errorf("multi: tee: %w", cerr)
+	}
+	return nil
+}
+
+// LoadSourceHash 仅当所有支持摘要的子 Writer 均记录了相同摘要时返回 ok=true；
+// 无子 Writer 支持摘要时始终 ok=false（即不跳过）。
+func (w *Writer) LoadSourceHash(ctx context.Context, id contract.ArtifactID) (string, bool, error) {
+	hash, seen := "", false
+	for _, c := range w.children {
+		st, ok := c.(contract.SourceHashStore)
+		if !ok {
+			continue
+		}
+		h, ok, err := st.LoadSourceHash(ctx, id)
+		if err != nil || !ok {
+			return "", false, err
+		}
+		if seen && h != hash {
+			return "", false, nil
+		}
+		hash, seen = h, true
+	}
+	return hash, seen, nil
+}
+
+// SaveSourceHash 写入全部支持摘要的子 Writer。
+func (w *Writer) SaveSourceHash(ctx context.Context, id contract.ArtifactID, hash string) error {
+	for i, c := range w.children {
+		if st, ok := c.(contract.SourceHashStore); ok {
+			if err := st.SaveSourceHash(ctx, id, hash); err != nil {
+				return fmt.Errorf("multi: writer %s: %w", w.names[i], err)
+			}
+		}
+	}
+	return nil
+}
+
+var _ contract.PathResolver = (*Writer)(nil)
+
+// ResolvePath 返回首个可解析该 id 的子 Writer 的路径（按配置顺序）。
+func (w *Writer) ResolvePath(id contract.FileID) (string, bool) {
+	for _, c := range w.children {
+		if pr, ok := c.(contract.PathResolver); ok {
+			if p, ok := pr.ResolvePath(id); ok {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+var _ contract.Flusher = (*Writer)(nil)
+
+// Flush 转发给全部支持 Flusher 的子 Writer（不因单个失败而中止），返回首个错误。
+func (w *Writer) Flush(ctx context.Context) error {
+	var first error
+	for i, c := range w.children {
+		if f, ok := c.(contract.Flusher); ok {
+			if err := f.Flush(ctx); err != nil && first == nil {
+				first = fmt.Errorf("multi: writer %s: %w", w.names[i], err)
+			}
+		}
+	}
+	return first
+}
+
+var _ contract.Preflighter = (*Writer)(nil)
+
+// Preflight 依次转发给全部支持 Preflighter 的子 Writer，返回首个错误。
+func (w *Writer) Preflight(ctx context.Context) error {
+	for i, c := range w.children {
+		if pf, ok := c.(contract.Preflighter); ok {
+			if err := pf.Preflight(ctx); err != nil {
+				return fmt.Errorf("multi: writer %s: %w", w.names[i], err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package multi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"llmspt/pkg/contract"
+)
+
+// memWriter: 内存子 Writer；fail 非空时读取部分数据后失败。
+type memWriter struct {
+	out    bytes.Buffer
+	fail   error
+	hashes map[contract.ArtifactID]string
+	// 预检：返回 pre，并计数调用次数
+	pre     error
+	checked int
+}
+
+func (m *memWriter) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	if m.fail != nil {
+		_, _ = io.CopyN(io.Discard, r, 1)
+		return m.fail
+	}
+	_, err := io.Copy(&m.out, r)
+	return err
+}
+
+func (m *memWriter) LoadSourceHash(ctx context.Context, id contract.ArtifactID) (string, bool, error) {
+	h, ok := m.hashes[id]
+	return h, ok, nil
+}
+
+func (m *memWriter) SaveSourceHash(ctx context.Context, id contract.ArtifactID, hash string) error {
+	m.hashes[id] = hash
+	return nil
+}
+
+func (m *memWriter) Preflight(ctx context.Context) error {
+	m.checked++
+	return m.pre
+}
+
+func newMulti(t *testing.T, kids ...*memWriter) *Writer {
+	t.Helper()
+	opts := &Options{}
+	for range kids {
+		opts.Writers = append(opts.Writers, Child{Name: "mem"})
+	}
+	i := 0
+	w, err := New(opts, func(name string, raw json.RawMessage) (contract.Writer, error) {
+		i++
+		return kids[i-1], nil
+	})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	return w
+}
+
+// TestWriteFanOut 大于管道缓冲的内容完整写入全部子 Writer
+func TestWriteFanOut(t *testing.T) {
+	a, b := &memWriter{}, &memWriter{}
+	w := newMulti(t, a, b)
+	src := strings.Repeat("字幕\n", 100000)
+	if err := w.Write(context.Background(), "a.srt", strings.NewReader(src)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if a.out.String() != src || b.out.String() != src {
+		t.Fatalf("content mismatch: %d/%d", a.out.Len(), b.out.Len())
+	}
+}
+
+// sideWriter: 实现 contract.SidecarWriter 的内存子 Writer，记录边车写入次数。
+type sideWriter struct {
+	memWriter
+	sides int
+}
+
+func (s *sideWriter) WriteSidecar(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	s.sides++
+	return s.Write(ctx, id, r)
+}
+
+// TestWriteSidecar 边车写入转发给实现 SidecarWriter 的子 Writer，其余子 Writer 回退为 Write
+func TestWriteSidecar(t *testing.T) {
+	a, b := &sideWriter{}, &memWriter{}
+	w, err := New(&Options{Writers: []Child{{Name: "side"}, {Name: "mem"}}}, func(name string, raw json.RawMessage) (contract.Writer, error) {
+		if name == "side" {
+			return a, nil
+		}
+		return b, nil
+	})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if err := w.WriteSidecar(context.Background(), "a.srt.qa", strings.NewReader("{}")); err != nil {
+		t.Fatalf("write sidecar: %v", err)
+	}
+	if err := w.Write(context.Background(), "a.srt", strings.NewReader("x")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if a.sides != 1 || a.out.String() != "{}x" || b.out.String() != "{}x" {
+		t.Fatalf("sides=%d a=%q b=%q", a.sides, a.out.String(), b.out.String())
+	}
+}
+
+// TestWriteChildFailure 子 Writer 失败时传播其错误，兄弟收到中止
+func TestWriteChildFailure(t *testing.T) {
+	boom := errors.New("boom")
+	a, b := &memWriter{}, &memWriter{fail: boom}
+	w := newMulti(t, a, b)
+	err := w.Write(context.Background(), "a.srt", strings.NewReader(strings.Repeat("x", 1<<20)))
+	if !errors.Is(err, boom) || errors.Is(err, ErrTeeAborted) {
+		t.Fatalf("expect only child error, got %v", err)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) { return 0, io.ErrUnexpectedEOF }
+
+// TestWriteSourceFailure 源读取失败时整体失败
+func TestWriteSourceFailure(t *testing.T) {
+	w := newMulti(t, &memWriter{}, &memWriter{})
+	if err := w.Write(context.Background(), "a.srt", errReader{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect source error, got %v", err)
+	}
+}
+
+// TestSourceHash 摘要仅在所有子 Writer 一致时命中
+func TestSourceHash(t *testing.T) {
+	a := &memWriter{hashes: map[contract.ArtifactID]string{}}
+	b := &memWriter{hashes: map[contract.ArtifactID]string{}}
+	w := newMulti(t, a, b)
+	ctx := context.Background()
+	if err := w.SaveSourceHash(ctx, "a.srt", "h1"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if h, ok, _ := w.LoadSourceHash(ctx, "a.srt"); !ok || h != "h1" {
+		t.Fatalf("load: %q %v", h, ok)
+	}
+	b.hashes["a.srt"] = "h2"
+	if _, ok, _ := w.LoadSourceHash(ctx, "a.srt"); ok {
+		t.Fatalf("mismatched hashes must not hit")
+	}
+}
+
+// TestNewInvalid 空列表或缺少名称
+func TestNewInvalid(t *testing.T) {
+	build := func(string, json.RawMessage) (contract.Writer, error) { return &memWriter{}, nil }
+	if _, err := New(&Options{}, build); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+	if _, err := New(&Options{Writers: []Child{{Name: " "}}}, build); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect ErrInvalidInput, got %v", err)
+	}
+}
+
+// TestPreflight 转发给全部子 Writer；子 Writer 失败时带名称返回并不再检查后续子 Writer
+func TestPreflight(t *testing.T) {
+	a, b := &memWriter{}, &memWriter{}
+	w := newMulti(t, a, b)
+	if err := w.Preflight(context.Background()); err != nil || a.checked != 1 || b.checked != 1 {
+		t.Fatalf("preflight: %v (checked %d/%d)", err, a.checked, b.checked)
+	}
+	a.pre = errors.New("read-only")
+	err := w.Preflight(context.Background())
+	if !errors.Is(err, a.pre) || !strings.Contains(err.Error(), "writer mem") || b.checked != 1 {
+		t.Fatalf("expect wrapped child error, got %v (b checked %d)", err, b.checked)
+	}
+}
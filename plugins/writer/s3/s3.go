@@ -0,0 +1,280 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+
+	"llmspt/pkg/contract"
+)
+
+// Options: S3（及 S3 兼容存储，如 MinIO）Writer 的最小必要选项。
+type Options struct {
+	// Bucket: 目标桶（必需）。
+	Bucket string `json:"bucket"`
+	// Prefix: 对象键前缀（可选），例如 "subs/out"；首尾斜杠忽略。
+	Prefix string `json:"prefix"`
+	// Region: 区域；为空时按 AWS 配置解析（AWS_REGION / AWS_DEFAULT_REGION / profile），仍为空则使用 us-east-1。
+	Region string `json:"region"`
+	// Endpoint: 自定义端点（如 http://127.0.0.1:9000）；为空时使用 SDK 默认的 AWS 端点。
+	Endpoint string `json:"endpoint"`
+	// ForcePathStyle: 使用 path-style 寻址（endpoint/bucket/key）；MinIO 等兼容服务通常需要开启。
+	ForcePathStyle bool `json:"force_path_style"`
+	// Profile: 共享凭证/配置文件中的 profile；为空时由 SDK 读取 AWS_PROFILE，仍为空则为 "default"。
+	Profile string `json:"profile"`
+	// Flat: 是否扁平化对象键（仅保留文件名）。默认 true，与 fs Writer 一致。
+	Flat *bool `json:"flat,omitempty"`
+	// TimeoutSeconds: 单次上传的 HTTP 超时（秒）；<=0 使用默认 60。
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// MaxAttempts: SDK 对单次请求的最大尝试次数（含首次，限流/5xx/网络错误时退避重试）；<=0 使用 SDK 默认值（3），1 表示不重试。
+	MaxAttempts int `json:"max_attempts,omitempty"`
+}
+
+// Writer 使用 AWS SDK（aws-sdk-go-v2）将工件上传为 s3://bucket/prefix/<mapped-id>。
+// 为保持 O(1) 内存，先流式落盘到临时文件，再以可定位、确定长度的请求体交给 SDK 签名上传。
+type Writer struct {
+	client *s3.Client
+	creds  aws.CredentialsProvider
+	bucket string
+	prefix string
+	flat   bool
+}
+
+// New 创建 S3 Writer。凭证按 AWS SDK 默认链解析（环境变量、共享配置/凭证文件含 SSO 与 AssumeRole、
+// Web Identity、容器端点、EC2 IMDS），首次上传或预检时取值；配置加载失败返回 ErrInvalidInput。
+func New(opts *Options) (*Writer, error) {
+	if opts == nil || strings.TrimSpace(opts.Bucket) == "" {
+		return nil, fmt.Errorf("s3: %w: bucket required", contract.ErrInvalidInput)
+	}
+	ep := strings.TrimRight(strings.TrimSpace(opts.Endpoint), "/")
+	if ep != "" {
+		u, err := url.Parse(ep)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("s3: %w: invalid endpoint %q", contract.ErrInvalidInput, ep)
+		}
+	}
+	to := opts.TimeoutSeconds
+	if to <= 0 {
+		to = 60
+	}
+	load := []func(*config.LoadOptions) error{
+		config.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(time.Duration(to) * time.Second)),
+	}
+	if r := strings.TrimSpace(opts.Region); r != "" {
+		load = append(load, config.WithRegion(r))
+	}
+	if p := strings.TrimSpace(opts.Profile); p != "" {
+		load = append(load, config.WithSharedConfigProfile(p))
+	}
+	if opts.MaxAttempts > 0 {
+		load = append(load, config.WithRetryMaxAttempts(opts.MaxAttempts))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), load...)
+	if err != nil {
+		return nil, fmt.Errorf("s3: load aws config: %v: %w", err, contract.ErrInvalidInput)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = opts.ForcePathStyle
+		if ep != "" {
+			o.BaseEndpoint = aws.String(ep)
+		}
+	})
+	flat := true
+	if opts.Flat != nil {
+		flat = *opts.Flat
+	}
+	return &Writer{
+		client: client,
+		creds:  cfg.Credentials,
+		bucket: opts.Bucket,
+		prefix: strings.Trim(opts.Prefix, "/"),
+		flat:   flat,
+	}, nil
+}
+
+var _ contract.Writer = (*Writer)(nil)
+
+// Write 将 r 的全部字节上传到基于 id 映射的对象键。
+func (w *Writer) Write(ctx context.Context, id contract.ArtifactID, r io.Reader) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	key, err := w.mapKey(id)
+	if err != nil {
+		return err
+	}
+	if err := w.credentials(ctx); err != nil {
+		return err
+	}
+
+	// 流式落盘，得到可定位的请求体（SDK 据此计算载荷摘要与校验和）
+	tmp, err := os.CreateTemp("", ".s3-upload-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	bw := bufio.NewWriter(tmp)
+	n, err := io.Copy(bw, readerWithCtx(ctx, r))
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = w.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(w.bucket),
+		Key:           aws.String(key),
+		Body:          tmp,
+		ContentLength: aws.Int64(n),
+		ContentType:   aws.String("application/octet-stream"),
+	})
+	return mapError(ctx, err)
+}
+
+var _ contract.Preflighter = (*Writer)(nil)
+
+// Preflight 检查上传暂存目录可写，并以 HeadBucket 探测桶的可达性与凭证权限（不写对象）。
+func (w *Writer) Preflight(ctx context.Context) error {
+	tmp, err := os.CreateTemp("", ".s3-preflight-*")
+	if err != nil {
+		return fmt.Errorf("s3: preflight temp dir: %w", err)
+	}
+	_ = tmp.Close()
+	_ = os.Remove(tmp.Name())
+
+	if err := w.credentials(ctx); err != nil {
+		return err
+	}
+	_, err = w.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(w.bucket)})
+	if err = mapError(ctx, err); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("s3: preflight bucket %s: %w", w.bucket, err)
+	}
+	return err
+}
+
+// credentials 经 SDK 凭证缓存取值（到期前自动刷新）；默认链无可用来源时视为配置错误。
+func (w *Writer) credentials(ctx context.Context) error {
+	if _, err := w.creds.Retrieve(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("s3: retrieve credentials: %v: %w", err, contract.ErrInvalidInput)
+	}
+	return nil
+}
+
+// mapError 将 SDK 错误映射为契约错误：取消透传 ctx.Err()；上游 429 限流；408/5xx 网络类；其余 HTTP 状态为输入/配置错误；传输层错误原样返回。
+func mapError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return ctx.Err()
+	}
+	var re interface{ HTTPStatusCode() int }
+	if !errors.As(err, &re) {
+		return err
+	}
+	status := re.HTTPStatusCode()
+	msg := http.StatusText(status)
+	var api smithy.APIError
+	if errors.As(err, &api) {
+		msg = api.ErrorCode()
+		if m := api.ErrorMessage(); m != "" {
+			msg += ": " + m
+		}
+	}
+	if status == http.StatusTooManyRequests {
+		return contract.ErrRateLimited
+	}
+	if status == http.StatusRequestTimeout || status/100 == 5 {
+		return upstreamError{status: status, msg: msg}
+	}
+	return fmt.Errorf("s3 upstream %d: %s: %w", status, msg, contract.ErrInvalidInput)
+}
+
+// mapKey: 规范化 + 越界校验（与 fs Writer 一致：禁止绝对路径、'..' 逃逸与卷名），再拼接前缀。
+func (w *Writer) mapKey(id contract.ArtifactID) (string, error) {
+	rel := path.Clean(strings.ReplaceAll(string(id), "\\", "/"))
+	if w.flat {
+		rel = path.Base(rel)
+		if rel == "." || rel == ".." || rel == "" || rel == "/" {
+			return "", contract.ErrPathInvalid
+		}
+	} else {
+		if rel == "." || rel == "" {
+			return "", contract.ErrPathInvalid
+		}
+		if strings.HasPrefix(rel, "/") {
+			return "", contract.ErrPathInvalid
+		}
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			return "", contract.ErrPathInvalid
+		}
+		if vol := filepath.VolumeName(rel); vol != "" || (len(rel) >= 2 && rel[1] == ':') {
+			return "", contract.ErrPathInvalid
+		}
+	}
+	if w.prefix == "" {
+		return rel, nil
+	}
+	return w.prefix + "/" + rel, nil
+}
+
+// upstreamError 实现 net.Error，用于将 HTTP 上游 5xx/408 映射为网络类错误。
+type upstreamError struct {
+	status int
+	msg    string
+}
+
+func (e upstreamError) Error() string           { return fmt.Sprintf("s3 upstream %d: %s", e.status, e.msg) }
+func (e upstreamError) Timeout() bool           { return e.status == http.StatusRequestTimeout }
+func (e upstreamError) Temporary() bool         { return e.status/100 == 5 }
+func (e upstreamError) UpstreamStatus() int     { return e.status }
+func (e upstreamError) UpstreamMessage() string { return e.msg }
+
+// readerWithCtx: 在每次 Read 前检查 ctx 是否已取消。
+func readerWithCtx(ctx context.Context, r io.Reader) io.Reader {
+	return &ctxReader{ctx: ctx, r: r}
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	select {
+	case <-cr.ctx.Done():
+		return 0, cr.ctx.Err()
+	default:
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,156 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"llmspt/pkg/contract"
+)
+
+// clearAWSEnv 清空凭证链相关环境变量、指向空的共享配置并关闭 IMDS，避免测试受宿主环境影响。
+func clearAWSEnv(t *testing.T) {
+	t.Helper()
+	for _, k := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_ENDPOINT_URL", "AWS_ENDPOINT_URL_S3",
+	} {
+		t.Setenv(k, "")
+	}
+	dir := t.TempDir()
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+func newTestWriter(t *testing.T, endpoint string, flat bool) *Writer {
+	t.Helper()
+	clearAWSEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	w, err := New(&Options{Bucket: "bkt", Prefix: "/subs/", Region: "us-east-1", Endpoint: endpoint, ForcePathStyle: true, Flat: &flat, MaxAttempts: 1})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	return w
+}
+
+// TestWritePathStyle 上传到 path-style 端点
+func TestWritePathStyle(t *testing.T) {
+	var gotPath, gotBody, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAuth = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	}))
+	defer srv.Close()
+	w := newTestWriter(t, srv.URL, false)
+	if err := w.Write(context.Background(), "dir/a b.srt", strings.NewReader("hello")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if gotPath != "/bkt/subs/dir/a%20b.srt" || gotBody != "hello" {
+		t.Fatalf("unexpected upload: path=%s body=%q", gotPath, gotBody)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+		t.Fatalf("missing sigv4 auth: %s", gotAuth)
+	}
+}
+
+// TestWriteUpstreamError 5xx 映射为上游错误
+func TestWriteUpstreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	w := newTestWriter(t, srv.URL, true)
+	err := w.Write(context.Background(), "a.srt", strings.NewReader("x"))
+	var ue contract.UpstreamError
+	if !errors.As(err, &ue) || ue.UpstreamStatus() != http.StatusServiceUnavailable {
+		t.Fatalf("expect upstream error, got %v", err)
+	}
+}
+
+// TestMapKeyInvalid 越界键校验
+func TestMapKeyInvalid(t *testing.T) {
+	w := newTestWriter(t, "http://127.0.0.1:1", false)
+	for _, id := range []string{"../x", "/abs", "C:/x", "."} {
+		if _, err := w.mapKey(contract.ArtifactID(id)); !errors.Is(err, contract.ErrPathInvalid) {
+			t.Fatalf("expect ErrPathInvalid for %q, got %v", id, err)
+		}
+	}
+	flat := newTestWriter(t, "http://127.0.0.1:1", true)
+	if k, err := flat.mapKey("a/b/c.srt"); err != nil || k != "subs/c.srt" {
+		t.Fatalf("flat key: %q %v", k, err)
+	}
+}
+
+// TestNewInvalid 缺少桶、端点非法或指定的 profile 不存在
+func TestNewInvalid(t *testing.T) {
+	clearAWSEnv(t)
+	for _, o := range []*Options{nil, {}, {Bucket: "b", Endpoint: "127.0.0.1:9000"}, {Bucket: "b", Profile: "missing"}} {
+		if _, err := New(o); !errors.Is(err, contract.ErrInvalidInput) {
+			t.Fatalf("%+v: expect ErrInvalidInput, got %v", o, err)
+		}
+	}
+}
+
+// TestProfileCredentials 共享凭证文件中的 profile 经 SDK 默认链用于签名；无任何凭证时预检为配置错误
+func TestProfileCredentials(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+	clearAWSEnv(t)
+	_ = os.WriteFile(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), []byte("[p]\naws_access_key_id = CRED\naws_secret_access_key = s\n"), 0o600)
+	w, err := New(&Options{Bucket: "bkt", Endpoint: srv.URL, ForcePathStyle: true, Profile: "p", MaxAttempts: 1})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if err := w.Preflight(context.Background()); err != nil || !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=CRED/") {
+		t.Fatalf("preflight: %v auth=%q", err, gotAuth)
+	}
+	anon, err := New(&Options{Bucket: "bkt", Endpoint: srv.URL, ForcePathStyle: true, MaxAttempts: 1})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if err := anon.Preflight(context.Background()); !errors.Is(err, contract.ErrInvalidInput) {
+		t.Fatalf("expect credentials error, got %v", err)
+	}
+}
+
+// TestPreflight 以签名 HEAD 探测桶：2xx 通过；403/404 为配置错误；5xx 为上游错误
+func TestPreflight(t *testing.T) {
+	var gotMethod, gotPath, gotAuth string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotAuth = r.Method, r.URL.EscapedPath(), r.Header.Get("Authorization")
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	w := newTestWriter(t, srv.URL, false)
+	if err := w.Preflight(context.Background()); err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+	if gotMethod != http.MethodHead || gotPath != "/bkt" || !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 ") {
+		t.Fatalf("unexpected probe: %s %s auth=%q", gotMethod, gotPath, gotAuth)
+	}
+	for _, status = range []int{http.StatusForbidden, http.StatusNotFound} {
+		if err := w.Preflight(context.Background()); !errors.Is(err, contract.ErrInvalidInput) {
+			t.Fatalf("%d: expect ErrInvalidInput, got %v", status, err)
+		}
+	}
+	status = http.StatusServiceUnavailable
+	var ue contract.UpstreamError
+	if err := w.Preflight(context.Background()); !errors.As(err, &ue) || ue.UpstreamStatus() != status {
+		t.Fatalf("expect upstream error, got %v", err)
+	}
+}